@@ -0,0 +1,129 @@
+package blockdevice
+
+import (
+	"context"
+)
+
+//This struct represents an operation running in the background, as
+//returned by the *Async methods, so many slow cluster operations can be
+//waited for together (e.g. in a select).
+type AsyncOperation struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	err    error
+	image  *Image
+}
+
+/*
+This is a helper method that runs `fn` in the background with a context
+done when `ctx` is, or when the operation is cancelled: the commands
+`fn` runs are then killed, the librbd calls can't be interrupted and
+are waited for. An image returned by `fn` once cancelled is closed if
+`owned` (the operation opened it) and dropped.
+*/
+func startAsync(ctx context.Context, owned bool, fn func(ctx context.Context) (*Image, error)) *AsyncOperation {
+	ctx, cancel := context.WithCancel(ctx)
+	operation := &AsyncOperation{done: make(chan struct{}), cancel: cancel}
+
+	go func() {
+		defer close(operation.done)
+		defer cancel()
+
+		image, err := fn(ctx)
+		switch {
+		case ctx.Err() != nil:
+			operation.err = ctx.Err()
+			if owned && image != nil {
+				image.Close()
+			}
+		case err != nil:
+			operation.err = err
+		default:
+			operation.image = image
+		}
+	}()
+	return operation
+}
+
+/*
+This method returns a channel closed when the operation is over, or
+was cancelled.
+*/
+func (o *AsyncOperation) Done() <-chan struct{} {
+	return o.done
+}
+
+/*
+This method returns the error the operation failed with, the context
+error if it was cancelled, nil if it succeeded or is still running.
+*/
+func (o *AsyncOperation) Err() error {
+	select {
+	case <-o.done:
+		return o.err
+	default:
+		return nil
+	}
+}
+
+/*
+This method waits for the operation to be over and returns its error,
+see `Err`.
+*/
+func (o *AsyncOperation) Wait() error {
+	<-o.done
+	return o.err
+}
+
+/*
+This method cancels the operation, which is then over with
+context.Canceled: the commands it runs are killed, a librbd call
+running is waited for and may still complete on the cluster side.
+*/
+func (o *AsyncOperation) Cancel() {
+	o.cancel()
+}
+
+/*
+Getter method for the image created or changed by the operation, nil
+until it succeeded.
+*/
+func (o *AsyncOperation) GetImage() *Image {
+	select {
+	case <-o.done:
+		return o.image
+	default:
+		return nil
+	}
+}
+
+/*
+This method is a variant of `CreateImageWithOptions` running in the
+background until `ctx` is done, the image may still be created after
+(it's then closed, not removed).
+*/
+func (c *Connection) CreateImageAsync(ctx context.Context, name string, size uint64, options *CreateImageOptions) *AsyncOperation {
+	return startAsync(ctx, true, func(ctx context.Context) (*Image, error) {
+		return c.CreateImageWithOptions(name, size, options)
+	})
+}
+
+/*
+This method is a variant of `Grow` running in the background until
+`ctx` is done, the image may still be grown after.
+*/
+func (i *Image) GrowAsync(ctx context.Context, size uint64) *AsyncOperation {
+	return startAsync(ctx, false, func(ctx context.Context) (*Image, error) {
+		return i, i.Grow(size)
+	})
+}
+
+/*
+This method is a variant of `Flatten` running in the background until
+`ctx` is done, the rbd tool is then killed.
+*/
+func (i *Image) FlattenAsync(ctx context.Context, progress ProgressFunc) *AsyncOperation {
+	return startAsync(ctx, false, func(ctx context.Context) (*Image, error) {
+		return i, i.flatten(ctx, progress)
+	})
+}
@@ -0,0 +1,134 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	//Time the connection replaced by `RotateCredentials` is kept open
+	//at least for the operations still using it.
+	DefaultCredentialDrain = 30 * time.Second
+)
+
+/*
+This option sets a file holding the cephx secret (the base64 key) of the
+user, so no keyring is needed.
+*/
+func WithKeyFile(keyFile string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.keyFile = keyFile
+	}
+}
+
+/*
+This is a helper method that returns the arguments authenticating the
+rbd tools run on the host of `runner` with the credentials of the
+connection (see `WithKey`, `WithKeyFile` and `WithKeyring`). An inline
+key is written to a temporary keyfile, the returned function removes it.
+*/
+func (c *Connection) authArgs(runner CommandRunner) ([]string, func(), error) {
+	none := func() {}
+	config := c.connectionConfig()
+	if config == nil || c.IsDryRun() {
+		return nil, none, nil
+	}
+
+	key := config.key
+	if key == "" && config.keyFile != "" {
+		if isLocalRunner(runner) {
+			return []string{"--keyfile", config.keyFile}, none, nil
+		}
+
+		content, err := ioutil.ReadFile(config.keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Cannot read keyfile: %s, Error: %w", config.keyFile, err)
+		}
+		key = strings.TrimSpace(string(content))
+	}
+
+	if key == "" {
+		if config.keyring != "" {
+			return []string{"--keyring", config.keyring}, none, nil
+		}
+		return nil, none, nil
+	}
+
+	file, err := runner.Run("mktemp", "-t", "rbd-key.XXXXXX")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Cannot create keyfile, Error: %s", err)
+	}
+
+	remove := func() { runner.Run("rm", "-f", file) }
+	if _, err := runWithInput(runner, []byte(key), "dd", "of="+file, "status=none"); err != nil {
+		remove()
+		return nil, nil, fmt.Errorf("Cannot write keyfile: %s, Error: %w", file, err)
+	}
+	return []string{"--keyfile", file}, remove, nil
+}
+
+/*
+This is a helper method that runs a ceph tool (rbd, rbd-nbd) on the host
+of `runner`, reaching the monitors and authenticated as the connection.
+*/
+func (c *Connection) runCeph(runner CommandRunner, name string, args ...string) (string, error) {
+	return c.runCephProgress(context.Background(), runner, nil, name, args...)
+}
+
+/*
+This is a helper method that runs a ceph tool like `runCeph`, reporting
+the progress it prints to `progress` if not nil, it's killed when `ctx`
+is done.
+*/
+func (c *Connection) runCephProgress(ctx context.Context, runner CommandRunner, progress ProgressFunc, name string, args ...string) (string, error) {
+	auth, remove, err := c.authArgs(runner)
+	if err != nil {
+		return "", err
+	}
+	defer remove()
+
+	if config := c.connectionConfig(); config != nil {
+		auth = append(config.monitorArgs(isLocalRunner(runner)), auth...)
+	}
+
+	if progress != nil {
+		return runProgress(ctx, runner, progress, name, append(auth, args...)...)
+	}
+	return runContext(ctx, runner, name, append(auth, args...)...)
+}
+
+/*
+This method switches the connection to the cephx secret `key` (the
+base64 key) without downtime: a replacement rados connection is
+established with it and swapped in for the subsequent operations, the
+previous one is left to drain for DefaultCredentialDrain, and until the
+images opened on it are closed, before being shut down. The connection
+is left untouched if the key is rejected.
+*/
+func (c *Connection) RotateCredentials(key string) error {
+	if c.parent != nil {
+		return c.parent.RotateCredentials(key)
+	}
+
+	current := c.connectionConfig()
+	if current == nil {
+		return fmt.Errorf("Cannot rotate credentials, Error: connection options are unknown")
+	}
+
+	config := *current
+	config.key, config.keyFile = key, ""
+	config.clientConfig = make(map[string]string)
+	for option, value := range current.clientConfig {
+		if option != "key" && option != "keyfile" {
+			config.clientConfig[option] = value
+		}
+	}
+
+	if err := c.reconnect(&config, DefaultCredentialDrain); err != nil {
+		return fmt.Errorf("Cannot rotate credentials of: %s, Error: %w", c.clientName(), err)
+	}
+	return nil
+}
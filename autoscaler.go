@@ -0,0 +1,228 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAutoscaleThreshold = 0.85
+	DefaultAutoscaleIncrement = 0.25
+	DefaultAutoscaleInterval  = time.Minute
+	DefaultAutoscaleCooldown  = 15 * time.Minute
+)
+
+//This struct represents the options of a `VolumeAutoscaler`, zero
+//values take the defaults.
+type AutoscalerOptions struct {
+	//Filesystem usage ratio (0-1) above which a volume is grown.
+	Threshold float64
+	//Growth ratio (0-1) applied to the current size.
+	Increment float64
+	//Minimum growth in megabytes.
+	MinIncrement uint64
+	//Maximum size of a volume in megabytes, zero means no limit.
+	MaxSize uint64
+	//Minimum time between two resizes of the same volume.
+	Cooldown time.Duration
+	//Time between two checks when started with `Start`.
+	Interval time.Duration
+	//Optional function computing the new size (in megabytes) of a
+	//volume, replacing the Increment based growth.
+	Size func(device *Device, used, total uint64) uint64
+	//Optional function called for every resize or failure.
+	OnEvent func(event AutoscaleEvent)
+}
+
+//This struct represents a resize performed, or attempted, by a
+//`VolumeAutoscaler`.
+type AutoscaleEvent struct {
+	Device  *Device
+	Image   string
+	Usage   float64
+	OldSize uint64
+	NewSize uint64
+	Time    time.Time
+	Err     error
+}
+
+//This struct represents a watcher of the filesystem usage of mounted
+//devices that grows them when they are running out of space.
+type VolumeAutoscaler struct {
+	options AutoscalerOptions
+	mutex   sync.Mutex
+	devices map[*Device]time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+/*
+This method is a constructor for `VolumeAutoscaler` objects, the
+`options` can be nil.
+*/
+func NewVolumeAutoscaler(options *AutoscalerOptions) *VolumeAutoscaler {
+	a := &VolumeAutoscaler{devices: make(map[*Device]time.Time)}
+	if options != nil {
+		a.options = *options
+	}
+
+	if a.options.Threshold <= 0 {
+		a.options.Threshold = DefaultAutoscaleThreshold
+	}
+
+	if a.options.Increment <= 0 {
+		a.options.Increment = DefaultAutoscaleIncrement
+	}
+
+	if a.options.Interval <= 0 {
+		a.options.Interval = DefaultAutoscaleInterval
+	}
+
+	if a.options.Cooldown <= 0 {
+		a.options.Cooldown = DefaultAutoscaleCooldown
+	}
+	return a
+}
+
+/*
+This method adds a mounted device to the autoscaler.
+*/
+func (a *VolumeAutoscaler) Add(device *Device) error {
+	if device.image == nil || !device.isMounted {
+		return fmt.Errorf("Cannot autoscale device: %s, Error: device must be mounted and attached to an image", device.path)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, ok := a.devices[device]; !ok {
+		a.devices[device] = time.Time{}
+	}
+	return nil
+}
+
+/*
+This method removes a device from the autoscaler.
+*/
+func (a *VolumeAutoscaler) Remove(device *Device) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.devices, device)
+}
+
+/*
+This method returns the new size in megabytes for a volume, or zero if
+it can't grow.
+*/
+func (a *VolumeAutoscaler) newSize(device *Device, used, total uint64) uint64 {
+	current := device.image.ImageInfo.Size / toMegs(1)
+
+	var size uint64
+	if a.options.Size != nil {
+		size = a.options.Size(device, used, total)
+	} else {
+		increment := uint64(float64(current) * a.options.Increment)
+		if increment < a.options.MinIncrement {
+			increment = a.options.MinIncrement
+		}
+		size = current + increment
+	}
+
+	if a.options.MaxSize > 0 && size > a.options.MaxSize {
+		size = a.options.MaxSize
+	}
+
+	if size <= current {
+		return 0
+	}
+	return size
+}
+
+/*
+This method checks every device once and grows the ones above the
+threshold, the events of the performed resizes are returned.
+*/
+func (a *VolumeAutoscaler) Check() []AutoscaleEvent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var events []AutoscaleEvent
+	for device, last := range a.devices {
+		if !device.isMounted || time.Since(last) < a.options.Cooldown {
+			continue
+		}
+
+		event := AutoscaleEvent{
+			Device:  device,
+			Image:   device.image.name,
+			OldSize: device.image.ImageInfo.Size / toMegs(1),
+			Time:    time.Now(),
+		}
+
+		used, total, err := device.Usage()
+		if err == nil && total > 0 {
+			event.Usage = float64(used) / float64(total)
+			if event.Usage < a.options.Threshold {
+				continue
+			}
+
+			if event.NewSize = a.newSize(device, used.Bytes(), total.Bytes()); event.NewSize == 0 {
+				err = fmt.Errorf("Cannot grow device: %s, Error: maximum size reached", device.path)
+			} else {
+				err = device.Grow(event.NewSize)
+			}
+			a.devices[device] = event.Time
+		}
+
+		event.Err = err
+		events = append(events, event)
+		if a.options.OnEvent != nil {
+			a.options.OnEvent(event)
+		}
+	}
+	return events
+}
+
+/*
+This method starts checking the devices periodically on background
+until `Stop` is called.
+*/
+func (a *VolumeAutoscaler) Start() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stop != nil {
+		return
+	}
+
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(a.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				a.Check()
+			}
+		}
+	}(a.stop, a.done)
+}
+
+/*
+This method stops the background checks started by `Start`.
+*/
+func (a *VolumeAutoscaler) Stop() {
+	a.mutex.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,128 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+This is a helper method that returns the image spec
+(<pool>/<image>[@<snap>]) used by the rbd tools.
+*/
+func imageSpec(pool string, name string, snap string) string {
+	spec := pool + "/" + name
+	if snap != "" {
+		spec += "@" + snap
+	}
+	return spec
+}
+
+/*
+This method maps the image using the requested backend and returns the
+device path and the backend actually used, which differs from the
+requested one when krbd failed and `options.FallbackToNBD` is set.
+Images with `options.Encryption` are mapped with rbd-nbd.
+*/
+func mapImage(image *Image, runner CommandRunner, options *MapOptions) (string, Backend, error) {
+	backend := options.backend()
+
+	if options.Encryption != nil && backend != BackendNBD {
+		return "", backend, fmt.Errorf("Cannot map image: %s, Error: librbd encryption requires the nbd backend", image.name)
+	}
+
+	switch backend {
+	case BackendKRBD, BackendSysfs:
+		device, err := mapKernel(image, runner, backend, options)
+		if err != nil && options.FallbackToNBD && isKRBDIncompatible(err) {
+			device, err = mapNBD(image, runner, options)
+			if err != nil {
+				return "", BackendNBD, fmt.Errorf("Cannot map image: %s with krbd nor rbd-nbd, Error: %w", image.name, err)
+			}
+			return device, BackendNBD, nil
+		}
+		return device, backend, err
+	case BackendNBD:
+		device, err := mapNBD(image, runner, options)
+		return device, backend, err
+	}
+
+	return "", backend, fmt.Errorf("Unknown map backend: %s", backend)
+}
+
+/*
+This method maps the image with the kernel rbd client, using either
+the rbd tool or sysfs.
+*/
+func mapKernel(image *Image, runner CommandRunner, backend Backend, options *MapOptions) (string, error) {
+	if err := EnsureKernelModule(runner, KernelModuleRBD, options.LoadKernelModule); err != nil {
+		return "", &krbdUnavailableError{err}
+	}
+
+	if backend == BackendSysfs {
+		if !isLocalRunner(runner) {
+			return "", fmt.Errorf("Cannot map image: %s, Error: the sysfs backend only works on the local host", image.name)
+		}
+		return mapSysfs(image, options)
+	}
+
+	args := []string{"map", "--id", image.username, "--pool", image.pool}
+	if namespace := image.GetNamespace(); namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, options.mapArgs()...)
+	return image.runCeph(runner, "rbd", append(args, image.name)...)
+}
+
+/*
+This method maps the image with rbd-nbd, krbd options don't apply, the
+librbd encryption of `options.Encryption` is loaded.
+*/
+func mapNBD(image *Image, runner CommandRunner, options *MapOptions) (string, error) {
+	if err := EnsureKernelModule(runner, KernelModuleNBD, options.LoadKernelModule); err != nil {
+		return "", err
+	}
+
+	args := []string{"map", "--id", image.username}
+	if options.ReadOnly || options.Snapshot != "" {
+		args = append(args, "--read-only")
+	}
+
+	if options.Exclusive {
+		args = append(args, "--exclusive")
+	}
+
+	if options.Encryption != nil {
+		file, remove, err := options.Encryption.passphraseFile(runner)
+		if err != nil {
+			return "", err
+		}
+		defer remove()
+
+		args = append(args, "--encryption-format", string(options.Encryption.Format), "--encryption-passphrase-file", file)
+	}
+
+	return image.runCeph(runner, "rbd-nbd", append(args, image.spec(image.name, options.Snapshot))...)
+}
+
+//This struct represents the error returned when the rbd kernel module
+//is not available.
+type krbdUnavailableError struct {
+	err error
+}
+
+func (e *krbdUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+/*
+This is a helper method that tells if krbd failed to map an image
+because the kernel client is missing or doesn't support the image.
+*/
+func isKRBDIncompatible(err error) bool {
+	var unavailable *krbdUnavailableError
+	if errors.As(err, &unavailable) {
+		return true
+	}
+
+	return stderrContains(err, "feature") || stderrContains(err, "sysfs write failed")
+}
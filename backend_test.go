@@ -0,0 +1,44 @@
+package blockdevice
+
+import (
+	"sync"
+	"testing"
+)
+
+//This struct answers rbd-nbd map as timed out after mapping the image.
+type nbdTimeoutRunner struct {
+	maps int
+}
+
+func (r *nbdTimeoutRunner) Run(name string, args ...string) (string, error) {
+	switch {
+	case name == "rbd-nbd" && args[0] == "map":
+		r.maps++
+		return "", kindErrorf(ErrCommandTimeout, nil, "command: rbd-nbd timed out")
+	case name == "rbd-nbd" && args[0] == "list-mapped":
+		if r.maps > 0 {
+			return `[{"id":"1234","pool":"rbd","namespace":"","image":"data","snap":"-","device":"/dev/nbd0"}]`, nil
+		}
+		return "[]", nil
+	case name == "rbd":
+		return "[]", nil
+	}
+	return "", nil
+}
+
+func TestMapDeviceNBDTimeout(t *testing.T) {
+	runner := &nbdTimeoutRunner{}
+	connection := &Connection{mutex: &sync.RWMutex{}, pool: "rbd", username: "admin", tracker: &deviceTracker{}}
+	connection.SetRunner(runner)
+	connection.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, Backoff: 1})
+	image := &Image{Connection: connection, name: "data"}
+
+	device, err := mapDevice(image, "ext4", &MapOptions{Backend: BackendNBD})
+	if err != nil {
+		t.Fatalf("mapDevice() = %v", err)
+	}
+
+	if device.path != "/dev/nbd0" || device.backend != BackendNBD || runner.maps != 1 {
+		t.Errorf("mapDevice() = %s (%s) after %d maps, want the timed out mapping reused", device.path, device.backend, runner.maps)
+	}
+}
@@ -0,0 +1,59 @@
+package blockdevice
+
+import (
+	"sync"
+)
+
+const (
+	DefaultProvisionConcurrency = 8
+)
+
+//This struct represents the outcome of provisioning a volume of a
+//`ProvisionBatch`.
+type ProvisionResult struct {
+	Spec   VolumeSpec
+	Device *Device
+	Err    error
+}
+
+/*
+This method provisions many volumes in parallel: the image of every
+spec is created if missing, mapped, formatted if empty and mounted (see
+`EnsureMounted`) by at most `concurrency` workers at once
+(DefaultProvisionConcurrency if zero or negative). A failed volume
+doesn't stop the others, the results are returned in the order of
+`specs`.
+*/
+func (c *Connection) ProvisionBatch(specs []VolumeSpec, concurrency int) []ProvisionResult {
+	if concurrency <= 0 {
+		concurrency = DefaultProvisionConcurrency
+	}
+
+	if concurrency > len(specs) {
+		concurrency = len(specs)
+	}
+
+	results := make([]ProvisionResult, len(specs))
+	indexes := make(chan int)
+
+	var wait sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range indexes {
+				spec := specs[index]
+				device, err := c.EnsureMounted(spec.Name, spec.Size, spec.FileSystemType, spec.MountPoint, nil)
+				results[index] = ProvisionResult{Spec: spec, Device: device, Err: err}
+			}
+		}()
+	}
+
+	for index := range specs {
+		indexes <- index
+	}
+	close(indexes)
+
+	wait.Wait()
+	return results
+}
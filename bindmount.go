@@ -0,0 +1,68 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+/*
+This method bind mounts the mounted filesystem of the device on
+`target` too (mount --bind), the bind mounts are tracked and unmounted
+along with the device.
+*/
+func (d *Device) BindMount(target string) error {
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot bind mount device: %s, Error: device is not mounted", d.path)
+	}
+
+	for _, mountPoint := range d.GetMounts() {
+		if mountPoint == target {
+			return kindErrorf(ErrAlreadyMounted, nil, "Device: %s is already mounted on path: %s", d.path, target)
+		}
+	}
+
+	if _, err := d.runMounted("mount", "--bind", d.mountPoint, target); err != nil {
+		return fmt.Errorf("Cannot bind mount: %s on: %s, Error: %w", d.mountPoint, target, err)
+	}
+	d.bindMounts = append(d.bindMounts, target)
+
+	if d.propagation != "" {
+		if _, err := d.runMounted("mount", "--make-"+string(d.propagation), target); err != nil {
+			return fmt.Errorf("Cannot set %s propagation on: %s, Error: %w", d.propagation, target, err)
+		}
+	}
+	return nil
+}
+
+/*
+This method unmounts a bind mount created by `BindMount` as described by
+`options` (which can be nil).
+*/
+func (d *Device) UnBindMount(target string, options *UnMountOptions) error {
+	if options == nil {
+		options = &UnMountOptions{}
+	}
+
+	for index, mountPoint := range d.bindMounts {
+		if mountPoint != target {
+			continue
+		}
+
+		if err := d.umount(target, options); err != nil {
+			return err
+		}
+		d.bindMounts = append(d.bindMounts[:index], d.bindMounts[index+1:]...)
+		return nil
+	}
+	return fmt.Errorf("Cannot unmount: %s, Error: not a bind mount of device: %s", target, d.path)
+}
+
+/*
+This method returns every active mount of the device, the primary
+mountpoint first and then its bind mounts.
+*/
+func (d *Device) GetMounts() []string {
+	if !d.isMounted {
+		return nil
+	}
+	return append([]string{d.mountPoint}, d.bindMounts...)
+}
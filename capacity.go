@@ -0,0 +1,236 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Error returned when an image wouldn't fit on its pool, see
+//`CreateImageOptions.CapacityFraction`.
+var ErrInsufficientCapacity = errors.New("insufficient pool capacity")
+
+//This struct represents the options used to create an image.
+type CreateImageOptions struct {
+	//Fail with `ErrInsufficientCapacity` when the image size exceeds
+	//this fraction (0 to 1) of the available bytes of the pool, the
+	//fraction set on the connection (see `SetCapacityFraction`) if
+	//zero.
+	CapacityFraction float64
+	//Grow an existing image smaller than the requested size with
+	//`GetOrCreateImageWithOptions`, images are never shrunk.
+	GrowToSize bool
+	//Write the whole image when it's created (thick provisioning) so its
+	//space is reserved upfront, `Progress` (which can be nil) is called
+	//with the percentage written.
+	Preallocate bool
+	Progress    ProgressFunc
+}
+
+//This struct represents the usage of a pool: `StoredBytes` is the data
+//written by the clients, `UsedBytes` the raw space it takes with its
+//replicas or coding chunks.
+type PoolStats struct {
+	Pool           string
+	StoredBytes    Size
+	UsedBytes      Size
+	AvailableBytes Size
+	Objects        uint64
+	//Fraction of the pool capacity used (0 to 1).
+	PercentUsed float64
+}
+
+//This struct represents the raw capacity and usage of the cluster and
+//of its pools.
+type ClusterStats struct {
+	TotalBytes     Size
+	UsedBytes      Size
+	AvailableBytes Size
+	Objects        uint64
+	Pools          []PoolStats
+}
+
+//This struct represents the output of the df mon command.
+type dfOutput struct {
+	Stats struct {
+		TotalBytes     uint64 `json:"total_bytes"`
+		TotalUsedBytes uint64 `json:"total_used_raw_bytes"`
+		TotalAvail     uint64 `json:"total_avail_bytes"`
+		TotalObjects   uint64 `json:"total_objects"`
+	} `json:"stats"`
+	Pools []struct {
+		Name  string `json:"name"`
+		Stats struct {
+			Stored      uint64  `json:"stored"`
+			BytesUsed   uint64  `json:"bytes_used"`
+			MaxAvail    uint64  `json:"max_avail"`
+			Objects     uint64  `json:"objects"`
+			PercentUsed float64 `json:"percent_used"`
+		} `json:"stats"`
+	} `json:"pools"`
+}
+
+/*
+This method returns the capacity and usage of the cluster and of each
+of its pools, as reported by `ceph df`.
+*/
+func (c *Connection) ClusterStats() (*ClusterStats, error) {
+	var df dfOutput
+	if err := c.monCommand(map[string]interface{}{"prefix": "df", "detail": "detail"}, &df); err != nil {
+		return nil, fmt.Errorf("Cannot get cluster stats, Error: %w", err)
+	}
+
+	stats := &ClusterStats{
+		TotalBytes:     Size(df.Stats.TotalBytes),
+		UsedBytes:      Size(df.Stats.TotalUsedBytes),
+		AvailableBytes: Size(df.Stats.TotalAvail),
+		Objects:        df.Stats.TotalObjects,
+	}
+
+	for _, pool := range df.Pools {
+		stored := pool.Stats.Stored
+		if stored == 0 {
+			//releases before nautilus only report the stored bytes
+			stored = pool.Stats.BytesUsed
+		}
+
+		stats.Pools = append(stats.Pools, PoolStats{
+			Pool:           pool.Name,
+			StoredBytes:    Size(stored),
+			UsedBytes:      Size(pool.Stats.BytesUsed),
+			AvailableBytes: Size(pool.Stats.MaxAvail),
+			Objects:        pool.Stats.Objects,
+			PercentUsed:    pool.Stats.PercentUsed,
+		})
+	}
+	return stats, nil
+}
+
+/*
+This method returns the usage of the given pool, nil if it's unknown.
+*/
+func (s *ClusterStats) Pool(name string) *PoolStats {
+	for index := range s.Pools {
+		if s.Pools[index].Pool == name {
+			return &s.Pools[index]
+		}
+	}
+	return nil
+}
+
+/*
+This method returns the pool with the most available bytes among
+`pools` (all the pools if none is given), nil if none is known. It's
+the natural place for a new image.
+*/
+func (s *ClusterStats) MostAvailable(pools ...string) *PoolStats {
+	candidates := make(map[string]bool)
+	for _, pool := range pools {
+		candidates[pool] = true
+	}
+
+	var best *PoolStats
+	for index := range s.Pools {
+		pool := &s.Pools[index]
+		if len(candidates) > 0 && !candidates[pool.Pool] {
+			continue
+		}
+
+		if best == nil || pool.AvailableBytes > best.AvailableBytes {
+			best = pool
+		}
+	}
+	return best
+}
+
+/*
+This method returns the usage of the pool of the connection.
+*/
+func (c *Connection) Stats() (*PoolStats, error) {
+	stats, err := c.ClusterStats()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := stats.Pool(c.pool)
+	if pool == nil {
+		return nil, fmt.Errorf("Cannot get stats of pool: %s, Error: pool not found", c.pool)
+	}
+	return pool, nil
+}
+
+/*
+This method sets the fraction (0 to 1) of the available bytes of the
+pool an image created through the connection can take, see
+`CreateImageOptions.CapacityFraction`. Zero (the default) disables the
+check, images are then thin provisioned whatever the pool usage.
+*/
+func (c *Connection) SetCapacityFraction(fraction float64) {
+	if c.parent != nil {
+		c.parent.SetCapacityFraction(fraction)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capacityFraction = fraction
+}
+
+/*
+Getter method for capacityFraction
+*/
+func (c *Connection) GetCapacityFraction() float64 {
+	if c.parent != nil {
+		return c.parent.GetCapacityFraction()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.capacityFraction
+}
+
+/*
+This is a helper method that checks that an image of `size` megabytes
+takes at most `fraction` of the available bytes of the pool.
+*/
+func (c *Connection) checkCapacity(size uint64, fraction float64) error {
+	if fraction <= 0 {
+		return nil
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		return fmt.Errorf("Cannot verify capacity, Error: %w", err)
+	}
+
+	if limit := uint64(fraction * float64(stats.AvailableBytes)); toMegs(size) > limit {
+		return kindErrorf(ErrInsufficientCapacity, nil, "Image size: %s exceeds %.0f%% of the available capacity of pool: %s (%s)",
+			Size(toMegs(size)), fraction*100, c.pool, stats.AvailableBytes)
+	}
+	return nil
+}
+
+/*
+This method creates the image `name` of `size` megabytes as set by
+`options` (which can be nil), applying the policy and the defaults of
+the pool. An existing image is an `ErrImageExists` error.
+*/
+func (c *Connection) CreateImageWithOptions(name string, size uint64, options *CreateImageOptions) (*Image, error) {
+	if options == nil {
+		options = &CreateImageOptions{}
+	}
+
+	if err := c.checkCreatePolicy(size); err != nil {
+		return nil, err
+	}
+
+	fraction := options.CapacityFraction
+	if fraction == 0 {
+		fraction = c.GetCapacityFraction()
+	}
+
+	if err := c.checkCapacity(size, fraction); err != nil {
+		return nil, err
+	}
+
+	return c.createImage(name, size, options)
+}
@@ -0,0 +1,199 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//Operation checked by `ValidateCaps`: mapping an image read-only, which
+//only reads it.
+const OperationMapReadOnly = "map-read-only"
+
+//Error returned by `ValidateCaps` when the caps of the user can't be
+//read, to be checked with errors.Is.
+var ErrCapsUnknown = errors.New("cannot introspect caps")
+
+//This struct represents a capability missing for an operation.
+type MissingCap struct {
+	//Operation (OperationCreate, OperationMap, OperationMapReadOnly or
+	//OperationSnapshot).
+	Operation string
+	//Service the capability applies to: "mon" or "osd".
+	Service string
+	//Capability that would grant it, and the current caps.
+	Required string
+	Current  string
+}
+
+//This struct represents the error returned by `ValidateCaps`.
+type CapsError struct {
+	Entity  string
+	Missing []MissingCap
+}
+
+func (e *CapsError) Error() string {
+	var missing []string
+	for _, cap := range e.Missing {
+		missing = append(missing, fmt.Sprintf("%s needs %s caps: '%s' (current: '%s')", cap.Operation, cap.Service, cap.Required, cap.Current))
+	}
+	return fmt.Sprintf("Missing capabilities for: %s, %s", e.Entity, strings.Join(missing, "; "))
+}
+
+//This struct represents a grant of a cephx caps string, e.g.
+//"profile rbd pool=rbd" or "allow rwx pool=rbd namespace=tenant".
+type capGrant struct {
+	permissions string
+	pool        string
+	namespace   string
+}
+
+/*
+This is a helper method that parses a cephx caps string into its
+grants, profiles are expanded to the permissions they give.
+*/
+func parseCaps(caps string) []capGrant {
+	var grants []capGrant
+	for _, grant := range strings.Split(caps, ",") {
+		fields := strings.Fields(strings.Replace(grant, "=", " = ", -1))
+		if len(fields) < 2 {
+			continue
+		}
+
+		parsed := capGrant{}
+		switch fields[0] {
+		case "allow":
+			//class-read, class-write ... are object class grants
+			parsed.permissions = strings.Trim(fields[1], "\"'")
+			if strings.Trim(parsed.permissions, "rwx*") != "" {
+				continue
+			}
+		case "profile":
+			switch fields[1] {
+			case "rbd":
+				parsed.permissions = "rwx"
+			case "rbd-read-only":
+				parsed.permissions = "rx"
+			default:
+				continue
+			}
+		default:
+			continue
+		}
+
+		for index := 2; index+2 < len(fields); index++ {
+			if fields[index+1] != "=" {
+				continue
+			}
+
+			value := strings.Trim(fields[index+2], "\"'")
+			switch fields[index] {
+			case "pool":
+				parsed.pool = value
+			case "namespace":
+				parsed.namespace = value
+			}
+			index += 2
+		}
+		grants = append(grants, parsed)
+	}
+	return grants
+}
+
+/*
+This is a helper method that tells if the grants give all the given
+permissions (r, w, x) on the pool and namespace.
+*/
+func capsAllow(grants []capGrant, permissions string, pool string, namespace string) bool {
+	given := ""
+	for _, grant := range grants {
+		if (grant.pool != "" && grant.pool != pool) || (grant.namespace != "" && grant.namespace != namespace) {
+			continue
+		}
+
+		if grant.permissions == "*" {
+			return true
+		}
+		given += grant.permissions
+	}
+
+	for _, permission := range permissions {
+		if !strings.ContainsRune(given, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+This method checks that the authenticated user has the caps required
+by the given operations (OperationCreate, OperationMap,
+OperationMapReadOnly and OperationSnapshot, all of them but
+OperationMapReadOnly if none is given) on the pool and namespace of the
+connection. A `CapsError` lists precisely the missing capabilities.
+
+Reading the caps requires the user to be allowed to run `auth get` on
+itself, which `mon 'profile rbd'` doesn't allow: an error of kind
+ErrCapsUnknown is returned then, nothing could be checked.
+*/
+func (c *Connection) ValidateCaps(operations ...string) error {
+	if len(operations) == 0 {
+		operations = []string{OperationCreate, OperationMap, OperationSnapshot}
+	}
+
+	entity := "client." + c.clientName()
+	var entries []struct {
+		Caps map[string]string `json:"caps"`
+	}
+
+	if err := c.monCommand(map[string]interface{}{"prefix": "auth get", "entity": entity}, &entries); err != nil {
+		if isAccessDeniedError(err) {
+			return kindErrorf(ErrCapsUnknown, err, "Cannot read the caps of: %s, Error: %s", entity, err)
+		}
+		return fmt.Errorf("Cannot read the caps of: %s, Error: %w", entity, err)
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("Cannot read the caps of: %s, Error: entity not found", entity)
+	}
+
+	caps := entries[0].Caps
+	namespace := c.GetNamespace()
+	scope := "pool=" + c.pool
+	if namespace != "" {
+		scope += " namespace=" + namespace
+	}
+
+	capsError := &CapsError{Entity: entity}
+	for _, operation := range operations {
+		if !capsAllow(parseCaps(caps["mon"]), "r", "", "") {
+			capsError.Missing = append(capsError.Missing, MissingCap{
+				Operation: operation,
+				Service:   "mon",
+				Required:  "profile rbd",
+				Current:   caps["mon"],
+			})
+		}
+
+		//creating, mapping read-write and snapshotting all write the
+		//image header objects, mapping read-only only reads them
+		permissions, profile := "rwx", "profile rbd "
+		if operation == OperationMapReadOnly {
+			permissions, profile = "rx", "profile rbd-read-only "
+		}
+
+		if !capsAllow(parseCaps(caps["osd"]), permissions, c.pool, namespace) {
+			capsError.Missing = append(capsError.Missing, MissingCap{
+				Operation: operation,
+				Service:   "osd",
+				Required:  profile + scope,
+				Current:   caps["osd"],
+			})
+		}
+	}
+
+	if len(capsError.Missing) > 0 {
+		return capsError
+	}
+	return nil
+}
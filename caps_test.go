@@ -0,0 +1,88 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseCaps(t *testing.T) {
+	tests := []struct {
+		caps string
+		want []capGrant
+	}{
+		{"", nil},
+		{"allow r", []capGrant{{permissions: "r"}}},
+		{"allow *", []capGrant{{permissions: "*"}}},
+		{"profile rbd", []capGrant{{permissions: "rwx"}}},
+		{"profile rbd pool=rbd", []capGrant{{permissions: "rwx", pool: "rbd"}}},
+		{"profile rbd-read-only pool=images", []capGrant{{permissions: "rx", pool: "images"}}},
+		{"allow rwx pool=rbd namespace=tenant", []capGrant{{permissions: "rwx", pool: "rbd", namespace: "tenant"}}},
+		{"allow rwx pool = rbd", []capGrant{{permissions: "rwx", pool: "rbd"}}},
+		{"allow 'rw' pool=\"rbd\"", []capGrant{{permissions: "rw", pool: "rbd"}}},
+		{"profile rbd pool=rbd, profile rbd-read-only pool=images", []capGrant{
+			{permissions: "rwx", pool: "rbd"},
+			{permissions: "rx", pool: "images"},
+		}},
+		{"allow class-read object_prefix rbd_children, allow rwx pool=rbd", []capGrant{{permissions: "rwx", pool: "rbd"}}},
+		{"profile osd", nil},
+		{"allow", nil},
+	}
+
+	for _, test := range tests {
+		if got := parseCaps(test.caps); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseCaps(%q) = %+v, want %+v", test.caps, got, test.want)
+		}
+	}
+}
+
+func TestCapsAllow(t *testing.T) {
+	tests := []struct {
+		caps        string
+		permissions string
+		pool        string
+		namespace   string
+		want        bool
+	}{
+		{"allow *", "rwx", "rbd", "", true},
+		{"profile rbd", "rwx", "rbd", "tenant", true},
+		{"profile rbd pool=rbd", "rwx", "rbd", "", true},
+		{"profile rbd pool=rbd", "rwx", "images", "", false},
+		{"profile rbd-read-only pool=rbd", "rx", "rbd", "", true},
+		{"profile rbd-read-only pool=rbd", "rwx", "rbd", "", false},
+		{"allow r pool=rbd, allow wx pool=rbd", "rwx", "rbd", "", true},
+		{"allow rwx pool=rbd namespace=tenant", "rwx", "rbd", "tenant", true},
+		{"allow rwx pool=rbd namespace=tenant", "rwx", "rbd", "", false},
+		{"allow rwx pool=rbd namespace=tenant", "rwx", "rbd", "other", false},
+		{"allow * pool=images", "r", "rbd", "", false},
+		{"", "r", "rbd", "", false},
+		{"", "", "rbd", "", true},
+	}
+
+	for _, test := range tests {
+		got := capsAllow(parseCaps(test.caps), test.permissions, test.pool, test.namespace)
+		if got != test.want {
+			t.Errorf("capsAllow(%q, %q, %q, %q) = %v, want %v", test.caps, test.permissions, test.pool, test.namespace, got, test.want)
+		}
+	}
+}
+
+func TestIsAccessDeniedError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EACCES, true},
+		{fmt.Errorf("Error running mon command: auth get, Error: %w ", syscall.EPERM), true},
+		{errors.New("Error running mon command: auth get, Error: rados: ret=-13, Permission denied access denied"), true},
+		{errors.New("Error running mon command: auth get, Error: rados: ret=-2, No such file or directory"), false},
+	}
+
+	for _, test := range tests {
+		if got := isAccessDeniedError(test.err); got != test.want {
+			t.Errorf("isAccessDeniedError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//This struct represents the devices set up through a connection (and
+//its pool scoped copies), torn down by `Close`.
+type deviceTracker struct {
+	mutex   sync.Mutex
+	devices []*Device
+}
+
+/*
+This is a helper method that tracks a device set up through the
+connection, planned devices are not. A layer (e.g. a LUKS volume)
+replaces the device it's set up on, which it tears down.
+*/
+func (c *Connection) track(device *Device) {
+	if c.IsDryRun() {
+		return
+	}
+
+	c.tracker.mutex.Lock()
+	defer c.tracker.mutex.Unlock()
+	for index, tracked := range c.tracker.devices {
+		if tracked == device {
+			return
+		}
+
+		if device.parent != nil && tracked == device.parent {
+			c.tracker.devices = append(c.tracker.devices[:index], c.tracker.devices[index+1:]...)
+			break
+		}
+	}
+	c.tracker.devices = append(c.tracker.devices, device)
+}
+
+/*
+This is a helper method that stops tracking a device once unmapped.
+*/
+func (c *Connection) untrack(device *Device) {
+	c.tracker.mutex.Lock()
+	defer c.tracker.mutex.Unlock()
+	for index, tracked := range c.tracker.devices {
+		if tracked == device {
+			c.tracker.devices = append(c.tracker.devices[:index], c.tracker.devices[index+1:]...)
+			return
+		}
+	}
+}
+
+/*
+This method returns the devices set up through the connection that are
+still mapped, in the order they were set up.
+*/
+func (c *Connection) GetDevices() []*Device {
+	c.tracker.mutex.Lock()
+	defer c.tracker.mutex.Unlock()
+	return append([]*Device(nil), c.tracker.devices...)
+}
+
+/*
+This is a helper method that returns the number of path elements of a
+mountpoint, an unmounted device has none.
+*/
+func mountDepth(device *Device) int {
+	if !device.isMounted {
+		return 0
+	}
+	return len(strings.Split(strings.Trim(device.mountPoint, "/"), "/"))
+}
+
+/*
+This method unmounts and unmaps the devices set up through the
+connection in dependency order, the last set up first and the nested
+mounts before the mounts they live on, and then shuts the connection
+down. The commands are killed and the teardown stops when `ctx` is
+done, the connection is shut down anyway. The teardown failures are
+returned together.
+*/
+func (c *Connection) Close(ctx context.Context) error {
+	devices := c.GetDevices()
+	for left, right := 0, len(devices)-1; left < right; left, right = left+1, right-1 {
+		devices[left], devices[right] = devices[right], devices[left]
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		return mountDepth(devices[i]) > mountDepth(devices[j])
+	})
+
+	var failed []string
+	for _, device := range devices {
+		if err := ctx.Err(); err != nil {
+			failed = append(failed, err.Error())
+			break
+		}
+
+		if err := device.UnMapCtx(ctx, nil); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	c.Shutdown()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Cannot tear down devices, Error: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//This command runs the support tasks of the blockdevice package on this
+//host, e.g. "gcb diagnostics -dir /tmp" writes a diagnostics bundle.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/niedbalski/go-ceph-blockdevice"
+	"os"
+)
+
+const usage = `Usage: gcb <command> [options]
+
+Commands:
+  diagnostics  collect the state of the rbd devices of this host into a tarball
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "diagnostics":
+		os.Exit(diagnostics(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+/*
+This method collects a diagnostics bundle and prints its path, it
+returns the exit code of the command.
+*/
+func diagnostics(args []string) int {
+	flags := flag.NewFlagSet("diagnostics", flag.ExitOnError)
+	dir := flags.String("dir", os.TempDir(), "directory the bundle is written in")
+	user := flags.String("id", "admin", "ceph user")
+	pool := flags.String("pool", blockdevice.DefaultPoolName, "pool of the images")
+	config := flags.String("conf", "", "ceph configuration file")
+	flags.Parse(args)
+
+	options := []blockdevice.ConnectionOption{blockdevice.WithUser(*user), blockdevice.WithPool(*pool)}
+	if *config != "" {
+		options = append(options, blockdevice.WithConfigFile(*config))
+	}
+
+	connection, err := blockdevice.NewConnection(options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting, Error: %s\n", err)
+		return 1
+	}
+	defer connection.Shutdown()
+
+	path, err := connection.CollectDiagnostics(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(path)
+	return 0
+}
@@ -0,0 +1,231 @@
+package blockdevice
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	//Image features supported by the kernel client.
+	krbdSupportedFeatures = "/sys/bus/rbd/supported_features"
+)
+
+var cephVersion = regexp.MustCompile(`ceph version (\d+)\.(\d+)\.(\d+)\S*(?: \([0-9a-f]+\))? ?(\w*)`)
+
+//This struct represents the version of the ceph daemons.
+type CephVersion struct {
+	Major int
+	Minor int
+	Patch int
+	//Release name (quincy, reef ...).
+	Release string
+}
+
+/*
+This method returns the version as major.minor.patch.
+*/
+func (v CephVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+/*
+This method tells if the version is at least major.minor.
+*/
+func (v CephVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+/*
+This is a helper method that tells if the version is older than `other`.
+*/
+func (v CephVersion) before(other CephVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+/*
+This is a helper method that parses a "ceph version ..." string.
+*/
+func parseCephVersion(version string) (CephVersion, error) {
+	match := cephVersion.FindStringSubmatch(version)
+	if match == nil {
+		return CephVersion{}, parseFailure("versions", version, fmt.Errorf("no ceph version found"))
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	patch, _ := strconv.Atoi(match[3])
+	return CephVersion{Major: major, Minor: minor, Patch: patch, Release: match[4]}, nil
+}
+
+/*
+This method returns the version of the cluster, the oldest version run
+by its daemons since it bounds the features available while upgrading.
+*/
+func (c *Connection) ClusterVersion() (*CephVersion, error) {
+	var versions map[string]map[string]int
+	if err := c.monCommand(map[string]interface{}{"prefix": "versions"}, &versions); err != nil {
+		return nil, fmt.Errorf("Cannot get cluster version, Error: %w", err)
+	}
+
+	var oldest *CephVersion
+	for daemon, running := range versions {
+		if daemon == "overall" {
+			continue
+		}
+
+		for raw := range running {
+			version, err := parseCephVersion(raw)
+			if err != nil {
+				return nil, err
+			}
+
+			if oldest == nil || version.before(*oldest) {
+				oldest = &version
+			}
+		}
+	}
+
+	if oldest == nil {
+		return nil, fmt.Errorf("Cannot get cluster version, Error: no daemons reported")
+	}
+	return oldest, nil
+}
+
+//This struct represents the mapping capabilities of a host.
+type HostCapabilities struct {
+	//Running kernel release (uname -r), the krbd version.
+	KernelVersion string
+	//The rbd kernel module is loaded.
+	KRBD bool
+	//Image feature bits supported by krbd (FeatureLayering | ...),
+	//zero if the kernel doesn't report them.
+	KRBDFeatures uint64
+	//The nbd kernel module is loaded and rbd-nbd is installed.
+	NBD bool
+}
+
+/*
+This method returns the mapping capabilities of the host targeted by the
+runner of the connection.
+*/
+func (c *Connection) HostCapabilities() (*HostCapabilities, error) {
+	runner := c.hostRunner(nil)
+
+	kernel, err := runner.Run("uname", "-r")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get kernel version, Error: %w", err)
+	}
+
+	capabilities := &HostCapabilities{
+		KernelVersion: strings.TrimSpace(kernel),
+		KRBD:          EnsureKernelModule(runner, KernelModuleRBD, false) == nil,
+	}
+
+	if capabilities.KRBD {
+		lines, err := readHostFile(runner, krbdSupportedFeatures)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+			features, err := strconv.ParseUint(strings.TrimSpace(lines[0]), 0, 64)
+			if err != nil {
+				return nil, parseFailure(krbdSupportedFeatures, lines[0], err)
+			}
+			capabilities.KRBDFeatures = features
+		}
+	}
+
+	if EnsureKernelModule(runner, KernelModuleNBD, false) == nil {
+		_, err := runner.Run("which", "rbd-nbd")
+		capabilities.NBD = err == nil
+	}
+
+	return capabilities, nil
+}
+
+//This struct represents the features and backends usable for new
+//images from the host of a connection.
+type CompatibilityReport struct {
+	Cluster *CephVersion
+	Host    *HostCapabilities
+	//Requested image features supported by krbd, and the ones only
+	//rbd-nbd can map.
+	KRBDFeatures    uint64
+	NBDOnlyFeatures uint64
+	//Backends able to map an image with the requested features, in
+	//order of preference.
+	Backends []Backend
+	Warnings []string
+}
+
+/*
+This is a helper method that lists the names of the given feature bits.
+*/
+func featureList(features uint64) []string {
+	var names []string
+	for bit, name := range featureNames {
+		if features&bit != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+This method reports which of the given image feature bits (FeatureLayering
+| ...) and which backends can be used from the host of the connection, so
+callers can pick them before creating and mapping images.
+*/
+func (c *Connection) CompatibilityReport(features uint64) (*CompatibilityReport, error) {
+	cluster, err := c.ClusterVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := c.HostCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CompatibilityReport{Cluster: cluster, Host: host}
+	if host.KRBD {
+		report.KRBDFeatures = features
+		if host.KRBDFeatures != 0 {
+			report.KRBDFeatures = features & host.KRBDFeatures
+		}
+		report.NBDOnlyFeatures = features &^ report.KRBDFeatures
+
+		if report.NBDOnlyFeatures == 0 {
+			report.Backends = append(report.Backends, BackendKRBD, BackendSysfs)
+		} else {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("krbd on kernel %s doesn't support the features: %s",
+				host.KernelVersion, strings.Join(featureList(report.NBDOnlyFeatures), ", ")))
+		}
+	} else {
+		report.NBDOnlyFeatures = features
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Kernel module: %s is not loaded", KernelModuleRBD))
+	}
+
+	if host.NBD {
+		report.Backends = append(report.Backends, BackendNBD)
+	} else {
+		report.Warnings = append(report.Warnings, "rbd-nbd is not available")
+	}
+
+	if len(report.Backends) == 0 {
+		report.Warnings = append(report.Warnings, "no backend can map images with the requested features")
+	}
+	return report, nil
+}
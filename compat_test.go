@@ -0,0 +1,56 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+func TestParseCephVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    CephVersion
+		wantErr bool
+	}{
+		{"ceph version 17.2.6 (d7ff0d10654d2280e08f1ab989c7cdf3064446a5) quincy (stable)", CephVersion{17, 2, 6, "quincy"}, false},
+		{"ceph version 18.2.0-1234-gabcdef (abcdef0123) reef (stable)", CephVersion{18, 2, 0, "reef"}, false},
+		{"ceph version 16.2.15", CephVersion{16, 2, 15, ""}, false},
+		{"ceph version 19.1.0 squid (rc)", CephVersion{19, 1, 0, "squid"}, false},
+		{"ceph version 17.2", CephVersion{}, true},
+		{"mimic", CephVersion{}, true},
+		{"", CephVersion{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseCephVersion(test.version)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseCephVersion(%q) error = %v, wantErr %v", test.version, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("parseCephVersion(%q) = %+v, want %+v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestCephVersionCompare(t *testing.T) {
+	tests := []struct {
+		version      CephVersion
+		major, minor int
+		atLeast      bool
+	}{
+		{CephVersion{Major: 17, Minor: 2}, 17, 2, true},
+		{CephVersion{Major: 17, Minor: 1}, 17, 2, false},
+		{CephVersion{Major: 18}, 17, 2, true},
+		{CephVersion{Major: 16, Minor: 9}, 17, 0, false},
+	}
+
+	for _, test := range tests {
+		if got := test.version.AtLeast(test.major, test.minor); got != test.atLeast {
+			t.Errorf("%s.AtLeast(%d, %d) = %v, want %v", test.version, test.major, test.minor, got, test.atLeast)
+		}
+	}
+
+	if !(CephVersion{17, 2, 5, ""}).before(CephVersion{17, 2, 6, ""}) || (CephVersion{17, 2, 6, ""}).before(CephVersion{17, 2, 6, ""}) {
+		t.Errorf("before() doesn't order the patch versions")
+	}
+}
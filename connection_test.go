@@ -0,0 +1,177 @@
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+This is a helper method that connects to the cluster of the default
+ceph configuration, on the pool of GO_CEPH_BLOCKDEVICE_TEST_POOL
+(DefaultPoolName if unset), the test is skipped without a cluster.
+*/
+func testConnection(t *testing.T) *Connection {
+	pool := os.Getenv("GO_CEPH_BLOCKDEVICE_TEST_POOL")
+	if pool == "" {
+		pool = DefaultPoolName
+	}
+
+	connection, err := NewConnection(WithPool(pool))
+	if err != nil {
+		t.Skipf("no ceph cluster available: %s", err)
+	}
+	t.Cleanup(connection.Shutdown)
+	return connection
+}
+
+func TestConcurrentConnection(t *testing.T) {
+	connection := testConnection(t)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				connection.SetCommandTimeout(time.Duration(round) * time.Second)
+				connection.GetCommandTimeout()
+				connection.SetCapacityFraction(0.5)
+				connection.GetCapacityFraction()
+				connection.SetPolicy(&Policy{})
+				connection.GetPolicy()
+				connection.SetLogger(nil)
+				connection.logger()
+				connection.SetRetryPolicy(nil)
+				connection.GetRetryPolicy()
+				connection.IsDryRun()
+				connection.GetDevices()
+				connection.ioContext()
+				connection.rados()
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentPoolHandles(t *testing.T) {
+	connection := testConnection(t)
+
+	var wg sync.WaitGroup
+	handles := make([][]*Connection, 8)
+	for worker := range handles {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < 20; round++ {
+				handle, err := connection.Namespace(fmt.Sprintf("test-%d", round%4))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				handles[worker] = append(handles[worker], handle)
+
+				pool, err := handle.Pool("")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				pool.GetNamespace()
+				connection.GetPoolHandles()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	//the handles are cached, every worker got the same ones
+	for worker := range handles {
+		for round, handle := range handles[worker] {
+			if handle != handles[0][round] {
+				t.Fatalf("worker %d got another handle of namespace test-%d", worker, round%4)
+			}
+
+			if want := fmt.Sprintf("test-%d", round%4); handle.GetNamespace() != want {
+				t.Fatalf("handle of namespace %s is scoped to %q", want, handle.GetNamespace())
+			}
+		}
+	}
+
+	if got := len(connection.GetPoolHandles()); got != 4 {
+		t.Errorf("GetPoolHandles() has %d handles, want 4", got)
+	}
+}
+
+func TestConcurrentSetNamespace(t *testing.T) {
+	connection := testConnection(t)
+	handle, err := connection.Namespace("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				if worker%2 == 0 {
+					connection.SetNamespace(fmt.Sprintf("test-%d", worker))
+					continue
+				}
+				connection.GetNamespace()
+				connection.spec("image", "")
+				handle.GetNamespace()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	connection.SetNamespace("")
+	if got := connection.GetNamespace(); got != "" {
+		t.Errorf("GetNamespace() = %q, want the default namespace", got)
+	}
+
+	//the handle keeps its own namespace
+	if got := handle.GetNamespace(); got != "test" {
+		t.Errorf("handle GetNamespace() = %q, want %q", got, "test")
+	}
+}
+
+func TestConcurrentReconnect(t *testing.T) {
+	connection := testConnection(t)
+	handle, err := connection.Namespace("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < 10; round++ {
+				if worker == 0 {
+					if err := connection.Reconnect(); err != nil {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+
+				session, _ := handle.acquireContext()
+				connection.rados()
+				handle.GetNamespace()
+				session.done()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	connection.mutex.RLock()
+	defer connection.mutex.RUnlock()
+	if connection.Conn != handle.Conn || connection.session != handle.session {
+		t.Errorf("the pool handle was not reconnected with the connection")
+	}
+}
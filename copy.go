@@ -0,0 +1,37 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+/*
+This method copies the image, with its snapshots, to the new image
+`name` on the connection pool (rbd deep cp), the copy is independent
+of the image and of its parent. `progress` (which can be nil) is called
+with the percentage copied.
+*/
+func (i *Image) DeepCopy(name string, progress ProgressFunc) (image *Image, err error) {
+	ctx, end := i.Connection.observe(context.Background(), OperationCopy, name)
+	defer end(&err)
+
+	size := i.ImageInfo.Size / toMegs(1)
+	if err := i.checkCreatePolicy(size); err != nil {
+		return nil, err
+	}
+
+	_, err = i.runWithProgress(ctx, progress, "deep", "cp", "--id", i.username, i.spec(i.name, ""), i.spec(name, ""))
+	if err != nil && isExistsError(err) {
+		return nil, kindErrorf(ErrImageExists, err, "Cannot copy image: %s to: %s, Error: %s", i.name, name, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot copy image: %s to: %s, Error: %w", i.name, name, err)
+	}
+
+	if i.IsDryRun() {
+		return i.plannedImage(name, size), nil
+	}
+	return NewImage(rbd.GetImage(i.ioContext(), name), i.Connection, name)
+}
@@ -0,0 +1,215 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//This struct represents a parsed cron field: the values it matches.
+type cronField struct {
+	values uint64
+	//the field is "*", so it takes no part in matching the day
+	any bool
+}
+
+//Bounds of the fields of a cron expression.
+var cronBounds = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+//Shorthands of cron expressions, and the interval they run at.
+var cronDescriptors = map[string]struct {
+	expression string
+	every      time.Duration
+}{
+	"@hourly":   {"0 * * * *", time.Hour},
+	"@daily":    {"0 0 * * *", 24 * time.Hour},
+	"@midnight": {"0 0 * * *", 24 * time.Hour},
+	"@weekly":   {"0 0 * * 0", 7 * 24 * time.Hour},
+	"@monthly":  {"0 0 1 * *", 0},
+	"@yearly":   {"0 0 1 1 *", 0},
+	"@annually": {"0 0 1 1 *", 0},
+}
+
+//This struct represents a cron-like schedule, as parsed by
+//`ParseCronSchedule`.
+type CronSchedule struct {
+	spec   string
+	fields []cronField
+	//run at a fixed interval instead (@every), or the interval the
+	//expression runs at if it's a regular one (@hourly ...)
+	every    time.Duration
+	interval bool
+}
+
+/*
+This method parses a cron-like schedule: a five fields expression
+(minute, hour, day of month, month and day of week, each one "*", a
+value, a range or a list, with an optional step: "0,30", "1-5" or
+"0-59/15"), one of the
+@hourly, @daily, @weekly, @monthly and @yearly shorthands, or
+"@every <duration>" (e.g. "@every 6h").
+*/
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	expression := strings.TrimSpace(spec)
+	schedule := &CronSchedule{spec: expression}
+
+	if strings.HasPrefix(expression, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse schedule: %q, Error: %w", spec, err)
+		}
+
+		if every < time.Minute {
+			return nil, fmt.Errorf("Cannot parse schedule: %q, Error: interval is shorter than a minute", spec)
+		}
+		schedule.every, schedule.interval = every, true
+		return schedule, nil
+	}
+
+	if descriptor, ok := cronDescriptors[expression]; ok {
+		expression, schedule.every = descriptor.expression, descriptor.every
+	}
+
+	terms := strings.Fields(expression)
+	if len(terms) != len(cronBounds) {
+		return nil, fmt.Errorf("Cannot parse schedule: %q, Error: expected %d fields", spec, len(cronBounds))
+	}
+
+	for index, term := range terms {
+		field, err := parseCronField(term, cronBounds[index].min, cronBounds[index].max)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse schedule: %q, Error: %s: %s", spec, cronBounds[index].name, err)
+		}
+		schedule.fields = append(schedule.fields, field)
+	}
+
+	//sunday is both 0 and 7
+	if dow := &schedule.fields[4]; dow.values&(1<<7) != 0 {
+		dow.values |= 1
+	}
+	return schedule, nil
+}
+
+/*
+This is a helper method that parses a field of a cron expression whose
+values range from `min` to `max`.
+*/
+func parseCronField(term string, min, max int) (cronField, error) {
+	field := cronField{any: term == "*"}
+	for _, part := range strings.Split(term, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			value, err := strconv.Atoi(part[index+1:])
+			if err != nil || value < 1 {
+				return field, fmt.Errorf("invalid step: %q", part)
+			}
+			step, part = value, part[:index]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			value, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return field, fmt.Errorf("invalid value: %q", part)
+			}
+			low, high = value, value
+
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return field, fmt.Errorf("invalid value: %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return field, fmt.Errorf("out of range: %q", part)
+		}
+
+		for value := low; value <= high; value += step {
+			field.values |= 1 << uint(value)
+		}
+	}
+	return field, nil
+}
+
+/*
+This is a helper method that tells if the field matches `value`.
+*/
+func (f cronField) matches(value int) bool {
+	return f.values&(1<<uint(value)) != 0
+}
+
+/*
+This is a helper method that tells if the schedule runs on the day of
+`t`: when both the day of month and the day of week are restricted
+either of them matching is enough, as with cron.
+*/
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := s.fields[2], s.fields[4]
+	domMatch, dowMatch := dom.matches(t.Day()), dow.matches(int(t.Weekday()))
+
+	if !dom.any && !dow.any {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+/*
+This method returns the first time the schedule runs after `after`, in
+the location of `after`. The zero time is returned if it never runs
+(e.g. on February 30th).
+*/
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	if s.interval {
+		return after.Add(s.every)
+	}
+
+	//the expression is checked minute by minute, skipping what can't
+	//match, for up to five years
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case !s.fields[3].matches(int(next.Month())):
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case !s.fields[1].matches(next.Hour()):
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case !s.fields[0].matches(next.Minute()):
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+/*
+Getter method for the interval the schedule runs at, zero if it's not a
+regular one (e.g. "0 9 * * 1-5").
+*/
+func (s *CronSchedule) GetInterval() time.Duration {
+	return s.every
+}
+
+/*
+This method returns the schedule as it was given.
+*/
+func (s *CronSchedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,108 @@
+package blockdevice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		spec     string
+		interval time.Duration
+		wantErr  bool
+	}{
+		{"0 * * * *", 0, false},
+		{"0,30 9-17 * * 1-5", 0, false},
+		{"0-59/15 * * * *", 0, false},
+		{"5/10 * * * *", 0, false},
+		{"0 0 * * 7", 0, false},
+		{"@hourly", time.Hour, false},
+		{"@daily", 24 * time.Hour, false},
+		{"@weekly", 7 * 24 * time.Hour, false},
+		{"@monthly", 0, false},
+		{"@every 6h", 6 * time.Hour, false},
+		{"@every 30s", 0, true},
+		{"@every tomorrow", 0, true},
+		{"* * * *", 0, true},
+		{"60 * * * *", 0, true},
+		{"* 24 * * *", 0, true},
+		{"* * 0 * *", 0, true},
+		{"* * * 13 *", 0, true},
+		{"* * * * 8", 0, true},
+		{"5-1 * * * *", 0, true},
+		{"*/0 * * * *", 0, true},
+		{"a * * * *", 0, true},
+		{"@fortnightly", 0, true},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseCronSchedule(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseCronSchedule(%q) error = %v, wantErr %v", test.spec, err, test.wantErr)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if got := schedule.GetInterval(); got != test.interval {
+			t.Errorf("ParseCronSchedule(%q).GetInterval() = %s, want %s", test.spec, got, test.interval)
+		}
+
+		if got := schedule.String(); got != test.spec {
+			t.Errorf("ParseCronSchedule(%q).String() = %q", test.spec, got)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		{"0 * * * *", "2024-03-10 10:00", "2024-03-10 11:00"},
+		{"0 * * * *", "2024-03-10 10:59", "2024-03-10 11:00"},
+		{"0-59/15 * * * *", "2024-03-10 10:16", "2024-03-10 10:30"},
+		{"30 9 * * 1-5", "2024-03-08 10:00", "2024-03-11 09:30"},
+		{"0 0 1 * *", "2024-01-31 12:00", "2024-02-01 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 * * 0", "2024-03-10 00:00", "2024-03-17 00:00"},
+		{"0 0 * * 7", "2024-03-11 00:00", "2024-03-17 00:00"},
+		{"@daily", "2024-12-31 23:59", "2025-01-01 00:00"},
+		//either the day of month or the day of week matches
+		{"0 0 13 * 5", "2024-09-01 00:00", "2024-09-06 00:00"},
+		{"@every 90m", "2024-03-10 10:07", "2024-03-10 11:37"},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseCronSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("ParseCronSchedule(%q) error = %v", test.spec, err)
+		}
+
+		if got := schedule.Next(at(test.after)); !got.Equal(at(test.want)) {
+			t.Errorf("%q.Next(%s) = %s, want %s", test.spec, test.after, got, test.want)
+		}
+	}
+}
+
+func TestCronScheduleNextNever(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next() = %s, want the zero time", got)
+	}
+}
@@ -0,0 +1,261 @@
+package blockdevice
+
+import (
+	"context"
+)
+
+//This struct runs the commands of a runner until a context is done, it's
+//bound to a device only for the duration of a *Ctx call.
+type boundRunner struct {
+	runner CommandRunner
+	ctx    context.Context
+}
+
+func (r *boundRunner) Run(name string, args ...string) (string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return "", err
+	}
+	return runContext(r.ctx, r.runner, name, args...)
+}
+
+func (r *boundRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	//keeps the deadline of the caller, e.g. the command timeout
+	bound := r.ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		bound, cancel = context.WithDeadline(r.ctx, deadline)
+		defer cancel()
+	}
+
+	if err := bound.Err(); err != nil {
+		return "", err
+	}
+	return runContext(withCommandLogger(bound, commandConnection(ctx)), r.runner, name, args...)
+}
+
+func (r *boundRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return r.runWithInputContext(context.Background(), input, name, args...)
+}
+
+func (r *boundRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return "", err
+	}
+	return runWithInputContext(withCommandLogger(r.ctx, commandConnection(ctx)), r.runner, input, name, args...)
+}
+
+/*
+This is a helper method that runs `fn` until it returns or `ctx` is
+done, in which case the context error is returned and `fn` keeps
+running on background (librbd calls can't be interrupted) and
+`abandon` (which can be nil) is called with its result.
+*/
+func abortable(ctx context.Context, fn func() error, abandon func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if abandon != nil {
+			go func() {
+				<-done
+				abandon()
+			}()
+		}
+		return ctx.Err()
+	}
+}
+
+/*
+This is a helper method that returns `runner` running its commands with
+`ctx`, in place of the context it's already bound to if any, which
+`ctx` should derive from.
+*/
+func bindRunner(runner CommandRunner, ctx context.Context) CommandRunner {
+	switch runner := runner.(type) {
+	case *boundRunner:
+		return &boundRunner{runner: runner.runner, ctx: ctx}
+	case *timeoutRunner:
+		return &timeoutRunner{runner: bindRunner(runner.runner, ctx), connection: runner.connection}
+	}
+	return &boundRunner{runner: runnerOrLocal(runner), ctx: ctx}
+}
+
+/*
+This is a helper method that returns the context `runner` is bound to,
+the background one if none.
+*/
+func runnerContext(runner CommandRunner) context.Context {
+	switch runner := runner.(type) {
+	case *boundRunner:
+		return runner.ctx
+	case *timeoutRunner:
+		return runnerContext(runner.runner)
+	}
+	return context.Background()
+}
+
+/*
+This is a helper method that binds `ctx` to the commands run by the
+device and the devices it's layered on, the returned function restores
+their runners.
+*/
+func (d *Device) bindContext(ctx context.Context) func() {
+	var bound []*Device
+	for device := d; device != nil; device = device.parent {
+		bound = append(bound, device)
+		if device.disk != nil {
+			bound = append(bound, device.disk)
+		}
+	}
+
+	runners := make([]CommandRunner, len(bound))
+	for index, device := range bound {
+		runners[index] = device.runner
+		device.runner = bindRunner(device.runner, ctx)
+	}
+
+	return func() {
+		for index, device := range bound {
+			device.runner = runners[index]
+		}
+	}
+}
+
+/*
+This is a helper method that removes the context bound to the runner of
+the device and of its layers.
+*/
+func (d *Device) unbindContext() {
+	for device := d; device != nil; device = device.parent {
+		switch runner := device.runner.(type) {
+		case *boundRunner:
+			device.runner = runner.runner
+		case *timeoutRunner:
+			if bound, ok := runner.runner.(*boundRunner); ok {
+				device.runner = &timeoutRunner{runner: bound.runner, connection: runner.connection}
+			}
+		}
+
+		if device.disk != nil {
+			device.disk.unbindContext()
+		}
+	}
+}
+
+/*
+This method is a variant of `NewConnection` giving up when `ctx` is
+done, the connection is then shut down once established.
+*/
+func NewConnectionCtx(ctx context.Context, options ...ConnectionOption) (*Connection, error) {
+	var connection *Connection
+	err := abortable(ctx, func() error {
+		var err error
+		connection, err = NewConnection(options...)
+		return err
+	}, func() {
+		if connection != nil {
+			connection.Shutdown()
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return connection, nil
+}
+
+/*
+This method is a variant of `GetImageByName` giving up when `ctx` is
+done, the image is then closed once opened.
+*/
+func (c *Connection) GetImageByNameCtx(ctx context.Context, name string) (*Image, error) {
+	var image *Image
+	err := abortable(ctx, func() error {
+		var err error
+		image, err = c.GetImageByName(name)
+		return err
+	}, func() {
+		if image != nil {
+			image.Close()
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+/*
+This method is a variant of `GetOrCreateImage` giving up when `ctx` is
+done, the image may still be created after and is then closed once
+opened.
+*/
+func (c *Connection) GetOrCreateImageCtx(ctx context.Context, name string, size uint64) (*Image, error) {
+	var image *Image
+	err := abortable(ctx, func() error {
+		var err error
+		image, err = c.GetOrCreateImage(name, size)
+		return err
+	}, func() {
+		if image != nil {
+			image.Close()
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+/*
+This method is a variant of `MapToDevice` whose commands (rbd map,
+mkfs, mount ...) are killed when `ctx` is done, `options` can be nil.
+*/
+func (i *Image) MapToDeviceCtx(ctx context.Context, fsType string, mountPoint string, options *MapOptions) (*Device, error) {
+	return i.mapToDevice(ctx, fsType, mountPoint, options)
+}
+
+/*
+This method is a variant of `Mount` whose commands are killed when
+`ctx` is done.
+*/
+func (d *Device) MountCtx(ctx context.Context, mountPoint string, options ...string) (string, error) {
+	defer d.bindContext(ctx)()
+	return d.Mount(mountPoint, options...)
+}
+
+/*
+This method is a variant of `FormatWithOptions` whose commands are
+killed when `ctx` is done.
+*/
+func (d *Device) FormatCtx(ctx context.Context, options *FormatOptions) error {
+	defer d.bindContext(ctx)()
+	return d.FormatWithOptions(options)
+}
+
+/*
+This method is a variant of `UnMountWithOptions` whose commands are
+killed when `ctx` is done.
+*/
+func (d *Device) UnMountCtx(ctx context.Context, options *UnMountOptions) error {
+	defer d.bindContext(ctx)()
+	return d.UnMountWithOptions(options)
+}
+
+/*
+This method is a variant of `UnMapWithOptions` whose commands are
+killed when `ctx` is done.
+*/
+func (d *Device) UnMapCtx(ctx context.Context, options *UnMapOptions) error {
+	defer d.bindContext(ctx)()
+	return d.UnMapWithOptions(options)
+}
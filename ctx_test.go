@@ -0,0 +1,105 @@
+package blockdevice
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type contextKey string
+
+//This struct records the context the commands are run with.
+type contextRecorder struct {
+	ctx context.Context
+}
+
+func (r *contextRecorder) Run(name string, args ...string) (string, error) {
+	return r.RunContext(context.Background(), name, args...)
+}
+
+func (r *contextRecorder) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	r.ctx = ctx
+	return "", nil
+}
+
+func TestBindRunner(t *testing.T) {
+	recorder := &contextRecorder{}
+	parent := context.WithValue(context.Background(), contextKey("operation"), "parent")
+	child := context.WithValue(parent, contextKey("span"), "child")
+
+	runner := bindRunner(&timeoutRunner{runner: &boundRunner{runner: recorder, ctx: parent}, connection: &Connection{mutex: &sync.RWMutex{}}}, child)
+	if got := runnerContext(runner); got != child {
+		t.Fatalf("runnerContext() = %v, want the bound context", got)
+	}
+
+	if _, err := runner.Run("true"); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+
+	if recorder.ctx.Value(contextKey("span")) != "child" {
+		t.Errorf("the command isn't run with the bound context")
+	}
+
+	if !isLocalRunner(bindRunner(nil, child)) {
+		t.Errorf("a bound local runner isn't local")
+	}
+
+	if got := runnerContext(recorder); got != context.Background() {
+		t.Errorf("runnerContext() of an unbound runner = %v, want the background context", got)
+	}
+}
+
+func TestDeviceBindContext(t *testing.T) {
+	recorder := &contextRecorder{}
+	disk := &Device{path: "/dev/rbd0", runner: recorder}
+	parent := &Device{path: "/dev/rbd0p1", runner: recorder, disk: disk}
+	device := &Device{path: "/dev/mapper/data", runner: &timeoutRunner{runner: recorder, connection: &Connection{mutex: &sync.RWMutex{}}}, parent: parent}
+	runners := []CommandRunner{device.runner, parent.runner, disk.runner}
+
+	ctx := context.WithValue(context.Background(), contextKey("span"), "device")
+	unbind := device.bindContext(ctx)
+
+	for _, bound := range []*Device{device, parent, disk} {
+		recorder.ctx = nil
+		bound.runner.Run("true")
+		if recorder.ctx == nil || recorder.ctx.Value(contextKey("span")) != "device" {
+			t.Errorf("the commands of %s aren't run with the bound context", bound.path)
+		}
+	}
+
+	unbind()
+	for index, bound := range []*Device{device, parent, disk} {
+		if bound.runner != runners[index] {
+			t.Errorf("the runner of %s isn't restored", bound.path)
+		}
+	}
+}
+
+func TestGetImageByNameCtxAbandoned(t *testing.T) {
+	connection := fakeConnection(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := make(chan struct{})
+	session := &radosSession{}
+	session.acquire()
+	session.retire(func() { close(closed) })
+
+	opener := imageOpener
+	imageOpener = func(c *Connection, name string) (*Image, error) {
+		//the image opens after the context is done
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return &Image{Connection: c, name: name, session: session}, nil
+	}
+	t.Cleanup(func() { imageOpener = opener })
+
+	if _, err := connection.GetImageByNameCtx(ctx, "data"); err != context.Canceled {
+		t.Fatalf("GetImageByNameCtx() = %v, want the context error", err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("the abandoned image isn't closed")
+	}
+}
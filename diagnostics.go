@@ -0,0 +1,164 @@
+package blockdevice
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//sysfs attributes collected for every rbd device, config_info is left
+//out since it might contain credentials.
+var diagnosticsSysfsAttributes = []string{
+	"pool", "pool_ns", "name", "current_snap", "size", "features",
+	"client_addr", "client_id", "cluster_fsid", "major", "minor", "image_id",
+}
+
+//This struct represents a diagnostics tarball being written.
+type diagnosticsBundle struct {
+	writer *tar.Writer
+	now    time.Time
+}
+
+/*
+This method adds a file to the bundle.
+*/
+func (b *diagnosticsBundle) add(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: b.now,
+	}
+
+	if err := b.writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := b.writer.Write(content)
+	return err
+}
+
+/*
+This method adds the output of a collector to the bundle, if it fails
+the error is stored as `<name>.error` so the bundle is still useful.
+*/
+func (b *diagnosticsBundle) collect(name string, content string, err error) error {
+	if err != nil {
+		return b.add(name+".error", []byte(err.Error()+"\n"+content))
+	}
+	return b.add(name, []byte(content))
+}
+
+/*
+This method gathers the state of the rbd devices on this host into a
+gzipped tarball written in `dir` and returns its path: showmapped
+and status of every mapped image, the rbd related kernel messages,
+mountinfo, findmnt, the rbd sysfs attributes and the recent logs of the
+package (see DefaultLogHistory). No tarball is left if it fails.
+*/
+func (c *Connection) CollectDiagnostics(dir string) (bundlePath string, err error) {
+	now := time.Now()
+	path := filepath.Join(dir, "gcb-diagnostics-"+now.Format("20060102-150405")+".tar.gz")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("Cannot create diagnostics bundle: %s, Error: %w", path, err)
+	}
+
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Cannot write diagnostics bundle: %s, Error: %w", path, closeErr)
+		}
+
+		if err != nil {
+			os.Remove(path)
+			bundlePath = ""
+		}
+	}()
+
+	compressor := gzip.NewWriter(file)
+	bundle := &diagnosticsBundle{tar.NewWriter(compressor), now}
+
+	if err := c.collectDiagnostics(bundle); err != nil {
+		return "", fmt.Errorf("Cannot write diagnostics bundle: %s, Error: %w", path, err)
+	}
+
+	if err := bundle.writer.Close(); err != nil {
+		return "", fmt.Errorf("Cannot write diagnostics bundle: %s, Error: %w", path, err)
+	}
+
+	if err := compressor.Close(); err != nil {
+		return "", fmt.Errorf("Cannot write diagnostics bundle: %s, Error: %w", path, err)
+	}
+
+	return path, nil
+}
+
+/*
+This method runs all the collectors.
+*/
+func (c *Connection) collectDiagnostics(bundle *diagnosticsBundle) error {
+	output, err := c.run("rbd", "showmapped", "--format", "json")
+	if err := bundle.collect("showmapped.json", output, err); err != nil {
+		return err
+	}
+
+	if devices, err := parseMappedDevices(output); err == nil {
+		for _, device := range devices {
+			spec := namespacedSpec(device.Pool, device.Namespace, device.Image, "")
+			status, err := c.run("rbd", "status", "--id", c.username, "--format", "json", spec)
+			name := "status/" + strings.Replace(spec, "/", "_", -1) + ".json"
+			if err := bundle.collect(name, status, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	dmesg, err := c.run("dmesg")
+	var lines []string
+	for _, line := range strings.Split(dmesg, "\n") {
+		if strings.Contains(line, "rbd") || strings.Contains(line, "libceph") {
+			lines = append(lines, line)
+		}
+	}
+	if err := bundle.collect("dmesg-rbd.txt", strings.Join(lines, "\n"), err); err != nil {
+		return err
+	}
+
+	mountinfo, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err := bundle.collect("mountinfo", string(mountinfo), err); err != nil {
+		return err
+	}
+
+	findmnt, err := c.run("findmnt", "--json")
+	if err := bundle.collect("findmnt.json", findmnt, err); err != nil {
+		return err
+	}
+
+	if err := bundle.add("library.log", []byte(strings.Join(recentLogs(), "\n")+"\n")); err != nil {
+		return err
+	}
+
+	ids, err := sysfsDeviceIds()
+	if err != nil {
+		return bundle.collect("sysfs", "", err)
+	}
+
+	for id := range ids {
+		var attributes []string
+		for _, attribute := range diagnosticsSysfsAttributes {
+			attributes = append(attributes, attribute+": "+sysfsAttribute(id, attribute))
+		}
+
+		if err := bundle.add("sysfs/"+id, []byte(strings.Join(attributes, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package blockdevice
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//This struct answers every command with an empty output.
+type silentRunner struct{}
+
+func (r *silentRunner) Run(name string, args ...string) (string, error) {
+	return "", nil
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	connection := &Connection{pool: "rbd", username: "admin", mutex: &sync.RWMutex{}}
+	connection.SetRunner(&silentRunner{})
+	connection.logger().Info("diagnostics test entry")
+
+	path, err := connection.CollectDiagnostics(t.TempDir())
+	if err != nil {
+		t.Fatalf("CollectDiagnostics() = %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	decompressor, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]bool)
+	reader := tar.NewReader(decompressor)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		names[header.Name] = true
+
+		if header.Name == "library.log" {
+			content, err := ioutil.ReadAll(reader)
+			if err != nil || !strings.Contains(string(content), "diagnostics test entry") {
+				t.Errorf("library.log doesn't hold the recent logs: %q", content)
+			}
+		}
+	}
+
+	for _, name := range []string{"showmapped.json", "mountinfo", "library.log"} {
+		if !names[name] {
+			t.Errorf("the bundle has no %s: %v", name, names)
+		}
+	}
+}
+
+func TestRecentLogs(t *testing.T) {
+	for index := 0; index < DefaultLogHistory+10; index++ {
+		recordLog("DEBUG", "entry", []interface{}{"index", index})
+	}
+
+	logs := recentLogs()
+	if len(logs) != DefaultLogHistory {
+		t.Fatalf("%d entries kept, want %d", len(logs), DefaultLogHistory)
+	}
+
+	if !strings.HasSuffix(logs[0], "index=10") || !strings.HasSuffix(logs[len(logs)-1], "index=1009") {
+		t.Errorf("the oldest entries weren't dropped: %q ... %q", logs[0], logs[len(logs)-1])
+	}
+}
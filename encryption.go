@@ -0,0 +1,67 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+//This type represents the format of an image encrypted by librbd.
+type EncryptionFormat string
+
+const (
+	LUKS1 EncryptionFormat = "luks1"
+	LUKS2 EncryptionFormat = "luks2"
+)
+
+//This struct represents the librbd encryption loaded when an image is
+//mapped, only rbd-nbd supports it.
+type EncryptionOptions struct {
+	Format     EncryptionFormat
+	Passphrase KeyProvider
+}
+
+/*
+This method formats the image with the librbd (rbd encryption format)
+encryption, the data is encrypted by the clients and never reaches
+the cluster in clear text. The image must be mapped with
+`MapOptions.Encryption` afterwards. The tool is run on the host of the
+connection runner, the passphrase is written to a temporary file there.
+*/
+func (i *Image) EncryptionFormat(format EncryptionFormat, passphrase KeyProvider) error {
+	runner := i.hostRunner(nil)
+	options := &EncryptionOptions{Format: format, Passphrase: passphrase}
+
+	file, remove, err := options.passphraseFile(runner)
+	if err != nil {
+		return fmt.Errorf("Cannot format encryption of image: %s, Error: %w", i.name, err)
+	}
+	defer remove()
+
+	if _, err := i.runCeph(runner, "rbd", "encryption", "format", "--id", i.username, i.spec(i.name, ""), string(format), file); err != nil {
+		return fmt.Errorf("Cannot format encryption of image: %s, Error: %w", i.name, err)
+	}
+	return nil
+}
+
+/*
+This is a helper method that writes the passphrase of `options` to a
+temporary file on the host of `runner`, the returned function removes
+it.
+*/
+func (o *EncryptionOptions) passphraseFile(runner CommandRunner) (string, func(), error) {
+	key, err := o.Passphrase.Key()
+	if err != nil {
+		return "", nil, fmt.Errorf("Cannot get encryption passphrase, Error: %s", err)
+	}
+
+	file, err := runner.Run("mktemp", "-t", "rbd-passphrase.XXXXXX")
+	if err != nil {
+		return "", nil, fmt.Errorf("Cannot create passphrase file, Error: %s", err)
+	}
+
+	remove := func() { runner.Run("rm", "-f", file) }
+	if _, err := runWithInput(runner, key, "dd", "of="+file, "status=none"); err != nil {
+		remove()
+		return "", nil, fmt.Errorf("Cannot write passphrase file: %s, Error: %w", file, err)
+	}
+	return file, remove, nil
+}
@@ -0,0 +1,52 @@
+package blockdevice
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+//This struct records the commands run on a remote host and the input
+//written to it.
+type remoteHostRunner struct {
+	commands []string
+	input    string
+}
+
+func (r *remoteHostRunner) Run(name string, args ...string) (string, error) {
+	r.commands = append(r.commands, strings.Join(append([]string{name}, args...), " "))
+	if name == "mktemp" {
+		return "/tmp/rbd-passphrase.abc123", nil
+	}
+	return "", nil
+}
+
+func (r *remoteHostRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	r.input = string(input)
+	return r.Run(name, args...)
+}
+
+func TestEncryptionFormatRemote(t *testing.T) {
+	runner := &remoteHostRunner{}
+	connection := &Connection{mutex: &sync.RWMutex{}, pool: "rbd", username: "admin"}
+	connection.SetRunner(runner)
+	image := &Image{Connection: connection, name: "data"}
+
+	if err := image.EncryptionFormat(LUKS2, StaticKey("secret")); err != nil {
+		t.Fatalf("EncryptionFormat() = %v", err)
+	}
+
+	want := []string{
+		"mktemp -t rbd-passphrase.XXXXXX",
+		"dd of=/tmp/rbd-passphrase.abc123 status=none",
+		"rbd encryption format --id admin rbd/data luks2 /tmp/rbd-passphrase.abc123",
+		"rm -f /tmp/rbd-passphrase.abc123",
+	}
+	if got := strings.Join(runner.commands, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("ran:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+
+	if runner.input != "secret" {
+		t.Errorf("wrote %q to the passphrase file, want the passphrase", runner.input)
+	}
+}
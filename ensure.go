@@ -0,0 +1,103 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+/*
+This method converges the image to being mapped and mounted on
+`mountPoint` with a `fsType` filesystem whatever the starting point,
+so it can be called again safely: an existing mapping of the image
+(and `options.Snapshot`) on the host is reused, the device is formatted
+only if it's empty (see `ExistingFSReuse`) and mounted only if it's not
+mounted on `mountPoint` yet. The resulting device is returned either
+way.
+
+Mappings with `options.Overlay` can't be reused, the image is mapped
+again.
+*/
+func (i *Image) EnsureMounted(fsType string, mountPoint string, options *MapOptions) (*Device, error) {
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	if fsType == "" {
+		fsType = DefaultFileSystemType
+	}
+
+	runner := i.hostRunner(options.Runner)
+	mapped, err := listMappedDevices(runner)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list mapped devices for image: %s, Error: %w", i.name, err)
+	}
+
+	var path string
+	for _, device := range mapped {
+		if device.Pool == i.pool && device.Namespace == i.GetNamespace() && device.Image == i.name && device.Snap == options.Snapshot {
+			path = device.Device
+			break
+		}
+	}
+
+	if path == "" || options.Overlay != nil {
+		return i.MapToDevice(fsType, mountPoint, options)
+	}
+
+	device := newMappedDevice(i, path, BackendKRBD, fsType, runner, options)
+	if options.Partition > 0 {
+		partition, err := device.partitionDevice(options.Partition, fsType, options.UdevTimeout)
+		if err != nil {
+			return nil, err
+		}
+		partition.ownsDisk = true
+		partition.formatOptions = device.formatOptions
+		device = partition
+	}
+
+	if mountPoint == "" {
+		i.track(device)
+		return device, nil
+	}
+
+	for _, current := range mountPointsOf(runner, device.path) {
+		if current == mountPoint {
+			device.isMounted = true
+			device.mountPoint = mountPoint
+			device.prepared = true
+			i.track(device)
+			return device, nil
+		}
+	}
+
+	if !device.readOnly {
+		if err := device.prepareFileSystem(options.OnExistingFS); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := device.Mount(mountPoint); err != nil {
+		return nil, err
+	}
+
+	i.track(device)
+	return device, nil
+}
+
+/*
+This method is a variant of `Image.EnsureMounted` that also creates the
+image `name` of `size` megabytes if it's missing, see
+`GetOrCreateImage`.
+*/
+func (c *Connection) EnsureMounted(name string, size uint64, fsType string, mountPoint string, options *MapOptions) (*Device, error) {
+	image, err := c.GetOrCreateImage(name, size)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := image.EnsureMounted(fsType, mountPoint, options)
+	if err != nil {
+		image.Close()
+		return nil, err
+	}
+	return device, nil
+}
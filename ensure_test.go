@@ -0,0 +1,19 @@
+package blockdevice
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectionEnsureMountedClosesImage(t *testing.T) {
+	fakeImages(t, 1024)
+	connection := fakeConnection(&showmappedRunner{err: errors.New("rbd: showmapped failed")})
+
+	if _, err := connection.EnsureMounted("data", 1024, "ext4", "/mnt/data", nil); err == nil {
+		t.Fatalf("EnsureMounted() succeeded, want the showmapped failure")
+	}
+
+	if users := sessionUsers(connection.session); users != 0 {
+		t.Errorf("the image is left open, the session has %d users", users)
+	}
+}
@@ -0,0 +1,54 @@
+package blockdevice
+
+import (
+	"os"
+	"strings"
+)
+
+//Environment variables read by `NewConnectionFromEnv`.
+const (
+	EnvConfigFile = "CEPH_CONF"
+	EnvUser       = "CEPH_USER"
+	EnvCluster    = "CEPH_CLUSTER"
+	EnvKeyring    = "CEPH_KEYRING"
+	EnvArgs       = "CEPH_ARGS"
+)
+
+/*
+This option configures the connection from the environment: CEPH_CONF,
+CEPH_USER (with or without the client. prefix), CEPH_CLUSTER and
+CEPH_KEYRING, and the ceph options of CEPH_ARGS (e.g. "--mon-host
+10.0.0.1 --keyfile /run/secrets/key") applied over the configuration
+file. Unset variables are ignored, options given after it take
+precedence.
+*/
+func WithEnv() ConnectionOption {
+	return func(config *connectionConfig) {
+		if configFile := os.Getenv(EnvConfigFile); configFile != "" {
+			config.configFile = configFile
+		}
+
+		if user := os.Getenv(EnvUser); user != "" {
+			config.username = strings.TrimPrefix(user, "client.")
+		}
+
+		if cluster := os.Getenv(EnvCluster); cluster != "" {
+			config.cluster = cluster
+		}
+
+		if keyring := os.Getenv(EnvKeyring); keyring != "" {
+			config.keyring = keyring
+		}
+
+		config.parseEnv = os.Getenv(EnvArgs) != ""
+	}
+}
+
+/*
+This method creates a connection configured from the environment, see
+`WithEnv`, so containerized deployments need no configuration file
+written. The given `options` override the environment.
+*/
+func NewConnectionFromEnv(options ...ConnectionOption) (*Connection, error) {
+	return NewConnection(append([]ConnectionOption{WithEnv()}, options...)...)
+}
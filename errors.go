@@ -0,0 +1,110 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+//Errors identifying the failures callers usually handle, to be checked
+//with errors.Is, the returned errors keep wrapping their cause. An
+//existing filesystem is reported as an `ExistingFilesystemError`, with
+//its details.
+var (
+	ErrImageNotFound      = errors.New("image not found")
+	ErrImageExists        = errors.New("image already exists")
+	ErrDeviceBusy         = errors.New("device is busy")
+	ErrNotMapped          = errors.New("image is not mapped")
+	ErrAlreadyMounted     = errors.New("device is already mounted")
+	ErrNotMounted         = errors.New("device is not mounted")
+	ErrExistingFilesystem = errors.New("device already holds a filesystem")
+)
+
+//This struct represents an error of one of the kinds above, wrapping
+//its cause if any.
+type kindError struct {
+	message string
+	kind    error
+	cause   error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.cause
+}
+
+/*
+This is a helper method that returns an error of the given kind with
+the formatted message, wrapping `cause` (which can be nil).
+*/
+func kindErrorf(kind error, cause error, format string, args ...interface{}) error {
+	return &kindError{message: fmt.Sprintf(format, args...), kind: kind, cause: cause}
+}
+
+/*
+This is a helper method that tells whether a librbd error reports a
+missing object (-ENOENT).
+*/
+func isNotFoundError(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || librbdErrorCode(err) == -int(syscall.ENOENT) ||
+		stderrContains(err, "no such file")
+}
+
+/*
+This is a helper method that tells whether an error reports a denied
+access (-EACCES or -EPERM), e.g. by the cephx caps of the user.
+*/
+func isAccessDeniedError(err error) bool {
+	if errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "permission denied") || strings.Contains(message, "access denied") ||
+		strings.Contains(message, "ret=-13")
+}
+
+/*
+This is a helper method that tells whether a librbd error reports an
+existing object (-EEXIST).
+*/
+func isExistsError(err error) bool {
+	return errors.Is(err, syscall.EEXIST) || librbdErrorCode(err) == -int(syscall.EEXIST) ||
+		stderrContains(err, "exists")
+}
+
+/*
+This is a helper method that tells whether the standard error of a
+failed command holds `text`, case insensitive.
+*/
+func stderrContains(err error, text string) bool {
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) {
+		return strings.Contains(strings.ToLower(commandErr.Stderr), text)
+	}
+	return false
+}
+
+/*
+This is a helper method that returns the return code of a librbd error
+("rbd: ret=<code>"), zero if it's not one.
+*/
+func librbdErrorCode(err error) int {
+	var code int
+	if err == nil {
+		return 0
+	}
+
+	if _, scanErr := fmt.Sscanf(err.Error(), "rbd: ret=%d", &code); scanErr != nil {
+		return 0
+	}
+	return code
+}
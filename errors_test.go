@@ -0,0 +1,23 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExistingFilesystemError(t *testing.T) {
+	err := fmt.Errorf("Cannot format device, Error: %w", &ExistingFilesystemError{Device: "/dev/rbd0", FileSystemType: "xfs", Expected: "ext4"})
+	if !errors.Is(err, ErrExistingFilesystem) {
+		t.Errorf("errors.Is(%v, ErrExistingFilesystem) = false", err)
+	}
+
+	var existing *ExistingFilesystemError
+	if !errors.As(err, &existing) || existing.FileSystemType != "xfs" {
+		t.Errorf("errors.As(%v) didn't return the details", err)
+	}
+
+	if errors.Is(err, ErrDeviceBusy) {
+		t.Errorf("an existing filesystem is reported as a busy device")
+	}
+}
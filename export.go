@@ -0,0 +1,48 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+)
+
+/*
+This method exports the content of the image (or of its `snapshot` if
+not empty) to the file `path` on the host of the runner of the
+connection. `progress` (which can be nil) is called with the percentage
+exported.
+*/
+func (i *Image) Export(snapshot string, path string, progress ProgressFunc) (err error) {
+	ctx, end := i.observe(context.Background(), OperationExport)
+	defer end(&err)
+
+	if _, err := i.runWithProgress(ctx, progress, "export", "--id", i.username, i.spec(i.name, snapshot), path); err != nil {
+		return fmt.Errorf("Cannot export image: %s to: %s, Error: %w", i.name, path, err)
+	}
+	return nil
+}
+
+/*
+This method creates the image `name` on the connection pool from the
+file `path` on the host of the runner of the connection, as written by
+`Image.Export`. `progress` (which can be nil) is called with the
+percentage imported.
+*/
+func (c *Connection) Import(path string, name string, progress ProgressFunc) (image *Image, err error) {
+	ctx, end := c.observe(context.Background(), OperationImport, name)
+	defer end(&err)
+
+	_, err = c.runWithProgress(ctx, progress, "import", "--id", c.username, path, c.spec(name, ""))
+	if err != nil && isExistsError(err) {
+		return nil, kindErrorf(ErrImageExists, err, "Cannot import image: %s from: %s, Error: %s", name, path, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot import image: %s from: %s, Error: %w", name, path, err)
+	}
+
+	if c.IsDryRun() {
+		return c.plannedImage(name, 0), nil
+	}
+	return NewImage(rbd.GetImage(c.ioContext(), name), c, name)
+}
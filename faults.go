@@ -0,0 +1,120 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+//This struct represents a device-mapper layer on top of a managed device
+//used to inject latency and I/O errors. It's meant for resilience testing
+//only: mount and use the device returned by `Device()` instead of the
+//original one and switch the fault mode at will.
+type FaultInjector struct {
+	device  *Device
+	lower   *Device
+	name    string
+	sectors string
+}
+
+/*
+This method creates a `FaultInjector` named `name` on top of the
+device, which must not be mounted. The injector starts passing I/O
+through untouched.
+*/
+func (d *Device) NewFaultInjector(name string) (*FaultInjector, error) {
+	if d.isMounted {
+		return nil, kindErrorf(ErrDeviceBusy, nil, "Cannot inject faults on device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	sectors, err := d.run("blockdev", "--getsz", d.path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get size of device: %s, Error: %w", d.path, err)
+	}
+
+	injector := &FaultInjector{lower: d, name: name, sectors: sectors}
+	if _, err := d.run("dmsetup", "create", name, "--table", injector.linearTable()); err != nil {
+		return nil, fmt.Errorf("Cannot create fault injection device: %s, Error: %w", name, err)
+	}
+
+	injector.device = d.layer("/dev/mapper/"+name, func() error {
+		if _, err := d.run("dmsetup", "remove", name); err != nil {
+			return fmt.Errorf("Cannot remove fault injection device: %s, Error: %w", name, err)
+		}
+		return nil
+	})
+	injector.device.prepared = d.prepared
+
+	return injector, nil
+}
+
+/*
+Getter method for the device to use while injecting faults, unmapping
+it also unmaps the underlying device.
+*/
+func (f *FaultInjector) Device() *Device {
+	return f.device
+}
+
+func (f *FaultInjector) linearTable() string {
+	return fmt.Sprintf("0 %s linear %s 0", f.sectors, f.lower.path)
+}
+
+/*
+This method replaces the device-mapper table of the injector, in-flight
+I/O is requeued rather than flushed so it also works when the current
+table is failing requests.
+*/
+func (f *FaultInjector) load(table string) error {
+	if _, err := f.lower.run("dmsetup", "suspend", "--noflush", f.name); err != nil {
+		return fmt.Errorf("Cannot suspend device: %s, Error: %w", f.name, err)
+	}
+
+	_, err := f.lower.run("dmsetup", "load", f.name, "--table", table)
+	if _, resumeErr := f.lower.run("dmsetup", "resume", f.name); resumeErr != nil && err == nil {
+		err = resumeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot load fault table on device: %s, Error: %w", f.name, err)
+	}
+	return nil
+}
+
+/*
+This method delays every I/O by `delay` (dm-delay).
+*/
+func (f *FaultInjector) InjectLatency(delay time.Duration) error {
+	milliseconds := strconv.FormatInt(int64(delay/time.Millisecond), 10)
+	return f.load(fmt.Sprintf("0 %s delay %s 0 %s", f.sectors, f.lower.path, milliseconds))
+}
+
+/*
+This method makes the device alternate between `up` periods, where
+I/O works, and `down` periods, where all I/O fails (dm-flakey). Periods
+are rounded down to seconds, with a minimum of one.
+*/
+func (f *FaultInjector) InjectErrors(up time.Duration, down time.Duration) error {
+	seconds := func(period time.Duration) int64 {
+		if period < time.Second {
+			return 1
+		}
+		return int64(period / time.Second)
+	}
+
+	return f.load(fmt.Sprintf("0 %s flakey %s 0 %d %d", f.sectors, f.lower.path, seconds(up), seconds(down)))
+}
+
+/*
+This method makes every I/O on the device fail (dm-error).
+*/
+func (f *FaultInjector) InjectFailure() error {
+	return f.load(fmt.Sprintf("0 %s error", f.sectors))
+}
+
+/*
+This method stops injecting faults, I/O reaches the device untouched.
+*/
+func (f *FaultInjector) Clear() error {
+	return f.load(f.linearTable())
+}
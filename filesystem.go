@@ -0,0 +1,183 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strings"
+)
+
+//This type represents what to do when a device being prepared for
+//mounting already holds a filesystem.
+type ExistingFSPolicy int
+
+const (
+	//Use the existing filesystem if it matches the requested type,
+	//fail otherwise. A device is only formatted when it's empty.
+	ExistingFSReuse ExistingFSPolicy = iota
+	//Fail if the device holds any filesystem.
+	ExistingFSFail
+	//Format the device even if it holds a filesystem, only honoured
+	//when FormatOptions.Force is set.
+	ExistingFSReformat
+)
+
+func (p ExistingFSPolicy) String() string {
+	switch p {
+	case ExistingFSReuse:
+		return "Reuse"
+	case ExistingFSFail:
+		return "Fail"
+	case ExistingFSReformat:
+		return "Reformat"
+	}
+	return fmt.Sprintf("ExistingFSPolicy(%d)", int(p))
+}
+
+/*
+This is a helper method that tells if blkid exited because no
+signature was found on the device.
+*/
+func isNotFoundByBlkid(err error) bool {
+	return exitCode(err) == 2
+}
+
+//This struct represents the error returned when a device that holds a
+//filesystem, or any other signature, would have been formatted, it's
+//an `ErrExistingFilesystem`.
+type ExistingFilesystemError struct {
+	Device         string
+	FileSystemType string
+	Expected       string
+}
+
+func (e *ExistingFilesystemError) Error() string {
+	return fmt.Sprintf("Device: %s already holds a %s signature, expected: %s, refusing to format it without Force", e.Device, e.FileSystemType, e.Expected)
+}
+
+func (e *ExistingFilesystemError) Is(target error) bool {
+	return target == ErrExistingFilesystem
+}
+
+/*
+This method returns the type of the signature found on the device,
+a filesystem or a partition table, or an empty string if there's none.
+*/
+func (d *Device) signature() (string, error) {
+	output, err := d.run("blkid", "-p", "-o", "export", d.path)
+	if err != nil {
+		if isNotFoundByBlkid(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var ptType string
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch key {
+		case "TYPE":
+			return value, nil
+		case "PTTYPE":
+			ptType = value
+		}
+	}
+
+	if ptType != "" {
+		return ptType + " partition table", nil
+	}
+	return "", nil
+}
+
+/*
+This method formats the device if needed according to the given policy.
+The device is never formatted if its current signature can't be
+detected, so a transient blkid failure doesn't destroy data, and a
+device holding any signature is only reformatted with
+`ExistingFSReformat` and `FormatOptions.Force` both set.
+*/
+func (d *Device) prepareFileSystem(policy ExistingFSPolicy) error {
+	current, err := d.signature()
+	if err != nil {
+		return fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	switch {
+	case current == "":
+		err = d.format(false)
+	case policy == ExistingFSReformat && d.formatOptions.Force:
+		err = d.format(true)
+	case policy == ExistingFSReuse && current == d.fileSystemType:
+	default:
+		err = &ExistingFilesystemError{Device: d.path, FileSystemType: current, Expected: d.fileSystemType}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	d.prepared = true
+	return nil
+}
+
+/*
+This method formats the device unless it holds a signature and
+`FormatOptions.Force` isn't set, in which case an
+`ExistingFilesystemError` is returned.
+*/
+func (d *Device) formatIfEmpty() error {
+	current, err := d.signature()
+	if err != nil {
+		return fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	if current != "" && !d.formatOptions.Force {
+		return &ExistingFilesystemError{Device: d.path, FileSystemType: current, Expected: d.fileSystemType}
+	}
+
+	return d.format(current != "")
+}
+
+/*
+This method runs mkfs on the device, `force` overwrites an
+existing filesystem. The device `FormatOptions` are applied.
+*/
+func (d *Device) format(force bool) (err error) {
+	defer d.observe(OperationFormat)(&err)
+
+	if d.readOnly {
+		return fmt.Errorf("Cannot format device:%s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.raw {
+		return fmt.Errorf("Cannot format device:%s, Error: device is mapped raw", d.path)
+	}
+
+	args, err := d.formatOptions.mkfsArgs(d.fileSystemType)
+	if err != nil {
+		return fmt.Errorf("Cannot format device:%s, Error: %w", d.path, err)
+	}
+
+	if force {
+		switch d.fileSystemType {
+		case "ext2", "ext3", "ext4":
+			args = append(args, "-F")
+		default:
+			args = append(args, "-f")
+		}
+	}
+
+	command := "mkfs." + d.fileSystemType
+	if d.fileSystemType == "swap" {
+		command = "mkswap"
+	}
+
+	if err := d.emit(EventPreFormat); err != nil {
+		return err
+	}
+
+	if _, err := d.run(command, append(args, d.path)...); err != nil {
+		return fmt.Errorf("Cannot format device:%s, Error: %w", d.path, err)
+	}
+
+	d.emit(EventPostFormat)
+	return nil
+}
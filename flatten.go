@@ -0,0 +1,43 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+This method flattens a clone: the data still shared with its parent
+snapshot is copied into the image, which is then detached from it so the
+parent can be unprotected and removed. It can take minutes on large
+images, `progress` (which can be nil) is called with the percentage done
+as it goes, from 0 to 100.
+*/
+func (i *Image) Flatten(progress ProgressFunc) error {
+	return i.flatten(context.Background(), progress)
+}
+
+/*
+This is a helper method that flattens the image as `Flatten` does, the
+rbd tool is killed when `ctx` is done.
+*/
+func (i *Image) flatten(ctx context.Context, progress ProgressFunc) (err error) {
+	ctx, end := i.observe(ctx, OperationFlatten)
+	defer end(&err)
+
+	if !i.IsDryRun() {
+		details, err := i.Info()
+		if err != nil {
+			return err
+		}
+
+		if details.Parent == nil {
+			return fmt.Errorf("Cannot flatten image: %s, Error: image has no parent", i.name)
+		}
+	}
+
+	if _, err := i.runWithProgress(ctx, progress, "flatten", "--id", i.username, i.spec(i.name, "")); err != nil {
+		return fmt.Errorf("Cannot flatten image: %s, Error: %w", i.name, err)
+	}
+
+	return i.Refresh()
+}
@@ -0,0 +1,93 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//Default mkfs arguments per filesystem type, discarding a whole thin
+//provisioned rbd image at mkfs time is very slow and pointless.
+var DefaultFormatArgs = map[string][]string{
+	"ext3":  {"-E", "nodiscard,lazy_itable_init=1,lazy_journal_init=1"},
+	"ext4":  {"-E", "nodiscard,lazy_itable_init=1,lazy_journal_init=1"},
+	"xfs":   {"-K"},
+	"btrfs": {"-K"},
+}
+
+//This struct represents the options used to create a filesystem.
+type FormatOptions struct {
+	//Filesystem label.
+	Label string
+	//Block size in bytes.
+	BlockSize int
+	//Inode size in bytes.
+	InodeSize int
+	//Extra mkfs arguments, e.g. "-E", "lazy_itable_init=0,lazy_journal_init=0".
+	Args []string
+	//Don't add the DefaultFormatArgs of the filesystem type.
+	NoDefaults bool
+	//Allow formatting a device that already holds a filesystem.
+	Force bool
+}
+
+/*
+This method returns the mkfs arguments for the given filesystem type.
+*/
+func (o *FormatOptions) mkfsArgs(fsType string) ([]string, error) {
+	var args []string
+	if o == nil {
+		return append(args, DefaultFormatArgs[fsType]...), nil
+	}
+
+	if !o.NoDefaults {
+		args = append(args, DefaultFormatArgs[fsType]...)
+	}
+
+	if o.Label != "" {
+		args = append(args, "-L", o.Label)
+	}
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		if o.BlockSize > 0 {
+			args = append(args, "-b", strconv.Itoa(o.BlockSize))
+		}
+		if o.InodeSize > 0 {
+			args = append(args, "-I", strconv.Itoa(o.InodeSize))
+		}
+	case "xfs":
+		if o.BlockSize > 0 {
+			args = append(args, "-b", "size="+strconv.Itoa(o.BlockSize))
+		}
+		if o.InodeSize > 0 {
+			args = append(args, "-i", "size="+strconv.Itoa(o.InodeSize))
+		}
+	default:
+		if o.BlockSize > 0 || o.InodeSize > 0 {
+			return nil, fmt.Errorf("Block and inode sizes are not supported for: %s", fsType)
+		}
+	}
+
+	return append(args, o.Args...), nil
+}
+
+/*
+This method formats the device with the given options, which are
+recorded on the device and used by later formats. A device holding a
+filesystem is only formatted with `options.Force` set.
+*/
+func (d *Device) FormatWithOptions(options *FormatOptions) error {
+	if options == nil {
+		options = &FormatOptions{}
+	}
+
+	d.formatOptions = *options
+	return d.formatIfEmpty()
+}
+
+/*
+Getter method for formatOptions
+*/
+func (d *Device) GetFormatOptions() FormatOptions {
+	return d.formatOptions
+}
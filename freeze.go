@@ -0,0 +1,101 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+/*
+This method suspends the writes to the mounted filesystem of the device
+(fsfreeze) and flushes it, so it's consistent on the image until `Thaw`
+is called.
+*/
+func (d *Device) Freeze() error {
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot freeze device: %s, Error: device is not mounted", d.path)
+	}
+
+	if d.frozen {
+		return nil
+	}
+
+	if _, err := d.runMounted("fsfreeze", "--freeze", d.mountPoint); err != nil {
+		return fmt.Errorf("Cannot freeze filesystem on: %s, Error: %w", d.mountPoint, err)
+	}
+
+	d.frozen = true
+	return nil
+}
+
+/*
+This method resumes the writes to a filesystem frozen by `Freeze`.
+*/
+func (d *Device) Thaw() error {
+	if !d.frozen {
+		return nil
+	}
+
+	if _, err := d.runMounted("fsfreeze", "--unfreeze", d.mountPoint); err != nil {
+		return fmt.Errorf("Cannot thaw filesystem on: %s, Error: %w", d.mountPoint, err)
+	}
+
+	d.frozen = false
+	return nil
+}
+
+/*
+Getter method for frozen
+*/
+func (d *Device) IsFrozen() bool {
+	return d.frozen
+}
+
+/*
+This method creates a snapshot of the image with the filesystems
+mounted from it on the local host frozen, and its quiesce hooks run
+around it. The filesystems are always thawed, even if the snapshot
+fails.
+*/
+func (i *Image) CreateConsistentSnapshot(name string) error {
+	devices, err := i.findMappedDevices(context.Background(), i.pool, i.name, "")
+	if err != nil {
+		return err
+	}
+
+	runner := i.hostRunner(nil)
+	var mountPoints []string
+	for _, device := range devices {
+		mountPoints = append(mountPoints, mountPointsOf(runner, device.Device)...)
+	}
+
+	return i.quiesced(func() error {
+		var frozen []string
+		thaw := func() []string {
+			var failed []string
+			for _, mountPoint := range frozen {
+				if _, err := runner.Run("fsfreeze", "--unfreeze", mountPoint); err != nil {
+					failed = append(failed, fmt.Sprintf("Cannot thaw filesystem on: %s, Error: %s", mountPoint, err))
+				}
+			}
+			return failed
+		}
+
+		for _, mountPoint := range mountPoints {
+			if _, err := runner.Run("fsfreeze", "--freeze", mountPoint); err != nil {
+				failed := append([]string{fmt.Sprintf("Cannot freeze filesystem on: %s, Error: %s", mountPoint, err)}, thaw()...)
+				return fmt.Errorf("%s", strings.Join(failed, "; "))
+			}
+			frozen = append(frozen, mountPoint)
+		}
+
+		err := i.createSnapshot(name)
+		if failed := thaw(); len(failed) > 0 {
+			if err != nil {
+				failed = append([]string{err.Error()}, failed...)
+			}
+			return fmt.Errorf("%s", strings.Join(failed, "; "))
+		}
+		return err
+	})
+}
@@ -0,0 +1,110 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/*
+This is a helper method that returns the exit code of a failed
+command, or -1 if it didn't run.
+*/
+func exitCode(err error) int {
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return -1
+}
+
+/*
+This method checks the filesystem of the device, repairing it if
+`repair` is set. The device must not be mounted.
+*/
+func (d *Device) Fsck(repair bool) error {
+	if d.isMounted {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot check device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	if repair && d.readOnly {
+		return fmt.Errorf("Cannot repair device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	var err error
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+		mode := "-n"
+		if repair {
+			mode = "-y"
+		}
+
+		//1 and 2 mean that errors were found and corrected
+		if _, err = d.run("e2fsck", "-f", mode, d.path); err != nil && repair {
+			if code := exitCode(err); code == 1 || code == 2 {
+				err = nil
+			}
+		}
+	case "xfs":
+		if repair {
+			_, err = d.run("xfs_repair", d.path)
+		} else {
+			_, err = d.run("xfs_repair", "-n", d.path)
+		}
+	case "btrfs":
+		if repair {
+			_, err = d.run("btrfs", "check", "--repair", d.path)
+		} else {
+			_, err = d.run("btrfs", "check", "--readonly", d.path)
+		}
+	default:
+		mode := "-n"
+		if repair {
+			mode = "-y"
+		}
+		_, err = d.run("fsck", "-t", d.fileSystemType, mode, d.path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Filesystem check failed on device: %s, Error: %w", d.path, err)
+	}
+	return nil
+}
+
+/*
+This method tells if the filesystem was cleanly unmounted. Only ext
+filesystems record it, the others (e.g. xfs replays its log on mount)
+are always reported as clean.
+*/
+func (d *Device) isClean() (bool, error) {
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+		output, err := d.run("dumpe2fs", "-h", d.path)
+		if err != nil {
+			return false, err
+		}
+
+		for _, line := range strings.Split(output, "\n") {
+			if strings.HasPrefix(line, "Filesystem state:") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "Filesystem state:")) == "clean", nil
+			}
+		}
+		return false, parseFailure("dumpe2fs", output, fmt.Errorf("no filesystem state found"))
+	}
+
+	return true, nil
+}
+
+/*
+This method repairs the filesystem before mounting if it was not
+cleanly unmounted, it returns the error of a failed repair.
+*/
+func (d *Device) fsckBeforeMount() error {
+	clean, err := d.isClean()
+	if err != nil || clean {
+		return nil
+	}
+
+	return d.Fsck(true)
+}
@@ -0,0 +1,44 @@
+package blockdevice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+//This struct answers a dirty filesystem failing its repair and records
+//the mount options.
+type dirtyFilesystemRunner struct {
+	options string
+}
+
+func (r *dirtyFilesystemRunner) Run(name string, args ...string) (string, error) {
+	switch name {
+	case "dumpe2fs":
+		return "Filesystem state:         not clean", nil
+	case "e2fsck":
+		return "", errors.New("e2fsck: unable to repair")
+	case "mount":
+		r.options = args[3]
+	}
+	return "", nil
+}
+
+func TestMountFsckFailure(t *testing.T) {
+	runner := &dirtyFilesystemRunner{}
+	device := &Device{path: "/dev/rbd0", fileSystemType: "ext4", fsckOnMount: true, prepared: true,
+		mountOptions: []string{"rw", "discard"}, runner: runner}
+
+	mounted, err := device.Mount("/mnt/data")
+	if mounted != "/mnt/data" || err == nil {
+		t.Fatalf("Mount() = %q, %v, want a read-only mount and the repair error", mounted, err)
+	}
+
+	if runner.options != "ro,noload,discard" {
+		t.Errorf("mounted with %q, want the journal replay disabled", runner.options)
+	}
+
+	if !device.mountReadOnly || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("the device isn't reported mounted read-only: %v", err)
+	}
+}
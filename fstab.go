@@ -0,0 +1,155 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//This struct represents the options used to persist a mount on fstab.
+type FstabOptions struct {
+	//fstab file (DefaultFstabPath if empty).
+	Path string
+	//Identify the filesystem by UUID=<uuid> instead of the udev
+	//symlink (/dev/rbd/<pool>/<image>).
+	ByUUID bool
+	//Mount at boot through fstab, otherwise the entry is noauto and
+	//mounted by the rbdmap service once the image is mapped.
+	Auto bool
+	//Dump and fsck pass fields.
+	Dump int
+	Pass int
+}
+
+/*
+This method returns the fstab source identifying the device.
+*/
+func (d *Device) fstabSource(byUUID bool) (string, error) {
+	if byUUID {
+		uuid, err := d.GetUUID()
+		if err != nil {
+			return "", err
+		}
+
+		if uuid == "" {
+			return "", fmt.Errorf("Cannot persist device: %s, Error: filesystem has no UUID", d.path)
+		}
+		return "UUID=" + uuid, nil
+	}
+
+	symlink := d.symlinkPath()
+	if symlink == "" || !d.exists(symlink) {
+		return "", fmt.Errorf("Cannot persist device: %s, Error: no stable /dev/rbd symlink, use ByUUID", d.path)
+	}
+	return symlink, nil
+}
+
+/*
+This method returns the fstab sources that may identify the device.
+*/
+func (d *Device) fstabSources() map[string]bool {
+	sources := map[string]bool{d.path: true}
+	if symlink := d.symlinkPath(); symlink != "" {
+		sources[symlink] = true
+	}
+
+	if uuid, err := d.GetUUID(); err == nil && uuid != "" {
+		sources["UUID="+uuid] = true
+	}
+	return sources
+}
+
+/*
+This method writes the fstab entry of the mounted device on its host,
+replacing any previous entry of the device or its mountpoint, so the
+mount survives reboots along with the rbdmap service (see
+`Image.PersistMapping`). `options` can be nil.
+*/
+func (d *Device) PersistToFstab(options *FstabOptions) error {
+	if options == nil {
+		options = &FstabOptions{}
+	}
+
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot persist device: %s, Error: device is not mounted", d.path)
+	}
+
+	path := options.Path
+	if path == "" {
+		path = DefaultFstabPath
+	}
+
+	source, err := d.fstabSource(options.ByUUID)
+	if err != nil {
+		return err
+	}
+
+	mountOptions := []string{"_netdev"}
+	if !options.Auto {
+		mountOptions = append(mountOptions, "noauto")
+	}
+
+	if d.mountReadOnly {
+		mountOptions = append(mountOptions, "ro")
+	}
+
+	mountOptions = append(mountOptions, managedMountOptions(withoutAccessMode(d.mountOptions))...)
+
+	lines, err := readHostFile(d.runner, path)
+	if err != nil {
+		return err
+	}
+
+	sources := d.fstabSources()
+	var kept []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") &&
+			(sources[fields[0]] || fields[1] == d.mountPoint) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	entry := strings.Join([]string{source, d.mountPoint, d.fileSystemType, strings.Join(mountOptions, ","),
+		strconv.Itoa(options.Dump), strconv.Itoa(options.Pass)}, " ")
+	if err := writeHostFile(d.runner, path, append(kept, entry)); err != nil {
+		return err
+	}
+
+	d.fstabPath = path
+	return nil
+}
+
+/*
+This method removes the fstab entries of the device from the fstab file
+it was persisted to (DefaultFstabPath if it was not).
+*/
+func (d *Device) RemoveFromFstab() error {
+	path := d.fstabPath
+	if path == "" {
+		path = DefaultFstabPath
+	}
+
+	lines, err := readHostFile(d.runner, path)
+	if err != nil {
+		return err
+	}
+
+	sources := d.fstabSources()
+	var kept []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && sources[fields[0]] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if len(kept) < len(lines) {
+		if err := writeHostFile(d.runner, path, kept); err != nil {
+			return err
+		}
+	}
+
+	d.fstabPath = ""
+	return nil
+}
@@ -3,12 +3,14 @@
 package blockdevice
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ceph/go-ceph/rados"
 	"github.com/ceph/go-ceph/rbd"
-	"os/exec"
-	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -16,13 +18,37 @@ const (
 	DefaultFileSystemType = "xfs"
 )
 
-//This struct represents a connection to the ceph cluster
+//This struct represents a connection to the ceph cluster, it can be
+//shared by several goroutines: its settings are guarded and images can
+//be opened concurrently. An `Image` or a `Device` must not be used by
+//several goroutines at once, and `Shutdown` must not be called while
+//operations are in progress.
 type Connection struct {
 	*rados.Conn
-	context  *rados.IOContext
-	pool     string
-	username string
-	cluster  string
+	context          *rados.IOContext
+	pool             string
+	namespace        string
+	username         string
+	cluster          string
+	configFile       string
+	config           *connectionConfig
+	policy           *Policy
+	quiesceHooks     map[string][]quiesceRegistration
+	poolDefaults     map[string]*PoolDefaults
+	log              Logger
+	eventHandlers    map[Event][]EventHandler
+	runner           CommandRunner
+	commandTimeout   time.Duration
+	capacityFraction float64
+	retryPolicy      *RetryPolicy
+	dryRun           *Plan
+	tracker          *deviceTracker
+	pools            *poolHandles
+	parent           *Connection
+	watchdog         *reconnectWatchdog
+	session          *radosSession
+	//guards the settings above, shared by the copies of the connection
+	mutex *sync.RWMutex
 }
 
 //This struct represents a RBD Image
@@ -30,7 +56,9 @@ type Image struct {
 	*rbd.Image
 	*rbd.ImageInfo
 	*Connection
-	name string
+	name    string
+	details *ImageDetails
+	session *radosSession
 }
 
 //This structure represents a local device mapped on the system.
@@ -39,6 +67,33 @@ type Device struct {
 	isMounted      bool
 	fileSystemType string
 	mountPoint     string
+	readOnly       bool
+	image          *Image
+	backend        Backend
+	runner         CommandRunner
+	snapshot       string
+	parent         *Device
+	release        func() error
+	onExistingFS   ExistingFSPolicy
+	prepared       bool
+	mountOptions   []string
+	mountReadOnly  bool
+	fsckOnMount    bool
+	formatOptions  FormatOptions
+	swap           bool
+	raw            bool
+	disk           *Device
+	partition      int
+	ownsDisk       bool
+	partitions     []*Device
+	frozen         bool
+	fstabPath      string
+	propagation    Propagation
+	namespace      *MountNamespace
+	bindMounts     []string
+	selinux        *SELinuxOptions
+	relabeled      bool
+	group          *VolumeGroup
 }
 
 //Getter method for path
@@ -53,50 +108,179 @@ func (d *Device) GetMountPoint() string {
 	return d.mountPoint
 }
 
+/*
+This is a helper method that runs a command on the host owning
+the device.
+*/
+func (d *Device) run(name string, args ...string) (string, error) {
+	return runnerOrLocal(d.runner).Run(name, args...)
+}
+
+/*
+Getter method for image
+*/
+func (d *Device) GetImage() *Image {
+	return d.image
+}
+
+/*
+Getter method for backend
+*/
+func (d *Device) GetBackend() Backend {
+	return d.backend
+}
+
+/*
+This method enables or disables the filesystem check (and repair)
+run before mounting a filesystem that was not cleanly unmounted.
+*/
+func (d *Device) SetFsckOnMount(enabled bool) {
+	d.fsckOnMount = enabled
+}
+
+/*
+Getter method for mountOptions
+*/
+func (d *Device) GetMountOptions() []string {
+	return d.mountOptions
+}
+
+/*
+Getter method for readOnly
+*/
+func (d *Device) IsReadOnly() bool {
+	return d.readOnly
+}
+
 /*
 This method mounts a `Device` on the given Mountpoint, it returns
-and error if is already mounted or has been already formatted.
+and error if is already mounted. The first time a device is mounted
+it's formatted as required by its `ExistingFSPolicy`.
+
+Mount `options` (noatime, discard, ...) given on the call replace the
+ones recorded on the device, which are used otherwise.
+
+If the device has fsck on mount enabled and the filesystem was not
+cleanly unmounted it's repaired first, when the repair fails the
+device is mounted read-only, with the options returned by
+`readOnlyMountOptions` so the journal isn't replayed, and an error is
+returned along with the mountpoint.
+
+Read-only devices are never formatted and are mounted with the
+options returned by `readOnlyMountOptions`.
+
+The mount is performed inside the mount namespace of the device, if
+any, and gets its propagation and SELinux contexts, the mountpoint is
+relabeled after the first mount if requested.
 */
-func (d *Device) Mount(mountPoint string) (string, error) {
+func (d *Device) Mount(mountPoint string, options ...string) (mounted string, err error) {
+	defer d.observe(OperationMount)(&err)
+
+	if d.raw {
+		return "", fmt.Errorf("Cannot mount device: %s, Error: device is mapped raw", d.path)
+	}
+
 	if d.isMounted && d.mountPoint == mountPoint {
-		return "", fmt.Errorf("Device: %s is already mounted on path: %s", d.path, d.mountPoint)
+		return "", kindErrorf(ErrAlreadyMounted, nil, "Device: %s is already mounted on path: %s", d.path, d.mountPoint)
 	}
 
-	if !d.IsAlreadyFormatted() {
-		if err := d.Format(); err != nil {
+	if d.image != nil {
+		if err := d.image.checkMountPolicy(d.image, d); err != nil {
+			return "", err
+		}
+
+		if err := d.image.emit(&EventInfo{Event: EventPreMount, Image: d.image, Device: d, MountPoint: mountPoint}); err != nil {
 			return "", err
 		}
 	}
 
-	if _, err := RunCommand("mount", "-t", d.fileSystemType, d.path, mountPoint); err != nil {
+	if len(options) > 0 {
+		d.mountOptions = options
+	}
+
+	mountOptions := d.mountOptions
+	if d.readOnly {
+		mountOptions = append([]string{readOnlyMountOptions(d.fileSystemType)}, mountOptions...)
+	} else if !d.prepared {
+		if err := d.prepareFileSystem(d.onExistingFS); err != nil {
+			return "", err
+		}
+	}
+
+	var fsckErr error
+	if !d.readOnly && d.fsckOnMount {
+		if fsckErr = d.fsckBeforeMount(); fsckErr != nil {
+			mountOptions = append([]string{readOnlyMountOptions(d.fileSystemType)}, withoutAccessMode(mountOptions)...)
+		}
+	}
+
+	mountOptions = append(mountOptions, d.selinux.mountOptions()...)
+
+	args := []string{"-t", d.fileSystemType}
+	if len(mountOptions) > 0 {
+		args = append(args, "-o", strings.Join(mountOptions, ","))
+	}
+
+	var policy *RetryPolicy
+	if d.image != nil {
+		policy = d.image.GetRetryPolicy()
+	}
+
+	err = policy.do(func() error {
+		_, err := d.runMounted("mount", append(args, d.path, mountPoint)...)
+		return err
+	})
+
+	if err != nil {
 		return "", err
 	}
 
 	d.isMounted = true
+	d.mountPoint = mountPoint
+	d.mountReadOnly = false
+	for _, option := range strings.Split(strings.Join(mountOptions, ","), ",") {
+		if option == "ro" {
+			d.mountReadOnly = true
+		}
+	}
+
+	if err := d.SetPropagation(d.propagation); err != nil {
+		return mountPoint, err
+	}
+
+	if d.selinux != nil && d.selinux.Relabel && !d.relabeled && !d.mountReadOnly {
+		if err := d.Relabel(); err != nil {
+			return mountPoint, err
+		}
+	}
+
+	d.emit(EventPostMount)
+
+	if fsckErr != nil {
+		return mountPoint, fmt.Errorf("Device: %s mounted read-only on: %s, Error: %s", d.path, mountPoint, fsckErr)
+	}
 	return mountPoint, nil
 }
 
 /*
-This method formats a given device with the specific filesystem type
+This method formats a given device with the specific filesystem type,
+an `ExistingFilesystemError` is returned if the device holds a filesystem
+and `FormatOptions.Force` isn't set.
 */
 func (d *Device) Format() error {
-	mkfs, err := exec.LookPath("mkfs." + d.fileSystemType)
-	if err != nil {
-		return fmt.Errorf("Cannot format device:%s, Error: %s", d.path, err)
-	}
-
-	if _, err = RunCommand(mkfs, d.path); err != nil {
-		return fmt.Errorf("Cannot format device:%s, Error: %s", d.path, err)
-	}
-	return nil
+	return d.formatIfEmpty()
 }
 
 /*
-This method returns the filesystem type using blkid of a given device.
+This method returns the filesystem type using blkid of a given device,
+an empty string is returned if the device holds no filesystem.
 */
 func (d *Device) GetFileSystemType() (string, error) {
-	format, err := RunCommand("blkid", "-o", "value", "-s", "TYPE", d.path)
+	format, err := d.run("blkid", "-p", "-o", "value", "-s", "TYPE", d.path)
 	if err != nil {
+		if isNotFoundByBlkid(err) {
+			return "", nil
+		}
 		return "", err
 	}
 	return format, nil
@@ -117,58 +301,217 @@ func (d *Device) IsAlreadyFormatted() bool {
 This method unmaps a device using the 'rbd unmap' command
 */
 func (d *Device) UnMap() error {
-	if d.isMounted {
-		if err := d.UnMount(); err != nil {
-			return err
-		}
-	}
-
-	if _, err := RunCommand("rbd", "unmap", d.path); err != nil {
-		return err
-	}
-	return nil
+	return d.UnMapWithOptions(nil)
 }
 
 /*
 This method unmounts the device from the current mounting path.
 */
 func (d *Device) UnMount() error {
-	if _, err := RunCommand("unmount", d.path); err != nil {
-		return err
-	}
-	return nil
+	return d.UnMountWithOptions(nil)
 }
 
 /*
 This method is a contructor for `Device` Objects.
+
+The `options` (which can be nil) are passed to `rbd map`. When
+`options.ReadOnly` is set, or a snapshot is mapped, the format step is
+skipped and the device is mounted read-only, so no write ever reaches
+the image. With `options.Overlay` the image is mapped read-only too, but
+the returned device is a writable throwaway layer on top of it. With
+`options.Partition` the given partition is used instead of the whole
+device.
+
+The setup is transactional: when a step fails once the image is mapped
+the device is unmounted and unmapped, and the original error is
+returned with the cleanup failures, if any, attached.
 */
-func NewDevice(image *Image, fsType string, mountPoint string) (*Device, error) {
-	device, err := RunCommand("rbd", "map", "--id", image.username, "--pool", image.pool, image.name)
-	if err != nil {
-		return nil, err
+func NewDevice(image *Image, fsType string, mountPoint string, options *MapOptions) (*Device, error) {
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	if options.Overlay != nil {
+		readOnly := *options
+		readOnly.ReadOnly = true
+		options = &readOnly
 	}
 
 	if fsType == "" {
 		fsType = DefaultFileSystemType
 	}
 
-	new_device := &Device{device, false, fsType, mountPoint}
-
-	if err = new_device.Format(); err != nil {
+	new_device, err := mapDevice(image, fsType, options)
+	if err != nil {
 		return nil, err
 	}
 
+	if options.Partition > 0 {
+		partition, err := new_device.partitionDevice(options.Partition, fsType, options.UdevTimeout)
+		if err != nil {
+			return nil, new_device.rollback(err)
+		}
+		partition.ownsDisk = true
+		partition.formatOptions = new_device.formatOptions
+		new_device = partition
+	}
+
+	if options.Overlay != nil {
+		overlay, err := new_device.overlay(options.Overlay)
+		if err != nil {
+			return nil, new_device.rollback(err)
+		}
+		new_device = overlay
+	}
+
+	if !new_device.readOnly {
+		if err = new_device.prepareFileSystem(options.OnExistingFS); err != nil {
+			return nil, new_device.rollback(err)
+		}
+	}
+
 	if mountPoint != "" {
 		if _, err = new_device.Mount(mountPoint); err != nil {
-			return nil, err
+			return nil, new_device.rollback(err)
 		}
 
 		new_device.isMounted = true
 	}
 
+	image.track(new_device)
 	return new_device, nil
 }
 
+/*
+This is a helper method that maps the image as set by `options`, and
+waits for its device nodes, the filesystem is left untouched.
+*/
+func mapDevice(image *Image, fsType string, options *MapOptions) (*Device, error) {
+	runner := image.hostRunner(options.Runner)
+	if err := image.checkMapPolicy(image, fsType, runner); err != nil {
+		return nil, err
+	}
+
+	if err := image.emit(&EventInfo{Event: EventPreMap, Image: image}); err != nil {
+		return nil, err
+	}
+
+	var device string
+	var backend Backend
+	var failed error
+	err := image.GetRetryPolicy().do(func() error {
+		//a map that timed out may have mapped the image anyway, it's not
+		//mapped twice
+		if errors.Is(failed, ErrCommandTimeout) {
+			if mapped := image.mappedDevice(runner, options.backend(), options.Snapshot); mapped != "" {
+				device, backend = mapped, options.backend()
+				return nil
+			}
+		}
+
+		device, backend, failed = mapImage(image, runner, options)
+		return failed
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if image.IsDryRun() {
+		device = plannedDevicePath(image, options.Snapshot)
+	}
+
+	new_device := newMappedDevice(image, device, backend, fsType, runner, options)
+	if err = new_device.waitForUdev(options.UdevTimeout); err != nil {
+		return nil, new_device.rollback(err)
+	}
+
+	new_device.emit(EventPostMap)
+	return new_device, nil
+}
+
+/*
+This is a helper method that returns the `Device` of the image mapped
+on `path` as set by `options`.
+*/
+func newMappedDevice(image *Image, path string, backend Backend, fsType string, runner CommandRunner, options *MapOptions) *Device {
+	new_device := &Device{
+		path:           path,
+		fileSystemType: fsType,
+		readOnly:       options.ReadOnly || options.Snapshot != "",
+		image:          image,
+		backend:        backend,
+		runner:         runner,
+		snapshot:       options.Snapshot,
+		onExistingFS:   options.OnExistingFS,
+		mountOptions:   options.MountOptions,
+		fsckOnMount:    options.FsckOnMount,
+		propagation:    options.Propagation,
+		namespace:      options.MountNamespace,
+		selinux:        options.SELinux,
+	}
+
+	if options.Format != nil {
+		new_device.formatOptions = *options.Format
+	}
+
+	if options.Label != "" {
+		new_device.formatOptions.Label = options.Label
+	}
+	return new_device
+}
+
+/*
+This is a helper method that undoes the partial setup of the device
+after `err`: it's unmounted if needed and unmapped, along with the
+devices it's layered on. `err` is returned with the cleanup failures
+attached.
+*/
+func (d *Device) rollback(err error) error {
+	var failed []string
+	if d.isMounted {
+		if cleanupErr := d.UnMount(); cleanupErr != nil {
+			failed = append(failed, cleanupErr.Error())
+		}
+	}
+
+	if cleanupErr := d.UnMap(); cleanupErr != nil {
+		failed = append(failed, cleanupErr.Error())
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w, Rollback error: %s", err, strings.Join(failed, "; "))
+	}
+	return err
+}
+
+/*
+This is a helper method that returns a `Device` layered on top of the
+device (device-mapper targets, loop devices ...), unmapping it calls
+`release` and then unmaps the device.
+*/
+func (d *Device) layer(path string, release func() error) *Device {
+	return &Device{
+		path:           path,
+		fileSystemType: d.fileSystemType,
+		mountPoint:     d.mountPoint,
+		readOnly:       d.readOnly,
+		image:          d.image,
+		backend:        d.backend,
+		runner:         d.runner,
+		parent:         d,
+		release:        release,
+		onExistingFS:   d.onExistingFS,
+		mountOptions:   d.mountOptions,
+		fsckOnMount:    d.fsckOnMount,
+		formatOptions:  d.formatOptions,
+		raw:            d.raw,
+		propagation:    d.propagation,
+		namespace:      d.namespace,
+		selinux:        d.selinux,
+	}
+}
+
 /*
 This is a helper method that transform units
 from bytes to megas.
@@ -178,24 +521,63 @@ func toMegs(size uint64) uint64 {
 }
 
 /*
-This is a helper method for running a command and returning
-the output.
+This is a helper method that returns the mount options used for
+read-only devices, these also disable the journal/log replay that
+would otherwise write to the device on a dirty filesystem.
+*/
+func readOnlyMountOptions(fsType string) string {
+	switch fsType {
+	case "ext3", "ext4":
+		return "ro,noload"
+	case "xfs":
+		return "ro,norecovery,nouuid"
+	}
+	return "ro"
+}
+
+/*
+This is a helper method for running a command on the local host and
+returning the output, see `CommandRunner` for the pluggable runners.
 */
 func RunCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	out, err := cmd.Output()
-	return strings.Trim(string(out), " \n"), err
+	return runProcess(context.Background(), nil, name, args...)
 }
 
 /*
 This method creates a new rados device (if available on the system), formats
-it on the given `fsType` and mount it on the given `mountPoint`
+it on the given `fsType` and mount it on the given `mountPoint`.
+
+The krbd mapping can be tuned through `options`, which can be nil, an
+existing filesystem is handled as set by `options.OnExistingFS`. Nothing
+is left mapped or mounted when an error is returned, see `NewDevice`.
+*/
+func (i *Image) MapToDevice(fsType string, mountPoint string, options *MapOptions) (*Device, error) {
+	return i.mapToDevice(context.Background(), fsType, mountPoint, options)
+}
+
+/*
+This is a helper method that maps the image as `MapToDevice` does, the
+commands are run with `ctx`.
 */
-func (i *Image) MapToDevice(fsType string, mountPoint string) (*Device, error) {
-	device, err := NewDevice(i, fsType, mountPoint)
+func (i *Image) mapToDevice(ctx context.Context, fsType string, mountPoint string, options *MapOptions) (device *Device, err error) {
+	ctx, end := i.observe(ctx, OperationMap)
+	defer end(&err)
+
+	bound := MapOptions{}
+	if options != nil {
+		bound = *options
+	}
+	runner := bound.Runner
+	if runner == nil {
+		runner = i.GetRunner()
+	}
+	bound.Runner = bindRunner(runner, ctx)
+
+	device, err = NewDevice(i, fsType, mountPoint, &bound)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot create new device for image: %s, Error: %s", i.name, err)
+		return nil, fmt.Errorf("Cannot create new device for image: %s, Error: %w", i.name, err)
 	}
+	device.unbindContext()
 	return device, err
 }
 
@@ -204,30 +586,52 @@ This methods returns the current device path of a given
 device is if mapped, otherwise it returns an empty string
 */
 func (i *Image) IsAlreadyMapped() string {
-	devices, err := i.GetMappedDevices()
-	if err != nil {
-		return ""
-	}
+	return i.mappedOn(context.Background())
+}
 
-	if path, ok := devices[i.name]; ok {
-		return path
+/*
+This is a helper method that returns the device the image is mapped on
+like `IsAlreadyMapped`, the rbd tool is run with `ctx`.
+*/
+func (i *Image) mappedOn(ctx context.Context) string {
+	devices, err := i.findMappedDevices(ctx, i.pool, i.name, "")
+	if err != nil || len(devices) == 0 {
+		return ""
 	}
 
-	return ""
+	return devices[0].Device
 }
 
 /*
 This is a constructor for `Image`, this also opens an image descriptor,
-and performs an Stat on it.
+and performs an Stat on it. The IO context of the connection is kept
+until the image is closed, even if the connection reconnects.
 */
 func NewImage(image *rbd.Image, connection *Connection, name string) (*Image, error) {
-	if err := image.Open(true); err != nil {
+	session, _ := connection.acquireContext()
+	return newImage(image, connection, name, session)
+}
+
+/*
+This is a helper method that opens the image as `NewImage` does, on the
+IO context of the acquired `session`, which is done if it fails.
+*/
+func newImage(image *rbd.Image, connection *Connection, name string, session *radosSession) (*Image, error) {
+	start := time.Now()
+	err := image.Open(true)
+	connection.logCall("open", name, start, err)
+	if err != nil {
+		session.done()
 		return nil, err
 	}
 
+	start = time.Now()
 	stat, err := image.Stat()
+	connection.logCall("stat", name, start, err)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot state image: %s, Error: %s", name, err)
+		image.Close()
+		session.done()
+		return nil, fmt.Errorf("Cannot state image: %s, Error: %w", name, err)
 	}
 
 	return &Image{
@@ -235,51 +639,196 @@ func NewImage(image *rbd.Image, connection *Connection, name string) (*Image, er
 		stat,
 		connection,
 		name,
+		nil,
+		session,
 	}, nil
 }
 
+/*
+Getter method for name
+*/
+func (i *Image) GetName() string {
+	return i.name
+}
+
+/*
+Getter method for pool
+*/
+func (i *Image) GetPool() string {
+	return i.pool
+}
+
+/*
+This method closes the librbd handle of the image, it's defined so it
+isn't shadowed by `Connection.Close`, and releases its rados session.
+The images planned in dry-run mode have no handle to close.
+*/
+func (i *Image) Close() error {
+	i.session.done()
+	i.session = nil
+	if i.Image == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := i.Image.Close()
+	i.logCall("close", i.name, start, err)
+	return err
+}
+
+//Opens the images looked up by name, replaced by the tests running
+//without a cluster.
+var imageOpener = (*Connection).openImageByName
+
 /*
 This method retrieves an image from the pool given
 the `name`
 */
 func (c *Connection) GetImageByName(name string) (*Image, error) {
-	image := rbd.GetImage(c.context, name)
+	return imageOpener(c, name)
+}
+
+/*
+This is a helper method that opens the image `name` of the pool with
+librbd, see `GetImageByName`.
+*/
+func (c *Connection) openImageByName(name string) (*Image, error) {
+	session, context := c.acquireContext()
+	image := rbd.GetImage(context, name)
 	if image == nil {
-		return nil, fmt.Errorf("Image:%s not found on pool:%s", name, c.pool)
+		session.done()
+		return nil, kindErrorf(ErrImageNotFound, nil, "Image:%s not found on pool:%s", name, c.pool)
 	}
 
-	return NewImage(image, c, name)
+	found, err := newImage(image, c, name, session)
+	if err != nil && isNotFoundError(err) {
+		return nil, kindErrorf(ErrImageNotFound, err, "Image:%s not found on pool:%s", name, c.pool)
+	}
+	return found, err
 }
 
 /*
 This method tries to fetch the given `name` from the ceph pool,
-if is not found it creates a new one using the given `size` parameter.
+if is not found it creates a new one using the given `size` parameter
+in megabytes (see `GetOrCreateImageSize` for a `Size`), applying the
+defaults registered for the pool (see `SetPoolDefaults`) and the
+capacity check of the connection (see `SetCapacityFraction`).
 */
 func (c *Connection) GetOrCreateImage(name string, size uint64) (*Image, error) {
-	if image, _ := c.GetImageByName(name); image != nil {
+	return c.GetOrCreateImageWithOptions(name, size, nil)
+}
+
+/*
+This method is a variant of `GetOrCreateImage` taking the size of the
+image as a `Size`, e.g. `MustParseSize("25GiB")`, rounded up to
+megabytes.
+*/
+func (c *Connection) GetOrCreateImageSize(name string, size Size) (*Image, error) {
+	return c.GetOrCreateImage(name, size.Megabytes())
+}
+
+/*
+This method is a variant of `GetOrCreateImage` creating the image as set
+by `options` (which can be nil), with `options.GrowToSize` an existing
+image smaller than `size` megabytes is grown to it, so the image is
+ensured to be at least that large.
+*/
+func (c *Connection) GetOrCreateImageWithOptions(name string, size uint64, options *CreateImageOptions) (*Image, error) {
+	image, _ := c.GetImageByName(name)
+	if image == nil {
+		return c.CreateImageWithOptions(name, size, options)
+	}
+
+	if options == nil || !options.GrowToSize || toMegs(size) <= image.ImageInfo.Size {
 		return image, nil
 	}
 
-	new_image, err := rbd.Create(c.context, name, toMegs(size))
+	fraction := options.CapacityFraction
+	if fraction == 0 {
+		fraction = c.GetCapacityFraction()
+	}
+
+	if err := c.checkCapacity(size-image.ImageInfo.Size/toMegs(1), fraction); err != nil {
+		image.Close()
+		return nil, err
+	}
+
+	if err := image.Grow(size); err != nil {
+		image.Close()
+		return nil, err
+	}
+	return image, nil
+}
+
+/*
+This is a helper method that returns the IO context of the connection
+pool.
+*/
+func (c *Connection) ioContext() *rados.IOContext {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.context
+}
+
+/*
+Creates a new connection to a Ceph cluster as set by `options`
+(`WithUser`, `WithPool` ...), this connection could be shutdown by
+defering the `Shutdown` method.
+*/
+func NewConnection(options ...ConnectionOption) (*Connection, error) {
+	return newConnection(newConnectionConfig(options), nil)
+}
+
+/*
+This is a helper method that creates a connection, connecting to the
+cluster as described by the retry `policy` (which can be nil).
+*/
+func newConnection(config *connectionConfig, policy *RetryPolicy) (*Connection, error) {
+	var conn *rados.Conn
+	err := policy.do(func() error {
+		var err error
+		conn, err = connect(config, nil)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	context, err := conn.OpenIOContext(config.pool)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot create image:%s of size:%d on pool: %s, Error: %s", name, toMegs(size), c.pool, err)
+		return nil, fmt.Errorf("Error opening a IO Context with ceph, Error; %s", err)
 	}
 
-	return NewImage(new_image, c, name)
+	return &Connection{
+		Conn:        conn,
+		context:     context,
+		pool:        config.pool,
+		username:    config.username,
+		cluster:     config.cluster,
+		configFile:  config.configFile,
+		config:      config,
+		retryPolicy: policy,
+		tracker:     &deviceTracker{},
+		session:     &radosSession{},
+		pools:       &poolHandles{handles: make(map[string]*Connection)},
+		mutex:       &sync.RWMutex{},
+	}, nil
 }
 
 /*
-Creates a new connection to a Ceph cluster, this connection
-could be shutdown by defering the `Shutdown` method.
+This is a helper method that connects to a Ceph cluster as described by
+`config`, the given configuration `overrides` (which can be nil) take
+precedence over its options.
 */
-func NewConnection(username string, pool string, cluster string, configFile string) (*Connection, error) {
+func connect(config *connectionConfig, overrides map[string]string) (*rados.Conn, error) {
 	var conn *rados.Conn
 	var err error
 
-	if cluster != "" && username != "" {
-		conn, err = rados.NewConnWithClusterAndUser(cluster, username)
-	} else if username != "" {
-		conn, err = rados.NewConnWithUser(username)
+	if config.cluster != "" && config.username != "" {
+		conn, err = rados.NewConnWithClusterAndUser(config.cluster, config.username)
+	} else if config.username != "" {
+		conn, err = rados.NewConnWithUser(config.username)
 	} else {
 		conn, err = rados.NewConn()
 	}
@@ -288,9 +837,9 @@ func NewConnection(username string, pool string, cluster string, configFile stri
 		return nil, fmt.Errorf("Error creating a connection with ceph, Error: %s", err)
 	}
 
-	if configFile != "" {
-		err = conn.ReadConfigFile(configFile)
-	} else {
+	if config.configFile != "" {
+		err = conn.ReadConfigFile(config.configFile)
+	} else if config.readsConfigFile() {
 		err = conn.ReadDefaultConfigFile()
 	}
 
@@ -298,45 +847,40 @@ func NewConnection(username string, pool string, cluster string, configFile stri
 		return nil, fmt.Errorf("Error reading ceph configuration, Error: %s", err)
 	}
 
-	err = conn.Connect()
-	if err != nil {
-		return nil, fmt.Errorf("Error connecting to ceph, Error: %s", err)
+	if config.parseEnv {
+		if err = conn.ParseDefaultConfigEnv(); err != nil {
+			return nil, fmt.Errorf("Error parsing %s, Error: %s", EnvArgs, err)
+		}
 	}
 
-	if pool == "" {
-		pool = DefaultPoolName
+	for option, value := range config.options(overrides) {
+		if err = conn.SetConfigOption(option, value); err != nil {
+			return nil, fmt.Errorf("Cannot set ceph option: %s, Error: %w", option, err)
+		}
 	}
 
-	context, err := conn.OpenIOContext(pool)
+	err = conn.Connect()
 	if err != nil {
-		return nil, fmt.Errorf("Error opening a IO Context with ceph, Error; %s", err)
+		return nil, fmt.Errorf("Error connecting to ceph, Error: %s", err)
 	}
 
-	return &Connection{
-		conn,
-		context,
-		pool,
-		username,
-		cluster,
-	}, nil
+	return conn, nil
 }
 
 /*
-This method lists all the mapped devices available on the system
-as seen by the output of the 'rbd showmapped' command
+This method returns the mapped devices available on the system as
+a map of image name to device path, it's kept for compatibility, see
+`ListMappedDevices`.
 */
 func (c *Connection) GetMappedDevices() (map[string]string, error) {
-	output, err := RunCommand("rbd", "showmapped")
+	mapped, err := c.ListMappedDevices()
 	if err != nil {
 		return nil, err
 	}
 
 	devices := make(map[string]string)
-	for _, line := range strings.Split(output, "\n") {
-		if matches, _ := regexp.MatchString("[0-9]+.*['\\/dev\\/rbd']+", line); matches == true {
-			line := strings.Split(line, " ")
-			devices[line[4]] = line[9]
-		}
+	for _, device := range mapped {
+		devices[device.Image] = device.Device
 	}
 
 	return devices, nil
@@ -344,12 +888,27 @@ func (c *Connection) GetMappedDevices() (map[string]string, error) {
 
 /*
 This method destroys the connection context and the
-connection itself.
+connection itself, the devices are left as they are, see `Close`.
+The IO contexts of the pool handles (see `Pool`) are destroyed too,
+shutting down a pool handle does nothing.
 */
 func (c *Connection) Shutdown() {
+	if c.parent != nil {
+		return
+	}
+
+	c.stopAutoReconnect()
+	c.pools.destroy()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	if c.context != nil {
 		c.context.Destroy()
+		c.context = nil
 	}
 
-	c.Shutdown()
+	if c.Conn != nil {
+		c.Conn.Shutdown()
+		c.Conn = nil
+	}
 }
@@ -0,0 +1,356 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strings"
+	"time"
+)
+
+//This type represents what a health check is about.
+type HealthLevel string
+
+const (
+	HealthCluster HealthLevel = "cluster"
+	HealthImage   HealthLevel = "image"
+	HealthDevice  HealthLevel = "device"
+)
+
+//This struct represents the outcome of a single health check.
+type HealthCheckResult struct {
+	Level   HealthLevel
+	Name    string
+	Healthy bool
+	//What was found, or why the check failed.
+	Message string
+}
+
+//This struct represents the outcome of the health checks of a cluster,
+//an image or a device, e.g. for a readiness probe.
+type HealthReport struct {
+	Checks []HealthCheckResult
+}
+
+/*
+This is a helper method that records the outcome of a check.
+*/
+func (r *HealthReport) add(level HealthLevel, name string, healthy bool, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, HealthCheckResult{
+		Level:   level,
+		Name:    name,
+		Healthy: healthy,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+/*
+This method tells if every check passed.
+*/
+func (r *HealthReport) Healthy() bool {
+	return len(r.Failed()) == 0
+}
+
+/*
+This method returns the checks that failed.
+*/
+func (r *HealthReport) Failed() []HealthCheckResult {
+	var failed []HealthCheckResult
+	for _, check := range r.Checks {
+		if !check.Healthy {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+/*
+This method returns the failed checks as an error, nil if every check
+passed.
+*/
+func (r *HealthReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(failed))
+	for _, check := range failed {
+		messages = append(messages, fmt.Sprintf("%s %s: %s", check.Level, check.Name, check.Message))
+	}
+	return fmt.Errorf("Health check failed, Error: %s", strings.Join(messages, "; "))
+}
+
+/*
+This method checks the cluster side of the connection: the monitors
+are in quorum and its pool (and RADOS namespace) exists.
+*/
+func (c *Connection) HealthCheck() *HealthReport {
+	report := &HealthReport{}
+
+	var quorum struct {
+		Quorum []int `json:"quorum"`
+		MonMap struct {
+			Mons []struct {
+				Name string `json:"name"`
+			} `json:"mons"`
+		} `json:"monmap"`
+	}
+
+	if err := c.monCommand(map[string]interface{}{"prefix": "quorum_status"}, &quorum); err != nil {
+		report.add(HealthCluster, "mon-quorum", false, "%s", err)
+	} else {
+		mons := len(quorum.MonMap.Mons)
+		report.add(HealthCluster, "mon-quorum", len(quorum.Quorum) > mons/2, "%d/%d monitors in quorum", len(quorum.Quorum), mons)
+	}
+
+	pools, err := c.rados().ListPools()
+	if err != nil {
+		report.add(HealthCluster, "pool", false, "Cannot list pools, Error: %s", err)
+		return report
+	}
+
+	found := false
+	for _, pool := range pools {
+		found = found || pool == c.pool
+	}
+
+	if !found {
+		report.add(HealthCluster, "pool", false, "pool: %s doesn't exist", c.pool)
+		return report
+	}
+	report.add(HealthCluster, "pool", true, "pool: %s exists", c.pool)
+
+	if namespace := c.GetNamespace(); namespace != "" {
+		namespaces, err := c.ListNamespaces()
+		if err != nil {
+			report.add(HealthCluster, "namespace", false, "%s", err)
+			return report
+		}
+
+		found = false
+		for _, name := range namespaces {
+			found = found || name == namespace
+		}
+		report.add(HealthCluster, "namespace", found, "namespace: %s exists: %t", namespace, found)
+	}
+	return report
+}
+
+/*
+This is a helper method that returns the addresses of the clients
+blocklisted by the cluster, falling back to the pre-Pacific blacklist
+command.
+*/
+func (c *Connection) blocklisted() (map[string]bool, error) {
+	var entries []struct {
+		Address string `json:"addr"`
+	}
+
+	err := c.monCommand(map[string]interface{}{"prefix": "osd blocklist ls"}, &entries)
+	if err != nil {
+		if err = c.monCommand(map[string]interface{}{"prefix": "osd blacklist ls"}, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	addresses := make(map[string]bool)
+	for _, entry := range entries {
+		addresses[entry.Address] = true
+	}
+	return addresses, nil
+}
+
+/*
+This method checks the image: it exists, it's not in the trash and no
+stale watcher (a blocklisted client) is left on it.
+*/
+func (i *Image) HealthCheck() *HealthReport {
+	report := &HealthReport{}
+
+	start := time.Now()
+	names, err := rbd.GetImageNames(i.ioContext())
+	i.logCall("list images", "", start, err)
+	if err != nil {
+		report.add(HealthImage, "exists", false, "Cannot list images of pool: %s, Error: %s", i.pool, err)
+		return report
+	}
+
+	exists := false
+	for _, name := range names {
+		exists = exists || name == i.name
+	}
+
+	if !exists {
+		report.add(HealthImage, "exists", false, "image: %s doesn't exist", i.name)
+
+		args := []string{"trash", "ls", "--id", i.username, "--format", "json", "--pool", i.pool}
+		if namespace := i.GetNamespace(); namespace != "" {
+			args = append(args, "--namespace", namespace)
+		}
+
+		output, err := i.run("rbd", args...)
+		if err != nil {
+			report.add(HealthImage, "trash", false, "Cannot list trash of pool: %s, Error: %s", i.pool, err)
+			return report
+		}
+
+		var trashed []struct {
+			Name string `json:"name"`
+		}
+
+		if err := json.Unmarshal([]byte(output), &trashed); err != nil {
+			report.add(HealthImage, "trash", false, "%s", parseFailure("rbd trash ls", output, err))
+			return report
+		}
+
+		inTrash := false
+		for _, entry := range trashed {
+			inTrash = inTrash || entry.Name == i.name
+		}
+		report.add(HealthImage, "trash", !inTrash, "image: %s is in the trash: %t", i.name, inTrash)
+		return report
+	}
+	report.add(HealthImage, "exists", true, "image: %s exists", i.name)
+
+	watchers, err := i.Watchers()
+	if err != nil {
+		report.add(HealthImage, "watchers", false, "%s", err)
+		return report
+	}
+
+	blocklisted, err := i.blocklisted()
+	if err != nil {
+		report.add(HealthImage, "watchers", false, "Cannot list blocklisted clients, Error: %s", err)
+		return report
+	}
+
+	var stale []string
+	for _, watcher := range watchers {
+		if blocklisted[watcher.Address] {
+			stale = append(stale, watcher.Address)
+		}
+	}
+
+	if len(stale) > 0 {
+		report.add(HealthImage, "watchers", false, "stale watchers: %s", strings.Join(stale, ", "))
+	} else {
+		report.add(HealthImage, "watchers", true, "%d watchers", len(watchers))
+	}
+	return report
+}
+
+/*
+This is a helper method that returns the rbd or nbd devices the device
+is built on: the mapped device under its layers (LUKS, overlay ...) and
+partitions, or the devices of its volume group.
+*/
+func (d *Device) mappedDevices() []*Device {
+	for d.parent != nil || d.disk != nil {
+		if d.parent != nil {
+			d = d.parent
+		} else {
+			d = d.disk
+		}
+	}
+
+	if d.group == nil {
+		return []*Device{d}
+	}
+
+	var devices []*Device
+	for _, device := range d.group.devices {
+		devices = append(devices, device.mappedDevices()...)
+	}
+	return devices
+}
+
+/*
+This method checks the device on its host: it's still mapped (the
+devices it's built on for layered devices and logical volumes), the
+device node is present, it's mounted where expected and its filesystem
+is healthy (not remounted read-only after errors, clean when unmounted).
+*/
+func (d *Device) HealthCheck() *HealthReport {
+	report := &HealthReport{}
+	runner := runnerOrLocal(d.runner)
+
+	if !d.exists(d.path) {
+		report.add(HealthDevice, "device-node", false, "device node: %s is missing", d.path)
+		return report
+	}
+	report.add(HealthDevice, "device-node", true, "device node: %s is present", d.path)
+
+	for _, base := range d.mappedDevices() {
+		disk := base.path
+		if whole := wholeDevice(base.path); whole != "" {
+			disk = whole
+		}
+
+		if base.backend == BackendNBD {
+			connected := nbdConnected(runner, disk)
+			report.add(HealthDevice, "mapped", connected, "%s rbd-nbd connected: %t", disk, connected)
+			continue
+		}
+
+		mapped, err := listMappedDevices(runner)
+		if err != nil {
+			report.add(HealthDevice, "mapped", false, "%s", err)
+			continue
+		}
+
+		found := false
+		for _, device := range mapped {
+			found = found || device.Device == disk
+		}
+		report.add(HealthDevice, "mapped", found, "%s mapped: %t", disk, found)
+	}
+
+	if d.raw || d.swap {
+		return report
+	}
+
+	if !d.isMounted {
+		clean, err := d.isClean()
+		if err != nil {
+			report.add(HealthDevice, "filesystem", false, "Cannot check filesystem state, Error: %s", err)
+		} else {
+			report.add(HealthDevice, "filesystem", clean, "%s cleanly unmounted: %t", d.fileSystemType, clean)
+		}
+		return report
+	}
+
+	mounted := false
+	for _, mountPoint := range mountPointsOf(runner, d.path) {
+		mounted = mounted || mountPoint == d.mountPoint
+	}
+
+	if !mounted {
+		report.add(HealthDevice, "mounted", false, "not mounted on: %s", d.mountPoint)
+		return report
+	}
+	report.add(HealthDevice, "mounted", true, "mounted on: %s", d.mountPoint)
+
+	output, err := runner.Run("findmnt", "-n", "-o", "OPTIONS", "--mountpoint", d.mountPoint)
+	if err != nil {
+		report.add(HealthDevice, "filesystem", false, "Cannot get mount options, Error: %s", err)
+		return report
+	}
+
+	readOnly := false
+	for _, option := range strings.Split(strings.TrimSpace(output), ",") {
+		readOnly = readOnly || option == "ro"
+	}
+
+	if readOnly && !d.mountReadOnly && !d.readOnly {
+		report.add(HealthDevice, "filesystem", false, "%s was remounted read-only", d.fileSystemType)
+		return report
+	}
+
+	if _, err := runner.Run("stat", "-f", d.mountPoint); err != nil {
+		report.add(HealthDevice, "filesystem", false, "%s is not responding, Error: %s", d.fileSystemType, err)
+		return report
+	}
+	report.add(HealthDevice, "filesystem", true, "%s is healthy", d.fileSystemType)
+	return report
+}
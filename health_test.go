@@ -0,0 +1,31 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+func TestDeviceHealthCheckLayered(t *testing.T) {
+	runner := &showmappedRunner{output: `[{"id":"0","pool":"rbd","namespace":"","name":"data","snap":"-","device":"/dev/rbd0"},` +
+		`{"id":"1","pool":"rbd","namespace":"","name":"logs","snap":"-","device":"/dev/rbd1"}]`}
+	disk := &Device{path: "/dev/rbd0", runner: runner, raw: true}
+	partition := &Device{path: "/dev/rbd1p1", runner: runner, raw: true, disk: &Device{path: "/dev/rbd1", runner: runner}}
+	group := &VolumeGroup{name: "data", devices: []*Device{disk, partition}, runner: runner}
+
+	devices := []*Device{
+		disk.layer("/dev/mapper/data", nil),
+		disk.layer("/dev/mapper/data", nil).layer("/dev/mapper/overlay", nil),
+		{path: "/dev/data/volume", runner: runner, raw: true, group: group},
+	}
+
+	for _, device := range devices {
+		if report := device.HealthCheck(); !report.Healthy() {
+			t.Errorf("HealthCheck() of %s failed: %+v", device.path, report.Failed())
+		}
+	}
+
+	missing := &Device{path: "/dev/data/volume", runner: runner, raw: true,
+		group: &VolumeGroup{devices: []*Device{disk, {path: "/dev/rbd2", runner: runner}}}}
+	if report := missing.HealthCheck(); report.Healthy() {
+		t.Errorf("HealthCheck() of a volume on an unmapped device passed")
+	}
+}
@@ -0,0 +1,121 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strings"
+)
+
+//This type represents a point of the lifecycle of a device hooks can be
+//registered on (see `Connection.OnEvent`).
+type Event string
+
+const (
+	EventPreMap      Event = "pre-map"
+	EventPostMap     Event = "post-map"
+	EventPreFormat   Event = "pre-format"
+	EventPostFormat  Event = "post-format"
+	EventPreMount    Event = "pre-mount"
+	EventPostMount   Event = "post-mount"
+	EventPreUnMount  Event = "pre-unmount"
+	EventPostUnMount Event = "post-unmount"
+	EventPreUnMap    Event = "pre-unmap"
+	EventPostUnMap   Event = "post-unmap"
+)
+
+//This struct represents the details of an event given to its handlers.
+type EventInfo struct {
+	Event Event
+	Image *Image
+	//Device the event is about, nil on EventPreMap.
+	Device *Device
+	//Mountpoint, on the mount events.
+	MountPoint string
+}
+
+//This type represents a function handling an event, an error returned
+//on a pre event vetoes the operation.
+type EventHandler func(info *EventInfo) error
+
+/*
+This method registers `handler` to be called on `event` for the images
+of the connection, handlers are called in registration order. An error
+returned by a pre event handler aborts the operation and is returned
+by it, the errors of post event handlers are logged (the operation is
+already done).
+*/
+func (c *Connection) OnEvent(event Event, handler EventHandler) {
+	if c.parent != nil {
+		c.parent.OnEvent(event, handler)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.eventHandlers == nil {
+		c.eventHandlers = make(map[Event][]EventHandler)
+	}
+	c.eventHandlers[event] = append(c.eventHandlers[event], handler)
+}
+
+/*
+This method removes all the handlers of the given event.
+*/
+func (c *Connection) ClearEventHandlers(event Event) {
+	if c.parent != nil {
+		c.parent.ClearEventHandlers(event)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.eventHandlers, event)
+}
+
+/*
+This is a helper method that tells if the event precedes its
+operation, so its handlers can veto it.
+*/
+func (e Event) isPre() bool {
+	return strings.HasPrefix(string(e), "pre-")
+}
+
+/*
+This is a helper method that calls the handlers of an event: a pre
+event stops at the first failure, which vetoes the operation, the
+failures of a post event are logged and the remaining handlers called.
+*/
+func (c *Connection) emit(info *EventInfo) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.parent != nil {
+		return c.parent.emit(info)
+	}
+
+	c.mutex.RLock()
+	handlers := c.eventHandlers[info.Event]
+	c.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(info); err != nil {
+			c.logger().Error("event handler failed", "event", string(info.Event), "error", err)
+
+			if info.Event.isPre() {
+				return fmt.Errorf("Operation vetoed by %s handler, Error: %w", info.Event, err)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+This is a helper method that emits an event of the device through the
+connection of its image, devices without image have no handlers.
+*/
+func (d *Device) emit(event Event) error {
+	if d.image == nil {
+		return nil
+	}
+	return d.image.emit(&EventInfo{Event: event, Image: d.image, Device: d, MountPoint: d.mountPoint})
+}
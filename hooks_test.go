@@ -0,0 +1,48 @@
+package blockdevice
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	logger := &recordingLogger{}
+	connection := &Connection{mutex: &sync.RWMutex{}}
+	connection.SetLogger(logger)
+
+	var called []string
+	for _, event := range []Event{EventPreMap, EventPostMap} {
+		event := event
+		connection.OnEvent(event, func(info *EventInfo) error {
+			called = append(called, string(event)+" first")
+			return errors.New("handler failed")
+		})
+		connection.OnEvent(event, func(info *EventInfo) error {
+			called = append(called, string(event)+" second")
+			return nil
+		})
+	}
+
+	if err := connection.emit(&EventInfo{Event: EventPreMap}); err == nil {
+		t.Errorf("a failed pre event handler didn't veto the operation")
+	}
+
+	if err := connection.emit(&EventInfo{Event: EventPostMap}); err != nil {
+		t.Errorf("emit() of a post event = %v, want nil", err)
+	}
+
+	want := []string{"pre-map first", "post-map first", "post-map second"}
+	if len(called) != len(want) {
+		t.Fatalf("called %v, want %v", called, want)
+	}
+	for index := range want {
+		if called[index] != want[index] {
+			t.Fatalf("called %v, want %v", called, want)
+		}
+	}
+
+	if len(logger.messages) != 2 {
+		t.Errorf("logged %v, want both failures", logger.messages)
+	}
+}
@@ -0,0 +1,61 @@
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+This is a helper method that reads the lines of a file on the host of
+`runner`, a missing file has no lines.
+*/
+func readHostFile(runner CommandRunner, path string) ([]string, error) {
+	runner = runnerOrLocal(runner)
+	if isLocalRunner(runner) {
+		return readLines(path)
+	}
+
+	if _, err := runner.Run("test", "-e", path); err != nil {
+		return nil, nil
+	}
+
+	output, err := runner.Run("cat", path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file: %s, Error: %w", path, err)
+	}
+
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+/*
+This is a helper method that replaces the lines of a file on the host
+of `runner` atomically, keeping its permissions.
+*/
+func writeHostFile(runner CommandRunner, path string, lines []string) error {
+	content := []byte(strings.Join(lines, "\n") + "\n")
+
+	runner = runnerOrLocal(runner)
+	if isLocalRunner(runner) {
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode()
+		}
+		return writeFileAtomic(path, content, mode)
+	}
+
+	temporary := path + ".tmp"
+	if _, err := runWithInput(runner, content, "dd", "of="+temporary, "status=none"); err != nil {
+		return fmt.Errorf("Cannot write file: %s, Error: %w", path, err)
+	}
+
+	runner.Run("chmod", "--reference="+path, temporary)
+	if _, err := runner.Run("mv", "-f", temporary, path); err != nil {
+		runner.Run("rm", "-f", temporary)
+		return fmt.Errorf("Cannot write file: %s, Error: %w", path, err)
+	}
+	return nil
+}
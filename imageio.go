@@ -0,0 +1,148 @@
+package blockdevice
+
+import (
+	"fmt"
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ceph/go-ceph/rbd"
+	"time"
+)
+
+//This struct represents the options of an image I/O handle.
+type IOOptions struct {
+	//Open the image read-only, optionally at the given snapshot.
+	ReadOnly bool
+	Snapshot string
+	//Flush after every write, so a successful write is durable.
+	SyncWrites bool
+	//Flush the pending writes when the handle is closed.
+	FlushOnClose bool
+	//Bypass the librbd client cache, every I/O reaches the cluster.
+	//The handle uses its own cluster connection.
+	NoCache bool
+}
+
+//This struct represents a handle for direct I/O on an image through
+//librbd, it implements io.ReaderAt, io.WriterAt and io.Closer.
+type ImageIO struct {
+	*rbd.Image
+	conn       *rados.Conn
+	context    *rados.IOContext
+	session    *radosSession
+	connection *Connection
+	name       string
+	options    IOOptions
+}
+
+/*
+This method opens an I/O handle on the image as set by `options`
+(which can be nil), the handle must be closed after use.
+*/
+func (i *Image) OpenIO(options *IOOptions) (*ImageIO, error) {
+	handle := &ImageIO{name: i.name, connection: i.Connection}
+	if options != nil {
+		handle.options = *options
+	}
+
+	if handle.options.Snapshot != "" {
+		handle.options.ReadOnly = true
+	}
+
+	var context *rados.IOContext
+	if handle.options.NoCache {
+		conn, err := connect(i.connectionConfig(), map[string]string{"rbd_cache": "false"})
+		if err != nil {
+			return nil, err
+		}
+
+		if context, err = conn.OpenIOContext(i.pool); err != nil {
+			conn.Shutdown()
+			return nil, fmt.Errorf("Error opening a IO Context with ceph, Error; %s", err)
+		}
+		handle.conn, handle.context = conn, context
+	} else {
+		handle.session, context = i.acquireContext()
+	}
+
+	var args []interface{}
+	if handle.options.Snapshot != "" {
+		args = append(args, handle.options.Snapshot)
+	}
+	if handle.options.ReadOnly {
+		args = append(args, true)
+	}
+
+	start := time.Now()
+	handle.Image = rbd.GetImage(context, i.name)
+	err := handle.Image.Open(args...)
+	i.logCall("open", i.name, start, err)
+	if err != nil {
+		handle.release()
+		return nil, fmt.Errorf("Cannot open image: %s, Error: %w", i.name, err)
+	}
+
+	return handle, nil
+}
+
+/*
+This method writes `p` at offset `off`, flushing it when the handle
+was opened with `SyncWrites`.
+*/
+func (h *ImageIO) WriteAt(p []byte, off int64) (int, error) {
+	if h.options.ReadOnly {
+		return 0, fmt.Errorf("Cannot write to image: %s, Error: handle is read-only", h.name)
+	}
+
+	n, err := h.Image.WriteAt(p, off)
+	if err == nil && h.options.SyncWrites {
+		err = h.Barrier()
+	}
+	return n, err
+}
+
+/*
+This method waits until every previous write is durable on the cluster.
+*/
+func (h *ImageIO) Barrier() error {
+	start := time.Now()
+	err := h.Image.Flush()
+	h.connection.logCall("flush", h.name, start, err)
+	if err != nil {
+		return fmt.Errorf("Cannot flush image: %s, Error: %w", h.name, err)
+	}
+	return nil
+}
+
+/*
+This method closes the handle, flushing the pending writes first if it
+was opened with `FlushOnClose`.
+*/
+func (h *ImageIO) Close() error {
+	var err error
+	if h.options.FlushOnClose && !h.options.ReadOnly {
+		err = h.Barrier()
+	}
+
+	start := time.Now()
+	closeErr := h.Image.Close()
+	h.connection.logCall("close", h.name, start, closeErr)
+	if closeErr != nil && err == nil {
+		err = fmt.Errorf("Cannot close image: %s, Error: %s", h.name, closeErr)
+	}
+
+	h.release()
+	return err
+}
+
+/*
+This method releases the dedicated connection of the handle, if any, or
+the IO context of the image connection it used.
+*/
+func (h *ImageIO) release() {
+	h.session.done()
+	h.session = nil
+	if h.conn != nil {
+		h.context.Destroy()
+		h.conn.Shutdown()
+		h.conn, h.context = nil, nil
+	}
+}
@@ -0,0 +1,117 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//This struct represents the parent snapshot an image is cloned from.
+type ImageParent struct {
+	Pool      string
+	Namespace string
+	Image     string
+	Snapshot  string
+	//Bytes of the image still backed by the parent.
+	Overlap Size
+}
+
+//This struct represents the description of an image: its provisioned
+//size and the space its head actually takes, its snapshots, parent and
+//features.
+type ImageDetails struct {
+	Name            string
+	ProvisionedSize Size
+	AllocatedSize   Size
+	ObjectSize      Size
+	Snapshots       int
+	//Nil unless the image is a clone.
+	Parent *ImageParent
+	//Feature bits (FeatureLayering | ...) and their names.
+	Features     uint64
+	FeatureNames []string
+	CreatedAt    time.Time
+}
+
+/*
+This method returns the description of the image, fetched the first
+time and kept until `Refresh` is called.
+*/
+func (i *Image) Info() (*ImageDetails, error) {
+	if i.details != nil {
+		return i.details, nil
+	}
+
+	output, err := i.run("rbd", "info", "--id", i.username, "--format", "json", i.spec(i.name, ""))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get info of image: %s, Error: %w", i.name, err)
+	}
+
+	var info struct {
+		Size            uint64   `json:"size"`
+		ObjectSize      uint64   `json:"object_size"`
+		SnapshotCount   int      `json:"snapshot_count"`
+		Features        []string `json:"features"`
+		CreateTimestamp string   `json:"create_timestamp"`
+		Parent          *struct {
+			Pool      string `json:"pool"`
+			Namespace string `json:"pool_namespace"`
+			Image     string `json:"image"`
+			Snapshot  string `json:"snapshot"`
+			Overlap   uint64 `json:"overlap"`
+		} `json:"parent"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return nil, parseFailure("rbd info", output, err)
+	}
+
+	details := &ImageDetails{
+		Name:            i.name,
+		ProvisionedSize: Size(info.Size),
+		ObjectSize:      Size(info.ObjectSize),
+		Snapshots:       info.SnapshotCount,
+		FeatureNames:    info.Features,
+	}
+
+	for _, name := range info.Features {
+		for bit, known := range featureNames {
+			if known == name {
+				details.Features |= bit
+			}
+		}
+	}
+
+	if info.CreateTimestamp != "" {
+		if details.CreatedAt, err = time.ParseInLocation(time.ANSIC, info.CreateTimestamp, time.Local); err != nil {
+			return nil, parseFailure("rbd info", output, err)
+		}
+	}
+
+	if info.Parent != nil {
+		details.Parent = &ImageParent{
+			Pool:      info.Parent.Pool,
+			Namespace: info.Parent.Namespace,
+			Image:     info.Parent.Image,
+			Snapshot:  info.Parent.Snapshot,
+			Overlap:   Size(info.Parent.Overlap),
+		}
+	}
+
+	if _, details.AllocatedSize, err = i.Usage(); err != nil {
+		return nil, err
+	}
+
+	i.details = details
+	return details, nil
+}
+
+/*
+This method fetches again the information of the image (the embedded
+`rbd.ImageInfo` and the description returned by `Info`), e.g. after it
+was resized by another client.
+*/
+func (i *Image) Refresh() error {
+	i.details = nil
+	return i.refreshInfo()
+}
@@ -0,0 +1,45 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+const (
+	KernelModuleRBD = "rbd"
+	KernelModuleNBD = "nbd"
+)
+
+/*
+This method checks that the given kernel module (KernelModuleRBD or
+KernelModuleNBD) is loaded on the host targeted by `runner` (the local
+host if nil), loading it with modprobe when `load` is set. It returns
+an error listing the remediation steps if the module is not available.
+*/
+func EnsureKernelModule(runner CommandRunner, module string, load bool) error {
+	runner = runnerOrLocal(runner)
+	if _, err := runner.Run("test", "-d", "/sys/module/"+module); err == nil {
+		return nil
+	}
+
+	if load {
+		if _, err := runner.Run("modprobe", module); err != nil {
+			return fmt.Errorf("Cannot load kernel module: %s, Error: %s%s", module, err, kernelModuleRemediation(module))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Kernel module: %s is not loaded%s", module, kernelModuleRemediation(module))
+}
+
+/*
+This is a helper method that describes how to make a kernel module
+available.
+*/
+func kernelModuleRemediation(module string) string {
+	return fmt.Sprintf(`, to fix it:
+  - load it as root: modprobe %[1]s
+  - if it's not found, install the extra kernel modules package for the running kernel (uname -r)
+  - to load it at boot, add it to /etc/modules-load.d/%[1]s.conf
+  - inside a container, load it on the host and mount /lib/modules and /sys read-only
+  - set MapOptions.LoadKernelModule to load it automatically before mapping`, module)
+}
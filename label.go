@@ -0,0 +1,106 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+/*
+This method returns the value of a blkid tag (LABEL, UUID, ...) of
+the device filesystem.
+*/
+func (d *Device) blkidTag(tag string) (string, error) {
+	value, err := d.run("blkid", "-p", "-o", "value", "-s", tag, d.path)
+	if err != nil {
+		if isNotFoundByBlkid(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("Cannot get %s of device: %s, Error: %w", tag, d.path, err)
+	}
+	return value, nil
+}
+
+/*
+This method returns the filesystem label of the device.
+*/
+func (d *Device) GetLabel() (string, error) {
+	return d.blkidTag("LABEL")
+}
+
+/*
+This method returns the filesystem UUID of the device, which can be
+used on fstab as UUID=<uuid> and survives remaps.
+*/
+func (d *Device) GetUUID() (string, error) {
+	return d.blkidTag("UUID")
+}
+
+/*
+This method sets the filesystem label of the device. XFS can only be
+relabeled while unmounted.
+*/
+func (d *Device) SetLabel(label string) error {
+	if d.readOnly {
+		return fmt.Errorf("Cannot set label of device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	var err error
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+		_, err = d.run("e2label", d.path, label)
+	case "xfs":
+		if d.isMounted {
+			return fmt.Errorf("Cannot set label of device: %s, Error: xfs must be unmounted", d.path)
+		}
+		_, err = d.run("xfs_admin", "-L", label, d.path)
+	case "btrfs":
+		target := d.path
+		if d.isMounted {
+			target = d.mountPoint
+		}
+		_, err = d.run("btrfs", "filesystem", "label", target, label)
+	default:
+		return fmt.Errorf("Cannot set label of device: %s, Error: unsupported filesystem: %s", d.path, d.fileSystemType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot set label of device: %s, Error: %w", d.path, err)
+	}
+
+	d.formatOptions.Label = label
+	return nil
+}
+
+/*
+This method gives the filesystem of the device a new random UUID, e.g.
+on a clone of a golden image so it can be mounted along with its
+siblings (xfs refuses duplicated UUIDs). The device must be unmounted.
+*/
+func (d *Device) RegenerateUUID() error {
+	if d.readOnly {
+		return fmt.Errorf("Cannot regenerate UUID of device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.isMounted {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot regenerate UUID of device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	var err error
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+		//tune2fs requires a freshly checked filesystem
+		if _, err = d.run("e2fsck", "-f", "-p", d.path); err == nil {
+			_, err = d.run("tune2fs", "-U", "random", d.path)
+		}
+	case "xfs":
+		_, err = d.run("xfs_admin", "-U", "generate", d.path)
+	case "btrfs":
+		_, err = d.run("btrfstune", "-f", "-u", d.path)
+	default:
+		return fmt.Errorf("Cannot regenerate UUID of device: %s, Error: unsupported filesystem: %s", d.path, d.fileSystemType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot regenerate UUID of device: %s, Error: %w", d.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+func TestMapOptionsLabel(t *testing.T) {
+	tests := []struct {
+		options *MapOptions
+		want    string
+	}{
+		{&MapOptions{Label: "data"}, "data"},
+		{&MapOptions{Format: &FormatOptions{Label: "format"}}, "format"},
+		{&MapOptions{Label: "data", Format: &FormatOptions{Label: "format"}}, "data"},
+	}
+
+	for _, test := range tests {
+		device := newMappedDevice(nil, "/dev/rbd0", BackendKRBD, "ext4", nil, test.options)
+		if got := device.formatOptions.Label; got != test.want {
+			t.Errorf("newMappedDevice(%+v) label = %q, want %q", test.options, got, test.want)
+		}
+	}
+}
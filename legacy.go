@@ -0,0 +1,402 @@
+package blockdevice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultRbdmapPath = "/etc/ceph/rbdmap"
+	DefaultFstabPath  = "/etc/fstab"
+)
+
+//This struct represents the options used to import a legacy
+//configuration.
+type ImportOptions struct {
+	//State file the volumes are added to (DefaultStateFile if empty).
+	StateFile string
+	//Rewrite the imported entries of the rbdmap and fstab files as the
+	//library persists them (see `Image.PersistMapping` and
+	//`Device.PersistToFstab`).
+	Rewrite bool
+}
+
+//This struct represents an entry of the rbdmap file.
+type rbdmapEntry struct {
+	line   int
+	volume ManagedVolume
+}
+
+//This struct represents an entry of the fstab file.
+type fstabEntry struct {
+	line       int
+	device     string
+	mountPoint string
+	fsType     string
+	options    []string
+	dump       string
+	pass       string
+}
+
+/*
+This is a helper method that reads the lines of a file, a missing file
+has no lines.
+*/
+func readLines(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read file: %s, Error: %w", path, err)
+	}
+	return strings.Split(strings.TrimRight(string(content), "\n"), "\n"), nil
+}
+
+/*
+This is a helper method that parses the image spec of a rbdmap entry
+(pool[/namespace]/image[@snap], the pool defaults to DefaultPoolName)
+into its pool, namespace, image and snapshot.
+*/
+func parseImageSpec(spec string) (string, string, string, string) {
+	var snapshot string
+	if index := strings.Index(spec, "@"); index >= 0 {
+		spec, snapshot = spec[:index], spec[index+1:]
+	}
+
+	pool, namespace := DefaultPoolName, ""
+	parts := strings.SplitN(spec, "/", 3)
+	switch len(parts) {
+	case 2:
+		pool, spec = parts[0], parts[1]
+	case 3:
+		pool, namespace, spec = parts[0], parts[1], parts[2]
+	}
+	return pool, namespace, spec, snapshot
+}
+
+/*
+This is a helper method that splits the parameters of a rbdmap entry on
+the commas outside of quotes, as in options='queue_depth=128,noshare'.
+*/
+func splitRbdmapParameters(parameters string) []string {
+	var split []string
+	quote, start := rune(0), 0
+	for index, r := range parameters {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ',':
+			split = append(split, parameters[start:index])
+			start = index + 1
+		}
+	}
+	return append(split, parameters[start:])
+}
+
+/*
+This is a helper method that parses the entries of a rbdmap file:
+"pool[/namespace]/image[@snap] id=user,keyring=path,read-only,options='queue_depth=128,noshare'",
+every parameter is passed to `rbd map` as --<key> <value>.
+*/
+func parseRbdmap(lines []string) []rbdmapEntry {
+	var entries []rbdmapEntry
+	for index, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		pool, namespace, image, snapshot := parseImageSpec(fields[0])
+		volume := ManagedVolume{Pool: pool, Namespace: namespace, Image: image, Snapshot: snapshot, Source: "rbdmap"}
+		if len(fields) > 1 {
+			for _, parameter := range splitRbdmapParameters(fields[1]) {
+				key, value, _ := strings.Cut(parameter, "=")
+				value = strings.Trim(value, "\"'")
+				switch key {
+				case "id":
+					volume.User = value
+				case "keyring":
+					volume.Keyring = value
+				case "read-only", "ro":
+					volume.ReadOnly = true
+				case "options":
+					for _, option := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+						name, optionValue, _ := strings.Cut(option, "=")
+						if name == "ro" || name == "read_only" {
+							volume.ReadOnly = true
+							continue
+						}
+
+						if volume.MapOptions == nil {
+							volume.MapOptions = make(map[string]string)
+						}
+						volume.MapOptions[name] = optionValue
+					}
+				}
+			}
+		}
+
+		entries = append(entries, rbdmapEntry{line: index, volume: volume})
+	}
+	return entries
+}
+
+/*
+This is a helper method that parses the entries of a fstab file.
+*/
+func parseFstab(lines []string) []fstabEntry {
+	var entries []fstabEntry
+	for index, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		entry := fstabEntry{line: index, device: fields[0], mountPoint: fields[1], fsType: fields[2], dump: "0", pass: "0"}
+		if len(fields) > 3 {
+			entry.options = strings.Split(fields[3], ",")
+		}
+
+		if len(fields) > 4 {
+			entry.dump = fields[4]
+		}
+
+		if len(fields) > 5 {
+			entry.pass = fields[5]
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+/*
+This is a helper method that returns the image spec and partition of a
+/dev/rbd/<pool>/<image>[@<snap>][-part<n>] fstab device, or an empty
+spec for any other device.
+*/
+func fstabImageSpec(device string) (string, int) {
+	if !strings.HasPrefix(device, "/dev/rbd/") {
+		return "", 0
+	}
+
+	spec := strings.TrimPrefix(device, "/dev/rbd/")
+	partition := 0
+	if index := strings.LastIndex(spec, "-part"); index > 0 {
+		if number, err := strconv.Atoi(spec[index+len("-part"):]); err == nil {
+			spec, partition = spec[:index], number
+		}
+	}
+	return spec, partition
+}
+
+/*
+This is a helper method that removes the boot ordering options that
+the library handles itself from fstab mount options.
+*/
+func managedMountOptions(options []string) []string {
+	var filtered []string
+	for _, option := range options {
+		switch option {
+		case "defaults", "noauto", "_netdev", "nofail", "auto":
+		default:
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
+
+/*
+This is a helper method that returns the entry of the volume as written
+by `Image.PersistMapping`.
+*/
+func (v *ManagedVolume) rbdmapEntry() string {
+	var parameters []string
+	if v.User != "" {
+		parameters = append(parameters, "id="+v.User)
+	}
+
+	if v.Keyring != "" {
+		parameters = append(parameters, "keyring="+v.Keyring)
+	}
+
+	if v.ReadOnly {
+		parameters = append(parameters, "read-only")
+	}
+
+	if len(v.MapOptions) > 0 {
+		var options []string
+		for name, value := range v.MapOptions {
+			if value != "" {
+				name += "=" + value
+			}
+			options = append(options, name)
+		}
+		sort.Strings(options)
+		parameters = append(parameters, "options='"+strings.Join(options, ",")+"'")
+	}
+
+	entry := v.Spec()
+	if len(parameters) > 0 {
+		entry += "\t" + strings.Join(parameters, ",")
+	}
+	return entry
+}
+
+/*
+This is a helper method that returns the fstab entry as written by
+`Device.PersistToFstab`: the entry keeps mounting at boot unless it was
+noauto.
+*/
+func (e *fstabEntry) managedEntry() string {
+	options := []string{"_netdev"}
+	for _, option := range e.options {
+		if option == "noauto" {
+			options = append(options, "noauto")
+			break
+		}
+	}
+
+	options = append(options, managedMountOptions(e.options)...)
+	return strings.Join([]string{e.device, e.mountPoint, e.fsType, strings.Join(options, ","), e.dump, e.pass}, " ")
+}
+
+/*
+This is a helper method that replaces the given lines of a file,
+keeping its mode.
+*/
+func rewriteLines(path string, lines []string, rewritten map[int]string) error {
+	if len(rewritten) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("Cannot rewrite file: %s, Error: %w", path, err)
+	}
+
+	content := make([]string, len(lines))
+	for index, line := range lines {
+		if entry, ok := rewritten[index]; ok {
+			line = entry
+		}
+		content[index] = line
+	}
+	return writeFileAtomic(path, []byte(strings.Join(content, "\n")+"\n"), info.Mode())
+}
+
+/*
+This method adopts the volumes of an existing rbdmap file and their
+fstab entries (/dev/rbd/<pool>/<image> devices) into the managed state,
+the paths default to DefaultRbdmapPath and DefaultFstabPath. fstab
+entries of images missing from rbdmap are adopted too.
+
+The state records the volumes as managed (so they're never taken for
+orphans, see `CleanupOrphans`), the rbdmap and fstab files still map
+and mount them at boot. They're left as they are unless
+`options.Rewrite` is set, then the imported entries are rewritten as
+the library persists them. The imported volumes are returned.
+*/
+func ImportLegacyConfig(rbdmapPath, fstabPath string, options *ImportOptions) ([]ManagedVolume, error) {
+	if options == nil {
+		options = &ImportOptions{}
+	}
+
+	if rbdmapPath == "" {
+		rbdmapPath = DefaultRbdmapPath
+	}
+
+	if fstabPath == "" {
+		fstabPath = DefaultFstabPath
+	}
+
+	state, err := LoadState(options.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdmapLines, err := readLines(rbdmapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fstabLines, err := readLines(fstabPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []ManagedVolume
+	bySpec := make(map[string]int)
+	rbdmapLine := make(map[int]int)
+	fstabEntries := make(map[int]fstabEntry)
+
+	for _, entry := range parseRbdmap(rbdmapLines) {
+		bySpec[entry.volume.Spec()] = len(volumes)
+		rbdmapLine[len(volumes)] = entry.line
+		volumes = append(volumes, entry.volume)
+	}
+
+	for _, entry := range parseFstab(fstabLines) {
+		spec, partition := fstabImageSpec(entry.device)
+		if spec == "" {
+			continue
+		}
+
+		index, ok := bySpec[spec]
+		if !ok {
+			pool, namespace, image, snapshot := parseImageSpec(spec)
+			index = len(volumes)
+			bySpec[spec] = index
+			volumes = append(volumes, ManagedVolume{Pool: pool, Namespace: namespace, Image: image, Snapshot: snapshot, Source: "fstab"})
+		}
+
+		volume := &volumes[index]
+		if volume.MountPoint != "" {
+			return nil, fmt.Errorf("Cannot import fstab entry for: %s, Error: image already mounted on: %s", entry.device, volume.MountPoint)
+		}
+
+		volume.Partition = partition
+		volume.MountPoint = entry.mountPoint
+		volume.FileSystemType = entry.fsType
+		volume.MountOptions = managedMountOptions(entry.options)
+		fstabEntries[entry.line] = entry
+	}
+
+	for _, volume := range volumes {
+		state.Add(volume)
+	}
+
+	if err := state.Save(); err != nil {
+		return nil, err
+	}
+
+	if options.Rewrite {
+		rewritten := make(map[int]string)
+		for index, line := range rbdmapLine {
+			rewritten[line] = volumes[index].rbdmapEntry()
+		}
+
+		if err := rewriteLines(rbdmapPath, rbdmapLines, rewritten); err != nil {
+			return volumes, err
+		}
+
+		rewritten = make(map[int]string)
+		for line, entry := range fstabEntries {
+			rewritten[line] = entry.managedEntry()
+		}
+
+		if err := rewriteLines(fstabPath, fstabLines, rewritten); err != nil {
+			return volumes, err
+		}
+	}
+	return volumes, nil
+}
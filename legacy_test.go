@@ -0,0 +1,163 @@
+package blockdevice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRbdmap(t *testing.T) {
+	lines := []string{
+		"# RbdDevice Parameters",
+		"#poolname/imagename id=client,keyring=/etc/ceph/ceph.client.keyring",
+		"",
+		"rbd/data id=admin,keyring=/etc/ceph/ceph.client.admin.keyring",
+		"images/base@golden\tid=reader,read-only",
+		"   ",
+		"vm-disk id=admin,options=queue_depth=128,options=ro",
+		"rbd/tuned options=lock_on_read;alloc_size=65536",
+		"rbd/quoted id=admin,options='queue_depth=128,noshare',read-only",
+	}
+
+	want := []rbdmapEntry{
+		{line: 3, volume: ManagedVolume{Pool: "rbd", Image: "data", User: "admin", Keyring: "/etc/ceph/ceph.client.admin.keyring", Source: "rbdmap"}},
+		{line: 4, volume: ManagedVolume{Pool: "images", Image: "base", Snapshot: "golden", User: "reader", ReadOnly: true, Source: "rbdmap"}},
+		{line: 6, volume: ManagedVolume{Pool: DefaultPoolName, Image: "vm-disk", User: "admin", ReadOnly: true, MapOptions: map[string]string{"queue_depth": "128"}, Source: "rbdmap"}},
+		{line: 7, volume: ManagedVolume{Pool: "rbd", Image: "tuned", MapOptions: map[string]string{"lock_on_read": "", "alloc_size": "65536"}, Source: "rbdmap"}},
+		{line: 8, volume: ManagedVolume{Pool: "rbd", Image: "quoted", User: "admin", ReadOnly: true, MapOptions: map[string]string{"queue_depth": "128", "noshare": ""}, Source: "rbdmap"}},
+	}
+
+	if got := parseRbdmap(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRbdmap() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseFstab(t *testing.T) {
+	lines := []string{
+		"# /etc/fstab",
+		"UUID=1234 / ext4 defaults 0 1",
+		"/dev/rbd/rbd/data /mnt/data xfs noauto,_netdev,noatime 0 0",
+		"#/dev/rbd/rbd/old /mnt/old ext4 defaults 0 0",
+		"/dev/rbd/rbd/short /mnt/short",
+		"/dev/rbd/rbd/bare /mnt/bare ext4",
+	}
+
+	want := []fstabEntry{
+		{line: 1, device: "UUID=1234", mountPoint: "/", fsType: "ext4", options: []string{"defaults"}, dump: "0", pass: "1"},
+		{line: 2, device: "/dev/rbd/rbd/data", mountPoint: "/mnt/data", fsType: "xfs", options: []string{"noauto", "_netdev", "noatime"}, dump: "0", pass: "0"},
+		{line: 5, device: "/dev/rbd/rbd/bare", mountPoint: "/mnt/bare", fsType: "ext4", dump: "0", pass: "0"},
+	}
+
+	if got := parseFstab(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFstab() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFstabImageSpec(t *testing.T) {
+	tests := []struct {
+		device    string
+		spec      string
+		partition int
+	}{
+		{"/dev/rbd/rbd/data", "rbd/data", 0},
+		{"/dev/rbd/rbd/data-part2", "rbd/data", 2},
+		{"/dev/rbd/images/base@golden-part1", "images/base@golden", 1},
+		{"/dev/rbd/rbd/my-partition", "rbd/my-partition", 0},
+		{"/dev/rbd0", "", 0},
+		{"UUID=1234", "", 0},
+	}
+
+	for _, test := range tests {
+		spec, partition := fstabImageSpec(test.device)
+		if spec != test.spec || partition != test.partition {
+			t.Errorf("fstabImageSpec(%q) = %q, %d, want %q, %d", test.device, spec, partition, test.spec, test.partition)
+		}
+	}
+}
+
+func TestManagedMountOptions(t *testing.T) {
+	got := managedMountOptions([]string{"defaults", "noatime", "_netdev", "nofail", "discard", "noauto"})
+	if want := []string{"noatime", "discard"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managedMountOptions() = %v, want %v", got, want)
+	}
+}
+
+func TestImportLegacyConfigRewrite(t *testing.T) {
+	directory := t.TempDir()
+	rbdmapPath := filepath.Join(directory, "rbdmap")
+	fstabPath := filepath.Join(directory, "fstab")
+
+	rbdmap := "# RbdDevice Parameters\n" +
+		"rbd/data id=admin,options=queue_depth=128;noshare\n" +
+		"images/base@golden id=reader,ro\n"
+	fstab := "UUID=1234 / ext4 defaults 0 1\n" +
+		"/dev/rbd/rbd/data /mnt/data xfs defaults,nofail,noatime 0 2\n" +
+		"/dev/rbd/images/base@golden-part1 /mnt/base ext4 noauto,ro\n"
+
+	if err := ioutil.WriteFile(rbdmapPath, []byte(rbdmap), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fstabPath, []byte(fstab), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &ImportOptions{StateFile: filepath.Join(directory, "state.json"), Rewrite: true}
+	volumes, err := ImportLegacyConfig(rbdmapPath, fstabPath, options)
+	if err != nil {
+		t.Fatalf("ImportLegacyConfig() error = %v", err)
+	}
+
+	if len(volumes) != 2 {
+		t.Fatalf("ImportLegacyConfig() = %+v, want 2 volumes", volumes)
+	}
+
+	tests := []struct {
+		path  string
+		lines []string
+		mode  os.FileMode
+	}{
+		{rbdmapPath, []string{
+			"# RbdDevice Parameters",
+			"rbd/data\tid=admin,options='noshare,queue_depth=128'",
+			"images/base@golden\tid=reader,read-only",
+		}, 0640},
+		{fstabPath, []string{
+			"UUID=1234 / ext4 defaults 0 1",
+			"/dev/rbd/rbd/data /mnt/data xfs _netdev,noatime 0 2",
+			"/dev/rbd/images/base@golden-part1 /mnt/base ext4 _netdev,noauto,ro 0 0",
+		}, 0644},
+	}
+
+	for _, test := range tests {
+		content, err := ioutil.ReadFile(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Split(strings.TrimRight(string(content), "\n"), "\n"); !reflect.DeepEqual(got, test.lines) {
+			t.Errorf("%s = %q, want %q", test.path, got, test.lines)
+		}
+
+		info, err := os.Stat(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != test.mode {
+			t.Errorf("%s mode = %v, want %v", test.path, info.Mode(), test.mode)
+		}
+	}
+
+	state, err := LoadState(options.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Find("rbd", "", "data", "") == nil || state.Find("images", "", "base", "golden") == nil {
+		t.Errorf("state = %+v, want the imported volumes", state)
+	}
+}
@@ -0,0 +1,232 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	//Number of recent log entries kept for the diagnostics bundles (see
+	//`Connection.CollectDiagnostics`).
+	DefaultLogHistory = 1000
+)
+
+//This interface represents a structured logger, the key/value pairs
+//alternate keys and values. It's satisfied by *slog.Logger.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+var defaultLogger = struct {
+	sync.Mutex
+	logger Logger
+}{}
+
+var logHistory = struct {
+	sync.Mutex
+	entries []string
+	next    int
+}{}
+
+//This struct keeps the log entries in the recent history, even when
+//logging is disabled, and forwards them to a logger (which can be nil).
+type historyLogger struct {
+	logger Logger
+}
+
+func (l *historyLogger) Debug(msg string, keysAndValues ...interface{}) {
+	recordLog("DEBUG", msg, keysAndValues)
+	if l.logger != nil {
+		l.logger.Debug(msg, keysAndValues...)
+	}
+}
+
+func (l *historyLogger) Info(msg string, keysAndValues ...interface{}) {
+	recordLog("INFO", msg, keysAndValues)
+	if l.logger != nil {
+		l.logger.Info(msg, keysAndValues...)
+	}
+}
+
+func (l *historyLogger) Error(msg string, keysAndValues ...interface{}) {
+	recordLog("ERROR", msg, keysAndValues)
+	if l.logger != nil {
+		l.logger.Error(msg, keysAndValues...)
+	}
+}
+
+/*
+This is a helper method that adds a log entry to the recent history,
+dropping the oldest one past DefaultLogHistory entries.
+*/
+func recordLog(level string, msg string, keysAndValues []interface{}) {
+	entry := time.Now().Format(time.RFC3339Nano) + " " + level + " " + msg
+	for index := 0; index+1 < len(keysAndValues); index += 2 {
+		entry += fmt.Sprintf(" %v=%v", keysAndValues[index], keysAndValues[index+1])
+	}
+
+	logHistory.Lock()
+	defer logHistory.Unlock()
+	if len(logHistory.entries) < DefaultLogHistory {
+		logHistory.entries = append(logHistory.entries, entry)
+		return
+	}
+	logHistory.entries[logHistory.next] = entry
+	logHistory.next = (logHistory.next + 1) % DefaultLogHistory
+}
+
+/*
+This is a helper method that returns the recent log entries, the oldest
+first.
+*/
+func recentLogs() []string {
+	logHistory.Lock()
+	defer logHistory.Unlock()
+
+	entries := make([]string, 0, len(logHistory.entries))
+	entries = append(entries, logHistory.entries[logHistory.next:]...)
+	return append(entries, logHistory.entries[:logHistory.next]...)
+}
+
+/*
+This method sets the logger of the package, used by the connections
+without their own logger (see `Connection.SetLogger`) and for the
+external commands run for none, nil disables the logs.
+*/
+func SetLogger(logger Logger) {
+	defaultLogger.Lock()
+	defer defaultLogger.Unlock()
+	defaultLogger.logger = logger
+}
+
+/*
+This is a helper method that returns the logger of the package, nil if
+logging is disabled.
+*/
+func packageLogger() Logger {
+	defaultLogger.Lock()
+	defer defaultLogger.Unlock()
+	return defaultLogger.logger
+}
+
+/*
+This method sets the logger of the librbd calls, external commands and
+operations of the connection, its images and devices, nil falls back to
+the logger of the package (see `SetLogger`).
+*/
+func (c *Connection) SetLogger(logger Logger) {
+	if c.parent != nil {
+		c.parent.SetLogger(logger)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.log = logger
+}
+
+/*
+This is a helper method that returns the logger of the connection, the
+entries are kept in the recent history (see `recentLogs`) even if
+logging is disabled.
+*/
+func (c *Connection) logger() Logger {
+	if c == nil {
+		return &historyLogger{logger: packageLogger()}
+	}
+
+	if c.parent != nil {
+		return c.parent.logger()
+	}
+
+	c.mutex.RLock()
+	logger := c.log
+	c.mutex.RUnlock()
+
+	if logger != nil {
+		return &historyLogger{logger: logger}
+	}
+	return &historyLogger{logger: packageLogger()}
+}
+
+/*
+This is a helper method that logs a librbd call on `image` started at
+`start`.
+*/
+func (c *Connection) logCall(call string, image string, start time.Time, err error) {
+	logger := c.logger()
+
+	keysAndValues := []interface{}{"call", call, "image", image, "duration", time.Since(start)}
+	if c != nil {
+		keysAndValues = append(keysAndValues, "pool", c.pool)
+	}
+
+	if err != nil {
+		keysAndValues = append(keysAndValues, "error", err)
+	}
+	logger.Debug("librbd call", keysAndValues...)
+}
+
+//Key of the connection whose logger logs the commands run with a
+//context, see `withCommandLogger`.
+type commandLoggerKey struct{}
+
+/*
+This is a helper method that returns `ctx` logging the commands run
+with it to the logger of `connection`, `ctx` itself if it's nil.
+*/
+func withCommandLogger(ctx context.Context, connection *Connection) context.Context {
+	if connection == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, commandLoggerKey{}, connection)
+}
+
+/*
+This is a helper method that returns the connection logging the
+commands run with `ctx`, nil if none.
+*/
+func commandConnection(ctx context.Context) *Connection {
+	connection, _ := ctx.Value(commandLoggerKey{}).(*Connection)
+	return connection
+}
+
+/*
+This is a helper method that logs an external command started at
+`start`, along with its exit code, to the logger of the connection it's
+run for (see `withCommandLogger`) or else of the package.
+*/
+func logCommand(ctx context.Context, name string, args []string, start time.Time, exitCode int, err error) {
+	logger := commandConnection(ctx).logger()
+
+	keysAndValues := []interface{}{"command", name, "args", args, "exit_code", exitCode, "duration", time.Since(start)}
+	if err != nil {
+		keysAndValues = append(keysAndValues, "error", err)
+	}
+	logger.Debug("command run", keysAndValues...)
+}
+
+/*
+This is a helper method that logs an operation, i.e. the state
+transitions of images and devices (mapped, mounted, unmapped ...).
+*/
+func (o *Operation) log() {
+	logger := o.connection.logger()
+
+	keysAndValues := []interface{}{"operation", o.Name, "duration", o.Duration}
+	for _, field := range []struct{ key, value string }{{"pool", o.Pool}, {"image", o.Image}, {"device", o.Device}} {
+		if field.value != "" {
+			keysAndValues = append(keysAndValues, field.key, field.value)
+		}
+	}
+
+	if o.Err != nil {
+		logger.Error("operation failed", append(keysAndValues, "error", o.Err)...)
+		return
+	}
+	logger.Info("operation completed", keysAndValues...)
+}
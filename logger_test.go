@@ -0,0 +1,55 @@
+package blockdevice
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//This struct records the messages logged.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func TestCommandLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	connection := &Connection{mutex: &sync.RWMutex{}}
+	connection.SetLogger(logger)
+
+	recorder := &contextRecorder{}
+	runners := []CommandRunner{
+		&timeoutRunner{runner: recorder, connection: connection},
+		//a bound context keeps the connection of the caller
+		&timeoutRunner{runner: &boundRunner{runner: recorder, ctx: context.Background()}, connection: connection},
+	}
+
+	for _, runner := range runners {
+		recorder.ctx = nil
+		runner.Run("true")
+		if commandConnection(recorder.ctx) != connection {
+			t.Fatalf("the command isn't run for the connection")
+		}
+	}
+
+	logCommand(recorder.ctx, "true", nil, time.Now(), 0, nil)
+	if len(logger.messages) != 1 {
+		t.Errorf("the connection logger got %v, want the command log", logger.messages)
+	}
+
+	if commandConnection(context.Background()) != nil {
+		t.Errorf("a command run for no connection has one")
+	}
+}
@@ -0,0 +1,117 @@
+package blockdevice
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+//This interface represents the source of the passphrase of an
+//encrypted device (a KMS, Vault, a local file ...).
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+//This type represents a passphrase known in advance.
+type StaticKey []byte
+
+func (k StaticKey) Key() ([]byte, error) {
+	return []byte(k), nil
+}
+
+//This type represents a passphrase read from a local file.
+type KeyFile string
+
+func (k KeyFile) Key() ([]byte, error) {
+	key, err := ioutil.ReadFile(string(k))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read key file: %s, Error: %w", string(k), err)
+	}
+	return key, nil
+}
+
+/*
+This method formats the device as a LUKS2 volume protected by the key
+of `keys`, use `OpenLUKS` to access it. The device must not hold any
+signature unless `FormatOptions.Force` is set.
+*/
+func (d *Device) EncryptLUKS(keys KeyProvider) error {
+	if d.readOnly {
+		return fmt.Errorf("Cannot encrypt device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.isMounted {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot encrypt device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	current, err := d.signature()
+	if err != nil {
+		return fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	if current != "" && !d.formatOptions.Force {
+		return &ExistingFilesystemError{Device: d.path, FileSystemType: current, Expected: "crypto_LUKS"}
+	}
+
+	key, err := keys.Key()
+	if err != nil {
+		return fmt.Errorf("Cannot get key for device: %s, Error: %w", d.path, err)
+	}
+
+	if _, err := runWithInput(d.runner, key, "cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "-", d.path); err != nil {
+		return fmt.Errorf("Cannot encrypt device: %s, Error: %w", d.path, err)
+	}
+
+	d.prepared = false
+	return nil
+}
+
+/*
+This method tells if the device is a LUKS volume.
+*/
+func (d *Device) IsLUKS() bool {
+	_, err := d.run("cryptsetup", "isLuks", d.path)
+	return err == nil
+}
+
+/*
+This method opens the LUKS volume of the device with the key of `keys`
+and returns the clear text `Device`, pointing at /dev/mapper/<name>.
+Mounting it formats it as the device would be, unmapping it closes the
+volume and unmaps the device.
+*/
+func (d *Device) OpenLUKS(name string, keys KeyProvider) (*Device, error) {
+	if d.isMounted {
+		return nil, kindErrorf(ErrDeviceBusy, nil, "Cannot open encrypted device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	key, err := keys.Key()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get key for device: %s, Error: %w", d.path, err)
+	}
+
+	args := []string{"open", "--type", "luks", "--key-file", "-"}
+	if d.readOnly {
+		args = append(args, "--readonly")
+	}
+
+	if _, err := runWithInput(d.runner, key, "cryptsetup", append(args, d.path, name)...); err != nil {
+		return nil, fmt.Errorf("Cannot open encrypted device: %s, Error: %w", d.path, err)
+	}
+
+	plain := d.layer("/dev/mapper/"+name, func() error {
+		if _, err := d.run("cryptsetup", "close", name); err != nil {
+			return fmt.Errorf("Cannot close encrypted device: %s, Error: %w", name, err)
+		}
+		return nil
+	})
+
+	if err := plain.waitForUdev(0); err != nil {
+		d.run("cryptsetup", "close", name)
+		return nil, err
+	}
+
+	if d.image != nil {
+		d.image.track(plain)
+	}
+	return plain, nil
+}
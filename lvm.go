@@ -0,0 +1,258 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//This struct represents a LVM volume group built on top of mapped
+//devices, e.g. to stripe a workload across several images.
+type VolumeGroup struct {
+	name    string
+	devices []*Device
+	runner  CommandRunner
+}
+
+//This struct represents the options used to create a logical volume.
+type LogicalVolumeOptions struct {
+	//Number of physical volumes to stripe the data across (linear if zero).
+	Stripes int
+	//Stripe size in kilobytes (the LVM default if zero).
+	StripeSize uint64
+	//Filesystem the volume is formatted with (DefaultFileSystemType if empty).
+	FileSystemType string
+}
+
+/*
+This method initializes the device as a LVM physical volume. The device
+must not hold any signature unless `FormatOptions.Force` is set.
+*/
+func (d *Device) CreatePhysicalVolume() error {
+	if d.readOnly {
+		return fmt.Errorf("Cannot create physical volume on device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.isMounted {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot create physical volume on device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	current, err := d.signature()
+	if err != nil {
+		return fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	if current == "LVM2_member" {
+		return nil
+	}
+
+	if current != "" && !d.formatOptions.Force {
+		return &ExistingFilesystemError{Device: d.path, FileSystemType: current, Expected: "LVM2_member"}
+	}
+
+	if _, err := d.run("pvcreate", "--yes", "--force", d.path); err != nil {
+		return fmt.Errorf("Cannot create physical volume on device: %s, Error: %w", d.path, err)
+	}
+
+	d.prepared = false
+	return nil
+}
+
+/*
+This method creates the volume group `name` aggregating the given
+devices, which are initialized as physical volumes first. All the
+devices must be mapped on the same host.
+*/
+func CreateVolumeGroup(name string, devices ...*Device) (*VolumeGroup, error) {
+	group, err := newVolumeGroup(name, devices)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"--yes", name}
+	for _, device := range devices {
+		if err := device.CreatePhysicalVolume(); err != nil {
+			return nil, err
+		}
+		args = append(args, device.path)
+	}
+
+	if _, err := group.run("vgcreate", args...); err != nil {
+		return nil, fmt.Errorf("Cannot create volume group: %s, Error: %w", name, err)
+	}
+	return group, nil
+}
+
+/*
+This method returns the existing volume group `name` built on the given
+devices, activating it (e.g. after the images were mapped again).
+*/
+func OpenVolumeGroup(name string, devices ...*Device) (*VolumeGroup, error) {
+	group, err := newVolumeGroup(name, devices)
+	if err != nil {
+		return nil, err
+	}
+
+	group.run("pvscan", "--cache")
+	if _, err := group.run("vgchange", "--activate", "y", name); err != nil {
+		return nil, fmt.Errorf("Cannot activate volume group: %s, Error: %w", name, err)
+	}
+	return group, nil
+}
+
+/*
+This is a helper method that checks the devices of a volume group.
+*/
+func newVolumeGroup(name string, devices []*Device) (*VolumeGroup, error) {
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("Cannot use volume group: %s, Error: no devices given", name)
+	}
+
+	for _, device := range devices {
+		if !sameHost(device.runner, devices[0].runner) {
+			return nil, fmt.Errorf("Cannot use volume group: %s, Error: devices are mapped on different hosts", name)
+		}
+	}
+
+	return &VolumeGroup{name: name, devices: devices, runner: devices[0].runner}, nil
+}
+
+/*
+This is a helper method that tells if two runners execute the commands
+on the same host, once unwrapped: the local runners all do, as well as
+the ssh runners reaching the same host, port and user.
+*/
+func sameHost(a CommandRunner, b CommandRunner) bool {
+	a, b = unwrapRunner(runnerOrLocal(a)), unwrapRunner(runnerOrLocal(b))
+	if isLocalRunner(a) || isLocalRunner(b) {
+		return isLocalRunner(a) && isLocalRunner(b)
+	}
+
+	sshA, okA := a.(*SSHRunner)
+	sshB, okB := b.(*SSHRunner)
+	if okA && okB {
+		return sshA.Host == sshB.Host && sshA.Port == sshB.Port && sshA.User == sshB.User
+	}
+	return a == b
+}
+
+/*
+This method runs a command on the host of the volume group.
+*/
+func (g *VolumeGroup) run(name string, args ...string) (string, error) {
+	return runnerOrLocal(g.runner).Run(name, args...)
+}
+
+/*
+Getter method for name
+*/
+func (g *VolumeGroup) GetName() string {
+	return g.name
+}
+
+/*
+Getter method for devices
+*/
+func (g *VolumeGroup) GetDevices() []*Device {
+	return g.devices
+}
+
+/*
+This method creates the logical volume `name` of `size` megabytes (all
+the free space if zero) as set by `options` (which can be nil), and
+returns it as a `Device` that is formatted when mounted.
+*/
+func (g *VolumeGroup) CreateLogicalVolume(name string, size uint64, options *LogicalVolumeOptions) (*Device, error) {
+	if options == nil {
+		options = &LogicalVolumeOptions{}
+	}
+
+	args := []string{"--yes", "--name", name}
+	if size > 0 {
+		args = append(args, "--size", strconv.FormatUint(size, 10)+"M")
+	} else {
+		args = append(args, "--extents", "100%FREE")
+	}
+
+	if options.Stripes > 1 {
+		args = append(args, "--stripes", strconv.Itoa(options.Stripes))
+		if options.StripeSize > 0 {
+			args = append(args, "--stripesize", strconv.FormatUint(options.StripeSize, 10)+"k")
+		}
+	}
+
+	if _, err := g.run("lvcreate", append(args, g.name)...); err != nil {
+		return nil, fmt.Errorf("Cannot create logical volume: %s on: %s, Error: %w", name, g.name, err)
+	}
+
+	return g.logicalVolume(name, options.FileSystemType)
+}
+
+/*
+This method returns the existing logical volume `name` as a `Device`,
+activating it if needed.
+*/
+func (g *VolumeGroup) LogicalVolume(name string, fsType string) (*Device, error) {
+	if _, err := g.run("lvchange", "--activate", "y", g.name+"/"+name); err != nil {
+		return nil, fmt.Errorf("Cannot activate logical volume: %s on: %s, Error: %w", name, g.name, err)
+	}
+	return g.logicalVolume(name, fsType)
+}
+
+/*
+This method returns the given logical volume as a `Device`, unmapping
+it only deactivates the volume: the devices of the group are unmapped
+on their own.
+*/
+func (g *VolumeGroup) logicalVolume(name string, fsType string) (*Device, error) {
+	if fsType == "" {
+		fsType = DefaultFileSystemType
+	}
+
+	volume := &Device{
+		path:           "/dev/" + g.name + "/" + name,
+		fileSystemType: fsType,
+		runner:         g.runner,
+		backend:        g.devices[0].backend,
+		group:          g,
+	}
+
+	volume.release = func() error {
+		if _, err := g.run("lvchange", "--activate", "n", g.name+"/"+name); err != nil {
+			return fmt.Errorf("Cannot deactivate logical volume: %s on: %s, Error: %w", name, g.name, err)
+		}
+		return nil
+	}
+
+	if err := volume.waitForUdev(0); err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
+/*
+This method deactivates the volume group, so its devices can be
+unmapped.
+*/
+func (g *VolumeGroup) Deactivate() error {
+	if _, err := g.run("vgchange", "--activate", "n", g.name); err != nil {
+		return fmt.Errorf("Cannot deactivate volume group: %s, Error: %w", g.name, err)
+	}
+	return nil
+}
+
+/*
+This method destroys the volume group along with its logical volumes
+and physical volume labels, the data is lost.
+*/
+func (g *VolumeGroup) Remove() error {
+	if _, err := g.run("vgremove", "--yes", "--force", g.name); err != nil {
+		return fmt.Errorf("Cannot remove volume group: %s, Error: %w", g.name, err)
+	}
+
+	for _, device := range g.devices {
+		if _, err := device.run("pvremove", "--yes", device.path); err != nil {
+			return fmt.Errorf("Cannot remove physical volume: %s, Error: %w", device.path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package blockdevice
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNewVolumeGroupSameHost(t *testing.T) {
+	connection := &Connection{mutex: &sync.RWMutex{}}
+	image := &Image{Connection: connection, name: "data"}
+	remote := &contextRecorder{}
+
+	tests := []struct {
+		runners []CommandRunner
+		wantErr bool
+	}{
+		{[]CommandRunner{image.hostRunner(nil), image.hostRunner(nil)}, false},
+		{[]CommandRunner{nil, &LocalRunner{}, image.hostRunner(nil)}, false},
+		{[]CommandRunner{NewSSHRunner("node1"), image.hostRunner(NewSSHRunner("node1"))}, false},
+		{[]CommandRunner{image.hostRunner(remote), &boundRunner{runner: remote}}, false},
+		{[]CommandRunner{NewSSHRunner("node1"), NewSSHRunner("node2")}, true},
+		{[]CommandRunner{image.hostRunner(nil), remote}, true},
+	}
+
+	for index, test := range tests {
+		var devices []*Device
+		for _, runner := range test.runners {
+			devices = append(devices, &Device{path: "/dev/rbd0", runner: runner})
+		}
+
+		_, err := newVolumeGroup("data", devices)
+		if (err != nil) != test.wantErr {
+			t.Errorf("newVolumeGroup() %d = %v, want error: %v", index, err, test.wantErr)
+		}
+	}
+}
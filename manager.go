@@ -0,0 +1,217 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//This struct represents a connection registered on a
+//`ConnectionManager`, established on first use.
+type managedConnection struct {
+	options    []ConnectionOption
+	mutex      sync.Mutex
+	connection *Connection
+}
+
+//This struct represents a set of named connections to several ceph
+//clusters (or users and pools of the same one), connected lazily and
+//closed together, e.g. to migrate or mirror volumes across clusters.
+type ConnectionManager struct {
+	mutex       sync.Mutex
+	connections map[string]*managedConnection
+	closed      bool
+}
+
+/*
+This method is a constructor for `ConnectionManager` objects.
+*/
+func NewConnectionManager() *ConnectionManager {
+	return &ConnectionManager{connections: make(map[string]*managedConnection)}
+}
+
+/*
+This method registers the connection `name`, established with the given
+`options` (see `NewConnection`) the first time it's requested.
+*/
+func (m *ConnectionManager) Register(name string, options ...ConnectionOption) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("Cannot register connection: %s, Error: manager is closed", name)
+	}
+
+	if _, ok := m.connections[name]; ok {
+		return fmt.Errorf("Cannot register connection: %s, Error: already registered", name)
+	}
+
+	m.connections[name] = &managedConnection{options: append([]ConnectionOption(nil), options...)}
+	return nil
+}
+
+/*
+This is a helper method that returns the registration of a connection.
+*/
+func (m *ConnectionManager) managed(name string) (*managedConnection, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil, fmt.Errorf("Cannot get connection: %s, Error: manager is closed", name)
+	}
+
+	managed, ok := m.connections[name]
+	if !ok {
+		return nil, fmt.Errorf("Cannot get connection: %s, Error: not registered", name)
+	}
+	return managed, nil
+}
+
+/*
+This method returns the connection `name`, connecting to its cluster if
+it's the first time it's requested, see `GetCtx`.
+*/
+func (m *ConnectionManager) Get(name string) (*Connection, error) {
+	return m.GetCtx(context.Background(), name)
+}
+
+/*
+This method returns the connection `name`, connecting to its cluster
+(giving up when `ctx` is done) if it's the first time it's requested.
+The connection is owned by the manager, it must not be shut down by
+the caller.
+*/
+func (m *ConnectionManager) GetCtx(ctx context.Context, name string) (*Connection, error) {
+	managed, err := m.managed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	if managed.connection != nil {
+		return managed.connection, nil
+	}
+
+	connection, err := NewConnectionCtx(ctx, managed.options...)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot connect: %s, Error: %w", name, err)
+	}
+	managed.connection = connection
+	return connection, nil
+}
+
+/*
+This method returns the names of the registered connections, sorted.
+*/
+func (m *ConnectionManager) Names() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	names := make([]string, 0, len(m.connections))
+	for name := range m.connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+This method tells if the connection `name` is established.
+*/
+func (m *ConnectionManager) IsConnected(name string) bool {
+	managed, err := m.managed(name)
+	if err != nil {
+		return false
+	}
+
+	managed.mutex.Lock()
+	defer managed.mutex.Unlock()
+	return managed.connection != nil
+}
+
+/*
+This method unregisters the connection `name`, closing it (see
+`Connection.Close`) if it was established.
+*/
+func (m *ConnectionManager) Remove(ctx context.Context, name string) error {
+	m.mutex.Lock()
+	managed, ok := m.connections[name]
+	delete(m.connections, name)
+	m.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("Cannot remove connection: %s, Error: not registered", name)
+	}
+	return managed.close(ctx)
+}
+
+/*
+This is a helper method that closes the connection if it was
+established.
+*/
+func (m *managedConnection) close(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.connection == nil {
+		return nil
+	}
+
+	err := m.connection.Close(ctx)
+	m.connection = nil
+	return err
+}
+
+/*
+This method closes the established connections (see `Connection.Close`)
+tearing their devices down, and the manager itself. The failures are
+returned together.
+*/
+func (m *ConnectionManager) Close(ctx context.Context) error {
+	m.mutex.Lock()
+	m.closed = true
+	names := make([]string, 0, len(m.connections))
+	for name := range m.connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	connections := m.connections
+	m.connections = make(map[string]*managedConnection)
+	m.mutex.Unlock()
+
+	var failed []string
+	for _, name := range names {
+		if err := connections[name].close(ctx); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Cannot close connections, Error: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+/*
+This method shuts the established connections down leaving their
+devices as they are (see `Connection.Shutdown`), and closes the manager.
+*/
+func (m *ConnectionManager) Shutdown() {
+	m.mutex.Lock()
+	m.closed = true
+	connections := m.connections
+	m.connections = make(map[string]*managedConnection)
+	m.mutex.Unlock()
+
+	for _, managed := range connections {
+		managed.mutex.Lock()
+		if managed.connection != nil {
+			managed.connection.Shutdown()
+			managed.connection = nil
+		}
+		managed.mutex.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//This struct represents the images `MapAll` failed to map, by image
+//spec (pool[/namespace]/image).
+type MapAllError struct {
+	Failures map[string]error
+}
+
+func (e *MapAllError) Error() string {
+	specs := make([]string, 0, len(e.Failures))
+	for spec := range e.Failures {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+
+	failed := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		failed = append(failed, fmt.Sprintf("%s: %s", spec, e.Failures[spec]))
+	}
+	return fmt.Sprintf("Cannot map %d images, Error: %s", len(failed), strings.Join(failed, "; "))
+}
+
+func (e *MapAllError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, err := range e.Failures {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+/*
+This method maps the given images concurrently (at most
+DefaultProvisionConcurrency at once) as set by `options`, the
+filesystems are left untouched. The udev settles are serialized, the
+devices are returned in the order of `images`, nil for the images that
+failed, which are reported by a `MapAllError`.
+*/
+func MapAll(images []*Image, options MapOptions) ([]*Device, error) {
+	devices := make([]*Device, len(images))
+	failures := make(map[string]error)
+
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, DefaultProvisionConcurrency)
+	for index, image := range images {
+		wait.Add(1)
+		go func(index int, image *Image) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			imageOptions := options
+			device, err := mapDevice(image, DefaultFileSystemType, &imageOptions)
+			if err != nil {
+				mutex.Lock()
+				failures[image.spec(image.name, options.Snapshot)] = err
+				mutex.Unlock()
+				return
+			}
+
+			image.track(device)
+			devices[index] = device
+		}(index, image)
+	}
+	wait.Wait()
+
+	if len(failures) > 0 {
+		return devices, &MapAllError{Failures: failures}
+	}
+	return devices, nil
+}
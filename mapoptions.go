@@ -0,0 +1,163 @@
+package blockdevice
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//This type represents the mechanism used to map an image.
+type Backend string
+
+const (
+	//Map using the `rbd` command line tool.
+	BackendKRBD Backend = "krbd"
+	//Map writing directly to /sys/bus/rbd, the `rbd` tool is not required.
+	BackendSysfs Backend = "sysfs"
+	//Map in userspace through rbd-nbd, krbd options are ignored.
+	BackendNBD Backend = "nbd"
+)
+
+//This struct represents the options used when mapping an image through
+//krbd, see the "Kernel rbd (krbd) options" section of rbd(8).
+type MapOptions struct {
+	//Mechanism used to map the image, BackendKRBD if empty.
+	Backend Backend
+	//Retry with BackendNBD when the kernel client can't map the image
+	//(missing module or unsupported image features).
+	FallbackToNBD bool
+	//Load the kernel module required by the backend if it's not loaded.
+	LoadKernelModule bool
+	//Host on which the image is mapped, formatted and mounted, the
+	//local host if nil (see `SSHRunner`).
+	Runner CommandRunner
+	//Map and mount the device read-only, the device is never formatted.
+	ReadOnly bool
+	//Map the given snapshot instead of the image head, implies ReadOnly.
+	Snapshot string
+	//Maximum number of in-flight requests (queue_depth).
+	QueueDepth int
+	//Acquire the exclusive lock also on reads (lock_on_read).
+	LockOnRead bool
+	//Disable automatic exclusive lock transitions (exclusive).
+	Exclusive bool
+	//Disable discard and write zeroes support (notrim).
+	NoTrim bool
+	//Arbitrary krbd options, keys with an empty value are passed as flags.
+	Options map[string]string
+	//Options used to mount the device (noatime, discard, nouuid, ...).
+	MountOptions []string
+	//Check and repair the filesystem before mounting it when it was not
+	//cleanly unmounted, falling back to a read-only mount on failure.
+	FsckOnMount bool
+	//Label set on the filesystem when the device is formatted, it takes
+	//precedence over Format.Label.
+	Label string
+	//Options used when the device is formatted (label, mkfs arguments).
+	Format *FormatOptions
+	//Partition of the image to format and mount instead of the whole
+	//device, the returned device unmaps the image.
+	Partition int
+	//What to do when the device already holds a filesystem,
+	//ExistingFSReformat also requires Format.Force.
+	OnExistingFS ExistingFSPolicy
+	//Load the librbd encryption of the image (see `EncryptionFormat`),
+	//implies BackendNBD.
+	Encryption *EncryptionOptions
+	//Propagation of the mount (shared, slave, private ...).
+	Propagation Propagation
+	//Mount namespace the device is mounted in, the host one if nil.
+	MountNamespace *MountNamespace
+	//SELinux contexts of the mount and relabeling of the mountpoint.
+	SELinux *SELinuxOptions
+	//Map read-only and layer a local throwaway COW device on top.
+	Overlay *OverlayOptions
+	//Time to wait for udev to create the device nodes after mapping
+	//(DefaultUdevTimeout if zero).
+	UdevTimeout time.Duration
+}
+
+/*
+This method returns the list of krbd options (as accepted by `rbd map -o`)
+described by the `MapOptions`.
+*/
+func (o *MapOptions) krbdOptions() []string {
+	if o == nil {
+		return nil
+	}
+
+	var options []string
+	if o.QueueDepth > 0 {
+		options = append(options, "queue_depth="+strconv.Itoa(o.QueueDepth))
+	}
+
+	if o.LockOnRead {
+		options = append(options, "lock_on_read")
+	}
+
+	if o.Exclusive {
+		options = append(options, "exclusive")
+	}
+
+	if o.NoTrim {
+		options = append(options, "notrim")
+	}
+
+	keys := make([]string, 0, len(o.Options))
+	for key := range o.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if value := o.Options[key]; value != "" {
+			options = append(options, key+"="+value)
+		} else {
+			options = append(options, key)
+		}
+	}
+
+	return options
+}
+
+/*
+This is a helper method that returns the backend the image is mapped
+with: BackendKRBD if none was requested, BackendNBD for the images with
+`Encryption`.
+*/
+func (o *MapOptions) backend() Backend {
+	if o.Backend != "" {
+		return o.Backend
+	}
+
+	if o.Encryption != nil {
+		return BackendNBD
+	}
+	return BackendKRBD
+}
+
+/*
+This method returns the extra arguments to append to the `rbd map`
+invocation.
+*/
+func (o *MapOptions) mapArgs() []string {
+	var args []string
+	if o == nil {
+		return args
+	}
+
+	if o.ReadOnly {
+		args = append(args, "--read-only")
+	}
+
+	if o.Snapshot != "" {
+		args = append(args, "--snap", o.Snapshot)
+	}
+
+	if options := o.krbdOptions(); len(options) > 0 {
+		args = append(args, "-o", strings.Join(options, ","))
+	}
+
+	return args
+}
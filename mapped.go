@@ -0,0 +1,168 @@
+package blockdevice
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+//This struct represents a device mapped on the system as reported
+//by `rbd showmapped`.
+type MappedDevice struct {
+	Id        string `json:"id"`
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	Image     string `json:"name"`
+	Snap      string `json:"snap"`
+	Device    string `json:"device"`
+}
+
+/*
+This is a helper method that parses the JSON output of `rbd showmapped`,
+newer releases return a list while older ones return an object keyed
+by device id.
+*/
+func parseMappedDevices(output string) ([]MappedDevice, error) {
+	var devices []MappedDevice
+	if output == "" {
+		return devices, nil
+	}
+
+	if err := json.Unmarshal([]byte(output), &devices); err != nil {
+		byId := make(map[string]MappedDevice)
+		if err := json.Unmarshal([]byte(output), &byId); err != nil {
+			return nil, parseFailure("rbd showmapped", output, err)
+		}
+
+		for id, device := range byId {
+			device.Id = id
+			devices = append(devices, device)
+		}
+	}
+
+	for index := range devices {
+		if devices[index].Snap == "-" {
+			devices[index].Snap = ""
+		}
+	}
+
+	return devices, nil
+}
+
+/*
+This method lists all the mapped devices available on the system
+as seen by the output of the 'rbd showmapped --format json' command
+*/
+func (c *Connection) ListMappedDevices() ([]MappedDevice, error) {
+	return listMappedDevices(c.hostRunner(nil))
+}
+
+/*
+This is a helper method that lists the mapped devices on the host
+targeted by `runner`.
+*/
+func listMappedDevices(runner CommandRunner) ([]MappedDevice, error) {
+	output, err := runner.Run("rbd", "showmapped", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMappedDevices(output)
+}
+
+/*
+This is a helper method that lists the devices mapped by rbd-nbd on the
+host targeted by `runner`, as seen by the output of the
+'rbd-nbd list-mapped --format json' command.
+*/
+func listNBDDevices(runner CommandRunner) ([]MappedDevice, error) {
+	output, err := runner.Run("rbd-nbd", "list-mapped", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []MappedDevice
+	if output == "" {
+		return devices, nil
+	}
+
+	var listed []struct {
+		Id        string `json:"id"`
+		Pool      string `json:"pool"`
+		Namespace string `json:"namespace"`
+		Image     string `json:"image"`
+		Snap      string `json:"snap"`
+		Device    string `json:"device"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, parseFailure("rbd-nbd list-mapped", output, err)
+	}
+
+	for _, device := range listed {
+		if device.Snap == "-" {
+			device.Snap = ""
+		}
+		devices = append(devices, MappedDevice(device))
+	}
+	return devices, nil
+}
+
+/*
+This method returns the devices on which the given image (and snapshot,
+empty for the image head) of the connection namespace is mapped, the
+rbd tool is run with `ctx`.
+*/
+func (c *Connection) findMappedDevices(ctx context.Context, pool string, name string, snap string) ([]MappedDevice, error) {
+	devices, err := listMappedDevices(bindRunner(c.hostRunner(nil), ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := c.GetNamespace()
+	var found []MappedDevice
+	for _, device := range devices {
+		if device.Pool == pool && device.Namespace == namespace && device.Image == name && device.Snap == snap {
+			found = append(found, device)
+		}
+	}
+
+	return found, nil
+}
+
+/*
+This is a helper method that returns the device the image (at `snap`,
+empty for the image head) is mapped on with `backend`, on the host
+targeted by `runner`, or an empty string.
+*/
+func (i *Image) mappedDevice(runner CommandRunner, backend Backend, snap string) string {
+	list := listMappedDevices
+	if backend == BackendNBD {
+		list = listNBDDevices
+	}
+
+	devices, err := list(runner)
+	if err != nil {
+		return ""
+	}
+
+	namespace := i.GetNamespace()
+	for _, device := range devices {
+		if device.Pool == i.pool && device.Namespace == namespace && device.Image == i.name && device.Snap == snap {
+			return device.Device
+		}
+	}
+	return ""
+}
+
+/*
+This is a helper method that returns the mountpoints of the given
+device on the host targeted by `runner`.
+*/
+func mountPointsOf(runner CommandRunner, device string) []string {
+	output, err := runner.Run("findmnt", "-n", "-o", "TARGET", "-S", device)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(output)
+}
@@ -0,0 +1,203 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Number of images whose metadata is fetched concurrently by `FindImages`.
+const DefaultFindImagesWorkers = 8
+
+//This struct represents an image found by `FindImages`.
+type ImageRef struct {
+	Pool      string
+	Namespace string
+	Name      string
+	Metadata  map[string]string
+}
+
+/*
+This is a helper method that returns the spec of an image (and
+snapshot) inside a namespace.
+*/
+func namespacedSpec(pool, namespace, name, snap string) string {
+	if namespace == "" {
+		return imageSpec(pool, name, snap)
+	}
+	return imageSpec(pool, namespace+"/"+name, snap)
+}
+
+/*
+This method returns the metadata (key/values) set on the image.
+*/
+func (i *Image) GetMetadata() (map[string]string, error) {
+	return i.imageMetadata(i.spec(i.name, ""))
+}
+
+/*
+This method sets a metadata key on the image.
+*/
+func (i *Image) SetMetadata(key, value string) error {
+	if _, err := i.run("rbd", "image-meta", "set", "--id", i.username, i.spec(i.name, ""), key, value); err != nil {
+		return fmt.Errorf("Cannot set metadata: %s on image: %s, Error: %w", key, i.name, err)
+	}
+	return nil
+}
+
+/*
+This method removes a metadata key from the image.
+*/
+func (i *Image) RemoveMetadata(key string) error {
+	if _, err := i.run("rbd", "image-meta", "remove", "--id", i.username, i.spec(i.name, ""), key); err != nil {
+		return fmt.Errorf("Cannot remove metadata: %s from image: %s, Error: %w", key, i.name, err)
+	}
+	return nil
+}
+
+/*
+This is a helper method that returns the metadata of the given image spec.
+*/
+func (c *Connection) imageMetadata(spec string) (map[string]string, error) {
+	output, err := c.run("rbd", "image-meta", "list", "--id", c.username, "--format", "json", spec)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get metadata of image: %s, Error: %w", spec, err)
+	}
+
+	metadata := make(map[string]string)
+	if output == "" {
+		return metadata, nil
+	}
+
+	if err := json.Unmarshal([]byte(output), &metadata); err != nil {
+		return nil, parseFailure("rbd image-meta list", output, err)
+	}
+	return metadata, nil
+}
+
+/*
+This is a helper method that returns the namespaces of a pool, the
+default namespace is returned as an empty string.
+*/
+func (c *Connection) poolNamespaces(pool string) ([]string, error) {
+	namespaces := []string{""}
+	output, err := c.run("rbd", "namespace", "list", "--id", c.username, "--format", "json", pool)
+	if err != nil || output == "" {
+		//releases without namespaces support only have the default one
+		return namespaces, nil
+	}
+
+	var list []struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, parseFailure("rbd namespace list", output, err)
+	}
+
+	for _, namespace := range list {
+		namespaces = append(namespaces, namespace.Name)
+	}
+	return namespaces, nil
+}
+
+/*
+This is a helper method that returns the images of a pool namespace.
+*/
+func (c *Connection) namespaceImages(pool, namespace string) ([]string, error) {
+	output, err := c.run("rbd", "ls", "--id", c.username, "--format", "json", "--pool", pool, "--namespace", namespace)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list images of pool: %s, Error: %w", pool, err)
+	}
+
+	var names []string
+	if output == "" {
+		return names, nil
+	}
+
+	if err := json.Unmarshal([]byte(output), &names); err != nil {
+		return nil, parseFailure("rbd ls", output, err)
+	}
+	return names, nil
+}
+
+/*
+This method returns the images of the cluster whose metadata matches
+the given label `selector` (see `ParseSelector`). Every namespace of
+`pools` is searched, all the pools of the cluster if none is given.
+*/
+func (c *Connection) FindImages(selector string, pools ...string) ([]ImageRef, error) {
+	parsed, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pools) == 0 {
+		if pools, err = c.rados().ListPools(); err != nil {
+			return nil, fmt.Errorf("Cannot list pools, Error: %s", err)
+		}
+	}
+
+	var candidates []ImageRef
+	for _, pool := range pools {
+		namespaces, err := c.poolNamespaces(pool)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, namespace := range namespaces {
+			names, err := c.namespaceImages(pool, namespace)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range names {
+				candidates = append(candidates, ImageRef{Pool: pool, Namespace: namespace, Name: name})
+			}
+		}
+	}
+
+	var (
+		wait     sync.WaitGroup
+		mutex    sync.Mutex
+		found    []ImageRef
+		firstErr error
+	)
+
+	queue := make(chan ImageRef)
+	for worker := 0; worker < DefaultFindImagesWorkers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for ref := range queue {
+				metadata, err := c.imageMetadata(namespacedSpec(ref.Pool, ref.Namespace, ref.Name, ""))
+
+				mutex.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				} else if err == nil && parsed.Matches(metadata) {
+					ref.Metadata = metadata
+					found = append(found, ref)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, ref := range candidates {
+		queue <- ref
+	}
+	close(queue)
+	wait.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(found, func(a, b int) bool {
+		return namespacedSpec(found[a].Pool, found[a].Namespace, found[a].Name, "") <
+			namespacedSpec(found[b].Pool, found[b].Namespace, found[b].Name, "")
+	})
+	return found, nil
+}
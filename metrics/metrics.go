@@ -0,0 +1,238 @@
+//This package exports the operations, devices and images of the
+//blockdevice package as Prometheus metrics.
+package metrics
+
+import (
+	"github.com/niedbalski/go-ceph-blockdevice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	Namespace = "blockdevice"
+)
+
+var (
+	deviceLabels = []string{"device", "pool", "image"}
+	imageLabels  = []string{"pool", "image"}
+
+	readIOPSDesc         = prometheus.NewDesc(Namespace+"_device_read_iops", "Completed reads per second.", deviceLabels, nil)
+	writeIOPSDesc        = prometheus.NewDesc(Namespace+"_device_write_iops", "Completed writes per second.", deviceLabels, nil)
+	readBytesDesc        = prometheus.NewDesc(Namespace+"_device_read_bytes_per_second", "Bytes read per second.", deviceLabels, nil)
+	writeBytesDesc       = prometheus.NewDesc(Namespace+"_device_write_bytes_per_second", "Bytes written per second.", deviceLabels, nil)
+	queueDepthDesc       = prometheus.NewDesc(Namespace+"_device_queue_depth", "Average number of queued requests.", deviceLabels, nil)
+	readLatencyDesc      = prometheus.NewDesc(Namespace+"_device_read_latency_seconds", "Average latency of the reads.", deviceLabels, nil)
+	writeLatencyDesc     = prometheus.NewDesc(Namespace+"_device_write_latency_seconds", "Average latency of the writes.", deviceLabels, nil)
+	utilizationDesc      = prometheus.NewDesc(Namespace+"_device_utilization_ratio", "Fraction of the time the device was busy.", deviceLabels, nil)
+	filesystemUsedDesc   = prometheus.NewDesc(Namespace+"_device_filesystem_used_bytes", "Bytes used on the mounted filesystem.", deviceLabels, nil)
+	filesystemSizeDesc   = prometheus.NewDesc(Namespace+"_device_filesystem_size_bytes", "Size of the mounted filesystem.", deviceLabels, nil)
+	imageProvisionedDesc = prometheus.NewDesc(Namespace+"_image_provisioned_bytes", "Provisioned size of the image.", imageLabels, nil)
+	imageUsedDesc        = prometheus.NewDesc(Namespace+"_image_used_bytes", "Bytes used by the image head.", imageLabels, nil)
+)
+
+//This struct represents a Prometheus collector of the operations of the
+//blockdevice package and of the tracked devices and images.
+type Collector struct {
+	//Interval over which the I/O statistics of the devices are sampled
+	//on every scrape (blockdevice.DefaultStatsInterval if zero).
+	StatsInterval time.Duration
+	operations    *prometheus.CounterVec
+	durations     *prometheus.HistogramVec
+	mutex         sync.Mutex
+	devices       map[*blockdevice.Device]bool
+	images        map[*blockdevice.Image]bool
+}
+
+/*
+This method is a constructor for `Collector` objects.
+*/
+func NewCollector() *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operations_total",
+			Help:      "Operations performed (map, mount, format, snapshot ...) by result.",
+		}, []string{"operation", "result"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the operations (map, mount, format, snapshot ...).",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"operation"}),
+		devices: make(map[*blockdevice.Device]bool),
+		images:  make(map[*blockdevice.Image]bool),
+	}
+}
+
+/*
+This method registers the collector on `registerer` and starts
+recording the operations of the blockdevice package, replacing any
+function set with `blockdevice.OnOperation`.
+*/
+func (c *Collector) Register(registerer prometheus.Registerer) error {
+	if err := registerer.Register(c); err != nil {
+		return err
+	}
+
+	blockdevice.OnOperation(c.observe)
+	return nil
+}
+
+/*
+This is a helper method that records an operation.
+*/
+func (c *Collector) observe(operation blockdevice.Operation) {
+	result := "success"
+	if operation.Err != nil {
+		result = "error"
+	}
+
+	c.operations.WithLabelValues(operation.Name, result).Inc()
+	c.durations.WithLabelValues(operation.Name).Observe(operation.Duration.Seconds())
+}
+
+/*
+This method adds a device whose I/O statistics and filesystem usage
+are exported.
+*/
+func (c *Collector) TrackDevice(device *blockdevice.Device) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.devices[device] = true
+}
+
+/*
+This method stops exporting the metrics of a device, e.g. before
+unmapping it.
+*/
+func (c *Collector) UntrackDevice(device *blockdevice.Device) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.devices, device)
+}
+
+/*
+This method adds an image whose usage is exported.
+*/
+func (c *Collector) TrackImage(image *blockdevice.Image) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.images[image] = true
+}
+
+/*
+This method stops exporting the usage of an image.
+*/
+func (c *Collector) UntrackImage(image *blockdevice.Image) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.images, image)
+}
+
+/*
+This method implements `prometheus.Collector`.
+*/
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.durations.Describe(ch)
+	for _, desc := range []*prometheus.Desc{
+		readIOPSDesc, writeIOPSDesc, readBytesDesc, writeBytesDesc, queueDepthDesc,
+		readLatencyDesc, writeLatencyDesc, utilizationDesc, filesystemUsedDesc,
+		filesystemSizeDesc, imageProvisionedDesc, imageUsedDesc,
+	} {
+		ch <- desc
+	}
+}
+
+/*
+This method implements `prometheus.Collector`, the devices are sampled
+concurrently so a scrape takes about `StatsInterval`.
+*/
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.durations.Collect(ch)
+
+	c.mutex.Lock()
+	devices := make([]*blockdevice.Device, 0, len(c.devices))
+	for device := range c.devices {
+		devices = append(devices, device)
+	}
+
+	images := make([]*blockdevice.Image, 0, len(c.images))
+	for image := range c.images {
+		images = append(images, image)
+	}
+	c.mutex.Unlock()
+
+	var wait sync.WaitGroup
+	for _, device := range devices {
+		wait.Add(1)
+		go func(device *blockdevice.Device) {
+			defer wait.Done()
+			c.collectDevice(ch, device)
+		}(device)
+	}
+
+	for _, image := range images {
+		provisioned, used, err := image.Usage()
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(imageUsedDesc, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(imageProvisionedDesc, prometheus.GaugeValue, float64(provisioned), image.GetPool(), image.GetName())
+		ch <- prometheus.MustNewConstMetric(imageUsedDesc, prometheus.GaugeValue, float64(used), image.GetPool(), image.GetName())
+	}
+	wait.Wait()
+}
+
+/*
+This is a helper method that collects the metrics of a device.
+*/
+func (c *Collector) collectDevice(ch chan<- prometheus.Metric, device *blockdevice.Device) {
+	labels := []string{device.GetPath(), "", ""}
+	if image := device.GetImage(); image != nil {
+		labels[1], labels[2] = image.GetPool(), image.GetName()
+	}
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	stats, err := device.Stats(c.StatsInterval)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(readIOPSDesc, err)
+	} else {
+		gauge(readIOPSDesc, stats.ReadIOPS)
+		gauge(writeIOPSDesc, stats.WriteIOPS)
+		gauge(readBytesDesc, stats.ReadThroughput)
+		gauge(writeBytesDesc, stats.WriteThroughput)
+		gauge(queueDepthDesc, stats.QueueDepth)
+		gauge(readLatencyDesc, stats.ReadLatency.Seconds())
+		gauge(writeLatencyDesc, stats.WriteLatency.Seconds())
+		gauge(utilizationDesc, stats.Utilization)
+	}
+
+	if device.GetMountPoint() == "" {
+		return
+	}
+
+	if used, total, err := device.Usage(); err == nil {
+		gauge(filesystemUsedDesc, float64(used))
+		gauge(filesystemSizeDesc, float64(total))
+	}
+}
+
+/*
+This method returns an http handler exposing the metrics gathered by
+`gatherer`, prometheus.DefaultGatherer if nil.
+*/
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,32 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/*
+This method sends a command to the monitors and decodes its JSON
+output into `out` (which can be nil).
+*/
+func (c *Connection) monCommand(command map[string]interface{}, out interface{}) error {
+	command["format"] = "json"
+	request, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	buffer, info, err := c.rados().MonCommand(request)
+	if err != nil {
+		return fmt.Errorf("Error running mon command: %s, Error: %w %s", command["prefix"], err, info)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(buffer, out); err != nil {
+		return parseFailure(fmt.Sprintf("mon command: %s", command["prefix"]), string(buffer), err)
+	}
+	return nil
+}
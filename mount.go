@@ -0,0 +1,80 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+This is a helper method that removes the ro/rw flags from a list of
+mount options.
+*/
+func withoutAccessMode(options []string) []string {
+	var filtered []string
+	for _, option := range options {
+		if option != "ro" && option != "rw" {
+			filtered = append(filtered, option)
+		}
+	}
+	return filtered
+}
+
+/*
+This method remounts the device in place (mount -o remount), `options`
+given on the call replace the ones recorded on the device, which are
+reused otherwise.
+*/
+func (d *Device) Remount(options ...string) error {
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot remount device: %s, Error: device is not mounted", d.path)
+	}
+
+	if len(options) > 0 {
+		d.mountOptions = options
+	}
+
+	return d.remount(d.mountReadOnly)
+}
+
+/*
+This method remounts the device read-only or read-write without an
+unmount cycle, e.g. to stop writes during maintenance. A device mapped
+read-only can't be switched to read-write.
+*/
+func (d *Device) SetReadOnly(readOnly bool) error {
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot remount device: %s, Error: device is not mounted", d.path)
+	}
+
+	if !readOnly && d.readOnly {
+		return fmt.Errorf("Cannot remount device: %s read-write, Error: device is mapped read-only", d.path)
+	}
+
+	return d.remount(readOnly)
+}
+
+/*
+Getter method for mountReadOnly, tells if the filesystem is currently
+mounted read-only.
+*/
+func (d *Device) IsMountedReadOnly() bool {
+	return d.readOnly || d.mountReadOnly
+}
+
+/*
+This method runs the remount with the recorded options.
+*/
+func (d *Device) remount(readOnly bool) error {
+	mode := "rw"
+	if readOnly {
+		mode = "ro"
+	}
+
+	options := append([]string{"remount", mode}, withoutAccessMode(d.mountOptions)...)
+	if _, err := d.runMounted("mount", "-o", strings.Join(options, ","), d.mountPoint); err != nil {
+		return fmt.Errorf("Cannot remount device: %s on: %s, Error: %w", d.path, d.mountPoint, err)
+	}
+
+	d.mountReadOnly = readOnly
+	return nil
+}
@@ -0,0 +1,123 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//This struct represents the pool scoped handles of a connection, shared
+//by its copies.
+type poolHandles struct {
+	mutex   sync.Mutex
+	handles map[string]*Connection
+}
+
+/*
+This is a helper method that destroys the IO contexts of the handles.
+*/
+func (p *poolHandles) destroy() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for name, handle := range p.handles {
+		if context := handle.ioContext(); context != nil {
+			context.Destroy()
+		}
+		delete(p.handles, name)
+	}
+}
+
+/*
+This method returns a handle of the connection scoped to the pool
+`name`, with its own IO context on the same rados connection, so the
+images of several pools are managed through a single connection. The
+handles are cached and reused, the connection itself is returned for
+its own pool.
+
+The handle shares the settings of the connection (runner, policy,
+dry-run, pool defaults, hooks and event handlers ...), changed through
+either of them, and its tracked devices. It's released by the
+`Shutdown` of the connection, not by its own.
+*/
+func (c *Connection) Pool(name string) (*Connection, error) {
+	if name == "" {
+		name = c.pool
+	}
+	return c.handle(name, "")
+}
+
+/*
+This is a helper method that returns the cached handle of the pool
+and RADOS namespace, or the root connection if they are its own.
+*/
+func (c *Connection) handle(pool string, namespace string) (*Connection, error) {
+	if c.parent != nil {
+		return c.parent.handle(pool, namespace)
+	}
+
+	if pool == c.pool && namespace == c.GetNamespace() {
+		return c, nil
+	}
+
+	key := pool
+	if namespace != "" {
+		key = pool + "/" + namespace
+	}
+
+	c.pools.mutex.Lock()
+	defer c.pools.mutex.Unlock()
+	if handle, ok := c.pools.handles[key]; ok {
+		return handle, nil
+	}
+
+	context, err := c.rados().OpenIOContext(pool)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening a IO Context with ceph on pool: %s, Error: %w", pool, err)
+	}
+
+	if namespace != "" {
+		context.SetNamespace(namespace)
+	}
+
+	c.mutex.RLock()
+	handle := *c
+	c.mutex.RUnlock()
+
+	handle.pool = pool
+	handle.namespace = namespace
+	handle.context = context
+	handle.parent = c
+	c.pools.handles[key] = &handle
+	return &handle, nil
+}
+
+/*
+This is a helper method that returns the connection holding the
+settings shared with its pool handles, the connection itself unless
+it's a handle.
+*/
+func (c *Connection) root() *Connection {
+	if c.parent != nil {
+		return c.parent
+	}
+	return c
+}
+
+/*
+This method returns the pools (<pool>[/<namespace>]) with a cached
+handle.
+*/
+func (c *Connection) GetPoolHandles() []string {
+	if c.parent != nil {
+		return c.parent.GetPoolHandles()
+	}
+
+	c.pools.mutex.Lock()
+	defer c.pools.mutex.Unlock()
+	var names []string
+	for name := range c.pools.handles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
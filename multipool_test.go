@@ -0,0 +1,58 @@
+package blockdevice
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPoolHandleSharesSettings(t *testing.T) {
+	root := fakeConnection(nil)
+	handle := &Connection{pool: "fast", parent: root, session: root.session, tracker: root.tracker, pools: root.pools, mutex: root.mutex}
+	root.pools.handles["fast"] = handle
+
+	defaults := &PoolDefaults{Features: FeatureLayering}
+	root.SetPoolDefaults("fast", defaults)
+	root.SetPolicy(&Policy{})
+	root.SetRunner(&contextRecorder{})
+	root.SetDryRun(&Plan{})
+
+	if handle.GetPoolDefaults("fast") != defaults || handle.GetPolicy() != root.GetPolicy() ||
+		handle.GetRunner() != root.GetRunner() || !handle.IsDryRun() {
+		t.Fatalf("the handle doesn't see the settings of its connection")
+	}
+
+	root.SetDryRun(nil)
+	if handle.IsDryRun() {
+		t.Errorf("the handle is still in dry-run mode")
+	}
+
+	events := 0
+	root.OnEvent(EventPostMap, func(info *EventInfo) error { events++; return nil })
+	handle.emit(&EventInfo{Event: EventPostMap})
+	if events != 1 {
+		t.Errorf("the event handlers of the connection got %d events of the handle, want 1", events)
+	}
+
+	quiesced := 0
+	handle.RegisterQuiesceHook("data", &FuncHook{Pre: func(ctx context.Context) error { quiesced++; return nil }}, 0)
+	(&Image{Connection: handle, name: "data"}).quiesced(func() error { return nil })
+	if quiesced != 1 || len(root.quiesceHooks["fast/data"]) != 1 {
+		t.Errorf("the quiesce hook of the handle isn't shared")
+	}
+}
+
+func TestPoolHandleDryRun(t *testing.T) {
+	root := fakeConnection(nil)
+	handle := &Connection{pool: "fast", parent: root, session: root.session, tracker: root.tracker, pools: root.pools, mutex: root.mutex}
+
+	plan, err := handle.DryRun(func(connection *Connection) error {
+		if connection.GetDryRun() == nil || connection.pool != "fast" {
+			t.Errorf("the copy of the handle isn't a dry-run of its pool")
+		}
+		return nil
+	})
+
+	if err != nil || plan == nil || root.IsDryRun() || handle.IsDryRun() {
+		t.Errorf("DryRun() = %v, %v, the handle and its connection must be left untouched", plan, err)
+	}
+}
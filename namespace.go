@@ -0,0 +1,80 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//This type represents the propagation of a mount, see mount(8).
+type Propagation string
+
+const (
+	PropagationShared   Propagation = "shared"
+	PropagationSlave    Propagation = "slave"
+	PropagationPrivate  Propagation = "private"
+	PropagationRShared  Propagation = "rshared"
+	PropagationRSlave   Propagation = "rslave"
+	PropagationRPrivate Propagation = "rprivate"
+)
+
+//This struct represents the mount namespace the filesystem of a device
+//is mounted in, e.g. the one of a container when the library runs in a
+//privileged container provisioning volumes for others.
+type MountNamespace struct {
+	//Process whose mount namespace is used (/proc/<pid>/ns/mnt).
+	PID int
+	//Namespace file (e.g. a bind mounted nsfs file), takes precedence
+	//over PID.
+	Path string
+}
+
+/*
+This method returns the namespace file.
+*/
+func (n *MountNamespace) file() string {
+	if n.Path != "" {
+		return n.Path
+	}
+	return "/proc/" + strconv.Itoa(n.PID) + "/ns/mnt"
+}
+
+/*
+This method runs a command acting on the mounts of the device inside
+its mount namespace, on the host one if it has none.
+*/
+func (d *Device) runMounted(name string, args ...string) (string, error) {
+	if d.namespace == nil {
+		return d.run(name, args...)
+	}
+	return d.run("nsenter", append([]string{"--mount=" + d.namespace.file(), "--", name}, args...)...)
+}
+
+/*
+This method sets the propagation of the mount of the device, it's
+applied right away if the device is mounted and on every later mount.
+*/
+func (d *Device) SetPropagation(propagation Propagation) error {
+	d.propagation = propagation
+	if !d.isMounted || propagation == "" {
+		return nil
+	}
+
+	if _, err := d.runMounted("mount", "--make-"+string(propagation), d.mountPoint); err != nil {
+		return fmt.Errorf("Cannot set %s propagation on: %s, Error: %w", propagation, d.mountPoint, err)
+	}
+	return nil
+}
+
+/*
+Getter method for propagation
+*/
+func (d *Device) GetPropagation() Propagation {
+	return d.propagation
+}
+
+/*
+Getter method for namespace
+*/
+func (d *Device) GetMountNamespace() *MountNamespace {
+	return d.namespace
+}
@@ -0,0 +1,228 @@
+package blockdevice
+
+import (
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"time"
+)
+
+//This struct represents the configuration of an `Observer`.
+type ObserverConfig struct {
+	Username   string
+	Pool       string
+	Cluster    string
+	ConfigFile string
+}
+
+//This struct represents a read-only view of a ceph cluster: it exposes
+//listings, usage, mappings and health queries but no method that
+//changes the cluster or the host, so it can be safely handed to
+//dashboards and other unprivileged consumers.
+type Observer struct {
+	connection *Connection
+}
+
+//This struct represents the read-only description of an image.
+type ImageSummary struct {
+	Name       string
+	Size       Size
+	ObjectSize Size
+	Objects    uint64
+	//Spec of the parent snapshot (pool/image@snap), empty unless the
+	//image is a clone.
+	Parent    string
+	Snapshots []string
+}
+
+//This struct represents the usage of the pool of an `Observer`.
+type PoolUsage struct {
+	Pool    string
+	Bytes   Size
+	Objects uint64
+}
+
+//This struct represents the health of the cluster.
+type ClusterHealth struct {
+	//HEALTH_OK, HEALTH_WARN or HEALTH_ERR.
+	Status string
+	//Summary of the failing checks, by check name.
+	Checks map[string]string
+}
+
+/*
+This method is a constructor for `Observer` objects, it connects to the
+cluster as set by `conf`. The observer must be closed after use.
+*/
+func NewObserver(conf ObserverConfig) (*Observer, error) {
+	connection, err := NewConnection(WithUser(conf.Username), WithPool(conf.Pool), WithCluster(conf.Cluster),
+		WithConfigFile(conf.ConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	return &Observer{connection: connection}, nil
+}
+
+/*
+This method closes the connection of the observer.
+*/
+func (o *Observer) Close() {
+	o.connection.Shutdown()
+}
+
+/*
+This method returns the names of the images of the pool.
+*/
+func (o *Observer) ListImages() ([]string, error) {
+	start := time.Now()
+	names, err := rbd.GetImageNames(o.connection.ioContext())
+	o.connection.logCall("list images", "", start, err)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list images of pool: %s, Error: %w", o.connection.pool, err)
+	}
+	return names, nil
+}
+
+/*
+This is a helper method that runs `fn` on the given image, opened
+read-only.
+*/
+func (o *Observer) withImage(name string, fn func(image *Image) error) error {
+	image, err := o.connection.GetImageByName(name)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	return fn(image)
+}
+
+/*
+This method returns the description of the given image.
+*/
+func (o *Observer) GetImage(name string) (*ImageSummary, error) {
+	summary := &ImageSummary{Name: name}
+	err := o.withImage(name, func(image *Image) error {
+		summary.Size = Size(image.ImageInfo.Size)
+		summary.ObjectSize = Size(image.ImageInfo.Obj_size)
+		summary.Objects = image.ImageInfo.Num_objs
+
+		details, err := image.Info()
+		if err != nil {
+			return err
+		}
+
+		if parent := details.Parent; parent != nil {
+			summary.Parent = namespacedSpec(parent.Pool, parent.Namespace, parent.Image, parent.Snapshot)
+		}
+
+		start := time.Now()
+		snapshots, err := image.GetSnapshotNames()
+		image.logCall("list snapshots", name, start, err)
+		if err != nil {
+			return fmt.Errorf("Cannot list snapshots of image: %s, Error: %w", name, err)
+		}
+
+		for _, snapshot := range snapshots {
+			summary.Snapshots = append(summary.Snapshots, snapshot.Name)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+/*
+This method returns the clients watching the given image.
+*/
+func (o *Observer) Watchers(name string) ([]Watcher, error) {
+	var watchers []Watcher
+	err := o.withImage(name, func(image *Image) (err error) {
+		watchers, err = image.Watchers()
+		return err
+	})
+	return watchers, err
+}
+
+/*
+This method returns the locks held on the given image.
+*/
+func (o *Observer) Locks(name string) ([]Lock, error) {
+	var locks []Lock
+	err := o.withImage(name, func(image *Image) (err error) {
+		locks, err = image.Locks()
+		return err
+	})
+	return locks, err
+}
+
+/*
+This method returns the metadata of the given image.
+*/
+func (o *Observer) GetMetadata(name string) (map[string]string, error) {
+	return o.connection.imageMetadata(o.connection.spec(name, ""))
+}
+
+/*
+This method returns the images matching the label `selector`, see
+`Connection.FindImages`.
+*/
+func (o *Observer) FindImages(selector string, pools ...string) ([]ImageRef, error) {
+	return o.connection.FindImages(selector, pools...)
+}
+
+/*
+This method returns the rbd devices mapped on the local host.
+*/
+func (o *Observer) ListMappedDevices() ([]MappedDevice, error) {
+	return o.connection.ListMappedDevices()
+}
+
+/*
+This method returns the usage of the pool.
+*/
+func (o *Observer) Usage() (*PoolUsage, error) {
+	stats, err := o.connection.ioContext().GetPoolStats()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get usage of pool: %s, Error: %w", o.connection.pool, err)
+	}
+
+	return &PoolUsage{
+		Pool:    o.connection.pool,
+		Bytes:   Size(stats.Num_bytes),
+		Objects: stats.Num_objects,
+	}, nil
+}
+
+/*
+This method returns the health of the cluster.
+*/
+func (o *Observer) Health() (*ClusterHealth, error) {
+	var health struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			Summary struct {
+				Message string `json:"message"`
+			} `json:"summary"`
+		} `json:"checks"`
+	}
+
+	if err := o.connection.monCommand(map[string]interface{}{"prefix": "health"}, &health); err != nil {
+		return nil, err
+	}
+
+	result := &ClusterHealth{Status: health.Status, Checks: make(map[string]string)}
+	for name, check := range health.Checks {
+		result.Checks[name] = check.Summary.Message
+	}
+	return result, nil
+}
+
+/*
+This method returns the crush location of the local host.
+*/
+func (o *Observer) HostTopology() (*HostTopology, error) {
+	return o.connection.HostTopology()
+}
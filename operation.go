@@ -0,0 +1,129 @@
+package blockdevice
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	OperationMap      = "map"
+	OperationMount    = "mount"
+	OperationFormat   = "format"
+	OperationSnapshot = "snapshot"
+	OperationUnMap    = "unmap"
+	OperationUnMount  = "unmount"
+	OperationCreate   = "create"
+	OperationResize   = "resize"
+	OperationRollback = "rollback"
+	OperationFlatten  = "flatten"
+	OperationCopy     = "copy"
+	OperationExport   = "export"
+	OperationImport   = "import"
+	OperationRemove   = "remove"
+	OperationPrune    = "prune"
+)
+
+//This struct represents an operation performed by the package, as
+//reported to the function set by `OnOperation`.
+type Operation struct {
+	Name string
+	//Pool and image operated on, empty if there's none.
+	Pool  string
+	Image string
+	//Device operated on, empty if there's none.
+	Device   string
+	Duration time.Duration
+	Err      error
+	//Connection of the image, used to annotate the spans.
+	connection *Connection
+}
+
+var operationHandler = struct {
+	sync.Mutex
+	handler func(Operation)
+}{}
+
+/*
+This method sets a function called after every operation (map, mount,
+format, snapshot ...), e.g. to feed a metrics system, nil removes it.
+*/
+func OnOperation(handler func(Operation)) {
+	operationHandler.Lock()
+	defer operationHandler.Unlock()
+	operationHandler.handler = handler
+}
+
+/*
+This is a helper method that starts the span of an operation, a child of
+the one of `ctx`. The commands run with the returned context are
+recorded as its children, the returned function ends it with `*err` (if
+not nil) and reports the operation to the `OnOperation` function, it's
+meant to be deferred.
+*/
+func observeOperation(ctx context.Context, operation Operation) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "blockdevice."+operation.Name, operation.attributes()...)
+
+	return ctx, func(err *error) {
+		operation.Duration = time.Since(start)
+		if err != nil {
+			operation.Err = *err
+		}
+		endSpan(span, operation.Err)
+		operation.report()
+	}
+}
+
+/*
+This is a helper method that logs an operation and reports it to the
+`OnOperation` function.
+*/
+func (o *Operation) report() {
+	o.log()
+
+	operationHandler.Lock()
+	handler := operationHandler.handler
+	operationHandler.Unlock()
+
+	if handler != nil {
+		handler(*o)
+	}
+}
+
+/*
+This is a helper method that starts an operation of the image, see
+`observeOperation`.
+*/
+func (i *Image) observe(ctx context.Context, name string) (context.Context, func(err *error)) {
+	return observeOperation(ctx, Operation{Name: name, Pool: i.pool, Image: i.name, connection: i.Connection})
+}
+
+/*
+This is a helper method that starts an operation of the connection on
+`image`, see `observeOperation`.
+*/
+func (c *Connection) observe(ctx context.Context, name string, image string) (context.Context, func(err *error)) {
+	return observeOperation(ctx, Operation{Name: name, Pool: c.pool, Image: image, connection: c})
+}
+
+/*
+This is a helper method that starts an operation of the device, see
+`observeOperation`, the span is a child of the one of the context
+bound to the device (see the *Ctx methods) and the commands of the
+device and of its layers are its children until it ends.
+*/
+func (d *Device) observe(name string) func(err *error) {
+	operation := Operation{Name: name, Device: d.path}
+	if d.image != nil {
+		operation.Pool, operation.Image = d.image.pool, d.image.name
+		operation.connection = d.image.Connection
+	}
+
+	ctx, end := observeOperation(runnerContext(d.runner), operation)
+	unbind := d.bindContext(ctx)
+	return func(err *error) {
+		unbind()
+		end(err)
+	}
+}
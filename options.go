@@ -0,0 +1,246 @@
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//This type represents an option of `NewConnection`.
+type ConnectionOption func(config *connectionConfig)
+
+//This struct represents how a connection reaches the cluster, as set by
+//the `ConnectionOption`s.
+type connectionConfig struct {
+	username       string
+	pool           string
+	cluster        string
+	configFile     string
+	monHosts       []string
+	fsid           string
+	key            string
+	keyFile        string
+	keyring        string
+	connectTimeout time.Duration
+	clientConfig   map[string]string
+	//apply the ceph options of CEPH_ARGS, see `WithEnv`
+	parseEnv bool
+}
+
+/*
+This option sets the cephx user of the connection (client.admin if
+empty).
+*/
+func WithUser(username string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.username = username
+	}
+}
+
+/*
+This option sets the name of the cluster, which selects its default
+configuration file (/etc/ceph/<cluster>.conf).
+*/
+func WithCluster(cluster string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.cluster = cluster
+	}
+}
+
+/*
+This option sets the pool of the connection (DefaultPoolName if empty).
+*/
+func WithPool(pool string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.pool = pool
+	}
+}
+
+/*
+This option sets the ceph configuration file read instead of the default
+one.
+*/
+func WithConfigFile(configFile string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.configFile = configFile
+	}
+}
+
+/*
+This option sets the monitors to contact (mon_host), as addresses or
+host names with an optional port.
+*/
+func WithMonHosts(hosts ...string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.monHosts = append([]string(nil), hosts...)
+	}
+}
+
+/*
+This option sets the fsid of the cluster, checked by the monitors when
+connecting without a configuration file.
+*/
+func WithFSID(fsid string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.fsid = fsid
+	}
+}
+
+/*
+This option sets the cephx secret (the base64 key) of the user, so no
+keyring is needed.
+*/
+func WithKey(key string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.key = key
+	}
+}
+
+/*
+This option sets the keyring file holding the key of the user.
+*/
+func WithKeyring(keyring string) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.keyring = keyring
+	}
+}
+
+/*
+This option sets how long connecting to the cluster may take
+(client_mount_timeout) before giving up.
+*/
+func WithConnectTimeout(timeout time.Duration) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.connectTimeout = timeout
+	}
+}
+
+/*
+This option sets ceph configuration options on the connection, they
+override the ones of the configuration file and the other options.
+*/
+func WithClientConfig(options map[string]string) ConnectionOption {
+	return func(config *connectionConfig) {
+		if config.clientConfig == nil {
+			config.clientConfig = make(map[string]string)
+		}
+
+		for option, value := range options {
+			config.clientConfig[option] = value
+		}
+	}
+}
+
+/*
+This is a helper method that builds the configuration described by
+`options`.
+*/
+func newConnectionConfig(options []ConnectionOption) *connectionConfig {
+	config := &connectionConfig{}
+	for _, option := range options {
+		if option != nil {
+			option(config)
+		}
+	}
+
+	if config.pool == "" {
+		config.pool = DefaultPoolName
+	}
+	return config
+}
+
+/*
+This is a helper method that returns the ceph configuration options set
+on the connection, `overrides` (which can be nil) taking precedence.
+*/
+func (config *connectionConfig) options(overrides map[string]string) map[string]string {
+	options := make(map[string]string)
+	if len(config.monHosts) > 0 {
+		options["mon_host"] = strings.Join(config.monHosts, ",")
+	}
+
+	if config.fsid != "" {
+		options["fsid"] = config.fsid
+	}
+
+	if config.key != "" {
+		options["key"] = config.key
+	}
+
+	if config.keyFile != "" {
+		options["keyfile"] = config.keyFile
+	}
+
+	if config.keyring != "" {
+		options["keyring"] = config.keyring
+	}
+
+	if config.connectTimeout > 0 {
+		seconds := int(config.connectTimeout.Round(time.Second) / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		options["client_mount_timeout"] = strconv.Itoa(seconds)
+	}
+
+	for _, set := range []map[string]string{config.clientConfig, overrides} {
+		for option, value := range set {
+			options[option] = value
+		}
+	}
+	return options
+}
+
+/*
+This is a helper method that tells if a configuration file must be read:
+the default one is skipped when the monitors are given, so no ceph.conf
+is needed at all.
+*/
+func (config *connectionConfig) readsConfigFile() bool {
+	if config.configFile != "" {
+		return true
+	}
+	return len(config.monHosts) == 0 && config.clientConfig["mon_host"] == ""
+}
+
+/*
+This is a helper method that returns the arguments pointing the ceph
+tools to the configuration file (when they run on the `local` host) or
+the monitors of the connection.
+*/
+func (config *connectionConfig) monitorArgs(local bool) []string {
+	var args []string
+	if config.configFile != "" && local {
+		args = append(args, "--conf", config.configFile)
+	}
+
+	if hosts := config.options(nil)["mon_host"]; hosts != "" && !config.readsConfigFile() {
+		args = append(args, "--mon-host", hosts)
+	}
+	return args
+}
+
+/*
+This is a helper method that returns a key identifying the configuration,
+equal configurations reach the cluster the same way.
+*/
+func (config *connectionConfig) identity() string {
+	options := config.options(nil)
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{config.username, config.pool, config.cluster, config.configFile}
+	if config.parseEnv {
+		parts = append(parts, EnvArgs+"="+os.Getenv(EnvArgs))
+	}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, options[name]))
+	}
+	return strings.Join(parts, "\x00")
+}
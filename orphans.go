@@ -0,0 +1,213 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//Kinds of debris found by `CleanupOrphans`.
+const (
+	//Mapped device whose image was removed from the cluster.
+	OrphanMissingImage = "missing-image"
+	//Mount whose rbd/nbd device is not mapped anymore.
+	OrphanStaleMount = "stale-mount"
+	//Mapped device neither mounted, held open nor managed (see
+	//`State`), left behind by a crashed process.
+	OrphanLeftoverMapping = "leftover-mapping"
+)
+
+//This struct represents the options used to clean up the orphans.
+type CleanupOptions struct {
+	//Remove the orphans, they're only reported otherwise. Leftover
+	//mappings may be legitimate (raw or swap mappings, idle disks,
+	//mappings of another provisioner), they're checked first.
+	Remove bool
+	//Host to clean up, the runner of the connection if nil.
+	Runner CommandRunner
+	//State file of the managed volumes, which are never leftovers
+	//(DefaultStateFile if empty).
+	StateFile string
+}
+
+//This struct represents an orphan found by `CleanupOrphans`.
+type Orphan struct {
+	Kind       string
+	Device     string
+	Pool       string
+	Namespace  string
+	Image      string
+	Snapshot   string
+	MountPoint string
+	//Whether it was removed, and the error if that failed.
+	Removed bool
+	Err     error
+}
+
+/*
+This method detects the debris left on the host by node restarts and
+crashed processes, it's only reported unless `options.Remove` is set
+(`options` can be nil), in which case it's removed:
+
+  - mapped devices whose image no longer exists, they are lazily
+    unmounted and force unmapped.
+  - mounts of rbd and nbd devices that are not mapped anymore, they are
+    lazily unmounted.
+  - mappings of existing images that are not mounted, not held open
+    and not managed, they are unmapped.
+
+The images are looked up through the pool handles of the connection
+scoped to their namespace (see `Namespace`), only the pools the connection can
+reach are checked. The
+orphans found are returned, a removal failure doesn't stop the
+cleanup.
+*/
+func (c *Connection) CleanupOrphans(options *CleanupOptions) ([]Orphan, error) {
+	if options == nil {
+		options = &CleanupOptions{}
+	}
+
+	runner := c.hostRunner(options.Runner)
+	mapped, err := listMappedDevices(runner)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list mapped devices, Error: %w", err)
+	}
+
+	state, err := LoadState(options.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := runner.Run("findmnt", "-rn", "-o", "SOURCE,TARGET")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list mounts, Error: %w", err)
+	}
+
+	//mounts of the rbd and nbd devices and their partitions, by device
+	mounts := make(map[string][]string)
+	var sources []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		whole := wholeDevice(fields[0])
+		if whole == "" {
+			continue
+		}
+
+		if _, ok := mounts[whole]; !ok {
+			sources = append(sources, whole)
+		}
+		mounts[whole] = append(mounts[whole], fields[1])
+	}
+
+	var orphans []Orphan
+	devices := make(map[string]bool)
+	for _, device := range mapped {
+		devices[device.Device] = true
+		if orphan := c.mappedOrphan(device, mounts[device.Device], state, runner, options.Remove); orphan != nil {
+			orphans = append(orphans, *orphan)
+		}
+	}
+
+	for _, source := range sources {
+		//nbd devices are not listed by rbd showmapped, they are stale
+		//only once disconnected
+		if devices[source] || (strings.HasPrefix(source, "/dev/nbd") && nbdConnected(runner, source)) {
+			continue
+		}
+
+		for _, mountPoint := range mounts[source] {
+			orphan := Orphan{Kind: OrphanStaleMount, Device: source, MountPoint: mountPoint}
+			if options.Remove {
+				stale := &Device{path: source, runner: runner, isMounted: true, mountPoint: mountPoint}
+				orphan.Err = stale.umount(mountPoint, &UnMountOptions{Lazy: true})
+				orphan.Removed = orphan.Err == nil
+			}
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	return orphans, nil
+}
+
+/*
+This is a helper method that returns the orphan the mapped `device`
+(mounted on `mountPoints`) is, removing it if `remove` is set, or nil if
+it's not one. The image of the device is only open during the check.
+*/
+func (c *Connection) mappedOrphan(device MappedDevice, mountPoints []string, state *State, runner CommandRunner, remove bool) *Orphan {
+	orphan := &Orphan{Device: device.Device, Pool: device.Pool, Namespace: device.Namespace, Image: device.Image, Snapshot: device.Snap}
+
+	connection, err := c.handle(device.Pool, device.Namespace)
+	if err != nil {
+		return nil
+	}
+
+	image, err := connection.GetImageByName(device.Image)
+	if image != nil {
+		defer image.Close()
+	}
+
+	switch {
+	case errors.Is(err, ErrImageNotFound):
+		orphan.Kind = OrphanMissingImage
+		image = nil
+	case err != nil:
+		return nil
+	case len(mountPoints) > 0 || state.Find(device.Pool, device.Namespace, device.Image, device.Snap) != nil:
+		return nil
+	default:
+		orphan.Kind = OrphanLeftoverMapping
+	}
+
+	target := newMappedDevice(image, device.Device, BackendKRBD, "", runner, &MapOptions{Snapshot: device.Snap})
+	if orphan.Kind == OrphanLeftoverMapping && len(target.holders(device.Device, false)) > 0 {
+		return nil
+	}
+
+	if remove {
+		for _, mountPoint := range mountPoints {
+			if orphan.Err = target.umount(mountPoint, &UnMountOptions{Lazy: true}); orphan.Err != nil {
+				break
+			}
+		}
+
+		if orphan.Err == nil {
+			orphan.Err = target.unmap(orphan.Kind == OrphanMissingImage)
+			orphan.Removed = orphan.Err == nil
+		}
+	}
+	return orphan
+}
+
+/*
+This is a helper method that returns the whole rbd or nbd device of a
+device or partition (/dev/rbd0p1 is /dev/rbd0), or an empty string for
+any other device.
+*/
+func wholeDevice(device string) string {
+	for _, prefix := range []string{"/dev/rbd", "/dev/nbd"} {
+		number := strings.TrimPrefix(device, prefix)
+		if number == device || number == "" || number[0] < '0' || number[0] > '9' {
+			continue
+		}
+
+		if index := strings.Index(number, "p"); index > 0 {
+			return device[:len(prefix)+index]
+		}
+		return device
+	}
+	return ""
+}
+
+/*
+This is a helper method that tells if the nbd device is connected, as
+reported by its sysfs pid attribute.
+*/
+func nbdConnected(runner CommandRunner, device string) bool {
+	_, err := runner.Run("test", "-e", "/sys/block/"+strings.TrimPrefix(device, "/dev/")+"/pid")
+	return err == nil
+}
@@ -0,0 +1,48 @@
+package blockdevice
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+//This struct answers the commands of a host with a mounted mapping and
+//an idle one.
+type orphansRunner struct {
+	unmapped []string
+}
+
+func (r *orphansRunner) Run(name string, args ...string) (string, error) {
+	switch {
+	case name == "rbd" && args[0] == "showmapped":
+		return `[{"id":"0","pool":"rbd","namespace":"","name":"data","snap":"-","device":"/dev/rbd0"},` +
+			`{"id":"1","pool":"rbd","namespace":"","name":"idle","snap":"-","device":"/dev/rbd1"}]`, nil
+	case name == "rbd" && args[0] == "unmap":
+		r.unmapped = append(r.unmapped, args[len(args)-1])
+	case name == "findmnt":
+		return "/dev/rbd0 /mnt/data", nil
+	}
+	return "", nil
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	fakeImages(t, 1024)
+	runner := &orphansRunner{}
+	connection := fakeConnection(runner)
+
+	orphans, err := connection.CleanupOrphans(&CleanupOptions{Remove: true, StateFile: filepath.Join(t.TempDir(), "state.json")})
+	if err != nil {
+		t.Fatalf("CleanupOrphans() = %v", err)
+	}
+
+	if len(orphans) != 1 || orphans[0].Kind != OrphanLeftoverMapping || orphans[0].Device != "/dev/rbd1" || !orphans[0].Removed {
+		t.Fatalf("CleanupOrphans() = %+v, want the idle mapping removed", orphans)
+	}
+
+	if len(runner.unmapped) != 1 || runner.unmapped[0] != "/dev/rbd1" {
+		t.Errorf("unmapped %v, want the idle mapping", runner.unmapped)
+	}
+
+	if users := sessionUsers(connection.session); users != 0 {
+		t.Errorf("the images checked are left open, the session has %d users", users)
+	}
+}
@@ -0,0 +1,90 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultOverlayDir  = "/var/tmp"
+	DefaultOverlaySize = 1024
+)
+
+//This struct represents an ephemeral writable layer on top of a read-only
+//mapping, writes go to a local dm-snapshot COW file and are discarded
+//when the device is unmapped.
+type OverlayOptions struct {
+	//Directory holding the COW file (DefaultOverlayDir if empty).
+	Dir string
+	//Size of the COW file in megabytes (DefaultOverlaySize if zero).
+	Size uint64
+	//Name of the device-mapper device (derived from the image if empty).
+	Name string
+}
+
+/*
+This method layers a dm-snapshot COW device on top of the (read-only)
+device and returns the resulting writable `Device`, pointing
+at /dev/mapper/<name>.
+*/
+func (d *Device) overlay(options *OverlayOptions) (*Device, error) {
+	dir := options.Dir
+	if dir == "" {
+		dir = DefaultOverlayDir
+	}
+
+	size := options.Size
+	if size == 0 {
+		size = DefaultOverlaySize
+	}
+
+	name := options.Name
+	if name == "" {
+		name = "rbd-overlay-" + strings.TrimPrefix(d.path, "/dev/")
+	}
+
+	sectors, err := d.run("blockdev", "--getsz", d.path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get size of device: %s, Error: %w", d.path, err)
+	}
+
+	cow, err := d.run("mktemp", "-p", dir, "rbd-overlay.XXXXXX")
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create overlay file on: %s, Error: %w", dir, err)
+	}
+
+	if _, err = d.run("truncate", "-s", strconv.FormatUint(size, 10)+"M", cow); err != nil {
+		d.run("rm", "-f", cow)
+		return nil, fmt.Errorf("Cannot allocate overlay file: %s, Error: %w", cow, err)
+	}
+
+	loop, err := d.run("losetup", "-f", "--show", cow)
+	if err != nil {
+		d.run("rm", "-f", cow)
+		return nil, fmt.Errorf("Cannot attach overlay file: %s, Error: %w", cow, err)
+	}
+
+	table := fmt.Sprintf("0 %s snapshot %s %s N 8", sectors, d.path, loop)
+	if _, err = d.run("dmsetup", "create", name, "--table", table); err != nil {
+		d.run("losetup", "-d", loop)
+		d.run("rm", "-f", cow)
+		return nil, fmt.Errorf("Cannot create overlay device: %s, Error: %w", name, err)
+	}
+
+	overlay := d.layer("/dev/mapper/"+name, func() error {
+		if _, err := d.run("dmsetup", "remove", name); err != nil {
+			return fmt.Errorf("Cannot remove overlay device: %s, Error: %w", name, err)
+		}
+
+		if _, err := d.run("losetup", "-d", loop); err != nil {
+			return fmt.Errorf("Cannot detach overlay file: %s, Error: %w", cow, err)
+		}
+
+		d.run("rm", "-f", cow)
+		return nil
+	})
+	overlay.readOnly = false
+
+	return overlay, nil
+}
@@ -0,0 +1,95 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//Maximum number of bytes of output kept as a sample.
+const MaxParseSampleSize = 4096
+
+//This struct represents a failure parsing the output of a command, the
+//raw output is kept so incompatible releases can be diagnosed.
+type ParseError struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Cannot parse output of: %s, Error: %s, output: %q", e.Command, e.Err, sample(e.Output))
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+//This struct represents the parse failures seen for a command.
+type ParseTelemetry struct {
+	Count  uint64
+	Sample string
+	Last   time.Time
+}
+
+var parseTelemetry = struct {
+	sync.Mutex
+	failures map[string]ParseTelemetry
+	handler  func(*ParseError)
+}{failures: make(map[string]ParseTelemetry)}
+
+/*
+This is a helper method that truncates an output to MaxParseSampleSize.
+*/
+func sample(output string) string {
+	if len(output) > MaxParseSampleSize {
+		return output[:MaxParseSampleSize] + "..."
+	}
+	return output
+}
+
+/*
+This method sets a function called for every parse failure, e.g. to
+feed a metrics system, nil removes it.
+*/
+func OnParseFailure(handler func(*ParseError)) {
+	parseTelemetry.Lock()
+	defer parseTelemetry.Unlock()
+	parseTelemetry.handler = handler
+}
+
+/*
+This method returns the parse failures seen so far by command.
+*/
+func ParseFailures() map[string]ParseTelemetry {
+	parseTelemetry.Lock()
+	defer parseTelemetry.Unlock()
+
+	failures := make(map[string]ParseTelemetry, len(parseTelemetry.failures))
+	for command, telemetry := range parseTelemetry.failures {
+		failures[command] = telemetry
+	}
+	return failures
+}
+
+/*
+This is a helper method that records a parse failure of the output of
+`command` and returns it as a `ParseError`.
+*/
+func parseFailure(command, output string, err error) error {
+	parseError := &ParseError{Command: command, Output: output, Err: err}
+
+	parseTelemetry.Lock()
+	telemetry := parseTelemetry.failures[command]
+	telemetry.Count++
+	telemetry.Sample = sample(output)
+	telemetry.Last = time.Now()
+	parseTelemetry.failures[command] = telemetry
+	handler := parseTelemetry.handler
+	parseTelemetry.Unlock()
+
+	if handler != nil {
+		handler(parseError)
+	}
+	return parseError
+}
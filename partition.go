@@ -0,0 +1,280 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//This type represents the partition table of a device.
+type PartitionTable string
+
+const (
+	PartitionTableGPT PartitionTable = "gpt"
+)
+
+//This type represents the GPT type code of a partition (as accepted by
+//`sgdisk --typecode`).
+type PartitionType string
+
+const (
+	PartitionLinux PartitionType = "8300"
+	PartitionSwap  PartitionType = "8200"
+	PartitionLVM   PartitionType = "8e00"
+	PartitionRAID  PartitionType = "fd00"
+)
+
+/*
+This method creates an empty partition table on the device, only GPT
+is supported. The device must not hold any signature unless
+`FormatOptions.Force` is set.
+*/
+func (d *Device) CreatePartitionTable(table PartitionTable) error {
+	if err := d.checkPartitionable(); err != nil {
+		return err
+	}
+
+	if table != PartitionTableGPT {
+		return fmt.Errorf("Cannot create partition table on device: %s, Error: unsupported table: %s", d.path, table)
+	}
+
+	current, err := d.signature()
+	if err != nil {
+		return fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	if current != "" && !d.formatOptions.Force {
+		return &ExistingFilesystemError{Device: d.path, FileSystemType: current, Expected: string(table) + " partition table"}
+	}
+
+	if _, err := d.run("sgdisk", "--zap-all", "--clear", d.path); err != nil {
+		return fmt.Errorf("Cannot create partition table on device: %s, Error: %w", d.path, err)
+	}
+
+	d.prepared = false
+	return d.rereadPartitions()
+}
+
+/*
+This method creates a partition of `size` megabytes (the rest of the
+device if zero) of the given type after the existing ones, and returns
+it as a `Device`. Swap partitions get the "swap" filesystem type, the
+others the one of the device.
+*/
+func (d *Device) CreatePartition(size uint64, partType PartitionType) (*Device, error) {
+	if err := d.checkPartitionable(); err != nil {
+		return nil, err
+	}
+
+	before, err := d.partitionNumbers()
+	if err != nil {
+		return nil, err
+	}
+
+	end := "0"
+	if size > 0 {
+		end = "+" + strconv.FormatUint(size, 10) + "M"
+	}
+
+	if _, err := d.run("sgdisk", "--new=0:0:"+end, "--typecode=0:"+string(partType), d.path); err != nil {
+		return nil, fmt.Errorf("Cannot create partition on device: %s, Error: %w", d.path, err)
+	}
+
+	if err := d.rereadPartitions(); err != nil {
+		return nil, err
+	}
+
+	after, err := d.partitionNumbers()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[int]bool)
+	for _, number := range before {
+		existing[number] = true
+	}
+
+	for _, number := range after {
+		if !existing[number] {
+			fsType := d.fileSystemType
+			if partType == PartitionSwap {
+				fsType = "swap"
+			}
+			return d.partitionDevice(number, fsType, 0)
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot find the partition created on device: %s", d.path)
+}
+
+/*
+This method checks that the device can be partitioned.
+*/
+func (d *Device) checkPartitionable() error {
+	switch {
+	case d.readOnly:
+		return fmt.Errorf("Cannot partition device: %s, Error: device is mapped read-only", d.path)
+	case d.isMounted:
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot partition device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	case d.parent != nil || d.disk != nil:
+		return fmt.Errorf("Cannot partition device: %s, Error: only whole mapped images can be partitioned", d.path)
+	}
+	return nil
+}
+
+/*
+This method makes the kernel reread the partition table of the device.
+*/
+func (d *Device) rereadPartitions() error {
+	if _, err := d.run("partprobe", d.path); err != nil {
+		if _, err := d.run("blockdev", "--rereadpt", d.path); err != nil {
+			return fmt.Errorf("Cannot reread partition table of device: %s, Error: %w", d.path, err)
+		}
+	}
+	return nil
+}
+
+/*
+This method returns the path of the given partition of the device.
+*/
+func (d *Device) partitionPath(number int) string {
+	return d.path + "p" + strconv.Itoa(number)
+}
+
+/*
+This method returns the numbers of the partitions known by the kernel.
+*/
+func (d *Device) partitionNumbers() ([]int, error) {
+	output, err := d.run("lsblk", "--noheadings", "--list", "--paths", "--output", "NAME,TYPE", d.path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list partitions of device: %s, Error: %w", d.path, err)
+	}
+
+	var numbers []int
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[1] != "part" || !strings.HasPrefix(fields[0], d.path+"p") {
+			continue
+		}
+
+		number, err := strconv.Atoi(strings.TrimPrefix(fields[0], d.path+"p"))
+		if err != nil {
+			return nil, parseFailure("lsblk", output, err)
+		}
+		numbers = append(numbers, number)
+	}
+
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+/*
+This method returns the partitions found on the device, e.g. on an
+image that was a full virtual machine disk, as `Device` objects with
+the filesystem type found on them (the one of the device if empty).
+*/
+func (d *Device) Partitions() ([]*Device, error) {
+	d.run("udevadm", "settle")
+
+	numbers, err := d.partitionNumbers()
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []*Device
+	for _, number := range numbers {
+		partition, err := d.Partition(number, 0)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+/*
+This method returns the given partition of the device as a `Device`,
+waiting up to `timeout` (DefaultUdevTimeout if zero) for its device node
+to appear.
+*/
+func (d *Device) Partition(number int, timeout time.Duration) (*Device, error) {
+	for _, partition := range d.partitions {
+		if partition.partition == number {
+			return partition, nil
+		}
+	}
+
+	partition, err := d.partitionDevice(number, d.fileSystemType, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if current, err := partition.GetFileSystemType(); err == nil && current != "" {
+		partition.fileSystemType = current
+	}
+
+	if d.image != nil {
+		d.image.track(partition)
+	}
+	return partition, nil
+}
+
+/*
+This method returns the given partition as a `Device`, waiting for its
+device node to appear. Unmapping the partition only unmounts it, the
+image is unmapped along with the whole device.
+*/
+func (d *Device) partitionDevice(number int, fsType string, timeout time.Duration) (*Device, error) {
+	formatOptions := d.formatOptions
+	formatOptions.Label = ""
+
+	partition := &Device{
+		path:           d.partitionPath(number),
+		fileSystemType: fsType,
+		readOnly:       d.readOnly,
+		image:          d.image,
+		backend:        d.backend,
+		runner:         d.runner,
+		snapshot:       d.snapshot,
+		disk:           d,
+		partition:      number,
+		onExistingFS:   d.onExistingFS,
+		mountOptions:   d.mountOptions,
+		fsckOnMount:    d.fsckOnMount,
+		formatOptions:  formatOptions,
+		propagation:    d.propagation,
+		namespace:      d.namespace,
+		selinux:        d.selinux,
+	}
+
+	if err := partition.waitForUdev(timeout); err != nil {
+		return nil, err
+	}
+
+	d.partitions = append(d.partitions, partition)
+	return partition, nil
+}
+
+/*
+Getter method for partition, zero for a whole device.
+*/
+func (d *Device) GetPartitionNumber() int {
+	return d.partition
+}
+
+/*
+This method releases the partitions of the device before it's
+unmapped.
+*/
+func (d *Device) releasePartitions() error {
+	for _, partition := range d.partitions {
+		if err := partition.UnMap(); err != nil {
+			return err
+		}
+	}
+
+	d.partitions = nil
+	return nil
+}
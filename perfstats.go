@@ -0,0 +1,67 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//This struct represents the performance of an image as seen by the
+//cluster, as reported by `rbd perf image iostat`.
+type ImagePerfStats struct {
+	Image string
+	//Operations and bytes per second.
+	ReadIOPS        float64
+	WriteIOPS       float64
+	ReadThroughput  float64
+	WriteThroughput float64
+	//Average latency of the operations.
+	ReadLatency  time.Duration
+	WriteLatency time.Duration
+}
+
+/*
+This method returns the performance of the active images of the pool
+(and RADOS namespace) of the connection, as measured by the OSDs so no
+image needs to be mapped. It requires the rbd_support manager module,
+and images without I/O are not reported.
+*/
+func (c *Connection) ImagePerfStats() ([]ImagePerfStats, error) {
+	pool := c.pool
+	if namespace := c.GetNamespace(); namespace != "" {
+		pool += "/" + namespace
+	}
+
+	output, err := c.run("rbd", "perf", "image", "iostat", "--id", c.username, "--iterations", "1", "--format", "json", pool)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get performance of pool: %s, Error: %w", pool, err)
+	}
+
+	var images []struct {
+		Image        string  `json:"image"`
+		ReadOps      float64 `json:"read_ops"`
+		WriteOps     float64 `json:"write_ops"`
+		ReadBytes    float64 `json:"read_bytes"`
+		WriteBytes   float64 `json:"write_bytes"`
+		ReadLatency  float64 `json:"read_latency"`
+		WriteLatency float64 `json:"write_latency"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &images); err != nil {
+		return nil, parseFailure("rbd perf image iostat", output, err)
+	}
+
+	stats := make([]ImagePerfStats, 0, len(images))
+	for _, image := range images {
+		stats = append(stats, ImagePerfStats{
+			Image:           image.Image,
+			ReadIOPS:        image.ReadOps,
+			WriteIOPS:       image.WriteOps,
+			ReadThroughput:  image.ReadBytes,
+			WriteThroughput: image.WriteBytes,
+			ReadLatency:     time.Duration(image.ReadLatency),
+			WriteLatency:    time.Duration(image.WriteLatency),
+		})
+	}
+	return stats, nil
+}
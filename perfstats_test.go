@@ -0,0 +1,30 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+//This struct answers rbd perf image iostat and records its pool spec.
+type iostatRunner struct {
+	pool string
+}
+
+func (r *iostatRunner) Run(name string, args ...string) (string, error) {
+	r.pool = args[len(args)-1]
+	return `[{"image":"data","read_ops":10,"write_ops":5,"read_bytes":40960,"write_bytes":20480,"read_latency":1000000,"write_latency":2000000}]`, nil
+}
+
+func TestImagePerfStatsNamespace(t *testing.T) {
+	runner := &iostatRunner{}
+	connection := fakeConnection(runner)
+	connection.SetNamespace("tenant-a")
+
+	stats, err := connection.ImagePerfStats()
+	if err != nil || len(stats) != 1 || stats[0].Image != "data" {
+		t.Fatalf("ImagePerfStats() = %+v, %v", stats, err)
+	}
+
+	if runner.pool != "rbd/tenant-a" {
+		t.Errorf("iostat run on %q, want the namespace of the connection", runner.pool)
+	}
+}
@@ -0,0 +1,238 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strings"
+	"sync"
+)
+
+const (
+	//Name of the plan steps that are librbd calls rather than commands.
+	PlanLibrbd = "librbd"
+)
+
+//This struct represents a step of a `Plan`: an external command or a
+//librbd call (`PlanLibrbd`) that would run.
+type PlanStep struct {
+	Name string
+	Args []string
+}
+
+func (s PlanStep) String() string {
+	words := []string{s.Name}
+	for _, arg := range s.Args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+//This struct represents the steps recorded by a connection in dry-run
+//mode, in the order they would run.
+type Plan struct {
+	mutex sync.Mutex
+	steps []PlanStep
+}
+
+/*
+This is a helper method that records a step on the plan.
+*/
+func (p *Plan) add(name string, args ...string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.steps = append(p.steps, PlanStep{Name: name, Args: append([]string(nil), args...)})
+}
+
+/*
+Getter method for steps
+*/
+func (p *Plan) GetSteps() []PlanStep {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]PlanStep(nil), p.steps...)
+}
+
+func (p *Plan) String() string {
+	var lines []string
+	for _, step := range p.GetSteps() {
+		lines = append(lines, step.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//Commands which only inspect the system, they're not recorded on a plan.
+var planProbes = map[string]bool{
+	"blkid":    true,
+	"cat":      true,
+	"df":       true,
+	"dmesg":    true,
+	"dumpe2fs": true,
+	"findmnt":  true,
+	"hostname": true,
+	"lsblk":    true,
+	"lsof":     true,
+	"ps":       true,
+	"readlink": true,
+	"stat":     true,
+	"test":     true,
+	"udevadm":  true,
+	"uname":    true,
+	"which":    true,
+}
+
+//Subcommands of the rbd tool which only inspect the cluster.
+var planRbdProbes = map[string]bool{
+	"children":   true,
+	"du":         true,
+	"get":        true,
+	"info":       true,
+	"list":       true,
+	"ls":         true,
+	"perf":       true,
+	"showmapped": true,
+	"status":     true,
+}
+
+//This struct represents a runner recording the commands on a plan
+//instead of running them, every command succeeds with no output.
+type planRunner struct {
+	plan *Plan
+}
+
+func (r *planRunner) Run(name string, args ...string) (string, error) {
+	if !isPlanProbe(name, args) {
+		r.plan.add(name, args...)
+	}
+	return "", nil
+}
+
+func (r *planRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	return r.Run(name, args...)
+}
+
+func (r *planRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return r.Run(name, args...)
+}
+
+/*
+This is a helper method that tells if the command only inspects the
+system or the cluster, so it has no place on a plan.
+*/
+func isPlanProbe(name string, args []string) bool {
+	switch name {
+	case "blockdev":
+		return len(args) > 0 && strings.HasPrefix(args[0], "--get")
+	case "fuser":
+		for _, arg := range args {
+			if arg == "-k" {
+				return false
+			}
+		}
+		return true
+	case "wipefs":
+		for _, arg := range args {
+			if arg == "--all" || arg == "-a" {
+				return false
+			}
+		}
+		return true
+	case "rbd":
+		//the subcommand words come before the first option
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				break
+			}
+			if planRbdProbes[arg] {
+				return true
+			}
+		}
+		return false
+	}
+	return planProbes[name]
+}
+
+/*
+This method puts the connection in dry-run mode: the images are not
+created, and the devices are not mapped, formatted, mounted, unmounted
+or unmapped, the commands and librbd calls that would run are recorded
+on `plan` instead. A nil plan leaves the dry-run mode.
+
+Read-only librbd calls (looking up images) still run, the commands only
+inspecting the system (blkid, lsblk ...) are not recorded. Every command
+is assumed to succeed with no output, so the plan of an
+operation is the one of a fresh image: blkid finds no filesystem and
+the device gets formatted.
+*/
+func (c *Connection) SetDryRun(plan *Plan) {
+	if c.parent != nil {
+		c.parent.SetDryRun(plan)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.dryRun = plan
+}
+
+/*
+Getter method for dryRun
+*/
+func (c *Connection) GetDryRun() *Plan {
+	if c.parent != nil {
+		return c.parent.GetDryRun()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.dryRun
+}
+
+/*
+This method tells if the connection is in dry-run mode.
+*/
+func (c *Connection) IsDryRun() bool {
+	return c.GetDryRun() != nil
+}
+
+/*
+This method runs `fn` with a dry-run copy of the connection (see
+`SetDryRun`) and returns the plan of what it would have done, the
+connection itself is left untouched.
+*/
+func (c *Connection) DryRun(fn func(connection *Connection) error) (*Plan, error) {
+	plan := &Plan{}
+	c.mutex.RLock()
+	//a copy of a handle holds the settings of its connection itself
+	planned := *c.root()
+	planned.pool, planned.namespace, planned.context = c.pool, c.namespace, c.context
+	c.mutex.RUnlock()
+
+	//the pool handles of the copy are dry-run too
+	planned.pools = &poolHandles{handles: make(map[string]*Connection)}
+	defer planned.pools.destroy()
+
+	planned.dryRun = plan
+	err := fn(&planned)
+	return plan, err
+}
+
+/*
+This is a helper method that returns the image of `size` megabytes
+that would be created in dry-run mode, it has no librbd handle.
+*/
+func (c *Connection) plannedImage(name string, size uint64) *Image {
+	return &Image{
+		ImageInfo:  &rbd.ImageInfo{Size: toMegs(size)},
+		Connection: c,
+		name:       name,
+	}
+}
+
+/*
+This is a helper method that returns the device path the image would
+be mapped on in dry-run mode.
+*/
+func plannedDevicePath(image *Image, snapshot string) string {
+	return fmt.Sprintf("/dev/rbd/%s", image.spec(image.name, snapshot))
+}
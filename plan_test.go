@@ -0,0 +1,58 @@
+package blockdevice
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsPlanProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"blkid", []string{"-p", "/dev/rbd0"}, true},
+		{"udevadm", []string{"settle"}, true},
+		{"test", []string{"-e", "/dev/rbd0"}, true},
+		{"lsblk", []string{"--noheadings", "/dev/rbd0"}, true},
+		{"blockdev", []string{"--getsz", "/dev/rbd0"}, true},
+		{"blockdev", []string{"--rereadpt", "/dev/rbd0"}, false},
+		{"fuser", []string{"-m", "/mnt"}, true},
+		{"fuser", []string{"-k", "-m", "/mnt"}, false},
+		{"wipefs", []string{"--json", "/dev/rbd0"}, true},
+		{"wipefs", []string{"--all", "/dev/rbd0"}, false},
+		{"rbd", []string{"showmapped", "--format", "json"}, true},
+		{"rbd", []string{"snap", "ls", "--id", "admin", "rbd/image"}, true},
+		{"rbd", []string{"config", "image", "get", "rbd/image", "key"}, true},
+		{"rbd", []string{"snap", "create", "--id", "ls", "rbd/image@snap"}, false},
+		{"rbd", []string{"map", "rbd/image"}, false},
+		{"mkfs.ext4", []string{"/dev/rbd0"}, false},
+		{"mount", []string{"/dev/rbd0", "/mnt"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isPlanProbe(test.name, test.args); got != test.want {
+			t.Errorf("isPlanProbe(%q, %q) = %v, want %v", test.name, test.args, got, test.want)
+		}
+	}
+}
+
+func TestPlanRunner(t *testing.T) {
+	plan := &Plan{}
+	runner := &planRunner{plan: plan}
+	runner.Run("blkid", "-p", "/dev/rbd0")
+	runner.Run("mkfs.ext4", "/dev/rbd0")
+	runner.RunWithInput([]byte("data"), "dd", "of=/tmp/key")
+
+	want := []PlanStep{{Name: "mkfs.ext4", Args: []string{"/dev/rbd0"}}, {Name: "dd", Args: []string{"of=/tmp/key"}}}
+	if got := plan.GetSteps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSteps() = %v, want %v", got, want)
+	}
+}
+
+func TestPlannedImageClose(t *testing.T) {
+	connection := &Connection{}
+	if err := connection.plannedImage("image", 1024).Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package blockdevice
+
+import (
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RuleMaxVolumesPerHost   = "MaxVolumesPerHost"
+	RuleMaxMountsPerImage   = "MaxMountsPerImage"
+	RuleMaxSizePerTenant    = "MaxSizePerTenant"
+	RuleForbiddenFileSystem = "ForbiddenFileSystems"
+)
+
+//This struct represents the platform guardrails enforced by a `Connection`
+//when images are created, mapped or mounted. Tenants are identified by pool, zero
+//values mean no limit.
+type Policy struct {
+	//Maximum number of rbd devices mapped on this host.
+	MaxVolumesPerHost int
+	//Maximum number of concurrent mounts of the same image (its devices
+	//and their partitions) on this host.
+	MaxMountsPerImage int
+	//Maximum provisioned size (in megabytes) of all the images of a pool.
+	MaxSizePerTenant uint64
+	//Filesystem types that devices can't be formatted or mounted with.
+	ForbiddenFileSystems []string
+}
+
+//This struct represents the violation of a `Policy` rule.
+type PolicyViolation struct {
+	Rule   string
+	Limit  string
+	Actual string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("Policy violation: %s, limit: %s, actual: %s", v.Rule, v.Limit, v.Actual)
+}
+
+/*
+This method sets the `Policy` enforced on the images and devices
+managed through this connection, nil disables it.
+*/
+func (c *Connection) SetPolicy(policy *Policy) {
+	if c.parent != nil {
+		c.parent.SetPolicy(policy)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policy = policy
+}
+
+/*
+Getter method for policy
+*/
+func (c *Connection) GetPolicy() *Policy {
+	if c.parent != nil {
+		return c.parent.GetPolicy()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.policy
+}
+
+/*
+This method checks that creating an image of `size` megabytes doesn't
+exceed the tenant quota.
+*/
+func (c *Connection) checkCreatePolicy(size uint64) error {
+	policy := c.GetPolicy()
+	if policy == nil || policy.MaxSizePerTenant == 0 {
+		return nil
+	}
+
+	used, err := c.provisionedSize()
+	if err != nil {
+		return err
+	}
+
+	if used+toMegs(size) > toMegs(policy.MaxSizePerTenant) {
+		return &PolicyViolation{
+			Rule:   RuleMaxSizePerTenant,
+			Limit:  strconv.FormatUint(policy.MaxSizePerTenant, 10) + "M",
+			Actual: strconv.FormatUint((used+toMegs(size))/toMegs(1), 10) + "M",
+		}
+	}
+
+	return nil
+}
+
+/*
+This method checks that mapping `image` and using it with `fsType`
+is allowed on the host targeted by `runner`.
+*/
+func (c *Connection) checkMapPolicy(image *Image, fsType string, runner CommandRunner) error {
+	policy := c.GetPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	for _, forbidden := range policy.ForbiddenFileSystems {
+		if fsType == forbidden {
+			return &PolicyViolation{
+				Rule:   RuleForbiddenFileSystem,
+				Limit:  fmt.Sprintf("%v", policy.ForbiddenFileSystems),
+				Actual: fsType,
+			}
+		}
+	}
+
+	if policy.MaxVolumesPerHost == 0 {
+		return nil
+	}
+
+	devices, err := listMappedDevices(runner)
+	if err != nil {
+		return fmt.Errorf("Cannot verify policy, Error: %s", err)
+	}
+
+	if limit := policy.MaxVolumesPerHost; len(devices) >= limit {
+		return &PolicyViolation{
+			Rule:   RuleMaxVolumesPerHost,
+			Limit:  strconv.Itoa(limit),
+			Actual: strconv.Itoa(len(devices) + 1),
+		}
+	}
+
+	return nil
+}
+
+/*
+This is a helper method that verifies that mounting `device`, a device
+of `image`, complies with the mounts limit of the policy: the mounts of
+every device the image is mapped on, and of their partitions, are
+counted on the host of the device.
+*/
+func (c *Connection) checkMountPolicy(image *Image, device *Device) error {
+	policy := c.GetPolicy()
+	if policy == nil || policy.MaxMountsPerImage == 0 {
+		return nil
+	}
+
+	devices, err := listMappedDevices(device.runner)
+	if err != nil {
+		return fmt.Errorf("Cannot verify policy, Error: %s", err)
+	}
+
+	//nbd devices are not listed by rbd showmapped
+	whole := map[string]bool{wholeDevice(device.path): true}
+	for _, mapped := range devices {
+		if mapped.Pool == image.pool && mapped.Namespace == image.GetNamespace() && mapped.Image == image.name {
+			whole[mapped.Device] = true
+		}
+	}
+
+	output, err := device.run("findmnt", "-rn", "-o", "SOURCE,TARGET")
+	if err != nil {
+		return fmt.Errorf("Cannot verify policy, Error: %s", err)
+	}
+
+	mounts := 0
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		//bind mounts are listed as <device>[<path>]
+		source, _, _ := strings.Cut(fields[0], "[")
+		if whole[wholeDevice(source)] {
+			mounts++
+		}
+	}
+
+	if limit := policy.MaxMountsPerImage; mounts >= limit {
+		return &PolicyViolation{
+			Rule:   RuleMaxMountsPerImage,
+			Limit:  strconv.Itoa(limit),
+			Actual: strconv.Itoa(mounts + 1),
+		}
+	}
+	return nil
+}
+
+/*
+This method returns the sum, in bytes, of the provisioned size of
+all the images in the connection pool.
+*/
+func (c *Connection) provisionedSize() (uint64, error) {
+	start := time.Now()
+	names, err := rbd.GetImageNames(c.ioContext())
+	c.logCall("list images", "", start, err)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot list images on pool: %s, Error: %w", c.pool, err)
+	}
+
+	var total uint64
+	for _, name := range names {
+		start := time.Now()
+		image := rbd.GetImage(c.ioContext(), name)
+		err := image.Open(true)
+		c.logCall("open", name, start, err)
+		if err != nil {
+			return 0, fmt.Errorf("Cannot open image: %s, Error: %w", name, err)
+		}
+
+		start = time.Now()
+		size, err := image.GetSize()
+		c.logCall("get size", name, start, err)
+		image.Close()
+		if err != nil {
+			return 0, fmt.Errorf("Cannot get size of image: %s, Error: %w", name, err)
+		}
+		total += size
+	}
+
+	return total, nil
+}
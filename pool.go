@@ -0,0 +1,256 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPoolMaxConnections = 4
+	DefaultPoolMaxIdle        = 5 * time.Minute
+)
+
+//This struct represents the options of a `ConnectionPool`.
+type ConnectionPoolOptions struct {
+	//Connections open at once per set of connection options
+	//(DefaultPoolMaxConnections if zero), `Get` blocks beyond it.
+	MaxConnections int
+	//Idle connections unused for longer are shut down
+	//(DefaultPoolMaxIdle if zero).
+	MaxIdle time.Duration
+	//Check run on an idle connection before handing it out again, a
+	//failed connection is replaced, the pool stats are fetched if nil.
+	HealthCheck func(connection *Connection) error
+}
+
+//This type represents what identifies the connections of a pool, see
+//`connectionConfig.identity`.
+type connectionKey string
+
+//This struct represents an idle connection of a pool.
+type idleConnection struct {
+	connection *Connection
+	since      time.Time
+}
+
+//This struct represents the connections sharing a `connectionKey`.
+type connectionBucket struct {
+	//a slot is held by every connection handed out or being opened
+	slots chan struct{}
+	idle  []idleConnection
+}
+
+//This struct represents a bounded set of rados connections handed out
+//to goroutines and reused, so operations don't pay the connection
+//setup.
+type ConnectionPool struct {
+	options ConnectionPoolOptions
+	mutex   sync.Mutex
+	buckets map[connectionKey]*connectionBucket
+	leased  map[*Connection]connectionKey
+	closed  bool
+}
+
+/*
+This method is a constructor for `ConnectionPool` objects, `options`
+can be nil.
+*/
+func NewConnectionPool(options *ConnectionPoolOptions) *ConnectionPool {
+	pool := &ConnectionPool{
+		buckets: make(map[connectionKey]*connectionBucket),
+		leased:  make(map[*Connection]connectionKey),
+	}
+
+	if options != nil {
+		pool.options = *options
+	}
+
+	if pool.options.MaxConnections <= 0 {
+		pool.options.MaxConnections = DefaultPoolMaxConnections
+	}
+
+	if pool.options.MaxIdle <= 0 {
+		pool.options.MaxIdle = DefaultPoolMaxIdle
+	}
+
+	if pool.options.HealthCheck == nil {
+		pool.options.HealthCheck = func(connection *Connection) error {
+			_, err := connection.ioContext().GetPoolStats()
+			return err
+		}
+	}
+	return pool
+}
+
+/*
+This is a helper method that returns the bucket of a key.
+*/
+func (p *ConnectionPool) bucket(key connectionKey) (*connectionBucket, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, fmt.Errorf("Cannot get connection, Error: pool is closed")
+	}
+
+	bucket, ok := p.buckets[key]
+	if !ok {
+		bucket = &connectionBucket{slots: make(chan struct{}, p.options.MaxConnections)}
+		p.buckets[key] = bucket
+	}
+	return bucket, nil
+}
+
+/*
+This method hands out a connection to the cluster, see `NewConnection`
+for the options: a healthy idle connection is reused, otherwise a
+new one is opened. When `MaxConnections` are in use it blocks until
+one is returned or `ctx` is done. The connection must be given back
+with `Put`, or `Discard` if it's broken.
+*/
+func (p *ConnectionPool) Get(ctx context.Context, options ...ConnectionOption) (*Connection, error) {
+	config := newConnectionConfig(options)
+	key := connectionKey(config.identity())
+	bucket, err := p.bucket(key)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case bucket.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("Cannot get connection to pool: %s, Error: %w", config.pool, ctx.Err())
+	}
+
+	for {
+		p.mutex.Lock()
+		if len(bucket.idle) == 0 {
+			p.mutex.Unlock()
+			break
+		}
+
+		last := bucket.idle[len(bucket.idle)-1]
+		bucket.idle = bucket.idle[:len(bucket.idle)-1]
+		p.mutex.Unlock()
+
+		if time.Since(last.since) > p.options.MaxIdle || p.options.HealthCheck(last.connection) != nil {
+			last.connection.Shutdown()
+			continue
+		}
+		return p.lease(last.connection, key), nil
+	}
+
+	connection, err := NewConnectionCtx(ctx, options...)
+	if err != nil {
+		<-bucket.slots
+		return nil, err
+	}
+	return p.lease(connection, key), nil
+}
+
+/*
+This is a helper method that records a connection as handed out.
+*/
+func (p *ConnectionPool) lease(connection *Connection, key connectionKey) *Connection {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.leased[connection] = key
+	return connection
+}
+
+/*
+This is a helper method that takes a connection back, returning its
+bucket.
+*/
+func (p *ConnectionPool) release(connection *Connection) *connectionBucket {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key, ok := p.leased[connection]
+	if !ok {
+		return nil
+	}
+	delete(p.leased, connection)
+
+	bucket := p.buckets[key]
+	<-bucket.slots
+	return bucket
+}
+
+/*
+This method gives back a connection handed out by `Get` so it's reused,
+connections given back to a closed pool are shut down.
+*/
+func (p *ConnectionPool) Put(connection *Connection) {
+	bucket := p.release(connection)
+	if bucket == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		connection.Shutdown()
+		return
+	}
+	bucket.idle = append(bucket.idle, idleConnection{connection: connection, since: time.Now()})
+}
+
+/*
+This method gives back a broken connection handed out by `Get`, it's
+shut down and will be replaced.
+*/
+func (p *ConnectionPool) Discard(connection *Connection) {
+	if p.release(connection) != nil {
+		connection.Shutdown()
+	}
+}
+
+/*
+This method shuts down the idle connections unused for longer than
+`MaxIdle`, it can be called periodically to free the connections once
+the load drops.
+*/
+func (p *ConnectionPool) Prune() {
+	p.mutex.Lock()
+	var expired []*Connection
+	for _, bucket := range p.buckets {
+		var kept []idleConnection
+		for _, idle := range bucket.idle {
+			if time.Since(idle.since) > p.options.MaxIdle {
+				expired = append(expired, idle.connection)
+				continue
+			}
+			kept = append(kept, idle)
+		}
+		bucket.idle = kept
+	}
+	p.mutex.Unlock()
+
+	for _, connection := range expired {
+		connection.Shutdown()
+	}
+}
+
+/*
+This method shuts down the idle connections and closes the pool, the
+connections still handed out are shut down when given back.
+*/
+func (p *ConnectionPool) Close() {
+	p.mutex.Lock()
+	p.closed = true
+	var idle []*Connection
+	for _, bucket := range p.buckets {
+		for _, connection := range bucket.idle {
+			idle = append(idle, connection.connection)
+		}
+		bucket.idle = nil
+	}
+	p.mutex.Unlock()
+
+	for _, connection := range idle {
+		connection.Shutdown()
+	}
+}
@@ -0,0 +1,198 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//RBD image feature bits.
+const (
+	FeatureLayering uint64 = 1 << iota
+	FeatureStripingV2
+	FeatureExclusiveLock
+	FeatureObjectMap
+	FeatureFastDiff
+	FeatureDeepFlatten
+	FeatureJournaling
+	FeatureDataPool
+)
+
+//Names of the feature bits as accepted by `rbd create --image-feature`.
+var featureNames = map[uint64]string{
+	FeatureLayering:      "layering",
+	FeatureStripingV2:    "striping",
+	FeatureExclusiveLock: "exclusive-lock",
+	FeatureObjectMap:     "object-map",
+	FeatureFastDiff:      "fast-diff",
+	FeatureDeepFlatten:   "deep-flatten",
+	FeatureJournaling:    "journaling",
+	FeatureDataPool:      "data-pool",
+}
+
+//This struct represents the defaults applied to the images created on
+//a pool, zero values keep the cluster defaults.
+type PoolDefaults struct {
+	//Image feature bits (FeatureLayering | FeatureExclusiveLock ...).
+	Features uint64
+	//Object size in bytes, must be a power of two.
+	ObjectSize uint64
+	//Minimum and maximum image size in megabytes.
+	MinSize uint64
+	MaxSize uint64
+	//QoS configuration set on every new image, e.g.
+	//"rbd_qos_iops_limit": "1000".
+	QoS map[string]string
+}
+
+/*
+This method registers the defaults applied by `GetOrCreateImage` to the
+images created on `pool`, nil removes them.
+*/
+func (c *Connection) SetPoolDefaults(pool string, defaults *PoolDefaults) {
+	if c.parent != nil {
+		c.parent.SetPoolDefaults(pool, defaults)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.poolDefaults == nil {
+		c.poolDefaults = make(map[string]*PoolDefaults)
+	}
+
+	if defaults == nil {
+		delete(c.poolDefaults, pool)
+		return
+	}
+	c.poolDefaults[pool] = defaults
+}
+
+/*
+Getter method for the defaults of a pool, nil if none were registered.
+*/
+func (c *Connection) GetPoolDefaults(pool string) *PoolDefaults {
+	if c.parent != nil {
+		return c.parent.GetPoolDefaults(pool)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.poolDefaults[pool]
+}
+
+/*
+This method validates the size (in megabytes) of a new image.
+*/
+func (d *PoolDefaults) validateSize(size uint64) error {
+	if d.MinSize > 0 && size < d.MinSize {
+		return fmt.Errorf("Image size: %dM is below the pool minimum: %dM", size, d.MinSize)
+	}
+
+	if d.MaxSize > 0 && size > d.MaxSize {
+		return fmt.Errorf("Image size: %dM exceeds the pool maximum: %dM", size, d.MaxSize)
+	}
+	return nil
+}
+
+/*
+This method creates an image of `size` megabytes on the connection pool
+applying the pool defaults and `options`, it's removed if the QoS of the
+pool can't be set on it.
+*/
+func (c *Connection) createImage(name string, size uint64, options *CreateImageOptions) (image *Image, err error) {
+	ctx, end := c.observe(context.Background(), OperationCreate, name)
+	defer end(&err)
+
+	defaults := c.GetPoolDefaults(c.pool)
+	if defaults == nil {
+		defaults = &PoolDefaults{}
+	}
+
+	if err := defaults.validateSize(size); err != nil {
+		return nil, fmt.Errorf("Cannot create image:%s on pool: %s, Error: %w", name, c.pool, err)
+	}
+
+	plan := c.GetDryRun()
+	start := time.Now()
+	switch {
+	case defaults.ObjectSize != 0 || options.Preallocate:
+		err = c.createImageWithTool(ctx, name, size, defaults, options)
+	case plan != nil:
+		plan.add(PlanLibrbd, "create", c.spec(name, ""), "--size", strconv.FormatUint(size, 10)+"M",
+			"--features", strconv.FormatUint(defaults.Features, 10))
+	case defaults.Features != 0:
+		_, err = rbd.Create(c.ioContext(), name, toMegs(size), defaults.Features)
+		c.logCall("create", name, start, err)
+	default:
+		_, err = rbd.Create(c.ioContext(), name, toMegs(size))
+		c.logCall("create", name, start, err)
+	}
+
+	if err != nil && isExistsError(err) {
+		return nil, kindErrorf(ErrImageExists, err, "Cannot create image:%s of size:%d on pool: %s, Error: %s", name, toMegs(size), c.pool, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create image:%s of size:%d on pool: %s, Error: %w", name, toMegs(size), c.pool, err)
+	}
+
+	keys := make([]string, 0, len(defaults.QoS))
+	for key := range defaults.QoS {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := c.runCtx(ctx, "rbd", "config", "image", "set", "--id", c.username,
+			c.spec(name, ""), key, defaults.QoS[key]); err != nil {
+			err = fmt.Errorf("Cannot set %s on image: %s, Error: %w", key, name, err)
+			//the image is removed so a retry can create it again
+			if _, removeErr := c.runCtx(ctx, "rbd", "rm", "--id", c.username, c.spec(name, "")); removeErr != nil {
+				err = fmt.Errorf("%w, Rollback error: %s", err, removeErr)
+			}
+			return nil, err
+		}
+	}
+
+	if plan != nil {
+		return c.plannedImage(name, size), nil
+	}
+	return NewImage(rbd.GetImage(c.ioContext(), name), c, name)
+}
+
+/*
+This method creates an image using the rbd tool, the librbd binding
+can't set the object size nor preallocate the image. The tool is run
+with `ctx`.
+*/
+func (c *Connection) createImageWithTool(ctx context.Context, name string, size uint64, defaults *PoolDefaults, options *CreateImageOptions) error {
+	args := []string{"create", "--id", c.username, "--size", strconv.FormatUint(size, 10) + "M"}
+
+	if defaults.ObjectSize != 0 {
+		if bits.OnesCount64(defaults.ObjectSize) != 1 {
+			return fmt.Errorf("Object size: %d is not a power of two", defaults.ObjectSize)
+		}
+		args = append(args, "--object-size", strconv.FormatUint(defaults.ObjectSize, 10)+"B")
+	}
+
+	if defaults.Features != 0 {
+		for bit := uint64(1); bit <= FeatureDataPool; bit <<= 1 {
+			if defaults.Features&bit != 0 {
+				args = append(args, "--image-feature", featureNames[bit])
+			}
+		}
+	}
+
+	if !options.Preallocate {
+		_, err := c.runCtx(ctx, "rbd", append(args, c.spec(name, ""))...)
+		return err
+	}
+
+	_, err := c.runWithProgress(ctx, options.Progress, append(args, "--thick-provision", c.spec(name, ""))...)
+	return err
+}
@@ -0,0 +1,40 @@
+package blockdevice
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//This struct fails setting the configuration of the images and records
+//the images removed.
+type qosFailingRunner struct {
+	removed []string
+}
+
+func (r *qosFailingRunner) Run(name string, args ...string) (string, error) {
+	switch args[0] {
+	case "config":
+		return "", errors.New("rbd: invalid config key")
+	case "rm":
+		r.removed = append(r.removed, args[len(args)-1])
+	}
+	return "", nil
+}
+
+func TestCreateImageQoSFailure(t *testing.T) {
+	runner := &qosFailingRunner{}
+	connection := &Connection{mutex: &sync.RWMutex{}, pool: "rbd", username: "admin"}
+	connection.SetRunner(runner)
+	connection.SetPoolDefaults("rbd", &PoolDefaults{ObjectSize: 4194304, QoS: map[string]string{"rbd_qos_iops_limit": "1000"}})
+
+	_, err := connection.createImage("data", 1024, &CreateImageOptions{})
+	if err == nil || !strings.Contains(err.Error(), "rbd_qos_iops_limit") {
+		t.Fatalf("createImage() = %v, want the QoS failure", err)
+	}
+
+	if len(runner.removed) != 1 || runner.removed[0] != "rbd/data" {
+		t.Errorf("removed %v, want the created image", runner.removed)
+	}
+}
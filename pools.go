@@ -0,0 +1,260 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	DefaultPoolApplication = "rbd"
+	//Suffix of the erasure coded data pool created along a pool.
+	DefaultDataPoolSuffix = "-data"
+)
+
+//This struct represents the erasure coded data pool created along a
+//pool, the image data is stored on it while the metadata stays on the
+//replicated pool.
+type ErasureCodedOptions struct {
+	//Name of the data pool (<pool>DefaultDataPoolSuffix if empty).
+	Name string
+	//Erasure code profile, created with `K` data and `M` coding chunks
+	//when they are set, the "default" profile if empty.
+	Profile string
+	K       int
+	M       int
+	//Failure domain of the created profile (host if empty).
+	FailureDomain string
+}
+
+//This struct represents the options used to create a pool, zero values
+//keep the cluster defaults.
+type PoolOptions struct {
+	//Number of replicas, and the minimum required to serve I/O.
+	Size    int
+	MinSize int
+	//Number of placement groups.
+	PGNum int
+	//PG autoscaler mode: "on", "warn" or "off".
+	AutoscaleMode string
+	//Application enabled on the pool (DefaultPoolApplication if empty).
+	Application string
+	//Create an erasure coded data pool used by the images of the pool.
+	ErasureCoded *ErasureCodedOptions
+}
+
+/*
+This is a helper method that creates a pool of the given type, `pg_num`
+is left to the cluster if zero.
+*/
+func (c *Connection) createPool(name string, poolType string, profile string, pgNum int) error {
+	command := map[string]interface{}{"prefix": "osd pool create", "pool": name, "pool_type": poolType}
+	if pgNum > 0 {
+		command["pg_num"] = pgNum
+	}
+
+	if profile != "" {
+		command["erasure_code_profile"] = profile
+	}
+	return c.monCommand(command, nil)
+}
+
+/*
+This is a helper method that sets a variable of a pool.
+*/
+func (c *Connection) setPoolVar(name string, variable string, value string) error {
+	if err := c.monCommand(map[string]interface{}{"prefix": "osd pool set", "pool": name, "var": variable, "val": value}, nil); err != nil {
+		return fmt.Errorf("Cannot set %s of pool: %s, Error: %w", variable, name, err)
+	}
+	return nil
+}
+
+/*
+This is a helper method that enables an application on a pool.
+*/
+func (c *Connection) enablePoolApplication(name string, application string) error {
+	if err := c.monCommand(map[string]interface{}{"prefix": "osd pool application enable", "pool": name, "app": application}, nil); err != nil {
+		return fmt.Errorf("Cannot enable application: %s on pool: %s, Error: %w", application, name, err)
+	}
+	return nil
+}
+
+/*
+This method creates the replicated pool `name` as set by `options`
+(which can be nil) and enables the rbd application on it. With
+`options.ErasureCoded` an erasure coded data pool is created too, with
+overwrites enabled, and set as the default data pool of the images of
+the pool.
+*/
+func (c *Connection) CreatePool(name string, options *PoolOptions) error {
+	if options == nil {
+		options = &PoolOptions{}
+	}
+
+	application := options.Application
+	if application == "" {
+		application = DefaultPoolApplication
+	}
+
+	if err := c.createPool(name, "replicated", "", options.PGNum); err != nil {
+		return fmt.Errorf("Cannot create pool: %s, Error: %w", name, err)
+	}
+
+	if options.Size > 0 {
+		if err := c.setPoolVar(name, "size", strconv.Itoa(options.Size)); err != nil {
+			return err
+		}
+	}
+
+	if options.MinSize > 0 {
+		if err := c.setPoolVar(name, "min_size", strconv.Itoa(options.MinSize)); err != nil {
+			return err
+		}
+	}
+
+	if options.AutoscaleMode != "" {
+		if err := c.setPoolVar(name, "pg_autoscale_mode", options.AutoscaleMode); err != nil {
+			return err
+		}
+	}
+
+	if err := c.enablePoolApplication(name, application); err != nil {
+		return err
+	}
+
+	if options.ErasureCoded != nil {
+		return c.createDataPool(name, application, options)
+	}
+	return nil
+}
+
+/*
+This is a helper method that creates the erasure coded data pool of a
+pool and associates it.
+*/
+func (c *Connection) createDataPool(name string, application string, options *PoolOptions) error {
+	erasure := options.ErasureCoded
+	dataPool := erasure.Name
+	if dataPool == "" {
+		dataPool = name + DefaultDataPoolSuffix
+	}
+
+	profile := erasure.Profile
+	if erasure.K > 0 && erasure.M > 0 {
+		if profile == "" {
+			profile = dataPool
+		}
+
+		failureDomain := erasure.FailureDomain
+		if failureDomain == "" {
+			failureDomain = "host"
+		}
+
+		err := c.monCommand(map[string]interface{}{
+			"prefix":  "osd erasure-code-profile set",
+			"name":    profile,
+			"profile": []string{"k=" + strconv.Itoa(erasure.K), "m=" + strconv.Itoa(erasure.M), "crush-failure-domain=" + failureDomain},
+		}, nil)
+
+		if err != nil {
+			return fmt.Errorf("Cannot create erasure code profile: %s, Error: %w", profile, err)
+		}
+	}
+
+	if err := c.createPool(dataPool, "erasure", profile, options.PGNum); err != nil {
+		return fmt.Errorf("Cannot create data pool: %s, Error: %w", dataPool, err)
+	}
+
+	if err := c.setPoolVar(dataPool, "allow_ec_overwrites", "true"); err != nil {
+		return err
+	}
+
+	if options.AutoscaleMode != "" {
+		if err := c.setPoolVar(dataPool, "pg_autoscale_mode", options.AutoscaleMode); err != nil {
+			return err
+		}
+	}
+
+	if err := c.enablePoolApplication(dataPool, application); err != nil {
+		return err
+	}
+
+	if _, err := c.run("rbd", "config", "pool", "set", "--id", c.username, name, "rbd_default_data_pool", dataPool); err != nil {
+		return fmt.Errorf("Cannot set data pool: %s of pool: %s, Error: %w", dataPool, name, err)
+	}
+	return nil
+}
+
+/*
+This method deletes the pool `name` and all its images, the monitors
+must allow it (mon_allow_pool_delete). Its cached handles are released,
+an erasure coded data pool must be deleted on its own.
+*/
+func (c *Connection) DeletePool(name string) error {
+	root := c
+	if c.parent != nil {
+		root = c.parent
+	}
+
+	if name == root.pool {
+		return fmt.Errorf("Cannot delete pool: %s, Error: the connection is bound to it", name)
+	}
+
+	root.pools.mutex.Lock()
+	for key, handle := range root.pools.handles {
+		if handle.pool == name {
+			handle.ioContext().Destroy()
+			delete(root.pools.handles, key)
+		}
+	}
+	root.pools.mutex.Unlock()
+
+	err := c.monCommand(map[string]interface{}{
+		"prefix":                      "osd pool delete",
+		"pool":                        name,
+		"pool2":                       name,
+		"yes_i_really_really_mean_it": true,
+	}, nil)
+
+	if err != nil {
+		return fmt.Errorf("Cannot delete pool: %s, Error: %w", name, err)
+	}
+	return nil
+}
+
+//This struct represents the quota of a pool, zero means no limit.
+type PoolQuota struct {
+	MaxBytes   uint64 `json:"quota_max_bytes"`
+	MaxObjects uint64 `json:"quota_max_objects"`
+}
+
+/*
+This method caps the pool of the connection to `maxBytes` bytes and
+`maxObjects` objects, zero removes the limit. Writes fail once the pool
+is full.
+*/
+func (c *Connection) SetQuota(maxBytes uint64, maxObjects uint64) error {
+	for field, value := range map[string]uint64{"max_bytes": maxBytes, "max_objects": maxObjects} {
+		err := c.monCommand(map[string]interface{}{
+			"prefix": "osd pool set-quota",
+			"pool":   c.pool,
+			"field":  field,
+			"val":    strconv.FormatUint(value, 10),
+		}, nil)
+
+		if err != nil {
+			return fmt.Errorf("Cannot set %s quota of pool: %s, Error: %w", field, c.pool, err)
+		}
+	}
+	return nil
+}
+
+/*
+This method returns the quota of the pool of the connection.
+*/
+func (c *Connection) GetQuota() (PoolQuota, error) {
+	var quota PoolQuota
+	if err := c.monCommand(map[string]interface{}{"prefix": "osd pool get-quota", "pool": c.pool}, &quota); err != nil {
+		return quota, fmt.Errorf("Cannot get quota of pool: %s, Error: %w", c.pool, err)
+	}
+	return quota, nil
+}
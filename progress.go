@@ -0,0 +1,143 @@
+package blockdevice
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+)
+
+//Progress printed by the rbd tool, e.g. "Image flatten: 42% complete...".
+var progressPercent = regexp.MustCompile(`(\d+)% complete`)
+
+//This type represents a function reporting the progress of a long-running
+//operation (flatten, copy, export ...), called with the percentage done
+//as it grows, from 0 to 100.
+type ProgressFunc func(percent int)
+
+//This interface represents a runner able to report the progress printed
+//by a command (e.g. rbd flatten) while it runs.
+type ProgressRunner interface {
+	RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error)
+}
+
+func (r *LocalRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	return runProcessStderr(ctx, nil, &progressWriter{progress: progress}, name, args...)
+}
+
+func (r *SSHRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	sshArgs, err := r.sshArgs(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return runProcessStderr(ctx, nil, &progressWriter{progress: progress}, "ssh", sshArgs...)
+}
+
+func (r *SudoRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	return runProgress(ctx, runnerOrLocal(r.Runner), progress, "sudo", r.sudoArgs(name, args...)...)
+}
+
+func (r *ChrootRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	return runProgress(ctx, runnerOrLocal(r.Runner), progress, "chroot", append([]string{r.Root, name}, args...)...)
+}
+
+func (r *timeoutRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	if timeout := r.connection.GetCommandTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return runProgress(withCommandLogger(ctx, r.connection), r.runner, progress, name, args...)
+}
+
+func (r *boundRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	bound := r.ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		bound, cancel = context.WithDeadline(r.ctx, deadline)
+		defer cancel()
+	}
+
+	if err := bound.Err(); err != nil {
+		return "", err
+	}
+	return runProgress(withCommandLogger(bound, commandConnection(ctx)), r.runner, progress, name, args...)
+}
+
+func (r *planRunner) RunWithProgress(ctx context.Context, progress ProgressFunc, name string, args ...string) (string, error) {
+	return r.Run(name, args...)
+}
+
+/*
+This is a helper method that runs a command on a runner, reporting its
+progress if the runner implements `ProgressRunner`, the command is only
+waited for otherwise.
+*/
+func runProgress(ctx context.Context, runner CommandRunner, progress ProgressFunc, name string, args ...string) (string, error) {
+	if progressRunner, ok := runner.(ProgressRunner); ok {
+		return progressRunner.RunWithProgress(ctx, progress, name, args...)
+	}
+	return runContext(ctx, runner, name, args...)
+}
+
+/*
+This is a helper method that runs the rbd tool with the runner of the
+connection like `run`, reporting its progress to `progress` (which can
+be nil) from 0 to 100. It's killed when `ctx` is done.
+*/
+func (c *Connection) runWithProgress(ctx context.Context, progress ProgressFunc, args ...string) (string, error) {
+	report := progressReporter(progress)
+	report(0)
+
+	output, err := c.runCephProgress(ctx, c.hostRunner(nil), report, "rbd", args...)
+	if err == nil {
+		report(100)
+	}
+	return output, err
+}
+
+/*
+This is a helper method that wraps `progress` (which can be nil) so that
+it's called only when the percentage grows, from 0 to 100.
+*/
+func progressReporter(progress ProgressFunc) ProgressFunc {
+	last := -1
+	return func(percent int) {
+		if percent < 0 {
+			percent = 0
+		} else if percent > 100 {
+			percent = 100
+		}
+
+		if progress != nil && percent > last {
+			last = percent
+			progress(percent)
+		}
+	}
+}
+
+//This struct parses the progress printed by the rbd tool as it's
+//written to the standard error.
+type progressWriter struct {
+	progress ProgressFunc
+	pending  []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+
+	matches := progressPercent.FindAllSubmatchIndex(w.pending, -1)
+	for _, match := range matches {
+		if percent, err := strconv.Atoi(string(w.pending[match[2]:match[3]])); err == nil {
+			w.progress(percent)
+		}
+	}
+
+	//keeps what may be the start of the next report
+	if len(matches) > 0 {
+		w.pending = append([]byte(nil), w.pending[matches[len(matches)-1][1]:]...)
+	}
+	if len(w.pending) > 64 {
+		w.pending = append([]byte(nil), w.pending[len(w.pending)-64:]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,50 @@
+package blockdevice
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProgressWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []int
+	}{
+		{"none", []string{"rbd: warning\n"}, nil},
+		{"single", []string{"Flatten image: 42% complete...\r"}, []int{42}},
+		{"many in a write", []string{"Flatten image: 1% complete...\rFlatten image: 2% complete...\r"}, []int{1, 2}},
+		{"split report", []string{"Flatten image: 5", "7% comp", "lete...\r"}, []int{57}},
+		{"done", []string{"Image copy: 99% complete...\r", "Image copy: 100% complete...done.\n"}, []int{99, 100}},
+	}
+
+	for _, test := range tests {
+		var got []int
+		writer := &progressWriter{progress: func(percent int) { got = append(got, percent) }}
+
+		for _, write := range test.writes {
+			if n, err := writer.Write([]byte(write)); err != nil || n != len(write) {
+				t.Fatalf("%s: Write() = %d, %v", test.name, n, err)
+			}
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: reported %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProgressReporter(t *testing.T) {
+	var got []int
+	report := progressReporter(func(percent int) { got = append(got, percent) })
+	for _, percent := range []int{0, 10, 10, 5, -3, 50, 120, 100} {
+		report(percent)
+	}
+
+	if want := []int{0, 10, 50, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reported %v, want %v", got, want)
+	}
+
+	//a nil progress is allowed
+	progressReporter(nil)(10)
+}
@@ -0,0 +1,180 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultQuiesceTimeout = 30 * time.Second
+)
+
+//This interface represents an application level hook run around the
+//snapshots of a volume, e.g. to flush and lock a database.
+type QuiesceHook interface {
+	//Called before the snapshot is taken.
+	Quiesce(ctx context.Context) error
+	//Called after the snapshot is taken (or failed).
+	Resume(ctx context.Context) error
+}
+
+//This struct represents a hook running local commands, e.g.
+//[]string{"mysql", "-e", "FLUSH TABLES WITH READ LOCK"}.
+type ExecHook struct {
+	Pre  []string
+	Post []string
+}
+
+func (h *ExecHook) run(ctx context.Context, command []string) error {
+	if len(command) == 0 {
+		return nil
+	}
+
+	output, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Error running hook: %s, Error: %s %s", strings.Join(command, " "), err, output)
+	}
+	return nil
+}
+
+func (h *ExecHook) Quiesce(ctx context.Context) error {
+	return h.run(ctx, h.Pre)
+}
+
+func (h *ExecHook) Resume(ctx context.Context) error {
+	return h.run(ctx, h.Post)
+}
+
+//This struct represents a hook calling Go functions, any can be nil.
+type FuncHook struct {
+	Pre  func(ctx context.Context) error
+	Post func(ctx context.Context) error
+}
+
+func (h *FuncHook) Quiesce(ctx context.Context) error {
+	if h.Pre == nil {
+		return nil
+	}
+	return h.Pre(ctx)
+}
+
+func (h *FuncHook) Resume(ctx context.Context) error {
+	if h.Post == nil {
+		return nil
+	}
+	return h.Post(ctx)
+}
+
+//This struct represents a hook registered on a volume.
+type quiesceRegistration struct {
+	hook    QuiesceHook
+	timeout time.Duration
+}
+
+/*
+This method registers a quiesce hook for the given image of the
+connection pool and RADOS namespace, hooks are run in registration
+order before the snapshots of the image and in reverse order after
+them. Each call is given `timeout` (DefaultQuiesceTimeout if zero) to
+complete.
+*/
+func (c *Connection) RegisterQuiesceHook(image string, hook QuiesceHook, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultQuiesceTimeout
+	}
+
+	spec, root := c.spec(image, ""), c.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	if root.quiesceHooks == nil {
+		root.quiesceHooks = make(map[string][]quiesceRegistration)
+	}
+	root.quiesceHooks[spec] = append(root.quiesceHooks[spec], quiesceRegistration{hook, timeout})
+}
+
+/*
+This method removes all the quiesce hooks of the given image of the
+connection pool and RADOS namespace.
+*/
+func (c *Connection) ClearQuiesceHooks(image string) {
+	spec, root := c.spec(image, ""), c.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	delete(root.quiesceHooks, spec)
+}
+
+/*
+This method runs `fn` with the image applications quiesced, hooks
+that quiesced are always resumed, even if `fn` or a later hook fails.
+*/
+func (i *Image) quiesced(fn func() error) error {
+	spec, root := i.spec(i.name, ""), i.root()
+	root.mutex.RLock()
+	hooks := root.quiesceHooks[spec]
+	root.mutex.RUnlock()
+
+	resume := func(count int) []string {
+		var failed []string
+		for index := count - 1; index >= 0; index-- {
+			ctx, cancel := context.WithTimeout(context.Background(), hooks[index].timeout)
+			if err := hooks[index].hook.Resume(ctx); err != nil {
+				failed = append(failed, err.Error())
+			}
+			cancel()
+		}
+		return failed
+	}
+
+	for index, registration := range hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), registration.timeout)
+		err := registration.hook.Quiesce(ctx)
+		cancel()
+
+		if err != nil {
+			failed := append([]string{err.Error()}, resume(index)...)
+			return fmt.Errorf("Cannot quiesce image: %s, Error: %s", i.name, strings.Join(failed, "; "))
+		}
+	}
+
+	err := fn()
+	if failed := resume(len(hooks)); len(failed) > 0 {
+		if err != nil {
+			failed = append([]string{err.Error()}, failed...)
+		}
+		return fmt.Errorf("Cannot resume image: %s, Error: %s", i.name, strings.Join(failed, "; "))
+	}
+
+	return err
+}
+
+/*
+This method creates a snapshot of the image, running the quiesce
+hooks registered for the image around it.
+*/
+func (i *Image) SnapshotQuiesced(name string) error {
+	return i.quiesced(func() error {
+		return i.createSnapshot(name)
+	})
+}
+
+/*
+This method creates a snapshot of the image, without running hooks.
+*/
+func (i *Image) createSnapshot(name string) (err error) {
+	_, end := i.observe(context.Background(), OperationSnapshot)
+	defer end(&err)
+
+	err = i.withWritableImage("create snapshot", func(image *rbd.Image) error {
+		_, err := image.CreateSnapshot(name)
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("Cannot create snapshot: %s of image: %s, Error: %w", name, i.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package blockdevice
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestQuiesceHooksBySpec(t *testing.T) {
+	connection := &Connection{pool: "rbd", mutex: &sync.RWMutex{}}
+	image := &Image{Connection: connection, name: "data"}
+
+	var quiesced, resumed int
+	connection.SetNamespace("tenant-a")
+	connection.RegisterQuiesceHook("data", &FuncHook{
+		Pre:  func(ctx context.Context) error { quiesced++; return nil },
+		Post: func(ctx context.Context) error { resumed++; return nil },
+	}, 0)
+
+	//an image of the same name in another namespace has no hooks
+	connection.SetNamespace("tenant-b")
+	image.quiesced(func() error { return nil })
+	if quiesced != 0 || resumed != 0 {
+		t.Errorf("the hooks of tenant-a/data ran for tenant-b/data")
+	}
+
+	connection.SetNamespace("tenant-a")
+	image.quiesced(func() error { return nil })
+	if quiesced != 1 || resumed != 1 {
+		t.Errorf("the hooks ran %d/%d times, want once", quiesced, resumed)
+	}
+
+	connection.ClearQuiesceHooks("data")
+	image.quiesced(func() error { return nil })
+	if quiesced != 1 {
+		t.Errorf("the cleared hooks still ran")
+	}
+}
@@ -0,0 +1,103 @@
+package blockdevice
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+This is a helper method that runs an xfs_quota expert command on the
+mounted filesystem of the device, which must be xfs mounted with the
+prjquota option.
+*/
+func (d *Device) xfsQuota(command string) (string, error) {
+	if !d.isMounted {
+		return "", kindErrorf(ErrNotMounted, nil, "Cannot manage quotas of device: %s, Error: device is not mounted", d.path)
+	}
+
+	if d.fileSystemType != "xfs" {
+		return "", fmt.Errorf("Cannot manage quotas of device: %s, Error: project quotas require xfs, found: %s", d.path, d.fileSystemType)
+	}
+	return d.runMounted("xfs_quota", "-x", "-c", command, d.mountPoint)
+}
+
+/*
+This is a helper method that tells the characters xfs_quota would take
+for a separator or a quote within the path of a command.
+*/
+func unsafeQuotaRune(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("'\"\\", r)
+}
+
+/*
+This method caps the directory tree at `path` (relative to the
+mountpoint, or absolute within it) to `limit` MB, setting it up as the
+xfs project `projectID`. A zero limit removes the cap. The path is
+passed within the xfs_quota command line, so paths with spaces, quotes
+or backslashes are rejected.
+*/
+func (d *Device) SetProjectQuota(projectID uint32, path string, limit uint64) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(d.mountPoint, path)
+	}
+
+	id := strconv.FormatUint(uint64(projectID), 10)
+	if strings.IndexFunc(path, unsafeQuotaRune) >= 0 {
+		return fmt.Errorf("Cannot set up project: %s on: %q, Error: path not supported by xfs_quota", id, path)
+	}
+
+	if _, err := d.xfsQuota("project -s -p " + path + " " + id); err != nil {
+		return fmt.Errorf("Cannot set up project: %s on: %s, Error: %w", id, path, err)
+	}
+
+	if _, err := d.xfsQuota("limit -p bhard=" + strconv.FormatUint(limit, 10) + "m " + id); err != nil {
+		return fmt.Errorf("Cannot set quota of project: %s, Error: %w", id, err)
+	}
+	return nil
+}
+
+/*
+This method removes the cap of the xfs project `projectID`.
+*/
+func (d *Device) RemoveProjectQuota(projectID uint32) error {
+	id := strconv.FormatUint(uint64(projectID), 10)
+	if _, err := d.xfsQuota("limit -p bsoft=0 bhard=0 " + id); err != nil {
+		return fmt.Errorf("Cannot remove quota of project: %s, Error: %w", id, err)
+	}
+	return nil
+}
+
+/*
+This method returns the used and the hard limit bytes of the xfs
+project `projectID`, a zero limit means it's not capped.
+*/
+func (d *Device) GetProjectQuota(projectID uint32) (uint64, uint64, error) {
+	id := strconv.FormatUint(uint64(projectID), 10)
+	output, err := d.xfsQuota("report -p -b -N")
+	if err != nil {
+		return 0, 0, fmt.Errorf("Cannot get quota of project: %s, Error: %w", id, err)
+	}
+
+	//#<id> <used> <soft> <hard> <warn> <grace>, in 1K blocks
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "#"+id {
+			continue
+		}
+
+		used, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, parseFailure("xfs_quota", output, err)
+		}
+
+		hard, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return 0, 0, parseFailure("xfs_quota", output, err)
+		}
+		return used * 1024, hard * 1024, nil
+	}
+	return 0, 0, nil
+}
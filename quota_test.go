@@ -0,0 +1,40 @@
+package blockdevice
+
+import (
+	"strings"
+	"testing"
+)
+
+//This struct records the xfs_quota commands run on a device.
+type xfsQuotaRunner struct {
+	commands []string
+}
+
+func (r *xfsQuotaRunner) Run(name string, args ...string) (string, error) {
+	r.commands = append(r.commands, args[2])
+	return "", nil
+}
+
+func TestSetProjectQuotaPath(t *testing.T) {
+	runner := &xfsQuotaRunner{}
+	device := &Device{path: "/dev/rbd0", isMounted: true, mountPoint: "/mnt/data", fileSystemType: "xfs", runner: runner}
+
+	for _, path := range []string{"my dir", "a'b", "x\" -c \"remove", "tab\there", "back\\slash", "line\nbreak"} {
+		if err := device.SetProjectQuota(42, path, 1024); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("SetProjectQuota(%q) error = %v, want a rejected path", path, err)
+		}
+	}
+
+	if len(runner.commands) != 0 {
+		t.Fatalf("xfs_quota ran %q for rejected paths", runner.commands)
+	}
+
+	if err := device.SetProjectQuota(42, "projects/a", 1024); err != nil {
+		t.Fatalf("SetProjectQuota() error = %v", err)
+	}
+
+	want := []string{"project -s -p /mnt/data/projects/a 42", "limit -p bhard=1024m 42"}
+	if strings.Join(runner.commands, "|") != strings.Join(want, "|") {
+		t.Errorf("xfs_quota commands = %q, want %q", runner.commands, want)
+	}
+}
@@ -0,0 +1,80 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+/*
+This is a helper method that returns the spec of an image of the
+connection pool and namespace.
+*/
+func (c *Connection) spec(name string, snap string) string {
+	return namespacedSpec(c.pool, c.GetNamespace(), name, snap)
+}
+
+/*
+This method sets the RADOS namespace the images of the connection are
+looked up, created and mapped in, an empty name is the default
+namespace. It also applies to pool handles (see `Pool`), see
+`Namespace` for a handle of its own.
+*/
+func (c *Connection) SetNamespace(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.context != nil {
+		c.context.SetNamespace(name)
+	}
+	c.namespace = name
+}
+
+/*
+Getter method for namespace
+*/
+func (c *Connection) GetNamespace() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.namespace
+}
+
+/*
+This method returns a handle of the connection scoped to the RADOS
+namespace `name` of its pool, it's cached and released like the pool
+handles (see `Pool`).
+*/
+func (c *Connection) Namespace(name string) (*Connection, error) {
+	return c.handle(c.pool, name)
+}
+
+/*
+This method creates the RADOS namespace `name` on the pool of the
+connection.
+*/
+func (c *Connection) CreateNamespace(name string) error {
+	if _, err := c.run("rbd", "namespace", "create", "--id", c.username, "--pool", c.pool, "--namespace", name); err != nil {
+		return fmt.Errorf("Cannot create namespace: %s on pool: %s, Error: %w", name, c.pool, err)
+	}
+	return nil
+}
+
+/*
+This method returns the RADOS namespaces of the pool of the connection,
+the default namespace is not included.
+*/
+func (c *Connection) ListNamespaces() ([]string, error) {
+	namespaces, err := c.poolNamespaces(c.pool)
+	if err != nil {
+		return nil, err
+	}
+	return namespaces[1:], nil
+}
+
+/*
+This method removes the RADOS namespace `name` from the pool of the
+connection, it must hold no images.
+*/
+func (c *Connection) RemoveNamespace(name string) error {
+	if _, err := c.run("rbd", "namespace", "remove", "--id", c.username, "--pool", c.pool, "--namespace", name); err != nil {
+		return fmt.Errorf("Cannot remove namespace: %s from pool: %s, Error: %w", name, c.pool, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+/*
+This method maps the image as set by `options` (which can be nil) and
+returns the block device as is: it's never formatted nor mounted, so
+it can be handed to a database or a virtual machine.
+*/
+func (i *Image) MapRaw(options *MapOptions) (*Device, error) {
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	if options.Overlay != nil {
+		readOnly := *options
+		readOnly.ReadOnly = true
+		options = &readOnly
+	}
+
+	device, err := mapDevice(i, "", options)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create new device for image: %s, Error: %w", i.name, err)
+	}
+	device.raw = true
+
+	if options.Overlay != nil {
+		overlay, err := device.overlay(options.Overlay)
+		if err != nil {
+			device.UnMap()
+			return nil, err
+		}
+		device = overlay
+	}
+
+	i.track(device)
+	return device, nil
+}
+
+/*
+Getter method for raw
+*/
+func (d *Device) IsRaw() bool {
+	return d.raw
+}
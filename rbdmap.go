@@ -0,0 +1,124 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strings"
+)
+
+//This struct represents the options used to persist the mapping of an
+//image on the rbdmap file.
+type RbdmapOptions struct {
+	//rbdmap file (DefaultRbdmapPath if empty).
+	Path string
+	//Host the image is mapped on at boot, the local host if nil.
+	Runner CommandRunner
+	//Keyring of the user (the ceph configuration default if empty).
+	Keyring string
+	//Map options (read-only, snapshot, krbd options) used at boot.
+	MapOptions *MapOptions
+}
+
+/*
+This method returns the rbdmap entry mapping the image as set by
+`options`, every parameter is passed by the rbdmap service to
+`rbd map` as --<key> <value>.
+*/
+func (i *Image) rbdmapEntry(options *RbdmapOptions) string {
+	mapOptions := options.MapOptions
+	if mapOptions == nil {
+		mapOptions = &MapOptions{}
+	}
+
+	var parameters []string
+	if i.username != "" {
+		parameters = append(parameters, "id="+i.username)
+	}
+
+	if options.Keyring != "" {
+		parameters = append(parameters, "keyring="+options.Keyring)
+	}
+
+	if mapOptions.ReadOnly {
+		parameters = append(parameters, "read-only")
+	}
+
+	if options := mapOptions.krbdOptions(); len(options) > 0 {
+		parameters = append(parameters, "options='"+strings.Join(options, ",")+"'")
+	}
+
+	entry := i.spec(i.name, mapOptions.Snapshot)
+	if len(parameters) > 0 {
+		entry += "\t" + strings.Join(parameters, ",")
+	}
+	return entry
+}
+
+/*
+This is a helper method that returns the lines of a rbdmap file without
+the entries of the image.
+*/
+func (i *Image) withoutRbdmapEntries(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			if pool, namespace, name, _ := parseImageSpec(fields[0]); pool == i.pool && namespace == i.GetNamespace() && name == i.name {
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+/*
+This method writes the rbdmap entry of the image, replacing any
+previous one, so the rbdmap service maps it again at boot (see
+`Device.PersistToFstab` to mount it too). `options` can be nil.
+*/
+func (i *Image) PersistMapping(options *RbdmapOptions) error {
+	if options == nil {
+		options = &RbdmapOptions{}
+	}
+
+	path := options.Path
+	if path == "" {
+		path = DefaultRbdmapPath
+	}
+
+	if options.MapOptions != nil && options.MapOptions.Backend == BackendNBD {
+		return fmt.Errorf("Cannot persist mapping of image: %s, Error: rbdmap only maps with krbd", i.name)
+	}
+
+	lines, err := readHostFile(options.Runner, path)
+	if err != nil {
+		return err
+	}
+
+	return writeHostFile(options.Runner, path, append(i.withoutRbdmapEntries(lines), i.rbdmapEntry(options)))
+}
+
+/*
+This method removes the rbdmap entries of the image from the rbdmap
+file of `options` (which can be nil).
+*/
+func (i *Image) UnpersistMapping(options *RbdmapOptions) error {
+	if options == nil {
+		options = &RbdmapOptions{}
+	}
+
+	path := options.Path
+	if path == "" {
+		path = DefaultRbdmapPath
+	}
+
+	lines, err := readHostFile(options.Runner, path)
+	if err != nil {
+		return err
+	}
+
+	kept := i.withoutRbdmapEntries(lines)
+	if len(kept) == len(lines) {
+		return nil
+	}
+	return writeHostFile(options.Runner, path, kept)
+}
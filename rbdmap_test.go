@@ -0,0 +1,76 @@
+package blockdevice
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRbdmapEntry(t *testing.T) {
+	image := &Image{Connection: &Connection{pool: "rbd", username: "admin", mutex: &sync.RWMutex{}}, name: "data"}
+
+	tests := []struct {
+		options *RbdmapOptions
+		want    string
+	}{
+		{&RbdmapOptions{}, "rbd/data\tid=admin"},
+		{&RbdmapOptions{Keyring: "/etc/ceph/keyring", MapOptions: &MapOptions{ReadOnly: true, Snapshot: "golden"}}, "rbd/data@golden\tid=admin,keyring=/etc/ceph/keyring,read-only"},
+		{&RbdmapOptions{MapOptions: &MapOptions{QueueDepth: 128}}, "rbd/data\tid=admin,options='queue_depth=128'"},
+		{&RbdmapOptions{MapOptions: &MapOptions{QueueDepth: 128, LockOnRead: true, NoTrim: true}}, "rbd/data\tid=admin,options='queue_depth=128,lock_on_read,notrim'"},
+	}
+
+	for _, test := range tests {
+		if got := image.rbdmapEntry(test.options); got != test.want {
+			t.Errorf("rbdmapEntry(%+v) = %q, want %q", test.options.MapOptions, got, test.want)
+		}
+	}
+}
+
+func TestRbdmapEntryParsed(t *testing.T) {
+	image := &Image{Connection: &Connection{pool: "rbd", username: "admin", mutex: &sync.RWMutex{}}, name: "data"}
+	entry := image.rbdmapEntry(&RbdmapOptions{MapOptions: &MapOptions{QueueDepth: 128, Exclusive: true}})
+
+	want := []rbdmapEntry{{volume: ManagedVolume{
+		Pool:       "rbd",
+		Image:      "data",
+		User:       "admin",
+		MapOptions: map[string]string{"queue_depth": "128", "exclusive": ""},
+		Source:     "rbdmap",
+	}}}
+
+	if got := parseRbdmap([]string{entry}); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRbdmap(%q) = %+v, want %+v", entry, got, want)
+	}
+}
+
+func TestParseImageSpec(t *testing.T) {
+	tests := []struct {
+		spec                            string
+		pool, namespace, name, snapshot string
+	}{
+		{"data", DefaultPoolName, "", "data", ""},
+		{"rbd/data", "rbd", "", "data", ""},
+		{"rbd/data@golden", "rbd", "", "data", "golden"},
+		{"rbd/ns/data", "rbd", "ns", "data", ""},
+		{"rbd/ns/data@golden", "rbd", "ns", "data", "golden"},
+	}
+
+	for _, test := range tests {
+		pool, namespace, name, snapshot := parseImageSpec(test.spec)
+		if pool != test.pool || namespace != test.namespace || name != test.name || snapshot != test.snapshot {
+			t.Errorf("parseImageSpec(%q) = %q, %q, %q, %q", test.spec, pool, namespace, name, snapshot)
+		}
+	}
+}
+
+func TestWithoutRbdmapEntriesNamespace(t *testing.T) {
+	lines := []string{"# boot mappings", "rbd/data\tid=admin", "rbd/ns/data\tid=admin", "rbd/other/data\tid=admin"}
+	connection := &Connection{pool: "rbd", username: "admin", mutex: &sync.RWMutex{}}
+	connection.SetNamespace("ns")
+	image := &Image{Connection: connection, name: "data"}
+
+	want := []string{"# boot mappings", "rbd/data\tid=admin", "rbd/other/data\tid=admin"}
+	if got := image.withoutRbdmapEntries(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutRbdmapEntries() = %q, want %q", got, want)
+	}
+}
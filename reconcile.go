@@ -0,0 +1,240 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Actions taken by a `Reconciler` on a volume.
+const (
+	ReconcileCreated = "created"
+	ReconcileResized = "resized"
+	ReconcileMapped  = "mapped"
+	ReconcileMounted = "mounted"
+	ReconcileRemoved = "removed"
+)
+
+//This struct represents the desired state of a volume on the host.
+type DesiredVolume struct {
+	VolumeSpec
+	//Pool of the image, the pool of the connection if empty, and its
+	//RADOS namespace.
+	Pool      string
+	Namespace string
+	//Options used to map the image (which can be nil), `Runner` selects
+	//the host.
+	Options *MapOptions
+}
+
+//This struct represents the options of a `Reconciler`.
+type ReconcileOptions struct {
+	//Unmount and unmap the images mapped on the host that are not
+	//desired, only in the pools of the desired volumes.
+	Prune bool
+	//Host the volumes are reconciled on, the runner of the connection
+	//if nil.
+	Runner CommandRunner
+}
+
+//This struct represents the outcome of the reconciliation of a volume.
+type VolumeResult struct {
+	Volume DesiredVolume
+	Device *Device
+	//Actions taken, none if the volume was already as desired.
+	Actions []string
+	Err     error
+}
+
+//This struct represents a reconciler converging the host to a list of
+//desired volumes.
+type Reconciler struct {
+	connection *Connection
+	options    ReconcileOptions
+}
+
+/*
+This method is a constructor for `Reconciler` objects, `options` can
+be nil.
+*/
+func NewReconciler(connection *Connection, options *ReconcileOptions) *Reconciler {
+	reconciler := &Reconciler{connection: connection}
+	if options != nil {
+		reconciler.options = *options
+	}
+	return reconciler
+}
+
+/*
+This method converges the host to the desired volumes: the missing
+images are created, the smaller ones grown (images are never shrunk)
+and every image is mapped and mounted as set by its spec, see
+`Image.EnsureMounted`. With `Prune` the extra images are torn down
+afterwards. A result is returned per volume, a failure doesn't stop
+the reconciliation of the others.
+*/
+func (r *Reconciler) Reconcile(volumes []DesiredVolume) []VolumeResult {
+	var results []VolumeResult
+	desired := make(map[string]bool)
+	pools := make(map[string]bool)
+
+	for _, volume := range volumes {
+		pool := volume.Pool
+		if pool == "" {
+			pool = r.connection.pool
+		}
+		desired[namespacedSpec(pool, volume.Namespace, volume.Name, "")] = true
+		pools[pool] = true
+
+		results = append(results, r.reconcileVolume(volume, pool))
+	}
+
+	if r.options.Prune {
+		results = append(results, r.prune(desired, pools)...)
+	}
+	return results
+}
+
+/*
+This is a helper method that converges a single volume of `pool`.
+*/
+func (r *Reconciler) reconcileVolume(volume DesiredVolume, pool string) VolumeResult {
+	result := VolumeResult{Volume: volume}
+	options := volume.Options
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	if options.Runner == nil {
+		copied := *options
+		copied.Runner = r.options.Runner
+		options = &copied
+	}
+
+	connection, err := r.connection.handle(pool, volume.Namespace)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	resized := false
+	image, err := connection.GetImageByName(volume.Name)
+	defer func() {
+		//the returned device keeps the image open
+		if image != nil && result.Device == nil {
+			image.Close()
+		}
+	}()
+
+	switch {
+	case errors.Is(err, ErrImageNotFound):
+		if image, err = connection.GetOrCreateImage(volume.Name, volume.Size); err != nil {
+			result.Err = err
+			return result
+		}
+		result.Actions = append(result.Actions, ReconcileCreated)
+	case err != nil:
+		result.Err = err
+		return result
+	case toMegs(volume.Size) > image.ImageInfo.Size:
+		if result.Err = image.Grow(volume.Size); result.Err != nil {
+			return result
+		}
+		result.Actions = append(result.Actions, ReconcileResized)
+		resized = true
+	}
+
+	runner := image.hostRunner(options.Runner)
+	mapped, mounted, err := mappedState(runner, pool, volume.Namespace, volume.Name, options.Snapshot, volume.MountPoint)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if result.Device, result.Err = image.EnsureMounted(volume.FileSystemType, volume.MountPoint, options); result.Err != nil {
+		return result
+	}
+
+	if !mapped {
+		result.Actions = append(result.Actions, ReconcileMapped)
+	}
+
+	if !mounted && volume.MountPoint != "" {
+		result.Actions = append(result.Actions, ReconcileMounted)
+	}
+
+	if resized && result.Device.isMounted {
+		result.Err = result.Device.GrowFilesystem()
+	}
+	return result
+}
+
+/*
+This is a helper method that tells if the image is mapped on the host
+targeted by `runner`, and mounted on `mountPoint`.
+*/
+func mappedState(runner CommandRunner, pool string, namespace string, name string, snap string, mountPoint string) (bool, bool, error) {
+	devices, err := listMappedDevices(runner)
+	if err != nil {
+		return false, false, fmt.Errorf("Cannot list mapped devices for image: %s, Error: %w", name, err)
+	}
+
+	mapped, mounted := false, false
+	for _, device := range devices {
+		if device.Pool != pool || device.Namespace != namespace || device.Image != name || device.Snap != snap {
+			continue
+		}
+
+		mapped = true
+		for _, current := range mountPointsOf(runner, device.Device) {
+			if current == mountPoint {
+				mounted = true
+			}
+		}
+	}
+	return mapped, mounted, nil
+}
+
+/*
+This is a helper method that unmounts and unmaps the images of `pools`
+mapped on the host that are not `desired`.
+*/
+func (r *Reconciler) prune(desired map[string]bool, pools map[string]bool) []VolumeResult {
+	runner := r.connection.hostRunner(r.options.Runner)
+	devices, err := listMappedDevices(runner)
+	if err != nil {
+		return []VolumeResult{{Err: fmt.Errorf("Cannot list mapped devices, Error: %w", err)}}
+	}
+
+	var results []VolumeResult
+	for _, mapped := range devices {
+		if !pools[mapped.Pool] || desired[namespacedSpec(mapped.Pool, mapped.Namespace, mapped.Image, "")] {
+			continue
+		}
+
+		result := VolumeResult{Volume: DesiredVolume{VolumeSpec: VolumeSpec{Name: mapped.Image}, Pool: mapped.Pool, Namespace: mapped.Namespace}}
+		var image *Image
+		if connection, err := r.connection.handle(mapped.Pool, mapped.Namespace); err == nil {
+			image, _ = connection.GetImageByName(mapped.Image)
+		}
+
+		device := newMappedDevice(image, mapped.Device, BackendKRBD, "", runner, &MapOptions{Snapshot: mapped.Snap})
+		for _, mountPoint := range mountPointsOf(runner, mapped.Device) {
+			device.isMounted, device.mountPoint = true, mountPoint
+			if result.Err = device.UnMount(); result.Err != nil {
+				break
+			}
+		}
+
+		if result.Err == nil {
+			if result.Err = device.UnMap(); result.Err == nil {
+				result.Actions = append(result.Actions, ReconcileRemoved)
+			}
+		}
+
+		if image != nil {
+			image.Close()
+		}
+		results = append(results, result)
+	}
+	return results
+}
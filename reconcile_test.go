@@ -0,0 +1,91 @@
+package blockdevice
+
+import (
+	"errors"
+	"github.com/ceph/go-ceph/rbd"
+	"sync"
+	"testing"
+)
+
+//This struct answers rbd showmapped with the given output, or fails it.
+type showmappedRunner struct {
+	output string
+	err    error
+}
+
+func (r *showmappedRunner) Run(name string, args ...string) (string, error) {
+	if name == "rbd" && len(args) > 0 && args[0] == "showmapped" {
+		return r.output, r.err
+	}
+	return "", nil
+}
+
+/*
+This is a helper method that returns a connection to the pool "rbd"
+running its commands with `runner`.
+*/
+func fakeConnection(runner CommandRunner) *Connection {
+	connection := &Connection{
+		pool:     "rbd",
+		username: "admin",
+		tracker:  &deviceTracker{},
+		session:  &radosSession{},
+		pools:    &poolHandles{handles: make(map[string]*Connection)},
+		mutex:    &sync.RWMutex{},
+	}
+	connection.SetRunner(runner)
+	return connection
+}
+
+/*
+This is a helper method that serves the images looked up by name
+without a cluster, every image of `size` megabytes holding the session
+of its connection, until the test ends.
+*/
+func fakeImages(t *testing.T, size uint64) {
+	opener := imageOpener
+	imageOpener = func(c *Connection, name string) (*Image, error) {
+		return &Image{ImageInfo: &rbd.ImageInfo{Size: toMegs(size)}, Connection: c, name: name, session: c.session.acquire()}, nil
+	}
+	t.Cleanup(func() { imageOpener = opener })
+}
+
+/*
+This is a helper method that returns the users of the session.
+*/
+func sessionUsers(session *radosSession) int {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return session.users
+}
+
+func TestReconcileKeepsDeviceImageOpen(t *testing.T) {
+	fakeImages(t, 1024)
+	runner := &showmappedRunner{output: `[{"id":"0","pool":"rbd","namespace":"","name":"data","snap":"-","device":"/dev/rbd0"}]`}
+	connection := fakeConnection(runner)
+
+	volume := DesiredVolume{VolumeSpec: VolumeSpec{Name: "data", Size: 1024}}
+	results := NewReconciler(connection, nil).Reconcile([]DesiredVolume{volume})
+	if len(results) != 1 || results[0].Err != nil || results[0].Device == nil {
+		t.Fatalf("Reconcile() = %+v, want the mapped device", results)
+	}
+
+	if results[0].Device.image.session == nil || sessionUsers(connection.session) != 1 {
+		t.Errorf("the image of the returned device is closed")
+	}
+}
+
+func TestReconcileClosesImageOnError(t *testing.T) {
+	fakeImages(t, 1024)
+	connection := fakeConnection(&showmappedRunner{err: errors.New("rbd: showmapped failed")})
+
+	volume := DesiredVolume{VolumeSpec: VolumeSpec{Name: "data", Size: 1024}}
+	results := NewReconciler(connection, nil).Reconcile([]DesiredVolume{volume})
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("Reconcile() = %+v, want the showmapped failure", results)
+	}
+
+	if users := sessionUsers(connection.session); users != 0 {
+		t.Errorf("the image is left open, the session has %d users", users)
+	}
+}
@@ -0,0 +1,248 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rados"
+	"time"
+)
+
+const (
+	DefaultPingTimeout       = 5 * time.Second
+	DefaultReconnectInterval = 30 * time.Second
+)
+
+//This struct represents the background checks of a connection started
+//by `SetAutoReconnect`.
+type reconnectWatchdog struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+/*
+This is a helper method that returns the rados connection, which is
+replaced when reconnecting.
+*/
+func (c *Connection) rados() *rados.Conn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Conn
+}
+
+/*
+This method checks that the cluster answers by fetching its stats,
+giving up when `ctx` is done.
+*/
+func (c *Connection) Ping(ctx context.Context) error {
+	conn := c.rados()
+	if conn == nil {
+		return fmt.Errorf("Cannot ping cluster, Error: connection is shut down")
+	}
+
+	err := abortable(ctx, func() error {
+		_, err := conn.GetClusterStats()
+		return err
+	}, nil)
+
+	if err != nil {
+		return fmt.Errorf("Cannot ping cluster, Error: %w", err)
+	}
+	return nil
+}
+
+/*
+This method re-establishes the rados connection with the options it was
+created with and reopens the IO contexts of the connection and its pool
+handles on it. Images opened before keep using the previous connection,
+which is shut down once they are all closed, they must be opened again
+to use the new one.
+*/
+func (c *Connection) Reconnect() error {
+	if c.parent != nil {
+		return c.parent.Reconnect()
+	}
+	return c.reconnect(c.connectionConfig(), 0)
+}
+
+/*
+This is a helper method that returns the options the connection was
+established with.
+*/
+func (c *Connection) connectionConfig() *connectionConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.config
+}
+
+/*
+This is a helper method that replaces the rados connection and the IO
+contexts with new ones established as described by `config`, the
+previous ones are shut down once `drain` has elapsed and no image
+opened on them is left.
+*/
+func (c *Connection) reconnect(config *connectionConfig, drain time.Duration) error {
+	if config == nil {
+		return fmt.Errorf("Cannot reconnect to ceph, Error: connection options are unknown")
+	}
+
+	var conn *rados.Conn
+	err := c.GetRetryPolicy().do(func() error {
+		var err error
+		conn, err = connect(config, nil)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	c.pools.mutex.Lock()
+	defer c.pools.mutex.Unlock()
+
+	handles := []*Connection{c}
+	for _, handle := range c.pools.handles {
+		handles = append(handles, handle)
+	}
+
+	contexts := make([]*rados.IOContext, 0, len(handles))
+	for _, handle := range handles {
+		context, err := conn.OpenIOContext(handle.pool)
+		if err != nil {
+			for _, opened := range contexts {
+				opened.Destroy()
+			}
+			conn.Shutdown()
+			return fmt.Errorf("Error opening a IO Context with ceph on pool: %s, Error: %w", handle.pool, err)
+		}
+
+		if namespace := handle.GetNamespace(); namespace != "" {
+			context.SetNamespace(namespace)
+		}
+		contexts = append(contexts, context)
+	}
+
+	session := &radosSession{}
+	c.mutex.Lock()
+	previous, previousSession := c.Conn, c.session
+	previousContexts := make([]*rados.IOContext, 0, len(handles))
+	for index, handle := range handles {
+		previousContexts = append(previousContexts, handle.context)
+		handle.Conn, handle.context, handle.config = conn, contexts[index], config
+		handle.session = session
+	}
+	c.mutex.Unlock()
+
+	release := func() {
+		for _, context := range previousContexts {
+			if context != nil {
+				context.Destroy()
+			}
+		}
+
+		if previous != nil {
+			previous.Shutdown()
+		}
+	}
+
+	//the previous connection is released once drained and once the
+	//images opened on it are closed, whichever comes last
+	retire := func() {
+		if previousSession != nil {
+			previousSession.retire(release)
+		} else {
+			release()
+		}
+	}
+
+	if drain > 0 {
+		time.AfterFunc(drain, retire)
+	} else {
+		retire()
+	}
+
+	c.logger().Info("reconnected to ceph", "pool", c.pool, "handles", len(handles)-1)
+	return nil
+}
+
+/*
+This method enables the auto-reconnect mode: the cluster is pinged
+every `interval` (DefaultReconnectInterval if negative) on background
+and the connection is re-established (see `Reconnect`) when the monitors
+can't be reached within DefaultPingTimeout. Zero disables it.
+*/
+func (c *Connection) SetAutoReconnect(interval time.Duration) {
+	if c.parent != nil {
+		c.parent.SetAutoReconnect(interval)
+		return
+	}
+
+	c.stopAutoReconnect()
+	if interval == 0 {
+		return
+	}
+
+	if interval < 0 {
+		interval = DefaultReconnectInterval
+	}
+
+	watchdog := &reconnectWatchdog{stop: make(chan struct{}), done: make(chan struct{})}
+	c.mutex.Lock()
+	c.watchdog = watchdog
+	c.mutex.Unlock()
+
+	go func() {
+		defer close(watchdog.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-watchdog.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), DefaultPingTimeout)
+				err := c.Ping(ctx)
+				cancel()
+				if err == nil {
+					continue
+				}
+
+				logger := c.logger()
+				logger.Error("lost connection to ceph, reconnecting", "pool", c.pool, "error", err)
+
+				if err := c.Reconnect(); err != nil {
+					logger.Error("cannot reconnect to ceph", "pool", c.pool, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+/*
+Getter method for the auto-reconnect mode
+*/
+func (c *Connection) IsAutoReconnect() bool {
+	if c.parent != nil {
+		return c.parent.IsAutoReconnect()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.watchdog != nil
+}
+
+/*
+This is a helper method that stops the background checks of the
+auto-reconnect mode.
+*/
+func (c *Connection) stopAutoReconnect() {
+	c.mutex.Lock()
+	watchdog := c.watchdog
+	c.watchdog = nil
+	c.mutex.Unlock()
+
+	if watchdog != nil {
+		close(watchdog.stop)
+		<-watchdog.done
+	}
+}
@@ -0,0 +1,38 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+This method removes the image and its data, it must have no snapshots
+and not be mapped. It can take minutes on large images, `progress`
+(which can be nil) is called with the percentage removed.
+*/
+func (i *Image) Remove(progress ProgressFunc) error {
+	return i.remove(context.Background(), progress)
+}
+
+/*
+This is a helper method that removes the image as `Remove` does, the
+commands are run with `ctx`.
+*/
+func (i *Image) remove(ctx context.Context, progress ProgressFunc) (err error) {
+	ctx, end := i.observe(ctx, OperationRemove)
+	defer end(&err)
+
+	if device := i.mappedOn(ctx); device != "" {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot remove image: %s, Error: image is mapped on: %s", i.name, device)
+	}
+
+	_, err = i.runWithProgress(ctx, progress, "rm", "--id", i.username, i.spec(i.name, ""))
+	if err != nil && isNotFoundError(err) {
+		return kindErrorf(ErrImageNotFound, err, "Cannot remove image: %s, Error: %s", i.name, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot remove image: %s, Error: %w", i.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strconv"
+	"strings"
+)
+
+/*
+This method grows the image to `size` megabytes, an image that is
+already as large is left untouched, images are never shrunk.
+*/
+func (i *Image) Grow(size uint64) error {
+	return i.grow(context.Background(), size)
+}
+
+/*
+This is a helper method that grows the image as `Grow` does, its span is
+a child of the one of `ctx`.
+*/
+func (i *Image) grow(ctx context.Context, size uint64) (err error) {
+	_, end := i.observe(ctx, OperationResize)
+	defer end(&err)
+
+	current := i.ImageInfo.Size
+	if toMegs(size) <= current {
+		return nil
+	}
+
+	if err := i.checkCreatePolicy(size - current/toMegs(1)); err != nil {
+		return err
+	}
+
+	err = i.withWritableImage("resize", func(image *rbd.Image) error {
+		return image.Resize(toMegs(size))
+	})
+
+	if err != nil {
+		return fmt.Errorf("Cannot resize image: %s, Error: %w", i.name, err)
+	}
+
+	return i.refreshInfo()
+}
+
+/*
+This method grows the filesystem of the device to the size of the
+device, the filesystem must be mounted for xfs and btrfs.
+*/
+func (d *Device) GrowFilesystem() error {
+	if d.readOnly {
+		return fmt.Errorf("Cannot grow filesystem on device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.parent != nil {
+		return fmt.Errorf("Cannot grow filesystem on device: %s, Error: layered devices can't be resized", d.path)
+	}
+
+	var err error
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+		_, err = d.run("resize2fs", d.path)
+	case "xfs":
+		if !d.isMounted {
+			return fmt.Errorf("Cannot grow filesystem on device: %s, Error: xfs must be mounted", d.path)
+		}
+		_, err = d.runMounted("xfs_growfs", d.mountPoint)
+	case "btrfs":
+		if !d.isMounted {
+			return fmt.Errorf("Cannot grow filesystem on device: %s, Error: btrfs must be mounted", d.path)
+		}
+		_, err = d.runMounted("btrfs", "filesystem", "resize", "max", d.mountPoint)
+	default:
+		return fmt.Errorf("Cannot grow filesystem on device: %s, Error: unsupported filesystem: %s", d.path, d.fileSystemType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot grow filesystem on device: %s, Error: %w", d.path, err)
+	}
+	return nil
+}
+
+/*
+This method grows the image of the device to `size` megabytes and
+then its filesystem.
+*/
+func (d *Device) Grow(size uint64) error {
+	if d.image == nil {
+		return fmt.Errorf("Cannot grow device: %s, Error: no image attached", d.path)
+	}
+
+	if err := d.image.Grow(size); err != nil {
+		return err
+	}
+
+	return d.GrowFilesystem()
+}
+
+/*
+This method returns the used and total bytes of the mounted
+filesystem of the device.
+*/
+func (d *Device) Usage() (Size, Size, error) {
+	if !d.isMounted {
+		return 0, 0, kindErrorf(ErrNotMounted, nil, "Cannot get usage of device: %s, Error: device is not mounted", d.path)
+	}
+
+	output, err := d.runMounted("df", "--output=used,size", "-B1", d.mountPoint)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Cannot get usage of device: %s, Error: %w", d.path, err)
+	}
+
+	lines := strings.Split(output, "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) != 2 {
+		return 0, 0, parseFailure("df", output, fmt.Errorf("unexpected format"))
+	}
+
+	used, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, parseFailure("df", output, err)
+	}
+
+	total, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, parseFailure("df", output, err)
+	}
+
+	return Size(used), Size(total), nil
+}
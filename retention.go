@@ -0,0 +1,228 @@
+package blockdevice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"sort"
+	"strings"
+	"time"
+)
+
+//This struct represents which snapshots of an image are kept when it's
+//pruned, the most recent snapshot of each period is kept as in a
+//grandfather-father-son rotation.
+type RetentionPolicy struct {
+	//Number of most recent snapshots kept.
+	KeepLast int
+	//Number of most recent hours, days, weeks and months whose last
+	//snapshot is kept.
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	//Only the snapshots whose name starts with it are pruned (e.g.
+	//"scheduled-"), all of them if empty.
+	Prefix string
+}
+
+//This struct represents the outcome of `Image.PruneSnapshots`, from the
+//newest snapshot to the oldest.
+type PruneResult struct {
+	Kept    []string
+	Removed []string
+	//Expired snapshots left in place, and why they can't be removed.
+	Skipped map[string]string
+}
+
+//This struct represents a snapshot of an image as listed by the rbd tool.
+type snapshotEntry struct {
+	name      string
+	protected bool
+	createdAt time.Time
+}
+
+/*
+This is a helper method that lists the snapshots of the image with their
+creation time, the newest first, the rbd tool is run with `ctx`.
+*/
+func (i *Image) listSnapshots(ctx context.Context) ([]snapshotEntry, error) {
+	output, err := i.runCtx(ctx, "rbd", "snap", "ls", "--id", i.username, "--format", "json", i.spec(i.name, ""))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list snapshots of image: %s, Error: %w", i.name, err)
+	}
+
+	var snapshots []snapshotEntry
+	if output == "" {
+		return snapshots, nil
+	}
+
+	var listed []struct {
+		Name      string `json:"name"`
+		Protected string `json:"protected"`
+		Timestamp string `json:"timestamp"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, parseFailure("rbd snap ls", output, err)
+	}
+
+	for _, snapshot := range listed {
+		createdAt, err := time.ParseInLocation(time.ANSIC, snapshot.Timestamp, time.Local)
+		if err != nil {
+			return nil, parseFailure("rbd snap ls", output, err)
+		}
+		snapshots = append(snapshots, snapshotEntry{
+			name:      snapshot.Name,
+			protected: snapshot.Protected == "true",
+			createdAt: createdAt,
+		})
+	}
+
+	sort.SliceStable(snapshots, func(a, b int) bool {
+		return snapshots[a].createdAt.After(snapshots[b].createdAt)
+	})
+	return snapshots, nil
+}
+
+/*
+This is a helper method that returns the images cloned from a snapshot
+of the image, including the ones in the trash, the rbd tool is run with
+`ctx`.
+*/
+func (i *Image) snapshotChildren(ctx context.Context, snapshot string) ([]string, error) {
+	output, err := i.runCtx(ctx, "rbd", "children", "--all", "--id", i.username, "--format", "json", i.spec(i.name, snapshot))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list children of snapshot: %s, Error: %w", snapshot, err)
+	}
+
+	var children []string
+	if output == "" {
+		return children, nil
+	}
+
+	var listed []struct {
+		Pool      string `json:"pool"`
+		Namespace string `json:"pool_namespace"`
+		Image     string `json:"image"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, parseFailure("rbd children", output, err)
+	}
+
+	for _, child := range listed {
+		children = append(children, namespacedSpec(child.Pool, child.Namespace, child.Image, ""))
+	}
+	return children, nil
+}
+
+/*
+This is a helper method that returns the snapshots kept by the policy,
+`snapshots` being sorted from the newest.
+*/
+func (p *RetentionPolicy) keep(snapshots []snapshotEntry) map[string]bool {
+	kept := make(map[string]bool)
+	for index, snapshot := range snapshots {
+		if index < p.KeepLast {
+			kept[snapshot.name] = true
+		}
+	}
+
+	periods := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for _, rotation := range periods {
+		last, count := "", 0
+		for _, snapshot := range snapshots {
+			if count >= rotation.count {
+				break
+			}
+
+			if period := rotation.period(snapshot.createdAt); period != last {
+				kept[snapshot.name] = true
+				last = period
+				count++
+			}
+		}
+	}
+	return kept
+}
+
+/*
+This method removes the snapshots of the image expired by `policy`.
+Protected snapshots and snapshots with clones are never removed, they're
+reported as skipped. A policy keeping no snapshot at all is refused.
+*/
+func (i *Image) PruneSnapshots(policy *RetentionPolicy) (result *PruneResult, err error) {
+	ctx, end := i.observe(context.Background(), OperationPrune)
+	defer end(&err)
+
+	if policy == nil || policy.KeepLast+policy.Hourly+policy.Daily+policy.Weekly+policy.Monthly <= 0 {
+		return nil, fmt.Errorf("Cannot prune snapshots of image: %s, Error: the policy keeps no snapshot", i.name)
+	}
+
+	listed, err := i.listSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []snapshotEntry
+	for _, snapshot := range listed {
+		if strings.HasPrefix(snapshot.name, policy.Prefix) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	result = &PruneResult{Skipped: make(map[string]string)}
+	kept := policy.keep(snapshots)
+
+	var failed []string
+	for _, snapshot := range snapshots {
+		if kept[snapshot.name] {
+			result.Kept = append(result.Kept, snapshot.name)
+			continue
+		}
+
+		if snapshot.protected {
+			result.Skipped[snapshot.name] = "snapshot is protected"
+			continue
+		}
+
+		children, err := i.snapshotChildren(ctx, snapshot.name)
+		if err != nil {
+			return result, err
+		}
+
+		if len(children) > 0 {
+			result.Skipped[snapshot.name] = "snapshot has clones: " + strings.Join(children, ", ")
+			continue
+		}
+
+		err = i.withWritableImage("remove snapshot", func(image *rbd.Image) error {
+			return image.GetSnapshot(snapshot.name).Remove()
+		})
+
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", snapshot.name, err))
+			continue
+		}
+		result.Removed = append(result.Removed, snapshot.name)
+	}
+
+	if len(failed) > 0 {
+		return result, fmt.Errorf("Cannot remove snapshots of image: %s, Error: %s", i.name, strings.Join(failed, "; "))
+	}
+	return result, i.refreshInfo()
+}
@@ -0,0 +1,55 @@
+package blockdevice
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	//newest first, as listed by listSnapshots
+	snapshots := []snapshotEntry{
+		{name: "a", createdAt: at("2024-03-20 10:30")},
+		{name: "b", createdAt: at("2024-03-20 10:00")},
+		{name: "c", createdAt: at("2024-03-20 09:00")},
+		{name: "d", createdAt: at("2024-03-19 23:00")},
+		{name: "e", createdAt: at("2024-03-19 01:00")},
+		{name: "f", createdAt: at("2024-03-12 12:00")},
+		{name: "g", createdAt: at("2024-02-28 12:00")},
+		{name: "h", createdAt: at("2024-01-15 12:00")},
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{"nothing", RetentionPolicy{}, nil},
+		{"last", RetentionPolicy{KeepLast: 2}, []string{"a", "b"}},
+		{"more than listed", RetentionPolicy{KeepLast: 20}, []string{"a", "b", "c", "d", "e", "f", "g", "h"}},
+		{"hourly", RetentionPolicy{Hourly: 3}, []string{"a", "c", "d"}},
+		{"daily", RetentionPolicy{Daily: 2}, []string{"a", "d"}},
+		{"weekly", RetentionPolicy{Weekly: 2}, []string{"a", "f"}},
+		{"monthly", RetentionPolicy{Monthly: 3}, []string{"a", "g", "h"}},
+		{"combined", RetentionPolicy{KeepLast: 1, Daily: 2, Monthly: 2}, []string{"a", "d", "g"}},
+	}
+
+	for _, test := range tests {
+		want := make(map[string]bool)
+		for _, name := range test.want {
+			want[name] = true
+		}
+
+		if got := test.policy.keep(snapshots); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: keep() = %v, want %v", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package blockdevice
+
+import (
+	"errors"
+	"math/rand"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultRetryMaxBackoff = 10 * time.Second
+)
+
+//This struct represents how the operations prone to transient failures
+//(rados connect, map and mount) are retried, e.g. during a mon election
+//or an udev race.
+type RetryPolicy struct {
+	//Number of attempts, including the first one.
+	MaxAttempts int
+	//Time to wait before the first retry, doubled on each attempt
+	//(DefaultRetryBackoff if zero) up to MaxBackoff
+	//(DefaultRetryMaxBackoff if zero).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	//Fraction of the backoff randomly added or removed (0 to 1).
+	Jitter float64
+	//Tells whether a failure should be retried, `IsTransientError` if
+	//nil.
+	Retryable func(err error) bool
+}
+
+//Retry policy retrying transient failures for about 10 seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     DefaultRetryBackoff,
+	MaxBackoff:  DefaultRetryMaxBackoff,
+	Jitter:      0.2,
+}
+
+/*
+This method tells whether an error is likely transient: timeouts,
+unavailable mons or OSDs, and devices not set up by the kernel yet. A
+missing image or file is not.
+*/
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, errno := range []syscall.Errno{syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR} {
+		if errors.Is(err, errno) || librbdErrorCode(err) == -int(errno) {
+			return true
+		}
+	}
+
+	if errors.Is(err, ErrCommandTimeout) {
+		return true
+	}
+
+	for _, text := range []string{"timed out", "temporarily unavailable", "no such device"} {
+		if stderrContains(err, text) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+This is a helper method that runs `fn` until it succeeds, fails with a
+permanent error or the attempts are exhausted, returning the last
+error. A nil policy runs `fn` once.
+*/
+func (p *RetryPolicy) do(fn func() error) error {
+	if p == nil || p.MaxAttempts <= 1 {
+		return fn()
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransientError
+	}
+
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		wait := backoff
+		if p.Jitter > 0 {
+			wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(backoff))
+		}
+		time.Sleep(wait)
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+/*
+This method sets the retry policy of the map and mount operations of
+the connection, nil (the default) disables the retries.
+*/
+func (c *Connection) SetRetryPolicy(policy *RetryPolicy) {
+	if c.parent != nil {
+		c.parent.SetRetryPolicy(policy)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.retryPolicy = policy
+}
+
+/*
+Getter method for retryPolicy
+*/
+func (c *Connection) GetRetryPolicy() *RetryPolicy {
+	if c.parent != nil {
+		return c.parent.GetRetryPolicy()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.retryPolicy
+}
+
+/*
+This method is a variant of `NewConnection` retrying the connection to
+the cluster as described by `policy` (DefaultRetryPolicy if nil), the
+policy is then used by the connection (see `SetRetryPolicy`).
+*/
+func NewConnectionWithRetry(policy *RetryPolicy, options ...ConnectionOption) (*Connection, error) {
+	if policy == nil {
+		defaults := DefaultRetryPolicy
+		policy = &defaults
+	}
+	return newConnection(newConnectionConfig(options), policy)
+}
@@ -0,0 +1,63 @@
+package blockdevice
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{syscall.ETIMEDOUT, true},
+		{fmt.Errorf("Cannot connect, Error: %w", syscall.EAGAIN), true},
+		{errors.New("rbd: ret=-110"), true},
+		{kindErrorf(ErrCommandTimeout, nil, "Command timed out"), true},
+		{&CommandError{Stderr: "rbd: sysfs write failed\nrbd: map failed: (6) No such device"}, true},
+		{&CommandError{Stderr: "rbd: error opening image data: (2) No such file or directory"}, false},
+		{syscall.ENOENT, false},
+		{errors.New("rbd: ret=-2"), false},
+		{syscall.EPERM, false},
+	}
+
+	for _, test := range tests {
+		if got := IsTransientError(test.err); got != test.want {
+			t.Errorf("IsTransientError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, Backoff: 1, MaxBackoff: 1}
+
+	attempts := 0
+	err := policy.do(func() error {
+		attempts++
+		return syscall.EAGAIN
+	})
+	if !errors.Is(err, syscall.EAGAIN) || attempts != 3 {
+		t.Errorf("do() = %v after %d attempts, want EAGAIN after 3", err, attempts)
+	}
+
+	attempts = 0
+	policy.do(func() error {
+		attempts++
+		return syscall.EPERM
+	})
+	if attempts != 1 {
+		t.Errorf("a permanent error was attempted %d times", attempts)
+	}
+
+	attempts = 0
+	(*RetryPolicy)(nil).do(func() error {
+		attempts++
+		return syscall.EAGAIN
+	})
+	if attempts != 1 {
+		t.Errorf("a nil policy attempted %d times", attempts)
+	}
+}
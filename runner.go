@@ -0,0 +1,358 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//This interface represents the mechanism used to run the external
+//commands (rbd, mkfs, mount, ...) on the host owning the device.
+type CommandRunner interface {
+	Run(name string, args ...string) (string, error)
+}
+
+//This interface represents a runner able to feed the standard input of
+//the commands, used to pass secrets without exposing them as arguments.
+type InputRunner interface {
+	RunWithInput(input []byte, name string, args ...string) (string, error)
+}
+
+//This interface represents an input runner passing a context to the
+//commands, so they're logged and traced as the ones of `ContextRunner`.
+type inputContextRunner interface {
+	runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error)
+}
+
+//This struct represents the failure of an external command, it wraps
+//the *exec.ExitError (or the error starting or stopping the command).
+type CommandError struct {
+	Cmd    string
+	Args   []string
+	Stdout string
+	Stderr string
+	//Exit code of the command, -1 if it didn't run.
+	ExitCode int
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	message := fmt.Sprintf("Command: %s failed, exit code: %d", strings.Join(append([]string{e.Cmd}, e.Args...), " "), e.ExitCode)
+	if e.Stderr != "" {
+		return message + ", Error: " + e.Stderr
+	}
+	return message + ", Error: " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+/*
+This is a helper method that returns the `CommandError` of a failed
+command, nil if it succeeded.
+*/
+func commandError(name string, args []string, stdout []byte, stderr []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &CommandError{
+		Cmd:      name,
+		Args:     args,
+		Stdout:   strings.TrimSpace(string(stdout)),
+		Stderr:   strings.TrimSpace(string(stderr)),
+		ExitCode: exitCode(err),
+		Err:      err,
+	}
+}
+
+//This struct runs commands on the local host.
+type LocalRunner struct{}
+
+func (r *LocalRunner) Run(name string, args ...string) (string, error) {
+	return RunCommand(name, args...)
+}
+
+func (r *LocalRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return runCommandWithInput(input, name, args...)
+}
+
+func (r *LocalRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	return runProcess(ctx, input, name, args...)
+}
+
+//This struct runs commands on a remote host using the ssh client, the
+//authentication is delegated to ssh (agent, identity or certificate).
+type SSHRunner struct {
+	Host string
+	User string
+	Port int
+	//Private key used to authenticate (ssh -i).
+	IdentityFile string
+	//Certificate used along with the identity (ssh -o CertificateFile).
+	CertificateFile string
+	//Extra ssh options (ssh -o), e.g. StrictHostKeyChecking=yes.
+	Options []string
+	//Run the commands through sudo on the remote host.
+	Sudo bool
+}
+
+/*
+This method is a constructor for `SSHRunner` objects, the remote
+user, port and credentials are taken from the ssh configuration.
+*/
+func NewSSHRunner(host string) *SSHRunner {
+	return &SSHRunner{Host: host}
+}
+
+/*
+This method returns the arguments to pass to the ssh client in order
+to run the given command on the remote host, a host (or user) starting
+with "-" is rejected as ssh would take it for an option.
+*/
+func (r *SSHRunner) sshArgs(name string, args ...string) ([]string, error) {
+	host := r.Host
+	if r.User != "" {
+		host = r.User + "@" + host
+	}
+
+	if r.Host == "" || strings.HasPrefix(host, "-") {
+		return nil, fmt.Errorf("Cannot run command: %s, Error: invalid ssh host: %q", name, host)
+	}
+
+	sshArgs := []string{"-o", "BatchMode=yes"}
+	if r.Port > 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(r.Port))
+	}
+
+	if r.IdentityFile != "" {
+		sshArgs = append(sshArgs, "-i", r.IdentityFile)
+	}
+
+	if r.CertificateFile != "" {
+		sshArgs = append(sshArgs, "-o", "CertificateFile="+r.CertificateFile)
+	}
+
+	for _, option := range r.Options {
+		sshArgs = append(sshArgs, "-o", option)
+	}
+
+	command := []string{shellQuote(name)}
+	if r.Sudo {
+		command = append([]string{"sudo", "-n"}, command...)
+	}
+
+	for _, arg := range args {
+		command = append(command, shellQuote(arg))
+	}
+
+	return append(sshArgs, host, "--", strings.Join(command, " ")), nil
+}
+
+func (r *SSHRunner) Run(name string, args ...string) (string, error) {
+	sshArgs, err := r.sshArgs(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return RunCommand("ssh", sshArgs...)
+}
+
+func (r *SSHRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	sshArgs, err := r.sshArgs(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return runCommandWithInput(input, "ssh", sshArgs...)
+}
+
+func (r *SSHRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	sshArgs, err := r.sshArgs(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return runProcess(ctx, input, "ssh", sshArgs...)
+}
+
+//This struct runs the commands of another runner (the local host if
+//nil) through sudo.
+type SudoRunner struct {
+	Runner CommandRunner
+	//Run the commands as this user instead of root (sudo -u).
+	User string
+}
+
+/*
+This method returns the sudo command line of the given command.
+*/
+func (r *SudoRunner) sudoArgs(name string, args ...string) []string {
+	sudoArgs := []string{"-n"}
+	if r.User != "" {
+		sudoArgs = append(sudoArgs, "-u", r.User)
+	}
+	return append(append(sudoArgs, "--", name), args...)
+}
+
+func (r *SudoRunner) Run(name string, args ...string) (string, error) {
+	return runnerOrLocal(r.Runner).Run("sudo", r.sudoArgs(name, args...)...)
+}
+
+func (r *SudoRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return runWithInput(r.Runner, input, "sudo", r.sudoArgs(name, args...)...)
+}
+
+func (r *SudoRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	return runWithInputContext(ctx, r.Runner, input, "sudo", r.sudoArgs(name, args...)...)
+}
+
+//This struct runs the commands of another runner (the local host if
+//nil) inside a chroot, e.g. the host root mounted in a container.
+type ChrootRunner struct {
+	Runner CommandRunner
+	Root   string
+}
+
+func (r *ChrootRunner) Run(name string, args ...string) (string, error) {
+	return runnerOrLocal(r.Runner).Run("chroot", append([]string{r.Root, name}, args...)...)
+}
+
+func (r *ChrootRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return runWithInput(r.Runner, input, "chroot", append([]string{r.Root, name}, args...)...)
+}
+
+func (r *ChrootRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	return runWithInputContext(ctx, r.Runner, input, "chroot", append([]string{r.Root, name}, args...)...)
+}
+
+/*
+This is a helper method for running a command feeding `input` to its
+standard input and returning the output.
+*/
+func runCommandWithInput(input []byte, name string, args ...string) (string, error) {
+	return runProcess(context.Background(), input, name, args...)
+}
+
+/*
+This is a helper method that runs a command with the given standard
+input on a runner, which must implement `InputRunner`.
+*/
+func runWithInput(runner CommandRunner, input []byte, name string, args ...string) (string, error) {
+	return runWithInputContext(context.Background(), runner, input, name, args...)
+}
+
+/*
+This is a helper method that runs a command with the given standard
+input on a runner like `runWithInput`, with `ctx` if the runner supports
+it.
+*/
+func runWithInputContext(ctx context.Context, runner CommandRunner, input []byte, name string, args ...string) (string, error) {
+	runner = runnerOrLocal(runner)
+	if contextRunner, ok := runner.(inputContextRunner); ok {
+		return contextRunner.runWithInputContext(ctx, input, name, args...)
+	}
+
+	inputRunner, ok := runner.(InputRunner)
+	if !ok {
+		return "", fmt.Errorf("Cannot run: %s, Error: runner doesn't support standard input", name)
+	}
+	return inputRunner.RunWithInput(input, name, args...)
+}
+
+/*
+This is a helper method that quotes an argument for a POSIX shell.
+*/
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+.,:/@%") == "" {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+/*
+This is a helper method that returns the runner to use, defaulting
+to the local host.
+*/
+func runnerOrLocal(runner CommandRunner) CommandRunner {
+	if runner == nil {
+		return &LocalRunner{}
+	}
+	return runner
+}
+
+/*
+This method sets the runner of the external commands of the connection
+(rbd, ...) and the default one of its devices (see `MapOptions.Runner`),
+nil runs them on the local host.
+*/
+func (c *Connection) SetRunner(runner CommandRunner) {
+	if c.parent != nil {
+		c.parent.SetRunner(runner)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.runner = runner
+}
+
+/*
+Getter method for runner
+*/
+func (c *Connection) GetRunner() CommandRunner {
+	if c.parent != nil {
+		return c.parent.GetRunner()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.runner
+}
+
+/*
+This is a helper method that returns `runner`, or the runner of the
+connection if it's nil, with the command timeout of the connection. In
+dry-run mode the commands are recorded on the plan instead.
+*/
+func (c *Connection) hostRunner(runner CommandRunner) CommandRunner {
+	if plan := c.GetDryRun(); plan != nil {
+		return &planRunner{plan: plan}
+	}
+
+	if runner == nil {
+		runner = runnerOrLocal(c.GetRunner())
+	}
+
+	if _, ok := runner.(*timeoutRunner); ok {
+		return runner
+	}
+	return &timeoutRunner{runner: runner, connection: c}
+}
+
+/*
+This is a helper method that runs a command with the runner of the
+connection, the rbd tool is authenticated with its credentials.
+*/
+func (c *Connection) run(name string, args ...string) (string, error) {
+	return c.runCtx(context.Background(), name, args...)
+}
+
+/*
+This is a helper method that runs a command like `run`, with `ctx`: it's
+killed when `ctx` is done and its span is a child of the one of `ctx`.
+*/
+func (c *Connection) runCtx(ctx context.Context, name string, args ...string) (string, error) {
+	if name == "rbd" {
+		return c.runCephProgress(ctx, c.hostRunner(nil), nil, name, args...)
+	}
+	return runContext(ctx, c.hostRunner(nil), name, args...)
+}
+
+/*
+This is a helper method that tells if the runner executes commands
+on the local host.
+*/
+func isLocalRunner(runner CommandRunner) bool {
+	_, local := unwrapRunner(runner).(*LocalRunner)
+	return local
+}
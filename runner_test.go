@@ -0,0 +1,42 @@
+package blockdevice
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSSHRunnerRejectsOptionHost(t *testing.T) {
+	runners := []*SSHRunner{
+		{Host: "-oProxyCommand=touch /tmp/owned"},
+		{Host: "node1", User: "-oProxyCommand=id"},
+		{},
+	}
+
+	for _, runner := range runners {
+		if _, err := runner.Run("true"); err == nil || !strings.Contains(err.Error(), "invalid ssh host") {
+			t.Errorf("Run() on %+v error = %v, want invalid ssh host", runner, err)
+		}
+
+		if _, err := runner.RunWithInput([]byte("input"), "cat"); err == nil {
+			t.Errorf("RunWithInput() on %+v succeeded, want an error", runner)
+		}
+
+		if _, err := runner.RunContext(context.Background(), "true"); err == nil {
+			t.Errorf("RunContext() on %+v succeeded, want an error", runner)
+		}
+	}
+}
+
+func TestSSHRunnerArgs(t *testing.T) {
+	runner := &SSHRunner{Host: "node1", User: "ceph", Port: 2222, Sudo: true}
+	args, err := runner.sshArgs("rbd", "map", "rbd/my image")
+	if err != nil {
+		t.Fatalf("sshArgs() error = %v", err)
+	}
+
+	want := "-o BatchMode=yes -p 2222 ceph@node1 -- sudo -n rbd map 'rbd/my image'"
+	if got := strings.Join(args, " "); got != want {
+		t.Errorf("sshArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package blockdevice
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Operators of a selector requirement.
+const (
+	SelectorEquals    = "="
+	SelectorNotEquals = "!="
+	SelectorIn        = "in"
+	SelectorNotIn     = "notin"
+	SelectorExists    = "exists"
+	SelectorNotExists = "!"
+)
+
+//This struct represents a single requirement of a `Selector`.
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+//This type represents a label selector matched against image metadata,
+//all its requirements must match.
+type Selector []Requirement
+
+/*
+This method parses a label selector such as
+"app=web,tier!=db,env in (prod,staging),pvc,!legacy".
+An empty selector matches every image.
+*/
+func ParseSelector(selector string) (Selector, error) {
+	var parsed Selector
+	for _, term := range splitSelector(selector) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		requirement, err := parseRequirement(term)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse selector: %q, Error: %w", selector, err)
+		}
+		parsed = append(parsed, requirement)
+	}
+	return parsed, nil
+}
+
+/*
+This is a helper method that splits a selector on the commas that are
+not inside a set of values.
+*/
+func splitSelector(selector string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for index, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:index])
+				start = index + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+/*
+This is a helper method that parses a single selector term.
+*/
+func parseRequirement(term string) (Requirement, error) {
+	if strings.HasPrefix(term, "!") {
+		return Requirement{Key: strings.TrimSpace(term[1:]), Operator: SelectorNotExists}, nil
+	}
+
+	if index := strings.Index(term, "!="); index > 0 {
+		return Requirement{Key: strings.TrimSpace(term[:index]), Operator: SelectorNotEquals,
+			Values: []string{strings.TrimSpace(term[index+2:])}}, nil
+	}
+
+	if index := strings.Index(term, "="); index > 0 {
+		value := strings.TrimPrefix(term[index+1:], "=")
+		return Requirement{Key: strings.TrimSpace(term[:index]), Operator: SelectorEquals,
+			Values: []string{strings.TrimSpace(value)}}, nil
+	}
+
+	fields := strings.Fields(term)
+	switch {
+	case len(fields) == 1:
+		return Requirement{Key: fields[0], Operator: SelectorExists}, nil
+	case len(fields) >= 3 && (fields[1] == SelectorIn || fields[1] == SelectorNotIn):
+		set := strings.TrimSpace(strings.Join(fields[2:], ""))
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return Requirement{}, fmt.Errorf("invalid set of values: %s", set)
+		}
+
+		var values []string
+		for _, value := range strings.Split(set[1:len(set)-1], ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+		return Requirement{Key: fields[0], Operator: fields[1], Values: values}, nil
+	}
+
+	return Requirement{}, fmt.Errorf("invalid requirement: %s", term)
+}
+
+/*
+This method tells if the given metadata matches the requirement.
+*/
+func (r Requirement) Matches(metadata map[string]string) bool {
+	value, ok := metadata[r.Key]
+	switch r.Operator {
+	case SelectorExists:
+		return ok
+	case SelectorNotExists:
+		return !ok
+	case SelectorEquals:
+		return ok && value == r.Values[0]
+	case SelectorNotEquals:
+		return !ok || value != r.Values[0]
+	case SelectorIn, SelectorNotIn:
+		found := false
+		for _, candidate := range r.Values {
+			if ok && value == candidate {
+				found = true
+			}
+		}
+		return found == (r.Operator == SelectorIn)
+	}
+	return false
+}
+
+/*
+This method tells if the given metadata matches every requirement.
+*/
+func (s Selector) Matches(metadata map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, r := range s {
+		switch r.Operator {
+		case SelectorExists:
+			terms = append(terms, r.Key)
+		case SelectorNotExists:
+			terms = append(terms, "!"+r.Key)
+		case SelectorIn, SelectorNotIn:
+			values := append([]string(nil), r.Values...)
+			sort.Strings(values)
+			terms = append(terms, fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(values, ",")))
+		default:
+			terms = append(terms, r.Key+r.Operator+r.Values[0])
+		}
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,68 @@
+package blockdevice
+
+import (
+	"fmt"
+)
+
+//This struct represents the SELinux labeling of the filesystem of a
+//device, see the "context mount options" of mount(8).
+type SELinuxOptions struct {
+	//Context of every file of the filesystem (context=).
+	Context string
+	//Context of the filesystem itself (fscontext=).
+	FSContext string
+	//Context of the unlabeled files (defcontext=).
+	DefContext string
+	//Context of the root directory (rootcontext=).
+	RootContext string
+	//Restore the default labels of the mountpoint (restorecon -R) after
+	//the first mount of the device.
+	Relabel bool
+}
+
+/*
+This method returns the mount options described by the `SELinuxOptions`,
+the contexts are quoted as they may hold commas (e.g. s0:c1,c2).
+*/
+func (o *SELinuxOptions) mountOptions() []string {
+	if o == nil {
+		return nil
+	}
+
+	var options []string
+	for _, option := range []struct{ name, context string }{
+		{"context", o.Context},
+		{"fscontext", o.FSContext},
+		{"defcontext", o.DefContext},
+		{"rootcontext", o.RootContext},
+	} {
+		if option.context != "" {
+			options = append(options, option.name+"=\""+option.context+"\"")
+		}
+	}
+	return options
+}
+
+/*
+This method restores the default SELinux labels of the files of the
+mounted device (restorecon -R).
+*/
+func (d *Device) Relabel() error {
+	if !d.isMounted {
+		return kindErrorf(ErrNotMounted, nil, "Cannot relabel device: %s, Error: device is not mounted", d.path)
+	}
+
+	if _, err := d.runMounted("restorecon", "-R", d.mountPoint); err != nil {
+		return fmt.Errorf("Cannot relabel: %s, Error: %w", d.mountPoint, err)
+	}
+
+	d.relabeled = true
+	return nil
+}
+
+/*
+Getter method for selinux
+*/
+func (d *Device) GetSELinuxOptions() *SELinuxOptions {
+	return d.selinux
+}
@@ -0,0 +1,89 @@
+package blockdevice
+
+import (
+	"github.com/ceph/go-ceph/rados"
+	"sync"
+)
+
+//This struct represents a rados connection and its IO contexts as used
+//by the images opened on them, so a reconnect releases them only once
+//the images are closed.
+type radosSession struct {
+	mutex   sync.Mutex
+	users   int
+	retired bool
+	release func()
+}
+
+/*
+This is a helper method that registers a user of the session.
+*/
+func (s *radosSession) acquire() *radosSession {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.users++
+	return s
+}
+
+/*
+This is a helper method that unregisters a user of the session, the
+last one of a retired session releases it.
+*/
+func (s *radosSession) done() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	s.users--
+	release := s.releasable()
+	s.mutex.Unlock()
+
+	if release != nil {
+		release()
+	}
+}
+
+/*
+This is a helper method that retires the session, it's released by
+`release` as soon as it has no users, at once if it has none.
+*/
+func (s *radosSession) retire(release func()) {
+	s.mutex.Lock()
+	s.retired, s.release = true, release
+	release = s.releasable()
+	s.mutex.Unlock()
+
+	if release != nil {
+		release()
+	}
+}
+
+/*
+This is a helper method that returns the release function of the
+session if it's due, only once. The mutex must be held.
+*/
+func (s *radosSession) releasable() func() {
+	if !s.retired || s.users > 0 || s.release == nil {
+		return nil
+	}
+
+	release := s.release
+	s.release = nil
+	return release
+}
+
+/*
+This is a helper method that returns the IO context of the connection
+pool along with its session, acquired, so the context outlives a
+reconnect until the session is done.
+*/
+func (c *Connection) acquireContext() (*radosSession, *rados.IOContext) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.session.acquire(), c.context
+}
@@ -0,0 +1,80 @@
+package blockdevice
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRadosSessionRelease(t *testing.T) {
+	released := 0
+	session := &radosSession{}
+	session.acquire()
+	session.acquire()
+
+	session.retire(func() { released++ })
+	if released != 0 {
+		t.Fatalf("session released with users left")
+	}
+
+	session.done()
+	if released != 0 {
+		t.Fatalf("session released with a user left")
+	}
+
+	session.done()
+	if released != 1 {
+		t.Fatalf("session released %d times once done, want 1", released)
+	}
+
+	//a late user doesn't release it again
+	session.acquire().done()
+	if released != 1 {
+		t.Fatalf("session released %d times, want 1", released)
+	}
+}
+
+func TestRadosSessionRetireUnused(t *testing.T) {
+	released := 0
+	session := &radosSession{}
+	session.acquire().done()
+
+	session.retire(func() { released++ })
+	if released != 1 {
+		t.Fatalf("unused session released %d times, want 1", released)
+	}
+}
+
+func TestRadosSessionConcurrent(t *testing.T) {
+	var mutex sync.Mutex
+	released := 0
+	session := &radosSession{}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		session.acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer session.done()
+			for round := 0; round < 100; round++ {
+				session.acquire().done()
+			}
+		}()
+	}
+
+	session.retire(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		released++
+	})
+	wg.Wait()
+
+	if released != 1 {
+		t.Fatalf("session released %d times, want 1", released)
+	}
+}
+
+func TestNilRadosSession(t *testing.T) {
+	var session *radosSession
+	session.acquire().done()
+}
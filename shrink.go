@@ -0,0 +1,149 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strconv"
+	"strings"
+)
+
+//Free space ratio, over the used space, a filesystem keeps after being
+//shrunk.
+const DefaultShrinkMargin = 0.1
+
+//This struct represents the options used to shrink a device, nothing
+//is shrunk unless `Confirm` is set.
+type ShrinkOptions struct {
+	//Acknowledge that the data beyond the new size is destroyed.
+	Confirm bool
+	//Free space ratio over the used space required after the shrink
+	//(DefaultShrinkMargin if zero).
+	Margin float64
+}
+
+/*
+This method shrinks the image to `size` megabytes, the data beyond is
+destroyed: the filesystem must have been shrunk first (see
+`Device.Shrink`). It requires `options.Confirm`.
+*/
+func (i *Image) ShrinkTo(size uint64, options *ShrinkOptions) (err error) {
+	_, end := i.observe(context.Background(), OperationResize)
+	defer end(&err)
+
+	if options == nil || !options.Confirm {
+		return fmt.Errorf("Cannot shrink image: %s, Error: shrinking destroys data and must be confirmed", i.name)
+	}
+
+	if toMegs(size) >= i.ImageInfo.Size {
+		return fmt.Errorf("Cannot shrink image: %s to: %dM, Error: image is not larger", i.name, size)
+	}
+
+	err = i.withWritableImage("resize", func(image *rbd.Image) error {
+		return image.Resize(toMegs(size))
+	})
+
+	if err != nil {
+		return fmt.Errorf("Cannot resize image: %s, Error: %w", i.name, err)
+	}
+
+	return i.refreshInfo()
+}
+
+/*
+This method returns the used bytes of the (unmounted) ext filesystem
+of the device.
+*/
+func (d *Device) extUsedBytes() (uint64, error) {
+	output, err := d.run("dumpe2fs", "-h", d.path)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot read filesystem of device: %s, Error: %w", d.path, err)
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		switch key {
+		case "Block count", "Free blocks", "Block size":
+			number, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return 0, parseFailure("dumpe2fs", output, err)
+			}
+			values[key] = number
+		}
+	}
+
+	if len(values) != 3 {
+		return 0, parseFailure("dumpe2fs", output, fmt.Errorf("missing block counts"))
+	}
+	return (values["Block count"] - values["Free blocks"]) * values["Block size"], nil
+}
+
+/*
+This method shrinks the filesystem of the device to `size` megabytes,
+after checking that the used space fits with the margin of `options`.
+Only ext filesystems can be shrunk (xfs can't), offline: the device
+must not be mounted. It requires `options.Confirm`.
+*/
+func (d *Device) ShrinkFilesystem(size uint64, options *ShrinkOptions) error {
+	if options == nil || !options.Confirm {
+		return fmt.Errorf("Cannot shrink filesystem on device: %s, Error: shrinking must be confirmed", d.path)
+	}
+
+	switch {
+	case d.readOnly:
+		return fmt.Errorf("Cannot shrink filesystem on device: %s, Error: device is mapped read-only", d.path)
+	case d.isMounted:
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot shrink filesystem on device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	switch d.fileSystemType {
+	case "ext2", "ext3", "ext4":
+	default:
+		return fmt.Errorf("Cannot shrink filesystem on device: %s, Error: %s filesystems can't be shrunk", d.path, d.fileSystemType)
+	}
+
+	//resize2fs refuses to shrink a filesystem that wasn't just checked
+	if err := d.Fsck(true); err != nil {
+		return err
+	}
+
+	used, err := d.extUsedBytes()
+	if err != nil {
+		return err
+	}
+
+	margin := options.Margin
+	if margin <= 0 {
+		margin = DefaultShrinkMargin
+	}
+
+	if required := uint64(float64(used) * (1 + margin)); required > toMegs(size) {
+		return fmt.Errorf("Cannot shrink filesystem on device: %s to: %dM, Error: %d bytes used, %d required", d.path, size, used, required)
+	}
+
+	if _, err := d.run("resize2fs", d.path, strconv.FormatUint(size, 10)+"M"); err != nil {
+		return fmt.Errorf("Cannot shrink filesystem on device: %s, Error: %w", d.path, err)
+	}
+	return nil
+}
+
+/*
+This method shrinks the filesystem of the device and then its image to
+`size` megabytes, see `ShrinkFilesystem`. It requires `options.Confirm`.
+*/
+func (d *Device) Shrink(size uint64, options *ShrinkOptions) error {
+	if d.image == nil || d.parent != nil || d.disk != nil {
+		return fmt.Errorf("Cannot shrink device: %s, Error: only whole mapped images can be shrunk", d.path)
+	}
+
+	if err := d.ShrinkFilesystem(size, options); err != nil {
+		return err
+	}
+
+	return d.image.ShrinkTo(size, options)
+}
@@ -0,0 +1,142 @@
+package blockdevice
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//This type represents a size in bytes, printed in human-readable form
+//(e.g. "1.5 GiB") and serialized as the number of bytes.
+type Size uint64
+
+//Binary units of `Size`.
+const (
+	Byte Size = 1
+	KiB       = 1024 * Byte
+	MiB       = 1024 * KiB
+	GiB       = 1024 * MiB
+	TiB       = 1024 * GiB
+	PiB       = 1024 * TiB
+)
+
+//Multipliers of the unit suffixes accepted by `ParseSize`, single
+//letters are binary as with the ceph tools.
+var sizeUnits = map[string]Size{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiB,
+	"ki":  KiB,
+	"kib": KiB,
+	"kb":  1000,
+	"m":   MiB,
+	"mi":  MiB,
+	"mib": MiB,
+	"mb":  1000 * 1000,
+	"g":   GiB,
+	"gi":  GiB,
+	"gib": GiB,
+	"gb":  1000 * 1000 * 1000,
+	"t":   TiB,
+	"ti":  TiB,
+	"tib": TiB,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"p":   PiB,
+	"pi":  PiB,
+	"pib": PiB,
+	"pb":  1000 * 1000 * 1000 * 1000 * 1000,
+}
+
+/*
+This method parses a human-readable size such as "25GiB", "1.5T",
+"512 MiB" or "4096": K/M/G/T/P (with or without the i and B suffixes)
+are powers of 1024, KB/MB/GB/TB/PB powers of 1000 and a bare number is
+in bytes. Fractional sizes are rounded up to the byte.
+*/
+func ParseSize(size string) (Size, error) {
+	value := strings.TrimSpace(size)
+	index := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	number, unit := value, ""
+	if index >= 0 {
+		number, unit = value[:index], strings.ToLower(strings.TrimSpace(value[index:]))
+	}
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("Cannot parse size: %q, Error: unknown unit", size)
+	}
+
+	if !strings.Contains(number, ".") {
+		count, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Cannot parse size: %q, Error: %w", size, err)
+		}
+
+		if count > math.MaxUint64/uint64(multiplier) {
+			return 0, fmt.Errorf("Cannot parse size: %q, Error: size is too large", size)
+		}
+		return Size(count) * multiplier, nil
+	}
+
+	count, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot parse size: %q, Error: %w", size, err)
+	}
+
+	bytes := math.Ceil(count * float64(multiplier))
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("Cannot parse size: %q, Error: size is too large", size)
+	}
+	return Size(bytes), nil
+}
+
+/*
+This method is a variant of `ParseSize` panicking on invalid sizes, for
+constant sizes.
+*/
+func MustParseSize(size string) Size {
+	parsed, err := ParseSize(size)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+/*
+Getter method for the size in bytes
+*/
+func (s Size) Bytes() uint64 {
+	return uint64(s)
+}
+
+/*
+This method returns the size in megabytes (MiB) rounded up, as taken by
+the image APIs (see `GetOrCreateImage`).
+*/
+func (s Size) Megabytes() uint64 {
+	return uint64((s + MiB - 1) / MiB)
+}
+
+/*
+This method returns the size with the largest binary unit it reaches,
+e.g. "25 GiB" or "1.5 TiB", with up to two decimals.
+*/
+func (s Size) String() string {
+	units := []struct {
+		size Size
+		name string
+	}{{PiB, "PiB"}, {TiB, "TiB"}, {GiB, "GiB"}, {MiB, "MiB"}, {KiB, "KiB"}}
+
+	for _, unit := range units {
+		if s >= unit.size {
+			value := strconv.FormatFloat(float64(s)/float64(unit.size), 'f', 2, 64)
+			value = strings.TrimRight(strings.TrimRight(value, "0"), ".")
+			return value + " " + unit.name
+		}
+	}
+	return fmt.Sprintf("%d B", uint64(s))
+}
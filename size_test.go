@@ -0,0 +1,85 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    Size
+		wantErr bool
+	}{
+		{"4096", 4096, false},
+		{"25GiB", 25 * GiB, false},
+		{"25G", 25 * GiB, false},
+		{"25gb", 25 * 1000 * 1000 * 1000, false},
+		{"512 MiB", 512 * MiB, false},
+		{" 1Ki ", KiB, false},
+		{"1KB", 1000, false},
+		{"1.5T", TiB + TiB/2, false},
+		{"1.5k", 1536, false},
+		{"0.1b", 1, false},
+		{"2P", 2 * PiB, false},
+		{"", 0, true},
+		{"GiB", 0, true},
+		{"-1G", 0, true},
+		{"12XB", 0, true},
+		{"1.2.3G", 0, true},
+		{"20000000P", 0, true},
+		{"18446744073709551616", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSize(test.size)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", test.size, err, test.wantErr)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", test.size, got, test.want)
+		}
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	tests := []struct {
+		size Size
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{KiB, "1 KiB"},
+		{1536, "1.5 KiB"},
+		{25 * GiB, "25 GiB"},
+		{TiB + TiB/2, "1.5 TiB"},
+		{GiB + GiB/3, "1.33 GiB"},
+		{3 * PiB, "3 PiB"},
+	}
+
+	for _, test := range tests {
+		if got := test.size.String(); got != test.want {
+			t.Errorf("Size(%d).String() = %q, want %q", uint64(test.size), got, test.want)
+		}
+	}
+}
+
+func TestSizeMegabytes(t *testing.T) {
+	tests := []struct {
+		size Size
+		want uint64
+	}{
+		{0, 0},
+		{1, 1},
+		{MiB, 1},
+		{MiB + 1, 2},
+		{25 * GiB, 25 * 1024},
+	}
+
+	for _, test := range tests {
+		if got := test.size.Megabytes(); got != test.want {
+			t.Errorf("Size(%d).Megabytes() = %d, want %d", uint64(test.size), got, test.want)
+		}
+	}
+}
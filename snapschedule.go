@@ -0,0 +1,450 @@
+package blockdevice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	//Name template of the scheduled snapshots.
+	DefaultSnapshotNameTemplate = `scheduled-{{.Time.UTC.Format "20060102-150405"}}`
+	//Time between two checks of the in-process schedules.
+	snapshotScheduleTick = time.Minute
+)
+
+//This type represents where the snapshot schedules of a
+//`SnapshotScheduler` run.
+type ScheduleMode string
+
+const (
+	//The scheduler creates the snapshots itself while it's started.
+	ScheduleInProcess ScheduleMode = "in-process"
+	//The schedules are handed to the rbd_support manager module of the
+	//cluster, which creates the snapshots (rbd mirror snapshot schedule).
+	ScheduleNative ScheduleMode = "native"
+)
+
+//This struct represents the snapshots to create on a schedule.
+type SnapshotSchedule struct {
+	//Identifies the schedule on the scheduler.
+	Name string
+	//Image of the pool of the connection to snapshot, or the label
+	//selector (see `ParseSelector`) the images of the pool must match.
+	Image    string
+	Selector string
+	//When the snapshots are created, see `ParseCronSchedule`.
+	Schedule string
+	//Template (text/template) of the snapshot names, executed with the
+	//Pool, Namespace, Image, Schedule and Time of the snapshot
+	//(DefaultSnapshotNameTemplate if empty). Native schedules ignore it.
+	NameTemplate string
+}
+
+//This struct represents the values a snapshot name template is
+//executed with.
+type snapshotName struct {
+	Pool      string
+	Namespace string
+	Image     string
+	Schedule  string
+	Time      time.Time
+}
+
+//This struct represents a snapshot created, or attempted, by a
+//`SnapshotScheduler`.
+type SnapshotEvent struct {
+	Schedule string
+	Image    ImageRef
+	Snapshot string
+	Time     time.Time
+	Err      error
+}
+
+//This struct represents a schedule added to a `SnapshotScheduler`.
+type scheduledSnapshot struct {
+	schedule SnapshotSchedule
+	cron     *CronSchedule
+	names    *template.Template
+	next     time.Time
+	//Images the native schedule was added to, and its interval.
+	native   []ImageRef
+	interval string
+}
+
+//This struct represents a scheduler creating snapshots of images on
+//cron-like schedules, either itself or through the cluster.
+type SnapshotScheduler struct {
+	connection *Connection
+	mode       ScheduleMode
+	onEvent    func(event SnapshotEvent)
+	mutex      sync.Mutex
+	schedules  map[string]*scheduledSnapshot
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+/*
+This method is a constructor for `SnapshotScheduler` objects, the
+schedules run as set by `mode` (ScheduleInProcess if empty) and
+`onEvent` (which can be nil) is called for every snapshot created in
+process.
+*/
+func NewSnapshotScheduler(connection *Connection, mode ScheduleMode, onEvent func(event SnapshotEvent)) *SnapshotScheduler {
+	if mode == "" {
+		mode = ScheduleInProcess
+	}
+
+	return &SnapshotScheduler{
+		connection: connection,
+		mode:       mode,
+		onEvent:    onEvent,
+		schedules:  make(map[string]*scheduledSnapshot),
+	}
+}
+
+/*
+This is a helper method that returns the interval of a native schedule
+(e.g. "6h"), the rbd_support module only runs regular intervals of
+minutes, hours or days.
+*/
+func nativeInterval(cron *CronSchedule) (string, error) {
+	every := cron.GetInterval()
+	switch {
+	case every == 0:
+		return "", fmt.Errorf("schedule: %s is not a regular interval", cron)
+	case every%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", every/(24*time.Hour)), nil
+	case every%time.Hour == 0:
+		return fmt.Sprintf("%dh", every/time.Hour), nil
+	case every%time.Minute == 0:
+		return fmt.Sprintf("%dm", every/time.Minute), nil
+	}
+	return "", fmt.Errorf("schedule: %s is not a whole number of minutes", cron)
+}
+
+/*
+This method adds a schedule to the scheduler. In ScheduleNative mode it's
+added on the cluster right away to every image it targets (the ones
+matching its selector now), which must be mirrored with snapshots (rbd
+mirror image enable <image> snapshot): the snapshots are mirror
+snapshots, named by the cluster. Only regular intervals (@hourly,
+@daily, @weekly or @every) can run natively.
+*/
+func (s *SnapshotScheduler) Add(schedule SnapshotSchedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("Cannot add snapshot schedule, Error: the schedule has no name")
+	}
+
+	if (schedule.Image == "") == (schedule.Selector == "") {
+		return fmt.Errorf("Cannot add snapshot schedule: %s, Error: exactly one of image and selector must be set", schedule.Name)
+	}
+
+	cron, err := ParseCronSchedule(schedule.Schedule)
+	if err != nil {
+		return err
+	}
+
+	if schedule.NameTemplate == "" {
+		schedule.NameTemplate = DefaultSnapshotNameTemplate
+	}
+
+	names, err := template.New(schedule.Name).Option("missingkey=error").Parse(schedule.NameTemplate)
+	if err != nil {
+		return fmt.Errorf("Cannot parse snapshot name template: %q, Error: %w", schedule.NameTemplate, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.schedules[schedule.Name]; ok {
+		return fmt.Errorf("Cannot add snapshot schedule: %s, Error: already added", schedule.Name)
+	}
+
+	scheduled := &scheduledSnapshot{schedule: schedule, cron: cron, names: names}
+	if s.mode == ScheduleNative {
+		if err := s.addNative(scheduled); err != nil {
+			return fmt.Errorf("Cannot add snapshot schedule: %s, Error: %w", schedule.Name, err)
+		}
+	} else {
+		scheduled.next = cron.Next(time.Now())
+	}
+
+	s.schedules[schedule.Name] = scheduled
+	return nil
+}
+
+/*
+This is a helper method that returns the images a schedule targets.
+*/
+func (s *SnapshotScheduler) images(schedule SnapshotSchedule) ([]ImageRef, error) {
+	c := s.connection
+	if schedule.Image != "" {
+		return []ImageRef{{Pool: c.pool, Namespace: c.GetNamespace(), Name: schedule.Image}}, nil
+	}
+	return c.FindImages(schedule.Selector, c.pool)
+}
+
+/*
+This is a helper method that returns the arguments of the rbd tool
+selecting an image by its pool, namespace and name.
+*/
+func (c *Connection) imageRefArgs(ref ImageRef) []string {
+	args := []string{"--id", c.username, "--pool", ref.Pool}
+	if ref.Namespace != "" {
+		args = append(args, "--namespace", ref.Namespace)
+	}
+	return append(args, "--image", ref.Name)
+}
+
+/*
+This is a helper method that tells if an image is mirrored with
+snapshots, the only images native schedules apply to.
+*/
+func (c *Connection) snapshotMirrored(ref ImageRef) (bool, error) {
+	if c.IsDryRun() {
+		return true, nil
+	}
+
+	spec := namespacedSpec(ref.Pool, ref.Namespace, ref.Name, "")
+	output, err := c.run("rbd", "info", "--id", c.username, "--format", "json", spec)
+	if err != nil {
+		return false, fmt.Errorf("Cannot get info of image: %s, Error: %w", spec, err)
+	}
+
+	var info struct {
+		Mirroring *struct {
+			Mode  string `json:"mode"`
+			State string `json:"state"`
+		} `json:"mirroring"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return false, parseFailure("rbd info", output, err)
+	}
+	return info.Mirroring != nil && info.Mirroring.Mode == "snapshot" && info.Mirroring.State == "enabled", nil
+}
+
+/*
+This is a helper method that adds a schedule on the cluster to every
+image it targets, it's removed again from the ones it was added to on
+failure.
+*/
+func (s *SnapshotScheduler) addNative(scheduled *scheduledSnapshot) error {
+	c := s.connection
+	interval, err := nativeInterval(scheduled.cron)
+	if err != nil {
+		return err
+	}
+
+	refs, err := s.images(scheduled.schedule)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		mirrored, err := c.snapshotMirrored(ref)
+		if err != nil {
+			return err
+		}
+
+		if !mirrored {
+			return fmt.Errorf("image: %s is not mirrored with snapshots", namespacedSpec(ref.Pool, ref.Namespace, ref.Name, ""))
+		}
+	}
+
+	scheduled.interval = interval
+	for _, ref := range refs {
+		args := append([]string{"mirror", "snapshot", "schedule", "add"}, c.imageRefArgs(ref)...)
+		if _, err := c.run("rbd", append(args, interval)...); err != nil {
+			s.removeNative(scheduled)
+			return err
+		}
+		scheduled.native = append(scheduled.native, ref)
+	}
+	return nil
+}
+
+/*
+This is a helper method that removes a schedule from the images it was
+added to on the cluster.
+*/
+func (s *SnapshotScheduler) removeNative(scheduled *scheduledSnapshot) error {
+	c := s.connection
+	for len(scheduled.native) > 0 {
+		ref := scheduled.native[0]
+		args := append([]string{"mirror", "snapshot", "schedule", "remove"}, c.imageRefArgs(ref)...)
+		if _, err := c.run("rbd", append(args, scheduled.interval)...); err != nil {
+			return fmt.Errorf("Cannot remove snapshot schedule of image: %s, Error: %w",
+				namespacedSpec(ref.Pool, ref.Namespace, ref.Name, ""), err)
+		}
+		scheduled.native = scheduled.native[1:]
+	}
+	return nil
+}
+
+/*
+This method removes a schedule from the scheduler, and from the cluster
+for native schedules.
+*/
+func (s *SnapshotScheduler) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scheduled, ok := s.schedules[name]
+	if !ok {
+		return fmt.Errorf("Cannot remove snapshot schedule: %s, Error: not found", name)
+	}
+
+	if err := s.removeNative(scheduled); err != nil {
+		return err
+	}
+	delete(s.schedules, name)
+	return nil
+}
+
+/*
+This method returns the schedules of the scheduler, sorted by name.
+*/
+func (s *SnapshotScheduler) Schedules() []SnapshotSchedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	schedules := make([]SnapshotSchedule, 0, len(s.schedules))
+	for _, scheduled := range s.schedules {
+		schedules = append(schedules, scheduled.schedule)
+	}
+
+	sort.Slice(schedules, func(a, b int) bool {
+		return schedules[a].Name < schedules[b].Name
+	})
+	return schedules
+}
+
+/*
+This is a helper method that creates the snapshot of a schedule on an
+image.
+*/
+func (s *SnapshotScheduler) snapshot(scheduled *scheduledSnapshot, ref ImageRef, now time.Time) SnapshotEvent {
+	event := SnapshotEvent{Schedule: scheduled.schedule.Name, Image: ref, Time: now}
+
+	var name bytes.Buffer
+	data := snapshotName{
+		Pool:      ref.Pool,
+		Namespace: ref.Namespace,
+		Image:     ref.Name,
+		Schedule:  scheduled.schedule.Name,
+		Time:      now,
+	}
+
+	if event.Err = scheduled.names.Execute(&name, data); event.Err != nil {
+		return event
+	}
+	event.Snapshot = name.String()
+
+	connection, err := s.connection.handle(ref.Pool, ref.Namespace)
+	if err != nil {
+		event.Err = err
+		return event
+	}
+
+	image, err := connection.GetImageByName(ref.Name)
+	if err != nil {
+		event.Err = err
+		return event
+	}
+	defer image.Close()
+
+	event.Err = image.SnapshotQuiesced(event.Snapshot)
+	return event
+}
+
+/*
+This method creates the snapshots of the in-process schedules due at
+`now` and returns the events, the selectors are matched again on every
+run.
+*/
+func (s *SnapshotScheduler) RunDue(now time.Time) []SnapshotEvent {
+	s.mutex.Lock()
+	var due []*scheduledSnapshot
+	for _, scheduled := range s.schedules {
+		if s.mode == ScheduleNative || scheduled.next.IsZero() || now.Before(scheduled.next) {
+			continue
+		}
+		scheduled.next = scheduled.cron.Next(now)
+		due = append(due, scheduled)
+	}
+	s.mutex.Unlock()
+
+	sort.Slice(due, func(a, b int) bool {
+		return due[a].schedule.Name < due[b].schedule.Name
+	})
+
+	var events []SnapshotEvent
+	for _, scheduled := range due {
+		refs, err := s.images(scheduled.schedule)
+		if err != nil {
+			events = append(events, SnapshotEvent{Schedule: scheduled.schedule.Name, Time: now, Err: err})
+		}
+
+		for _, ref := range refs {
+			events = append(events, s.snapshot(scheduled, ref, now))
+		}
+	}
+
+	if s.onEvent != nil {
+		for _, event := range events {
+			s.onEvent(event)
+		}
+	}
+	return events
+}
+
+/*
+This method starts creating the snapshots of the in-process schedules on
+background until `Stop` is called.
+*/
+func (s *SnapshotScheduler) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(snapshotScheduleTick)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				s.RunDue(now)
+			}
+		}
+	}(s.stop, s.done)
+}
+
+/*
+This method stops the background snapshots started by `Start`, the
+native schedules keep running on the cluster.
+*/
+func (s *SnapshotScheduler) Stop() {
+	s.mutex.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
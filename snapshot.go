@@ -0,0 +1,234 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strings"
+	"time"
+)
+
+//This struct represents the safety options of a snapshot rollback.
+type RollbackOptions struct {
+	//Unmount and unmap the local devices of the image and blocklist the
+	//remote clients watching it, instead of refusing to roll back.
+	ForceRelease bool
+	//Allow rolling back to a snapshot whose size differs from the
+	//current image size, the image takes the snapshot size.
+	AllowResize bool
+}
+
+/*
+This method opens a writable handle on the image, the `Image` handle
+itself is opened read-only, and runs `fn` with it. The librbd call made
+by `fn` is logged as `call`, in dry-run mode it's recorded on the plan
+instead.
+*/
+func (i *Image) withWritableImage(call string, fn func(image *rbd.Image) error) error {
+	if plan := i.GetDryRun(); plan != nil {
+		plan.add(PlanLibrbd, call, i.spec(i.name, ""))
+		return nil
+	}
+
+	session, context := i.acquireContext()
+	defer session.done()
+
+	start := time.Now()
+	image := rbd.GetImage(context, i.name)
+	if err := image.Open(); err != nil {
+		i.logCall("open", i.name, start, err)
+		return fmt.Errorf("Cannot open image: %s, Error: %w", i.name, err)
+	}
+	defer image.Close()
+
+	start = time.Now()
+	err := fn(image)
+	i.logCall(call, i.name, start, err)
+	return err
+}
+
+/*
+This method refreshes the image information after a change.
+*/
+func (i *Image) refreshInfo() error {
+	if i.IsDryRun() {
+		return nil
+	}
+
+	start := time.Now()
+	stat, err := i.Stat()
+	i.logCall("stat", i.name, start, err)
+	if err != nil {
+		return fmt.Errorf("Cannot state image: %s, Error: %w", i.name, err)
+	}
+
+	i.ImageInfo, i.details = stat, nil
+	return nil
+}
+
+/*
+This method returns the information of the given snapshot.
+*/
+func (i *Image) snapshotInfo(name string) (*rbd.SnapInfo, error) {
+	start := time.Now()
+	snapshots, err := i.GetSnapshotNames()
+	i.logCall("list snapshots", i.name, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list snapshots of image: %s, Error: %w", i.name, err)
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name {
+			return &snapshot, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Snapshot: %s not found on image: %s", name, i.name)
+}
+
+/*
+This method blocklists a client address so it can no longer write to
+the cluster, falling back to the pre-Pacific blacklist command.
+*/
+func (c *Connection) blocklist(address string) error {
+	err := c.monCommand(map[string]interface{}{
+		"prefix":      "osd blocklist",
+		"blocklistop": "add",
+		"addr":        address,
+	}, nil)
+
+	if err != nil {
+		err = c.monCommand(map[string]interface{}{
+			"prefix":      "osd blacklist",
+			"blacklistop": "add",
+			"addr":        address,
+		}, nil)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot blocklist client: %s, Error: %w", address, err)
+	}
+	return nil
+}
+
+/*
+This method releases the local devices of the image, unmounting and
+unmapping them with `ctx`.
+*/
+func (i *Image) releaseLocalDevices(ctx context.Context, devices []MappedDevice) error {
+	runner := bindRunner(i.hostRunner(nil), ctx)
+	for _, device := range devices {
+		for _, mountPoint := range mountPointsOf(runner, device.Device) {
+			if _, err := runner.Run("umount", mountPoint); err != nil {
+				return fmt.Errorf("Cannot unmount: %s, Error: %w", mountPoint, err)
+			}
+		}
+
+		if _, err := runner.Run("rbd", "unmap", device.Device); err != nil {
+			return fmt.Errorf("Cannot unmap device: %s, Error: %w", device.Device, err)
+		}
+	}
+	return nil
+}
+
+/*
+This method rolls the image back to the given snapshot after verifying
+that it's safe: the image must not be mapped on this host nor watched or
+locked by other clients, and the snapshot must have the same size as the
+image. With `options.ForceRelease` local devices are unmounted and
+unmapped, remote clients are blocklisted and their locks broken instead
+of failing.
+*/
+func (i *Image) RollbackToSnapshot(name string, options *RollbackOptions) (err error) {
+	ctx, end := i.observe(context.Background(), OperationRollback)
+	defer end(&err)
+
+	if options == nil {
+		options = &RollbackOptions{}
+	}
+
+	snapshot, err := i.snapshotInfo(name)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	size, err := i.GetSize()
+	i.logCall("get size", i.name, start, err)
+	if err != nil {
+		return fmt.Errorf("Cannot get size of image: %s, Error: %w", i.name, err)
+	}
+
+	if snapshot.Size != size && !options.AllowResize {
+		return fmt.Errorf("Cannot rollback image: %s, Error: snapshot: %s size %d differs from image size %d, set AllowResize",
+			i.name, name, snapshot.Size, size)
+	}
+
+	devices, err := i.findMappedDevices(ctx, i.pool, i.name, "")
+	if err != nil {
+		return fmt.Errorf("Cannot list mapped devices, Error: %s", err)
+	}
+
+	if len(devices) > 0 {
+		if !options.ForceRelease {
+			var paths []string
+			for _, device := range devices {
+				paths = append(paths, device.Device)
+			}
+			return fmt.Errorf("Cannot rollback image: %s, Error: mapped on devices: %s", i.name, strings.Join(paths, ", "))
+		}
+
+		if err := i.releaseLocalDevices(ctx, devices); err != nil {
+			return err
+		}
+	}
+
+	watchers, err := i.watchers(ctx)
+	if err != nil {
+		return err
+	}
+
+	locks, err := i.Locks()
+	if err != nil {
+		return err
+	}
+
+	if len(watchers) > 0 || len(locks) > 0 {
+		if !options.ForceRelease {
+			var holders []string
+			for _, watcher := range watchers {
+				holders = append(holders, watcher.Address)
+			}
+			for _, lock := range locks {
+				holders = append(holders, lock.Client+"@"+lock.Address)
+			}
+			return fmt.Errorf("Cannot rollback image: %s, Error: in use by clients: %s", i.name, strings.Join(holders, ", "))
+		}
+
+		for _, watcher := range watchers {
+			if err := i.blocklist(watcher.Address); err != nil {
+				return err
+			}
+		}
+
+		for _, lock := range locks {
+			if err := i.blocklist(lock.Address); err != nil {
+				return err
+			}
+
+			if err := i.ForceUnlock(lock); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = i.withWritableImage("rollback", func(image *rbd.Image) error {
+		return image.GetSnapshot(name).Rollback()
+	})
+
+	if err != nil {
+		return fmt.Errorf("Cannot rollback image: %s to snapshot: %s, Error: %w", i.name, name, err)
+	}
+
+	return i.refreshInfo()
+}
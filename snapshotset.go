@@ -0,0 +1,145 @@
+package blockdevice
+
+import (
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strings"
+)
+
+//This struct represents the options used to take a `SnapshotSet`.
+type SnapshotSetOptions struct {
+	//Take a single group snapshot of this rbd group (see `CreateGroup`)
+	//instead of a snapshot of each image, the images must belong to it.
+	Group string
+}
+
+/*
+This method creates the rbd group `name` on the pool of the connection
+holding the given images, so they can be snapshotted at once.
+*/
+func (c *Connection) CreateGroup(name string, images ...*Image) error {
+	group := c.spec(name, "")
+	if _, err := c.run("rbd", "group", "create", "--id", c.username, group); err != nil {
+		return fmt.Errorf("Cannot create group: %s, Error: %w", group, err)
+	}
+
+	for _, image := range images {
+		if _, err := c.run("rbd", "group", "image", "add", "--id", c.username, group, image.spec(image.name, "")); err != nil {
+			return fmt.Errorf("Cannot add image: %s to group: %s, Error: %w", image.name, group, err)
+		}
+	}
+	return nil
+}
+
+/*
+This method takes a mutually consistent snapshot `name` of the images
+of the given devices, see `SnapshotSetWithOptions`.
+*/
+func SnapshotSet(devices []*Device, name string) error {
+	return SnapshotSetWithOptions(devices, name, nil)
+}
+
+/*
+This method takes a mutually consistent snapshot `name` of the images
+of the given devices: the quiesce hooks of every image run and every
+filesystem is frozen before any snapshot is taken, and thawed after.
+Without `options.Group` (`options` can be nil) each image is
+snapshotted, and the snapshots already taken are removed if one fails.
+*/
+func SnapshotSetWithOptions(devices []*Device, name string, options *SnapshotSetOptions) error {
+	if options == nil {
+		options = &SnapshotSetOptions{}
+	}
+
+	var images []*Image
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		if device.image == nil {
+			return fmt.Errorf("Cannot snapshot device: %s, Error: no image attached", device.path)
+		}
+
+		if spec := device.image.spec(device.image.name, ""); !seen[spec] {
+			seen[spec] = true
+			images = append(images, device.image)
+		}
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("Cannot take snapshot set: %s, Error: no devices given", name)
+	}
+
+	return quiescedAll(images, func() error {
+		var frozen []*Device
+		thaw := func() []string {
+			var failed []string
+			for _, device := range frozen {
+				if err := device.Thaw(); err != nil {
+					failed = append(failed, err.Error())
+				}
+			}
+			return failed
+		}
+
+		for _, device := range devices {
+			if !device.isMounted || device.frozen {
+				continue
+			}
+
+			if err := device.Freeze(); err != nil {
+				failed := append([]string{err.Error()}, thaw()...)
+				return fmt.Errorf("Cannot take snapshot set: %s, Error: %s", name, strings.Join(failed, "; "))
+			}
+			frozen = append(frozen, device)
+		}
+
+		var err error
+		if options.Group != "" {
+			group := images[0].spec(options.Group, name)
+			if _, err = images[0].run("rbd", "group", "snap", "create", "--id", images[0].username, group); err != nil {
+				err = fmt.Errorf("Cannot create group snapshot: %s, Error: %w", group, err)
+			}
+		} else {
+			err = snapshotImages(images, name)
+		}
+
+		if failed := thaw(); len(failed) > 0 {
+			if err != nil {
+				failed = append([]string{err.Error()}, failed...)
+			}
+			return fmt.Errorf("Cannot take snapshot set: %s, Error: %s", name, strings.Join(failed, "; "))
+		}
+		return err
+	})
+}
+
+/*
+This is a helper method that snapshots every image, removing the
+snapshots already taken if one fails.
+*/
+func snapshotImages(images []*Image, name string) error {
+	for index, image := range images {
+		if err := image.createSnapshot(name); err != nil {
+			for _, taken := range images[:index] {
+				taken.withWritableImage("remove snapshot", func(image *rbd.Image) error {
+					return image.GetSnapshot(name).Remove()
+				})
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+This is a helper method that runs `fn` with the applications of every
+image quiesced.
+*/
+func quiescedAll(images []*Image, fn func() error) error {
+	if len(images) == 0 {
+		return fn()
+	}
+
+	return images[0].quiesced(func() error {
+		return quiescedAll(images[1:], fn)
+	})
+}
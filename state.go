@@ -0,0 +1,178 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	DefaultStateFile = "/var/lib/go-ceph-blockdevice/state.json"
+)
+
+//This struct represents a volume managed by the library on a host, as
+//recorded in the state file: how it's mapped and mounted. Nothing is
+//restored from it, it tells the managed volumes apart.
+type ManagedVolume struct {
+	Pool           string            `json:"pool"`
+	Namespace      string            `json:"namespace,omitempty"`
+	Image          string            `json:"image"`
+	Snapshot       string            `json:"snapshot,omitempty"`
+	User           string            `json:"user,omitempty"`
+	Keyring        string            `json:"keyring,omitempty"`
+	ReadOnly       bool              `json:"read_only,omitempty"`
+	MapOptions     map[string]string `json:"map_options,omitempty"`
+	Partition      int               `json:"partition,omitempty"`
+	FileSystemType string            `json:"fs_type,omitempty"`
+	MountPoint     string            `json:"mount_point,omitempty"`
+	MountOptions   []string          `json:"mount_options,omitempty"`
+	//Where the volume comes from: "library", "rbdmap" or "fstab".
+	Source string `json:"source,omitempty"`
+}
+
+/*
+This method returns the spec of the mapped image.
+*/
+func (v *ManagedVolume) Spec() string {
+	return namespacedSpec(v.Pool, v.Namespace, v.Image, v.Snapshot)
+}
+
+//This struct represents the persistent state of the volumes managed by
+//the library on a host.
+type State struct {
+	path    string
+	mutex   sync.Mutex
+	Volumes []ManagedVolume `json:"volumes"`
+}
+
+/*
+This method loads the state from `path` (DefaultStateFile if empty), a
+missing file is an empty state.
+*/
+func LoadState(path string) (*State, error) {
+	if path == "" {
+		path = DefaultStateFile
+	}
+
+	state := &State{path: path}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read state file: %s, Error: %w", path, err)
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("Cannot parse state file: %s, Error: %w", path, err)
+	}
+	return state, nil
+}
+
+/*
+This method writes the state to its file, atomically.
+*/
+func (s *State) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("Cannot create state directory for: %s, Error: %w", s.path, err)
+	}
+
+	return writeFileAtomic(s.path, content, 0600)
+}
+
+/*
+This method adds a volume to the state, replacing the one of the same
+image spec if any.
+*/
+func (s *State) Add(volume ManagedVolume) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for index := range s.Volumes {
+		if s.Volumes[index].Spec() == volume.Spec() {
+			s.Volumes[index] = volume
+			return
+		}
+	}
+	s.Volumes = append(s.Volumes, volume)
+}
+
+/*
+This method removes the volume of the given image spec from the state,
+it tells if it was found.
+*/
+func (s *State) Remove(pool, namespace, image, snapshot string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	spec := namespacedSpec(pool, namespace, image, snapshot)
+	for index := range s.Volumes {
+		if s.Volumes[index].Spec() == spec {
+			s.Volumes = append(s.Volumes[:index], s.Volumes[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+/*
+This method returns the volume of the given image spec, or nil.
+*/
+func (s *State) Find(pool, namespace, image, snapshot string) *ManagedVolume {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	spec := namespacedSpec(pool, namespace, image, snapshot)
+	for index := range s.Volumes {
+		if s.Volumes[index].Spec() == spec {
+			volume := s.Volumes[index]
+			return &volume
+		}
+	}
+	return nil
+}
+
+/*
+This is a helper method that replaces the content of a file through a
+temporary file, so readers never see a partial write.
+*/
+func writeFileAtomic(path string, content []byte, mode os.FileMode) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return fmt.Errorf("Cannot write file: %s, Error: %w", path, err)
+	}
+	defer os.Remove(temporary.Name())
+
+	if _, err = temporary.Write(content); err == nil {
+		err = temporary.Sync()
+	}
+
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(temporary.Name(), mode)
+	}
+
+	if err == nil {
+		err = os.Rename(temporary.Name(), path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Cannot write file: %s, Error: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+func TestStateNamespace(t *testing.T) {
+	state := &State{}
+	state.Add(ManagedVolume{Pool: "rbd", Image: "data", MountPoint: "/mnt/data"})
+	state.Add(ManagedVolume{Pool: "rbd", Namespace: "ns", Image: "data", MountPoint: "/mnt/ns"})
+
+	if volume := state.Find("rbd", "ns", "data", ""); volume == nil || volume.MountPoint != "/mnt/ns" {
+		t.Fatalf("Find() of the namespaced image = %+v", volume)
+	}
+
+	if !state.Remove("rbd", "ns", "data", "") || state.Find("rbd", "ns", "data", "") != nil {
+		t.Fatalf("the namespaced image isn't removed")
+	}
+
+	if volume := state.Find("rbd", "", "data", ""); volume == nil || volume.MountPoint != "/mnt/data" {
+		t.Errorf("Find() of the default namespace image = %+v", volume)
+	}
+}
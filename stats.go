@@ -0,0 +1,146 @@
+package blockdevice
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultStatsInterval = time.Second
+	//Size of the sectors reported by the block layer.
+	statSectorSize = 512
+)
+
+//This struct represents the I/O statistics of a device sampled over an
+//interval.
+type DeviceStats struct {
+	Interval time.Duration
+	//Completed operations per second.
+	ReadIOPS  float64
+	WriteIOPS float64
+	//Bytes per second.
+	ReadThroughput  float64
+	WriteThroughput float64
+	//Average number of requests in the queue over the interval, and
+	//requests in flight at the end of it.
+	QueueDepth float64
+	InFlight   uint64
+	//Average time spent by each completed operation.
+	ReadLatency  time.Duration
+	WriteLatency time.Duration
+	//Fraction of the interval the device was busy.
+	Utilization float64
+}
+
+//This struct represents the counters of a /sys/block/<dev>/stat file.
+type blockStat struct {
+	readIOs      uint64
+	readSectors  uint64
+	readTicks    uint64
+	writeIOs     uint64
+	writeSectors uint64
+	writeTicks   uint64
+	inFlight     uint64
+	ioTicks      uint64
+	queueTicks   uint64
+}
+
+/*
+This is a helper method that reads the block layer counters of the
+device from sysfs, following device-mapper symlinks.
+*/
+func (d *Device) blockStat() (*blockStat, error) {
+	path, err := d.run("readlink", "-f", d.path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot resolve device: %s, Error: %w", d.path, err)
+	}
+
+	lines, err := readHostFile(d.runner, "/sys/class/block/"+filepath.Base(strings.TrimSpace(path))+"/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("Cannot get statistics of device: %s, Error: no block statistics found", d.path)
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) < 11 {
+		return nil, parseFailure("stat", lines[0], fmt.Errorf("expected at least 11 fields, found: %d", len(fields)))
+	}
+
+	var values [11]uint64
+	for index := range values {
+		if values[index], err = strconv.ParseUint(fields[index], 10, 64); err != nil {
+			return nil, parseFailure("stat", lines[0], err)
+		}
+	}
+
+	return &blockStat{
+		readIOs:      values[0],
+		readSectors:  values[2],
+		readTicks:    values[3],
+		writeIOs:     values[4],
+		writeSectors: values[6],
+		writeTicks:   values[7],
+		inFlight:     values[8],
+		ioTicks:      values[9],
+		queueTicks:   values[10],
+	}, nil
+}
+
+/*
+This method samples the I/O statistics of the device over `interval`
+(DefaultStatsInterval if zero), blocking meanwhile.
+*/
+func (d *Device) Stats(interval time.Duration) (*DeviceStats, error) {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+
+	before, err := d.blockStat()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	time.Sleep(interval)
+
+	after, err := d.blockStat()
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := time.Since(start)
+	seconds := elapsed.Seconds()
+	milliseconds := float64(elapsed) / float64(time.Millisecond)
+
+	reads := after.readIOs - before.readIOs
+	writes := after.writeIOs - before.writeIOs
+	stats := &DeviceStats{
+		Interval:        elapsed,
+		ReadIOPS:        float64(reads) / seconds,
+		WriteIOPS:       float64(writes) / seconds,
+		ReadThroughput:  float64((after.readSectors-before.readSectors)*statSectorSize) / seconds,
+		WriteThroughput: float64((after.writeSectors-before.writeSectors)*statSectorSize) / seconds,
+		QueueDepth:      float64(after.queueTicks-before.queueTicks) / milliseconds,
+		InFlight:        after.inFlight,
+		Utilization:     float64(after.ioTicks-before.ioTicks) / milliseconds,
+	}
+
+	if reads > 0 {
+		stats.ReadLatency = time.Duration(after.readTicks-before.readTicks) * time.Millisecond / time.Duration(reads)
+	}
+
+	if writes > 0 {
+		stats.WriteLatency = time.Duration(after.writeTicks-before.writeTicks) * time.Millisecond / time.Duration(writes)
+	}
+
+	if stats.Utilization > 1 {
+		stats.Utilization = 1
+	}
+	return stats, nil
+}
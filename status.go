@@ -0,0 +1,122 @@
+package blockdevice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//This struct represents a client watching an image header, as reported
+//by `rbd status`. Ceph doesn't report since when the watch exists.
+type Watcher struct {
+	Address string `json:"address"`
+	Client  uint64 `json:"client"`
+	Cookie  uint64 `json:"cookie"`
+}
+
+//This struct represents an advisory lock held on an image.
+type Lock struct {
+	//Lock holder, e.g. client.4123.
+	Client  string
+	Cookie  string
+	Address string
+	//Tag of shared locks, empty for exclusive ones.
+	Tag string
+}
+
+/*
+This method returns the clients watching the image.
+*/
+func (i *Image) Watchers() ([]Watcher, error) {
+	return i.watchers(context.Background())
+}
+
+/*
+This is a helper method that returns the clients watching the image
+like `Watchers`, the rbd tool is run with `ctx`.
+*/
+func (i *Image) watchers(ctx context.Context) ([]Watcher, error) {
+	output, err := i.runCtx(ctx, "rbd", "status", "--id", i.username, "--format", "json", i.spec(i.name, ""))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get status of image: %s, Error: %w", i.name, err)
+	}
+
+	var status struct {
+		Watchers []Watcher `json:"watchers"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &status); err != nil {
+		return nil, parseFailure("rbd status", output, err)
+	}
+
+	return status.Watchers, nil
+}
+
+/*
+This method returns the locks held on the image.
+*/
+func (i *Image) Locks() ([]Lock, error) {
+	start := time.Now()
+	tag, lockers, err := i.ListLockers()
+	i.logCall("list lockers", i.name, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list locks of image: %s, Error: %w", i.name, err)
+	}
+
+	var locks []Lock
+	for _, locker := range lockers {
+		locks = append(locks, Lock{
+			Client:  locker.Client,
+			Cookie:  locker.Cookie,
+			Address: locker.Addr,
+			Tag:     tag,
+		})
+	}
+	return locks, nil
+}
+
+/*
+This method breaks a lock held on the image, the holder should be
+blocklisted first so it can't keep writing.
+*/
+func (i *Image) ForceUnlock(lock Lock) error {
+	start := time.Now()
+	err := i.Image.BreakLock(lock.Client, lock.Cookie)
+	i.logCall("break lock", i.name, start, err)
+	if err != nil {
+		return fmt.Errorf("Cannot break lock: %s of image: %s, Error: %w", lock.Cookie, i.name, err)
+	}
+	return nil
+}
+
+/*
+This method returns the provisioned and used bytes of the image head,
+as reported by `rbd du`, which is fast with the fast-diff feature.
+*/
+func (i *Image) Usage() (Size, Size, error) {
+	output, err := i.run("rbd", "du", "--id", i.username, "--format", "json", i.spec(i.name, ""))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Cannot get usage of image: %s, Error: %w", i.name, err)
+	}
+
+	var usage struct {
+		Images []struct {
+			Name            string `json:"name"`
+			Snapshot        string `json:"snapshot"`
+			ProvisionedSize uint64 `json:"provisioned_size"`
+			UsedSize        uint64 `json:"used_size"`
+		} `json:"images"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &usage); err != nil {
+		return 0, 0, parseFailure("rbd du", output, err)
+	}
+
+	for _, image := range usage.Images {
+		if image.Name == i.name && image.Snapshot == "" {
+			return Size(image.ProvisionedSize), Size(image.UsedSize), nil
+		}
+	}
+	return 0, 0, parseFailure("rbd du", output, fmt.Errorf("image: %s not reported", i.name))
+}
@@ -0,0 +1,89 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//Priority that leaves the swap priority to the kernel.
+const DefaultSwapPriority = -1
+
+/*
+This method maps the image and enables it as a swap area with the given
+`priority` (0-32767, higher is used first, DefaultSwapPriority leaves it
+to the kernel). The swap signature is created if the image is empty, an
+existing filesystem is handled as set by `options.OnExistingFS`.
+
+The swap area is disabled by `UnMap`.
+*/
+func (i *Image) MapAsSwap(priority int, options *MapOptions) (*Device, error) {
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	if options.ReadOnly || options.Snapshot != "" || options.Overlay != nil {
+		return nil, fmt.Errorf("Cannot map image: %s as swap, Error: swap requires a writable mapping", i.name)
+	}
+
+	device, err := mapDevice(i, "swap", options)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create new device for image: %s, Error: %w", i.name, err)
+	}
+
+	if err = device.prepareFileSystem(options.OnExistingFS); err == nil {
+		err = device.SwapOn(priority)
+	}
+
+	if err != nil {
+		device.UnMap()
+		return nil, err
+	}
+
+	i.track(device)
+	return device, nil
+}
+
+/*
+This method enables the device as a swap area with the given `priority`
+(DefaultSwapPriority leaves it to the kernel).
+*/
+func (d *Device) SwapOn(priority int) error {
+	if d.fileSystemType != "swap" {
+		return fmt.Errorf("Cannot enable swap on device: %s, Error: device holds a %s filesystem", d.path, d.fileSystemType)
+	}
+
+	var args []string
+	if priority >= 0 {
+		args = append(args, "--priority", strconv.Itoa(priority))
+	}
+
+	if _, err := d.run("swapon", append(args, d.path)...); err != nil {
+		return fmt.Errorf("Cannot enable swap on device: %s, Error: %w", d.path, err)
+	}
+
+	d.swap = true
+	return nil
+}
+
+/*
+This method disables the swap area of the device.
+*/
+func (d *Device) SwapOff() error {
+	if !d.swap {
+		return nil
+	}
+
+	if _, err := d.run("swapoff", d.path); err != nil {
+		return fmt.Errorf("Cannot disable swap on device: %s, Error: %w", d.path, err)
+	}
+
+	d.swap = false
+	return nil
+}
+
+/*
+Getter method for swap
+*/
+func (d *Device) IsSwap() bool {
+	return d.swap
+}
@@ -0,0 +1,238 @@
+package blockdevice
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMonPort = "6789"
+	sysfsRbdPath   = "/sys/bus/rbd"
+)
+
+/*
+This is a helper method that returns the sysfs control file to write to,
+preferring the single major variant if the kernel supports it.
+*/
+func sysfsControlFile(name string) string {
+	single := filepath.Join(sysfsRbdPath, name+"_single_major")
+	if _, err := os.Stat(single); err == nil {
+		return single
+	}
+	return filepath.Join(sysfsRbdPath, name)
+}
+
+/*
+This is a helper method that returns the ids of the rbd devices
+currently registered on sysfs.
+*/
+func sysfsDeviceIds() (map[string]bool, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(sysfsRbdPath, "devices"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, entry := range entries {
+		ids[entry.Name()] = true
+	}
+	return ids, nil
+}
+
+/*
+This is a helper method that reads a sysfs attribute of a rbd device.
+*/
+func sysfsAttribute(id string, name string) string {
+	value, _ := ioutil.ReadFile(filepath.Join(sysfsRbdPath, "devices", id, name))
+	return strings.TrimSpace(string(value))
+}
+
+/*
+This method translates the `mon_host` configuration option into the
+comma separated list of v1 addresses expected by the kernel client.
+*/
+func (c *Connection) monAddresses() (string, error) {
+	value, err := c.rados().GetConfigOption("mon_host")
+	if err != nil || value == "" {
+		return "", fmt.Errorf("Cannot get the monitor addresses, Error: %v", err)
+	}
+
+	var addresses []string
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '[' || r == ']'
+	}) {
+		if strings.HasPrefix(field, "v2:") {
+			continue
+		}
+
+		field = strings.TrimPrefix(field, "v1:")
+		if index := strings.LastIndex(field, "/"); index > 0 {
+			field = field[:index]
+		}
+
+		if !strings.Contains(field, ":") {
+			field = field + ":" + DefaultMonPort
+		}
+		addresses = append(addresses, field)
+	}
+
+	if len(addresses) == 0 {
+		return "", fmt.Errorf("Cannot find a v1 monitor address in: %s", value)
+	}
+
+	return strings.Join(addresses, ","), nil
+}
+
+/*
+This method returns the connection user name without the `client.`
+prefix, as expected by the kernel client.
+*/
+func (c *Connection) clientName() string {
+	if c.username == "" {
+		return "admin"
+	}
+	return strings.TrimPrefix(c.username, "client.")
+}
+
+/*
+This method returns the cephx secret of the connection user, looking
+at the `key`, `keyfile` and `keyring` configuration options in order.
+*/
+func (c *Connection) secret() (string, error) {
+	if key, _ := c.rados().GetConfigOption("key"); key != "" {
+		return key, nil
+	}
+
+	if keyfile, _ := c.rados().GetConfigOption("keyfile"); keyfile != "" {
+		key, err := ioutil.ReadFile(keyfile)
+		if err != nil {
+			return "", fmt.Errorf("Cannot read keyfile: %s, Error: %w", keyfile, err)
+		}
+		return strings.TrimSpace(string(key)), nil
+	}
+
+	keyrings, _ := c.rados().GetConfigOption("keyring")
+	for _, keyring := range strings.Split(keyrings, ",") {
+		if key, err := readKeyring(strings.TrimSpace(keyring), "client."+c.clientName()); err == nil {
+			return key, nil
+		}
+	}
+
+	return "", fmt.Errorf("Cannot find the key for client.%s on keyrings: %s", c.clientName(), keyrings)
+}
+
+/*
+This is a helper method that extracts the key of `entity` from
+a keyring file.
+*/
+func readKeyring(path string, entity string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		if section != entity {
+			continue
+		}
+
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 && strings.TrimSpace(parts[0]) == "key" {
+			return strings.TrimSpace(parts[1]), nil
+		}
+	}
+
+	return "", fmt.Errorf("Key for: %s not found on keyring: %s", entity, path)
+}
+
+/*
+This method maps the image writing directly to the sysfs rbd bus,
+without requiring the `rbd` binary. It returns the device path.
+*/
+func mapSysfs(image *Image, options *MapOptions) (string, error) {
+	monitors, err := image.monAddresses()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := image.secret()
+	if err != nil {
+		return "", err
+	}
+
+	krbdOptions := append([]string{"name=" + image.clientName(), "secret=" + secret}, options.krbdOptions()...)
+	if options.ReadOnly {
+		krbdOptions = append(krbdOptions, "ro")
+	}
+
+	namespace := image.GetNamespace()
+	if namespace != "" {
+		krbdOptions = append(krbdOptions, "_pool_ns="+namespace)
+	}
+
+	snapshot := "-"
+	if options.Snapshot != "" {
+		snapshot = options.Snapshot
+	}
+
+	before, err := sysfsDeviceIds()
+	if err != nil {
+		return "", fmt.Errorf("Cannot list rbd devices on sysfs, Error: %s", err)
+	}
+
+	request := fmt.Sprintf("%s %s %s %s %s", monitors, strings.Join(krbdOptions, ","), image.pool, image.name, snapshot)
+	if err := ioutil.WriteFile(sysfsControlFile("add"), []byte(request), 0200); err != nil {
+		return "", fmt.Errorf("Cannot map image: %s using sysfs, Error: %w", image.name, err)
+	}
+
+	after, err := sysfsDeviceIds()
+	if err != nil {
+		return "", fmt.Errorf("Cannot list rbd devices on sysfs, Error: %s", err)
+	}
+
+	for id := range after {
+		if before[id] {
+			continue
+		}
+
+		if sysfsAttribute(id, "pool") == image.pool && sysfsAttribute(id, "pool_ns") == namespace &&
+			sysfsAttribute(id, "name") == image.name {
+			return "/dev/rbd" + id, nil
+		}
+	}
+
+	return "", fmt.Errorf("Cannot find the sysfs device for image: %s", image.name)
+}
+
+/*
+This method unmaps the given device path writing its id to the sysfs
+rbd bus, `force` unmaps the device even if it's still open.
+*/
+func unmapSysfs(path string, force bool) error {
+	id := strings.TrimPrefix(path, "/dev/rbd")
+	if _, err := strconv.Atoi(id); err != nil {
+		return fmt.Errorf("Cannot unmap device: %s, Error: not a rbd device", path)
+	}
+
+	if force {
+		id = id + " force"
+	}
+
+	if err := ioutil.WriteFile(sysfsControlFile("remove"), []byte(id), 0200); err != nil {
+		return fmt.Errorf("Cannot unmap device: %s using sysfs, Error: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package blockdevice
+
+import (
+	"context"
+	"fmt"
+	"github.com/ceph/go-ceph/rbd"
+	"strconv"
+	"time"
+)
+
+//This struct represents the options of a `Template`.
+type TemplateOptions struct {
+	//Feature bits of the clones (FeatureLayering | ...), layering is
+	//always set.
+	Features uint64
+	//Give the filesystem of every clone a new UUID, the clone is mapped
+	//on the local host (or `MapOptions.Runner`) to do so and its
+	//filesystem is detected.
+	RegenerateUUID bool
+	//Options used to map the clones to regenerate their UUID, can be
+	//nil.
+	MapOptions *MapOptions
+}
+
+//This struct represents a golden image and the protected snapshot its
+//clones are provisioned from, e.g. for VM or container root disks.
+type Template struct {
+	image    *Image
+	snapshot string
+	options  TemplateOptions
+}
+
+/*
+This method registers the image `name` of the connection as a template
+cloned from its snapshot `snapshot`, which is created if missing and
+protected. `options` can be nil.
+*/
+func (c *Connection) RegisterTemplate(name string, snapshot string, options *TemplateOptions) (*Template, error) {
+	template := &Template{snapshot: snapshot}
+	if options != nil {
+		template.options = *options
+	}
+
+	image, err := c.GetImageByName(name)
+	if err != nil {
+		return nil, err
+	}
+	template.image = image
+
+	if _, err := image.snapshotInfo(snapshot); err != nil {
+		if err := image.SnapshotQuiesced(snapshot); err != nil {
+			image.Close()
+			return nil, err
+		}
+	}
+
+	err = image.withWritableImage("protect snapshot", func(image *rbd.Image) error {
+		snap := image.GetSnapshot(snapshot)
+		if protected, err := snap.IsProtected(); err != nil || protected {
+			return err
+		}
+		return snap.Protect()
+	})
+
+	if err != nil {
+		image.Close()
+		return nil, fmt.Errorf("Cannot protect snapshot: %s of image: %s, Error: %w", snapshot, name, err)
+	}
+	return template, nil
+}
+
+/*
+Getter method for image
+*/
+func (t *Template) GetImage() *Image {
+	return t.image
+}
+
+/*
+Getter method for snapshot
+*/
+func (t *Template) GetSnapshot() string {
+	return t.snapshot
+}
+
+/*
+This method provisions the image `name` as a clone of the template, on
+the pool of the template image, grown to `size` megabytes if the golden
+image is smaller (zero keeps its size). With
+`TemplateOptions.RegenerateUUID` the filesystem of the clone gets a new
+UUID. The image is returned unmapped, ready to be mapped, the clone is
+removed if it can't be grown or get a new UUID.
+*/
+func (t *Template) Provision(name string, size uint64) (image *Image, err error) {
+	c := t.image.Connection
+	ctx, end := c.observe(context.Background(), OperationCreate, name)
+	defer end(&err)
+
+	parentSize := t.image.ImageInfo.Size / toMegs(1)
+	if size < parentSize {
+		size = parentSize
+	}
+
+	if err := c.checkCreatePolicy(size); err != nil {
+		return nil, err
+	}
+
+	features := t.options.Features | FeatureLayering
+	if plan := c.GetDryRun(); plan != nil {
+		plan.add(PlanLibrbd, "clone", t.image.spec(t.image.name, t.snapshot), c.spec(name, ""),
+			"--features", strconv.FormatUint(features, 10))
+		return c.plannedImage(name, size), nil
+	}
+
+	start := time.Now()
+	//order 0 keeps the object size of the golden image
+	clone, err := t.image.Image.Clone(t.snapshot, c.ioContext(), name, features, 0)
+	c.logCall("clone", name, start, err)
+	if err != nil && isExistsError(err) {
+		return nil, kindErrorf(ErrImageExists, err, "Cannot clone image: %s from: %s, Error: %s", name, t.image.spec(t.image.name, t.snapshot), err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot clone image: %s from: %s, Error: %w", name, t.image.spec(t.image.name, t.snapshot), err)
+	}
+
+	image, err = NewImage(clone, c, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := image.grow(ctx, size); err != nil {
+		return nil, discardClone(ctx, image, err)
+	}
+
+	if t.options.RegenerateUUID {
+		if err := t.regenerateUUID(ctx, image); err != nil {
+			return nil, discardClone(ctx, image, err)
+		}
+	}
+	return image, nil
+}
+
+/*
+This is a helper method that closes and removes, with `ctx`, a clone
+that failed to be provisioned with `err`, a removal failure is reported
+along with it.
+*/
+func discardClone(ctx context.Context, image *Image, err error) error {
+	image.Close()
+	if removeErr := image.remove(ctx, nil); removeErr != nil {
+		return fmt.Errorf("%w, Rollback error: %s", err, removeErr)
+	}
+	return err
+}
+
+/*
+This is a helper method that maps the clone to give its filesystem, as
+found by blkid, a new UUID, and unmaps it, the commands are run with
+`ctx`.
+*/
+func (t *Template) regenerateUUID(ctx context.Context, image *Image) error {
+	options := &MapOptions{}
+	if t.options.MapOptions != nil {
+		mapOptions := *t.options.MapOptions
+		options = &mapOptions
+	}
+	options.ReadOnly, options.Snapshot = false, ""
+
+	runner := options.Runner
+	if runner == nil {
+		runner = image.GetRunner()
+	}
+	options.Runner = bindRunner(runner, ctx)
+
+	device, err := mapDevice(image, "", options)
+	if err != nil {
+		return err
+	}
+
+	fsType, err := device.GetFileSystemType()
+	if err == nil && fsType == "" {
+		err = fmt.Errorf("Cannot regenerate UUID of image: %s, Error: no filesystem found", image.name)
+	}
+
+	if err != nil {
+		return device.rollback(err)
+	}
+	device.fileSystemType = fsType
+
+	if err := device.RegenerateUUID(); err != nil {
+		return device.rollback(err)
+	}
+	return device.UnMap()
+}
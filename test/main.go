@@ -6,7 +6,8 @@ import (
 )
 
 func main() {
-	connection, err := blockdevice.NewConnection("lxd", "lxd", "", "./ceph.conf")
+	connection, err := blockdevice.NewConnection(blockdevice.WithUser("lxd"), blockdevice.WithPool("lxd"),
+		blockdevice.WithConfigFile("./ceph.conf"))
 	if err != nil {
 		fmt.Println("Error connecting", err)
 	}
@@ -20,7 +21,7 @@ func main() {
 		fmt.Printf("Image: %s has been already mapped to device:%s", image, device)
 	} else {
 
-		device, err := image.MapToDevice("ext4", "/mnt/foo")
+		device, err := image.MapToDevice("ext4", "/mnt/foo", nil)
 		if err != nil {
 			fmt.Printf("Error mapping device, Error: %s\n", err)
 		} else {
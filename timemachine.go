@@ -0,0 +1,253 @@
+package blockdevice
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeMachineMaxMounted = 8
+)
+
+//This struct represents a version of a file as found on a snapshot.
+type FileVersion struct {
+	Snapshot string
+	Path     string
+	Size     int64
+	ModTime  time.Time
+}
+
+//This struct represents a read-only browser over the snapshot history
+//of an image, snapshots are mapped and mounted on demand and cached.
+type TimeMachine struct {
+	image      *Image
+	fsType     string
+	mountPoint string
+	baseDir    string
+	maxMounted int
+	mutex      sync.Mutex
+	devices    map[string]*Device
+	recent     []string
+}
+
+/*
+This method is a constructor for `TimeMachine` objects, given a
+mounted `Device` snapshots of its image are mounted under `baseDir`.
+At most `maxMounted` snapshots are kept mounted at the same time
+(DefaultTimeMachineMaxMounted if zero), least recently used ones are
+unmapped first.
+*/
+func (d *Device) NewTimeMachine(baseDir string, maxMounted int) (*TimeMachine, error) {
+	if d.image == nil {
+		return nil, fmt.Errorf("Cannot browse snapshots of device: %s, Error: no image attached", d.path)
+	}
+
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("Cannot create directory: %s, Error: %w", baseDir, err)
+	}
+
+	if maxMounted <= 0 {
+		maxMounted = DefaultTimeMachineMaxMounted
+	}
+
+	return &TimeMachine{
+		image:      d.image,
+		fsType:     d.fileSystemType,
+		mountPoint: d.mountPoint,
+		baseDir:    baseDir,
+		maxMounted: maxMounted,
+		devices:    make(map[string]*Device),
+	}, nil
+}
+
+/*
+This method returns the path of `path` relative to the root of the
+volume, `path` can be absolute (inside the volume mountpoint) or
+already relative to the volume root.
+*/
+func (t *TimeMachine) relativePath(path string) (string, error) {
+	if filepath.IsAbs(path) && t.mountPoint != "" {
+		rel, err := filepath.Rel(t.mountPoint, path)
+		if err != nil {
+			return "", err
+		}
+		path = rel
+	}
+
+	path = filepath.Clean(strings.TrimPrefix(path, "/"))
+	if path == ".." || strings.HasPrefix(path, "../") {
+		return "", fmt.Errorf("Path: %s is outside of the volume mounted on: %s", path, t.mountPoint)
+	}
+
+	return path, nil
+}
+
+/*
+This method returns the mounted device for the given snapshot, mapping
+and mounting it if needed.
+*/
+func (t *TimeMachine) mount(snapshot string) (*Device, error) {
+	t.touch(snapshot)
+	if device, ok := t.devices[snapshot]; ok {
+		return device, nil
+	}
+
+	for len(t.devices) >= t.maxMounted {
+		if err := t.release(t.recent[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	mountPoint := filepath.Join(t.baseDir, snapshot)
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return nil, fmt.Errorf("Cannot create directory: %s, Error: %w", mountPoint, err)
+	}
+
+	device, err := NewDevice(t.image, t.fsType, mountPoint, &MapOptions{Snapshot: snapshot})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot mount snapshot: %s, Error: %w", snapshot, err)
+	}
+
+	t.devices[snapshot] = device
+	return device, nil
+}
+
+/*
+This method marks the snapshot as the most recently used one.
+*/
+func (t *TimeMachine) touch(snapshot string) {
+	for index, name := range t.recent {
+		if name == snapshot {
+			t.recent = append(t.recent[:index], t.recent[index+1:]...)
+			break
+		}
+	}
+	t.recent = append(t.recent, snapshot)
+}
+
+/*
+This method unmaps the given snapshot and removes its mountpoint.
+*/
+func (t *TimeMachine) release(snapshot string) error {
+	for index, name := range t.recent {
+		if name == snapshot {
+			t.recent = append(t.recent[:index], t.recent[index+1:]...)
+			break
+		}
+	}
+
+	device, ok := t.devices[snapshot]
+	if !ok {
+		return nil
+	}
+
+	if err := device.UnMap(); err != nil {
+		return fmt.Errorf("Cannot release snapshot: %s, Error: %w", snapshot, err)
+	}
+
+	delete(t.devices, snapshot)
+	os.Remove(filepath.Join(t.baseDir, snapshot))
+	return nil
+}
+
+/*
+This method lists the versions of the file at `path` across the image
+snapshots, from the oldest to the newest. Consecutive snapshots holding
+the same version (same size and modification time) are reported once.
+*/
+func (t *TimeMachine) ListVersions(path string) ([]FileVersion, error) {
+	rel, err := t.relativePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	snapshots, err := t.image.GetSnapshotNames()
+	t.image.logCall("list snapshots", t.image.name, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list snapshots of image: %s, Error: %w", t.image.name, err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var versions []FileVersion
+	for _, snapshot := range snapshots {
+		device, err := t.mount(snapshot.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(filepath.Join(device.mountPoint, rel))
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		if last := len(versions) - 1; last >= 0 &&
+			versions[last].Size == info.Size() && versions[last].ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		versions = append(versions, FileVersion{
+			Snapshot: snapshot.Name,
+			Path:     rel,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+		})
+	}
+
+	return versions, nil
+}
+
+/*
+This method copies the contents of the given file version into `w`,
+it returns the number of bytes copied.
+*/
+func (t *TimeMachine) Retrieve(version FileVersion, w io.Writer) (int64, error) {
+	rel, err := t.relativePath(version.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	device, err := t.mount(version.Snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(filepath.Join(device.mountPoint, rel))
+	if err != nil {
+		return 0, fmt.Errorf("Cannot open file: %s on snapshot: %s, Error: %w", rel, version.Snapshot, err)
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
+
+/*
+This method unmounts and unmaps all the snapshots mounted by
+the `TimeMachine`.
+*/
+func (t *TimeMachine) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var failed []string
+	for snapshot := range t.devices {
+		if err := t.release(snapshot); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Cannot close time machine, Error: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package blockdevice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//Returned (wrapped in a `CommandError`) when a command is killed for
+//exceeding its timeout, see `Connection.SetCommandTimeout`.
+var ErrCommandTimeout = errors.New("command timed out")
+
+//This interface represents a runner able to stop the commands when a
+//context is done.
+type ContextRunner interface {
+	RunContext(ctx context.Context, name string, args ...string) (string, error)
+}
+
+func (r *LocalRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	return RunCommandContext(ctx, name, args...)
+}
+
+func (r *SSHRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	sshArgs, err := r.sshArgs(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return RunCommandContext(ctx, "ssh", sshArgs...)
+}
+
+func (r *SudoRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	return runContext(ctx, runnerOrLocal(r.Runner), "sudo", r.sudoArgs(name, args...)...)
+}
+
+func (r *ChrootRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	return runContext(ctx, runnerOrLocal(r.Runner), "chroot", append([]string{r.Root, name}, args...)...)
+}
+
+/*
+This method runs a command on the local host like `RunCommand`, its
+whole process group is killed when `ctx` is done, the error then wraps
+ErrCommandTimeout (on deadlines) and the context error.
+*/
+func RunCommandContext(ctx context.Context, name string, args ...string) (string, error) {
+	return runProcess(ctx, nil, name, args...)
+}
+
+/*
+This is a helper method that runs a local process, feeding `input` to
+its standard input if not nil, until it exits or `ctx` is done.
+*/
+func runProcess(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	return runProcessStderr(ctx, input, nil, name, args...)
+}
+
+/*
+This is a helper method that runs a local process like `runProcess`,
+its standard error is also written to `stderr` (if not nil) as it goes.
+*/
+func runProcessStderr(ctx context.Context, input []byte, stderrWriter io.Writer, name string, args ...string) (string, error) {
+	start := time.Now()
+	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if stderrWriter != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, stderrWriter)
+	}
+	//the children (e.g. rbd helpers) are killed along with the command
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+			err = ctx.Err()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = kindErrorf(ErrCommandTimeout, err, "command: %s timed out after: %s", name, time.Since(start).Round(time.Millisecond))
+			}
+		}
+	}
+
+	traceCommand(ctx, name, args, start, err)
+	return strings.Trim(stdout.String(), " \n"), commandError(name, args, stdout.Bytes(), stderr.Bytes(), err)
+}
+
+/*
+This is a helper method that runs a command on a runner, stopping it
+when `ctx` is done if the runner implements `ContextRunner`.
+*/
+func runContext(ctx context.Context, runner CommandRunner, name string, args ...string) (string, error) {
+	if contextRunner, ok := runner.(ContextRunner); ok {
+		return contextRunner.RunContext(ctx, name, args...)
+	}
+	return runner.Run(name, args...)
+}
+
+//This struct runs the commands of a runner with the command timeout of
+//a connection.
+type timeoutRunner struct {
+	runner     CommandRunner
+	connection *Connection
+}
+
+func (r *timeoutRunner) Run(name string, args ...string) (string, error) {
+	return r.RunContext(context.Background(), name, args...)
+}
+
+func (r *timeoutRunner) RunContext(ctx context.Context, name string, args ...string) (string, error) {
+	if timeout := r.connection.GetCommandTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return runContext(withCommandLogger(ctx, r.connection), r.runner, name, args...)
+}
+
+func (r *timeoutRunner) RunWithInput(input []byte, name string, args ...string) (string, error) {
+	return r.runWithInputContext(context.Background(), input, name, args...)
+}
+
+func (r *timeoutRunner) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	if timeout := r.connection.GetCommandTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return runWithInputContext(withCommandLogger(ctx, r.connection), r.runner, input, name, args...)
+}
+
+/*
+This method sets the time the external commands of the connection and
+its devices (rbd map, mkfs, mount ...) are given to complete before
+being killed, zero (the default) waits forever.
+*/
+func (c *Connection) SetCommandTimeout(timeout time.Duration) {
+	if c.parent != nil {
+		c.parent.SetCommandTimeout(timeout)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commandTimeout = timeout
+}
+
+/*
+Getter method for commandTimeout
+*/
+func (c *Connection) GetCommandTimeout() time.Duration {
+	if c.parent != nil {
+		return c.parent.GetCommandTimeout()
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.commandTimeout
+}
+
+/*
+This is a helper method that returns the runner wrapped by the command
+timeout of a connection and by a bound context, if any.
+*/
+func unwrapRunner(runner CommandRunner) CommandRunner {
+	switch wrapper := runner.(type) {
+	case *timeoutRunner:
+		return unwrapRunner(wrapper.runner)
+	case *boundRunner:
+		return unwrapRunner(wrapper.runner)
+	}
+	return runner
+}
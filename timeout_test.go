@@ -0,0 +1,37 @@
+package blockdevice
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+//This struct records the context the commands given an input are run
+//with.
+type inputContextRecorder struct {
+	ctx context.Context
+}
+
+func (r *inputContextRecorder) Run(name string, args ...string) (string, error) {
+	return "", nil
+}
+
+func (r *inputContextRecorder) runWithInputContext(ctx context.Context, input []byte, name string, args ...string) (string, error) {
+	r.ctx = ctx
+	return "", nil
+}
+
+func TestTimeoutRunnerInput(t *testing.T) {
+	recorder := &inputContextRecorder{}
+	connection := &Connection{mutex: &sync.RWMutex{}}
+	connection.SetCommandTimeout(time.Minute)
+
+	if _, err := runWithInput(&timeoutRunner{runner: recorder, connection: connection}, []byte("key"), "dd", "of=/tmp/key"); err != nil {
+		t.Fatalf("runWithInput() = %v", err)
+	}
+
+	if _, ok := recorder.ctx.Deadline(); !ok {
+		t.Errorf("the command given an input is run without the command timeout")
+	}
+}
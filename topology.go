@@ -0,0 +1,182 @@
+package blockdevice
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DefaultAffinitySamples = 32
+)
+
+//Crush bucket types used to compute locality, most specific first.
+var localityLevels = []string{"host", "chassis", "rack", "row", "room", "zone", "datacenter", "region"}
+
+//This struct represents the placement of the host running the client.
+type HostTopology struct {
+	Hostname      string
+	CrushLocation map[string]string
+	Zone          string
+}
+
+//This struct represents where the primary OSDs of an image objects live
+//relative to the client, computed over a sample of the image objects.
+type AffinityReport struct {
+	Pool           string
+	Image          string
+	Client         *HostTopology
+	SampledObjects int
+	//Number of sampled objects per primary OSD.
+	PrimaryOSDs map[int]int
+	//Number of sampled objects per host of the primary OSD.
+	PrimaryHosts map[string]int
+	//Number of sampled objects whose primary shares the client crush
+	//bucket, keyed by bucket type (host, rack, zone, ...).
+	Local map[string]int
+}
+
+/*
+This method returns the fraction of the sampled objects whose primary
+OSD shares the client bucket of the given type.
+*/
+func (r *AffinityReport) LocalFraction(level string) float64 {
+	if r.SampledObjects == 0 {
+		return 0
+	}
+	return float64(r.Local[level]) / float64(r.SampledObjects)
+}
+
+/*
+This is a helper method that parses a crush location as found on the
+`crush_location` option (e.g. "root=default rack=r1 host=node1").
+*/
+func parseCrushLocation(location string) map[string]string {
+	buckets := make(map[string]string)
+	for _, field := range strings.FieldsFunc(location, func(r rune) bool {
+		return r == ' ' || r == ','
+	}) {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			buckets[parts[0]] = parts[1]
+		}
+	}
+	return buckets
+}
+
+/*
+This method returns the topology of the host running the client, the
+crush location comes from the `crush_location` option and the zone
+from its `zone` (or `datacenter`) bucket.
+*/
+func (c *Connection) HostTopology() (*HostTopology, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get hostname, Error: %s", err)
+	}
+
+	location, _ := c.rados().GetConfigOption("crush_location")
+	buckets := parseCrushLocation(location)
+	if _, ok := buckets["host"]; !ok {
+		buckets["host"] = strings.Split(hostname, ".")[0]
+	}
+
+	zone := buckets["zone"]
+	if zone == "" {
+		zone = buckets["datacenter"]
+	}
+
+	return &HostTopology{
+		Hostname:      hostname,
+		CrushLocation: buckets,
+		Zone:          zone,
+	}, nil
+}
+
+/*
+This method returns the name of the data object with the given index.
+*/
+func (i *Image) objectName(index uint64) string {
+	if old, _ := i.IsOldFormat(); old {
+		return fmt.Sprintf("%s.%012x", i.Block_name_prefix, index)
+	}
+	return fmt.Sprintf("%s.%016x", i.Block_name_prefix, index)
+}
+
+/*
+This method reports where the primary OSDs of the image objects live
+relative to this client, sampling up to `samples` objects evenly
+spread over the image (DefaultAffinitySamples if zero).
+*/
+func (i *Image) PrimaryAffinityReport(samples int) (*AffinityReport, error) {
+	client, err := i.HostTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	if samples <= 0 {
+		samples = DefaultAffinitySamples
+	}
+
+	objects := i.Num_objs
+	if objects == 0 {
+		objects = 1
+	}
+
+	step := objects / uint64(samples)
+	if step == 0 {
+		step = 1
+	}
+
+	report := &AffinityReport{
+		Pool:         i.pool,
+		Image:        i.name,
+		Client:       client,
+		PrimaryOSDs:  make(map[int]int),
+		PrimaryHosts: make(map[string]int),
+		Local:        make(map[string]int),
+	}
+
+	locations := make(map[int]map[string]string)
+	for index := uint64(0); index < objects && report.SampledObjects < samples; index += step {
+		var mapping struct {
+			ActingPrimary int `json:"acting_primary"`
+		}
+
+		if err := i.monCommand(map[string]interface{}{
+			"prefix": "osd map",
+			"pool":   i.pool,
+			"object": i.objectName(index),
+		}, &mapping); err != nil {
+			return nil, err
+		}
+
+		location, ok := locations[mapping.ActingPrimary]
+		if !ok {
+			var osd struct {
+				CrushLocation map[string]string `json:"crush_location"`
+			}
+
+			if err := i.monCommand(map[string]interface{}{
+				"prefix": "osd find",
+				"id":     mapping.ActingPrimary,
+			}, &osd); err != nil {
+				return nil, err
+			}
+
+			location = osd.CrushLocation
+			locations[mapping.ActingPrimary] = location
+		}
+
+		report.SampledObjects++
+		report.PrimaryOSDs[mapping.ActingPrimary]++
+		report.PrimaryHosts[location["host"]]++
+
+		for _, level := range localityLevels {
+			if value, ok := client.CrushLocation[level]; ok && location[level] == value {
+				report.Local[level]++
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,118 @@
+package blockdevice
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+const (
+	tracerName = "github.com/niedbalski/go-ceph-blockdevice"
+)
+
+var tracing = struct {
+	sync.Mutex
+	provider trace.TracerProvider
+}{}
+
+/*
+This method sets the OpenTelemetry provider of the spans recorded for
+the operations and the external commands, the global one (see
+otel.SetTracerProvider) is used if it's not set or nil.
+*/
+func SetTracerProvider(provider trace.TracerProvider) {
+	tracing.Lock()
+	defer tracing.Unlock()
+	tracing.provider = provider
+}
+
+/*
+This is a helper method that returns the tracer of the package.
+*/
+func tracer() trace.Tracer {
+	tracing.Lock()
+	provider := tracing.provider
+	tracing.Unlock()
+
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+/*
+This is a helper method that starts a span, a child of the one of
+`ctx`, and returns the context carrying it.
+*/
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+/*
+This is a helper method that ends a span, marked as failed if `err` is
+not nil.
+*/
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(time.Now()))
+}
+
+/*
+This is a helper method that records a span started at `start` and
+ending now, marked as failed if `err` is not nil.
+*/
+func recordSpan(ctx context.Context, name string, start time.Time, err error, attributes ...attribute.KeyValue) {
+	_, span := tracer().Start(ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attributes...))
+	endSpan(span, err)
+}
+
+/*
+This is a helper method that records the span and the log of an
+external command, along with its exit code, the span is a child of the
+one of `ctx` (see the *Ctx methods).
+*/
+func traceCommand(ctx context.Context, name string, args []string, start time.Time, err error) {
+	code := 0
+	if err != nil {
+		code = exitCode(err)
+	}
+
+	logCommand(ctx, name, args, start, code, err)
+	recordSpan(ctx, "exec "+name, start, err,
+		attribute.String("process.command", name),
+		attribute.StringSlice("process.command_args", args),
+		attribute.Int("process.exit_code", code))
+}
+
+/*
+This is a helper method that returns the span attributes of an
+operation.
+*/
+func (o *Operation) attributes() []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("blockdevice.operation", o.Name)}
+	if o.connection != nil {
+		attributes = append(attributes,
+			attribute.String("ceph.user", o.connection.username),
+			attribute.String("ceph.cluster", o.connection.cluster))
+	}
+
+	if o.Pool != "" {
+		attributes = append(attributes, attribute.String("ceph.pool", o.Pool))
+	}
+
+	if o.Image != "" {
+		attributes = append(attributes, attribute.String("ceph.image", o.Image))
+	}
+
+	if o.Device != "" {
+		attributes = append(attributes, attribute.String("blockdevice.device", o.Device))
+	}
+	return attributes
+}
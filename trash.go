@@ -0,0 +1,281 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//Time between two purges of a `TrashPurger`.
+	DefaultTrashPurgeInterval = time.Hour
+	//Source of the images moved to the trash by the users, the other
+	//ones (migrations, mirroring) are never purged.
+	trashSourceUser = "USER"
+)
+
+//This struct represents an image of the trash.
+type TrashEntry struct {
+	Pool      string
+	Namespace string
+	ID        string
+	Name      string
+	DeletedAt time.Time
+	//Time the image can be removed from, before that it's protected.
+	ExpiresAt time.Time
+	Source    string
+}
+
+//This struct represents an image purged from the trash, or attempted, by
+//a `TrashPurger`.
+type TrashPurgeEvent struct {
+	Entry TrashEntry
+	Time  time.Time
+	Err   error
+}
+
+//This struct represents a purge of the expired images of the trash of a
+//connection pool (and RADOS namespace) running on background, as
+//started by `Connection.ScheduleTrashPurge`.
+type TrashPurger struct {
+	connection *Connection
+	interval   time.Duration
+	olderThan  time.Duration
+	onPurge    func(event TrashPurgeEvent)
+	//serializes the purges
+	running sync.Mutex
+	mutex   sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	//the background purge is calling the callback
+	delivering bool
+}
+
+/*
+This method moves the image to the trash of its pool, it can't be
+removed from there (see `Connection.ScheduleTrashPurge`) before
+`expiresAt`, nor restored after it's purged. A zero `expiresAt` lets it
+be removed at once.
+*/
+func (i *Image) MoveToTrash(expiresAt time.Time) error {
+	if device := i.IsAlreadyMapped(); device != "" {
+		return kindErrorf(ErrDeviceBusy, nil, "Cannot move image: %s to the trash, Error: image is mapped on: %s", i.name, device)
+	}
+
+	args := []string{"trash", "mv", "--id", i.username}
+	if !expiresAt.IsZero() {
+		args = append(args, "--expires-at", expiresAt.UTC().Format("2006-01-02T15:04:05Z"))
+	}
+
+	if _, err := i.run("rbd", append(args, i.spec(i.name, ""))...); err != nil {
+		return fmt.Errorf("Cannot move image: %s to the trash, Error: %w", i.name, err)
+	}
+	return nil
+}
+
+/*
+This is a helper method that returns the arguments of the rbd tool
+selecting the trash of the connection pool and namespace.
+*/
+func (c *Connection) trashArgs(args ...string) []string {
+	args = append([]string{"trash"}, args...)
+	args = append(args, "--id", c.username, "--pool", c.pool)
+	if namespace := c.GetNamespace(); namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	return args
+}
+
+/*
+This is a helper method that parses a time printed by the rbd tool.
+*/
+func parseTrashTime(value string, output string) (time.Time, error) {
+	parsed, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(value), time.Local)
+	if err != nil {
+		return time.Time{}, parseFailure("rbd trash ls", output, err)
+	}
+	return parsed, nil
+}
+
+/*
+This method lists the images of the trash of the connection pool (and
+RADOS namespace).
+*/
+func (c *Connection) ListTrash() ([]TrashEntry, error) {
+	output, err := c.run("rbd", c.trashArgs("ls", "--long", "--format", "json")...)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list trash of pool: %s, Error: %w", c.pool, err)
+	}
+
+	var entries []TrashEntry
+	if output == "" {
+		return entries, nil
+	}
+
+	var listed []struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Source    string `json:"source"`
+		DeletedAt string `json:"deleted_at"`
+		//"expired at <time>" or "protected until <time>"
+		Status string `json:"status"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &listed); err != nil {
+		return nil, parseFailure("rbd trash ls", output, err)
+	}
+
+	for _, image := range listed {
+		entry := TrashEntry{
+			Pool:      c.pool,
+			Namespace: c.GetNamespace(),
+			ID:        image.ID,
+			Name:      image.Name,
+			Source:    image.Source,
+		}
+
+		if entry.DeletedAt, err = parseTrashTime(image.DeletedAt, output); err != nil {
+			return nil, err
+		}
+
+		status := strings.TrimPrefix(strings.TrimPrefix(image.Status, "expired at "), "protected until ")
+		if entry.ExpiresAt, err = parseTrashTime(status, output); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+/*
+This method removes for good the images of the trash of the connection
+pool moved there by the users with an expiry and expired for at least
+`olderThan` as of `now`. An event is returned for every image, in the order of the
+trash.
+*/
+func (c *Connection) PurgeTrash(now time.Time, olderThan time.Duration) ([]TrashPurgeEvent, error) {
+	entries, err := c.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []TrashPurgeEvent
+	for _, entry := range entries {
+		//images trashed without an expiry expire when deleted, they're
+		//left to the users
+		if entry.Source != trashSourceUser || !entry.ExpiresAt.After(entry.DeletedAt) || entry.ExpiresAt.After(now.Add(-olderThan)) {
+			continue
+		}
+
+		event := TrashPurgeEvent{Entry: entry, Time: now}
+		if _, event.Err = c.run("rbd", c.trashArgs("rm", entry.ID)...); event.Err != nil {
+			event.Err = fmt.Errorf("Cannot remove image: %s from the trash, Error: %w", entry.Name, event.Err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+/*
+This method starts purging the trash of the connection pool (and RADOS
+namespace) every `interval` (DefaultTrashPurgeInterval if zero) on
+background: the images moved there with an expiry (see
+`Image.MoveToTrash`) are removed once expired for `olderThan`.
+`onPurge` (which can be nil) is called for every image removed, or
+failed to, e.g. for audit logging. The purger must be stopped before
+the connection is shut down.
+*/
+func (c *Connection) ScheduleTrashPurge(interval time.Duration, olderThan time.Duration, onPurge func(event TrashPurgeEvent)) *TrashPurger {
+	if interval <= 0 {
+		interval = DefaultTrashPurgeInterval
+	}
+
+	purger := &TrashPurger{
+		connection: c,
+		interval:   interval,
+		olderThan:  olderThan,
+		onPurge:    onPurge,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				purger.runOnce(now, true)
+			}
+		}
+	}(purger.stop, purger.done)
+	return purger
+}
+
+/*
+This method purges the trash once as of `now`, see
+`Connection.PurgeTrash`, and reports the events to the callback, which
+may stop the purger.
+*/
+func (p *TrashPurger) RunOnce(now time.Time) ([]TrashPurgeEvent, error) {
+	return p.runOnce(now, false)
+}
+
+/*
+This is a helper method that purges the trash like `RunOnce`, the
+callback is called without any lock held, flagged when it's called by
+the `background` purge so it can stop it.
+*/
+func (p *TrashPurger) runOnce(now time.Time, background bool) ([]TrashPurgeEvent, error) {
+	p.running.Lock()
+	events, err := p.connection.PurgeTrash(now, p.olderThan)
+	p.running.Unlock()
+
+	if p.onPurge == nil {
+		return events, err
+	}
+
+	if background {
+		p.setDelivering(true)
+		defer p.setDelivering(false)
+	}
+
+	for _, event := range events {
+		p.onPurge(event)
+	}
+	return events, err
+}
+
+/*
+This is a helper method that flags the background purge calling the
+callback.
+*/
+func (p *TrashPurger) setDelivering(delivering bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.delivering = delivering
+}
+
+/*
+This method stops the background purges, waiting for the running one
+unless it's called by its callback.
+*/
+func (p *TrashPurger) Stop() {
+	p.mutex.Lock()
+	stop, done, delivering := p.stop, p.done, p.delivering
+	p.stop, p.done = nil, nil
+	p.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		if !delivering {
+			<-done
+		}
+	}
+}
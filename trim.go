@@ -0,0 +1,187 @@
+package blockdevice
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTrimInterval = 24 * time.Hour
+)
+
+var fstrimBytes = regexp.MustCompile(`\((\d+) bytes\)`)
+
+/*
+This method releases the unused blocks of the device back to the pool:
+the filesystem is trimmed (fstrim) when mounted, otherwise the whole
+device is discarded (blkdiscard) but only if it holds no signature, so
+no data is ever lost. Raw devices are never discarded. The number of
+trimmed bytes is returned when known.
+*/
+func (d *Device) Trim() (uint64, error) {
+	if d.readOnly {
+		return 0, fmt.Errorf("Cannot trim device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.isMounted {
+		output, err := d.runMounted("fstrim", "--verbose", d.mountPoint)
+		if err != nil {
+			return 0, fmt.Errorf("Cannot trim device: %s, Error: %w", d.path, err)
+		}
+
+		match := fstrimBytes.FindStringSubmatch(output)
+		if match == nil {
+			return 0, parseFailure("fstrim", output, fmt.Errorf("no trimmed bytes found"))
+		}
+		return strconv.ParseUint(match[1], 10, 64)
+	}
+
+	if d.raw {
+		return 0, fmt.Errorf("Cannot trim device: %s, Error: raw devices are never discarded", d.path)
+	}
+
+	current, err := d.signature()
+	if err != nil {
+		return 0, fmt.Errorf("Cannot detect filesystem on device: %s, Error: %w", d.path, err)
+	}
+
+	if current != "" {
+		return 0, fmt.Errorf("Cannot trim device: %s, Error: device holds a %s signature and is not mounted", d.path, current)
+	}
+
+	if _, err := d.run("blkdiscard", d.path); err != nil {
+		return 0, fmt.Errorf("Cannot discard device: %s, Error: %w", d.path, err)
+	}
+	return 0, nil
+}
+
+//This struct represents a trim performed by a `TrimScheduler`.
+type TrimEvent struct {
+	Device  *Device
+	Trimmed Size
+	Time    time.Time
+	Err     error
+}
+
+//This struct represents a scheduler that periodically trims the tracked
+//devices.
+type TrimScheduler struct {
+	interval time.Duration
+	onEvent  func(event TrimEvent)
+	mutex    sync.Mutex
+	devices  map[*Device]bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+/*
+This method is a constructor for `TrimScheduler` objects, devices are
+trimmed every `interval` (DefaultTrimInterval if zero) and `onEvent`
+(which can be nil) is called for every trim.
+*/
+func NewTrimScheduler(interval time.Duration, onEvent func(event TrimEvent)) *TrimScheduler {
+	if interval <= 0 {
+		interval = DefaultTrimInterval
+	}
+
+	return &TrimScheduler{
+		interval: interval,
+		onEvent:  onEvent,
+		devices:  make(map[*Device]bool),
+	}
+}
+
+/*
+This method adds a device to the scheduler.
+*/
+func (s *TrimScheduler) Add(device *Device) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.devices[device] = true
+}
+
+/*
+This method removes a device from the scheduler.
+*/
+func (s *TrimScheduler) Remove(device *Device) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.devices, device)
+}
+
+/*
+This method trims every mounted device once and returns the events, the
+devices are trimmed and `onEvent` is called without the lock held, so
+it can add or remove devices.
+*/
+func (s *TrimScheduler) RunOnce() []TrimEvent {
+	s.mutex.Lock()
+	devices := make([]*Device, 0, len(s.devices))
+	for device := range s.devices {
+		devices = append(devices, device)
+	}
+	s.mutex.Unlock()
+
+	var events []TrimEvent
+	for _, device := range devices {
+		if !device.isMounted {
+			continue
+		}
+
+		trimmed, err := device.Trim()
+		event := TrimEvent{Device: device, Trimmed: Size(trimmed), Time: time.Now(), Err: err}
+		events = append(events, event)
+
+		if s.onEvent != nil {
+			s.onEvent(event)
+		}
+	}
+	return events
+}
+
+/*
+This method starts trimming the devices periodically on background
+until `Stop` is called.
+*/
+func (s *TrimScheduler) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.RunOnce()
+			}
+		}
+	}(s.stop, s.done)
+}
+
+/*
+This method stops the background trims started by `Start`.
+*/
+func (s *TrimScheduler) Stop() {
+	s.mutex.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,34 @@
+package blockdevice
+
+import (
+	"testing"
+)
+
+//This struct answers fstrim as if it trimmed a fixed number of bytes.
+type fstrimRunner struct{}
+
+func (r *fstrimRunner) Run(name string, args ...string) (string, error) {
+	return "/mnt/data: 1 GiB (1073741824 bytes) trimmed", nil
+}
+
+func TestTrimSchedulerCallback(t *testing.T) {
+	device := &Device{path: "/dev/rbd0", isMounted: true, mountPoint: "/mnt/data", runner: &fstrimRunner{}}
+	added := &Device{path: "/dev/rbd1", runner: &fstrimRunner{}}
+
+	var scheduler *TrimScheduler
+	scheduler = NewTrimScheduler(0, func(event TrimEvent) {
+		//a callback updating the scheduler must not deadlock
+		scheduler.Remove(event.Device)
+		scheduler.Add(added)
+	})
+	scheduler.Add(device)
+
+	events := scheduler.RunOnce()
+	if len(events) != 1 || events[0].Err != nil || events[0].Trimmed != 1073741824 {
+		t.Fatalf("RunOnce() = %+v, want one trim of 1073741824 bytes", events)
+	}
+
+	if scheduler.devices[device] || !scheduler.devices[added] {
+		t.Errorf("the callback didn't update the devices: %v", scheduler.devices)
+	}
+}
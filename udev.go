@@ -0,0 +1,99 @@
+package blockdevice
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUdevTimeout = 10 * time.Second
+	udevPollInterval   = 100 * time.Millisecond
+)
+
+//Serializes the udev settles of the devices mapped concurrently, each
+//settle waits for the whole event queue anyway.
+var udevSettle sync.Mutex
+
+/*
+This method tells if the given path exists on the host owning
+the device.
+*/
+func (d *Device) exists(path string) bool {
+	_, err := d.run("test", "-e", path)
+	return err == nil
+}
+
+/*
+This method returns the udev managed symlink of the device
+(/dev/rbd/<pool>[/<namespace>]/<image>[@<snap>][-part<n>]), it doesn't
+check if it exists.
+Only krbd devices have one.
+*/
+func (d *Device) symlinkPath() string {
+	if d.disk != nil {
+		if symlink := d.disk.symlinkPath(); symlink != "" {
+			return symlink + "-part" + strconv.Itoa(d.partition)
+		}
+		return ""
+	}
+
+	if d.image == nil || d.parent != nil || d.backend == BackendNBD {
+		return ""
+	}
+
+	path := "/dev/rbd/" + d.image.pool + "/" + d.image.name
+	if namespace := d.image.GetNamespace(); namespace != "" {
+		path = "/dev/rbd/" + d.image.pool + "/" + namespace + "/" + d.image.name
+	}
+	if d.snapshot != "" {
+		path += "@" + d.snapshot
+	}
+	return path
+}
+
+/*
+This method returns a path for the device that doesn't change across
+remaps, the /dev/rbd/<pool>/<image> symlink created by the ceph udev
+rules, suitable for fstab entries. It returns the device node if the
+symlink doesn't exist.
+*/
+func (d *Device) GetStablePath() string {
+	if symlink := d.symlinkPath(); symlink != "" && d.exists(symlink) {
+		return symlink
+	}
+	return d.path
+}
+
+/*
+This method waits, up to `timeout`, for udev to process the events of a
+newly mapped device and for its device node to appear. The symlink is
+waited for too, but its absence is not an error since the udev rules
+might not be installed.
+*/
+func (d *Device) waitForUdev(timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultUdevTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	udevSettle.Lock()
+	d.run("udevadm", "settle", "--timeout="+strconv.Itoa(int(timeout.Seconds())))
+	udevSettle.Unlock()
+
+	for !d.exists(d.path) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Device: %s didn't appear after: %s", d.path, timeout)
+		}
+		time.Sleep(udevPollInterval)
+	}
+
+	if symlink := d.symlinkPath(); symlink != "" {
+		for !d.exists(symlink) && time.Now().Before(deadline) {
+			time.Sleep(udevPollInterval)
+		}
+	}
+
+	return nil
+}
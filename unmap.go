@@ -0,0 +1,197 @@
+package blockdevice
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultUnMapBackoff = time.Second
+)
+
+//This struct represents the options used to unmap a device.
+type UnMapOptions struct {
+	//Unmap the device even if it's still open (rbd unmap -o force).
+	Force bool
+	//Number of times to retry when the device is busy.
+	Retries int
+	//Time to wait before the first retry, doubled on each attempt
+	//(DefaultUnMapBackoff if zero).
+	Backoff time.Duration
+}
+
+/*
+This method unmaps a device, unmounting it (or disabling its swap
+area) first if needed, layered devices (e.g. overlays) are torn down
+before their parent and partitions are released before their disk,
+unmapping a partition only unmounts it unless it was mapped through
+`MapOptions.Partition`, and standalone layers (e.g. logical volumes) are
+only released. When the device is busy the
+unmap is retried as described by `options` (which can be nil), if it's
+still busy the error reports the processes holding it open.
+*/
+func (d *Device) UnMapWithOptions(options *UnMapOptions) (err error) {
+	defer d.observe(OperationUnMap)(&err)
+
+	if options == nil {
+		options = &UnMapOptions{}
+	}
+
+	//emitted by each layer, the outermost first
+	if err := d.emit(EventPreUnMap); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil {
+			d.emit(EventPostUnMap)
+			if d.image != nil {
+				d.image.untrack(d)
+			}
+		}
+	}()
+
+	if d.isMounted {
+		if err := d.UnMount(); err != nil {
+			return err
+		}
+	}
+
+	if err := d.SwapOff(); err != nil {
+		return err
+	}
+
+	if d.disk != nil {
+		if !d.ownsDisk {
+			return nil
+		}
+
+		d.ownsDisk = false
+		return d.disk.UnMapWithOptions(options)
+	}
+
+	if err := d.releasePartitions(); err != nil {
+		return err
+	}
+
+	if d.parent == nil && d.release != nil {
+		return d.release()
+	}
+
+	if d.parent != nil {
+		if d.release != nil {
+			if err := d.release(); err != nil {
+				return err
+			}
+		}
+		return d.parent.UnMapWithOptions(options)
+	}
+
+	backoff := options.Backoff
+	if backoff <= 0 {
+		backoff = DefaultUnMapBackoff
+	}
+
+	for attempt := 0; attempt <= options.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err = d.unmap(options.Force); err != nil && isNotMappedError(err) {
+			return kindErrorf(ErrNotMapped, err, "Device: %s is not mapped, Error: %s", d.path, err)
+		}
+
+		if err == nil || !isBusyError(err) {
+			return err
+		}
+	}
+
+	if holders := d.holders(d.path, false); len(holders) > 0 {
+		return kindErrorf(ErrDeviceBusy, err, "Device: %s is busy, held open by: %s", d.path, strings.Join(holders, ", "))
+	}
+	return kindErrorf(ErrDeviceBusy, err, "Device: %s is busy, Error: %s", d.path, err)
+}
+
+/*
+This method unmaps the device using the backend it was mapped with.
+*/
+func (d *Device) unmap(force bool) error {
+	if d.backend == BackendSysfs {
+		return unmapSysfs(d.path, force)
+	}
+
+	if d.backend == BackendNBD {
+		_, err := d.run("rbd-nbd", "unmap", d.path)
+		return err
+	}
+
+	args := []string{"unmap"}
+	if force {
+		args = append(args, "-o", "force")
+	}
+
+	if _, err := d.run("rbd", append(args, d.path)...); err != nil {
+		return err
+	}
+	return nil
+}
+
+/*
+This method returns the processes (as pid(command)) holding `target`
+open, using fuser and falling back to lsof. If `mount` is set target
+is a mountpoint and all the processes using its filesystem are returned.
+*/
+func (d *Device) holders(target string, mount bool) []string {
+	var output string
+	if mount {
+		output, _ = d.run("fuser", "-m", target)
+	} else {
+		output, _ = d.run("fuser", target)
+	}
+
+	pids := strings.Fields(output)
+	if len(pids) == 0 {
+		output, _ = d.run("lsof", "-t", target)
+		pids = strings.Fields(output)
+	}
+
+	if len(pids) == 0 {
+		return nil
+	}
+
+	output, err := d.run("ps", "-o", "pid=,comm=", "-p", strings.Join(pids, ","))
+	if err != nil {
+		return pids
+	}
+
+	var holders []string
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			holders = append(holders, fields[0]+"("+fields[1]+")")
+		}
+	}
+	return holders
+}
+
+/*
+This is a helper method that tells if an unmap failed because the
+device is not mapped anymore.
+*/
+func isNotMappedError(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || stderrContains(err, "not mapped") || stderrContains(err, "not a mapped")
+}
+
+/*
+This is a helper method that tells if an error was caused by a busy
+device (EBUSY).
+*/
+func isBusyError(err error) bool {
+	if errors.Is(err, syscall.EBUSY) {
+		return true
+	}
+
+	return stderrContains(err, "busy")
+}
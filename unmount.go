@@ -0,0 +1,115 @@
+package blockdevice
+
+import (
+	"strings"
+	"time"
+)
+
+//This struct represents the options used to unmount a device.
+type UnMountOptions struct {
+	//Detach the filesystem now and clean up references later (umount -l).
+	Lazy bool
+	//Force the unmount, e.g. of an unreachable filesystem (umount -f).
+	Force bool
+	//When the mount is busy, kill the processes using it before retrying,
+	//it's retried at least once even if `Retries` is zero.
+	KillHolders bool
+	//Number of times to retry when the mount is busy.
+	Retries int
+	//Time to wait before the first retry, doubled on each attempt
+	//(DefaultUnMapBackoff if zero).
+	Backoff time.Duration
+}
+
+/*
+This method unmounts the device from the current mounting path as
+described by `options` (which can be nil), along with its bind mounts.
+If a mount is still busy after the retries, the error reports the
+processes using it.
+*/
+func (d *Device) UnMountWithOptions(options *UnMountOptions) (err error) {
+	defer d.observe(OperationUnMount)(&err)
+
+	if options == nil {
+		options = &UnMountOptions{}
+	}
+
+	if err := d.emit(EventPreUnMount); err != nil {
+		return err
+	}
+
+	//unmounting a frozen filesystem blocks until it's thawed
+	if err := d.Thaw(); err != nil {
+		return err
+	}
+
+	for len(d.bindMounts) > 0 {
+		last := len(d.bindMounts) - 1
+		if err := d.umount(d.bindMounts[last], options); err != nil {
+			return err
+		}
+		d.bindMounts = d.bindMounts[:last]
+	}
+
+	target := d.mountPoint
+	if target == "" {
+		target = d.path
+	}
+
+	if err := d.umount(target, options); err != nil {
+		return err
+	}
+
+	d.isMounted = false
+	d.emit(EventPostUnMount)
+	return nil
+}
+
+/*
+This is a helper method that unmounts a mount of the device, retrying
+as described by `options` while it's busy.
+*/
+func (d *Device) umount(target string, options *UnMountOptions) error {
+	args := []string{}
+	if options.Lazy {
+		args = append(args, "-l")
+	}
+
+	if options.Force {
+		args = append(args, "-f")
+	}
+
+	backoff := options.Backoff
+	if backoff <= 0 {
+		backoff = DefaultUnMapBackoff
+	}
+
+	retries := options.Retries
+	if options.KillHolders && retries < 1 {
+		retries = 1
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if options.KillHolders {
+				d.runMounted("fuser", "-k", "-m", target)
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if _, err = d.runMounted("umount", append(args, target)...); err == nil {
+			return nil
+		}
+
+		if !isBusyError(err) {
+			return err
+		}
+	}
+
+	if holders := d.holders(target, true); len(holders) > 0 {
+		return kindErrorf(ErrDeviceBusy, err, "Mount: %s is busy, used by: %s", target, strings.Join(holders, ", "))
+	}
+	return kindErrorf(ErrDeviceBusy, err, "Mount: %s is busy, Error: %s", target, err)
+}
@@ -0,0 +1,38 @@
+package blockdevice
+
+import (
+	"strings"
+	"testing"
+)
+
+//This struct answers umount as busy until fuser killed the holders.
+type busyMountRunner struct {
+	commands []string
+	killed   bool
+}
+
+func (r *busyMountRunner) Run(name string, args ...string) (string, error) {
+	r.commands = append(r.commands, name)
+	switch name {
+	case "fuser":
+		r.killed = true
+	case "umount":
+		if !r.killed {
+			return "", &CommandError{Stderr: "umount: /mnt/data: target is busy."}
+		}
+	}
+	return "", nil
+}
+
+func TestUmountKillHolders(t *testing.T) {
+	runner := &busyMountRunner{}
+	device := &Device{path: "/dev/rbd0", runner: runner}
+
+	if err := device.umount("/mnt/data", &UnMountOptions{KillHolders: true, Backoff: 1}); err != nil {
+		t.Fatalf("umount() = %v", err)
+	}
+
+	if got := strings.Join(runner.commands, " "); got != "umount fuser umount" {
+		t.Errorf("ran %q, want the holders killed before a retry", got)
+	}
+}
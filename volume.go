@@ -0,0 +1,225 @@
+package blockdevice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//Name of the object holding the volume intents on the pool omap.
+const volumeIntentObject = "gcb_volume_intents"
+
+//States of a volume intent.
+const (
+	VolumePrepared  = "prepared"
+	VolumeCreated   = "created"
+	VolumeCommitted = "committed"
+	VolumeFailed    = "failed"
+)
+
+//This struct represents a volume to provision: an image mapped and
+//mounted on a host.
+type VolumeSpec struct {
+	//Image name and size in megabytes.
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+	//Filesystem and mount point used when the volume is committed.
+	FileSystemType string `json:"fs_type"`
+	MountPoint     string `json:"mount_point"`
+}
+
+//This struct represents the intent recorded on the cluster for a
+//volume being provisioned.
+type VolumeIntent struct {
+	Token   string     `json:"token"`
+	Spec    VolumeSpec `json:"spec"`
+	State   string     `json:"state"`
+	Host    string     `json:"host,omitempty"`
+	Device  string     `json:"device,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Created time.Time  `json:"created"`
+	Updated time.Time  `json:"updated"`
+}
+
+/*
+This is a helper method that generates a random volume token.
+*/
+func newVolumeToken() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+/*
+This method stores the given intent on the pool omap.
+*/
+func (c *Connection) saveVolumeIntent(intent *VolumeIntent) error {
+	intent.Updated = time.Now()
+	value, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ioContext().SetOmap(volumeIntentObject, map[string][]byte{intent.Token: value}); err != nil {
+		return fmt.Errorf("Cannot record intent for volume: %s, Error: %w", intent.Spec.Name, err)
+	}
+	return nil
+}
+
+/*
+This method returns the intent recorded for the given `token`.
+*/
+func (c *Connection) GetVolumeIntent(token string) (*VolumeIntent, error) {
+	values, err := c.ioContext().GetOmapValues(volumeIntentObject, "", token, 1)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read volume intent: %s, Error: %w", token, err)
+	}
+
+	value, ok := values[token]
+	if !ok {
+		return nil, fmt.Errorf("Volume intent: %s not found on pool: %s", token, c.pool)
+	}
+
+	intent := &VolumeIntent{}
+	if err := json.Unmarshal(value, intent); err != nil {
+		return nil, fmt.Errorf("Cannot parse volume intent: %s, Error: %w", token, err)
+	}
+	return intent, nil
+}
+
+/*
+This method returns all the volume intents recorded on the pool, which
+includes the volumes left behind by a crashed controller.
+*/
+func (c *Connection) ListVolumeIntents() ([]VolumeIntent, error) {
+	values, err := c.ioContext().GetAllOmapValues(volumeIntentObject, "", "", 100)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list volume intents on pool: %s, Error: %w", c.pool, err)
+	}
+
+	var intents []VolumeIntent
+	for token, value := range values {
+		var intent VolumeIntent
+		if err := json.Unmarshal(value, &intent); err != nil {
+			return nil, fmt.Errorf("Cannot parse volume intent: %s, Error: %w", token, err)
+		}
+		intents = append(intents, intent)
+	}
+	return intents, nil
+}
+
+/*
+This method removes the intent recorded for the given `token`, the image
+is left untouched.
+*/
+func (c *Connection) DeleteVolumeIntent(token string) error {
+	if err := c.ioContext().RmOmapKeys(volumeIntentObject, []string{token}); err != nil {
+		return fmt.Errorf("Cannot remove volume intent: %s, Error: %w", token, err)
+	}
+	return nil
+}
+
+/*
+This method is the first phase of a volume provisioning: the intent is
+recorded on the cluster before the image is created, and the returned
+token is passed to `CommitVolume` to perform the host-side actions.
+
+A failure at any later point leaves the intent on the pool, so the
+provisioning can be audited (see `ListVolumeIntents`) and resumed.
+*/
+func (c *Connection) PrepareVolume(spec VolumeSpec) (string, error) {
+	if spec.Name == "" {
+		return "", fmt.Errorf("Cannot prepare volume, Error: no image name given")
+	}
+
+	if spec.FileSystemType == "" {
+		spec.FileSystemType = DefaultFileSystemType
+	}
+
+	token, err := newVolumeToken()
+	if err != nil {
+		return "", fmt.Errorf("Cannot prepare volume: %s, Error: %w", spec.Name, err)
+	}
+
+	intent := &VolumeIntent{
+		Token:   token,
+		Spec:    spec,
+		State:   VolumePrepared,
+		Created: time.Now(),
+	}
+
+	if err := c.saveVolumeIntent(intent); err != nil {
+		return "", err
+	}
+
+	image, err := c.GetOrCreateImage(spec.Name, spec.Size)
+	if err != nil {
+		intent.State = VolumeFailed
+		intent.Error = err.Error()
+		c.saveVolumeIntent(intent)
+		return token, fmt.Errorf("Cannot create image for volume: %s, Error: %w", spec.Name, err)
+	}
+	image.Close()
+
+	intent.State = VolumeCreated
+	intent.Error = ""
+	return token, c.saveVolumeIntent(intent)
+}
+
+/*
+This method is the second phase of a volume provisioning, it maps and
+mounts the image prepared by `PrepareVolume` on the host of
+`options.Runner` (`options` can be nil) and records the result.
+
+A prepared or failed intent is resumed, its image is created if
+missing, so this method can be retried with the same token.
+*/
+func (c *Connection) CommitVolume(token string, options *MapOptions) (*Device, error) {
+	intent, err := c.GetVolumeIntent(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.State == VolumeCommitted {
+		return nil, fmt.Errorf("Volume: %s already committed on host: %s, device: %s", intent.Spec.Name, intent.Host, intent.Device)
+	}
+
+	if options == nil {
+		options = &MapOptions{}
+	}
+
+	runner := c.hostRunner(options.Runner)
+	if intent.Host, err = runner.Run("hostname"); err != nil {
+		return nil, fmt.Errorf("Cannot get hostname for volume: %s, Error: %w", intent.Spec.Name, err)
+	}
+
+	fail := func(err error) (*Device, error) {
+		intent.State = VolumeFailed
+		intent.Error = err.Error()
+		c.saveVolumeIntent(intent)
+		return nil, err
+	}
+
+	image, err := c.GetOrCreateImage(intent.Spec.Name, intent.Spec.Size)
+	if err != nil {
+		return fail(err)
+	}
+
+	device, err := image.MapToDevice(intent.Spec.FileSystemType, intent.Spec.MountPoint, options)
+	if err != nil {
+		image.Close()
+		return fail(err)
+	}
+
+	intent.State = VolumeCommitted
+	intent.Device = device.GetPath()
+	intent.Error = ""
+	if err := c.saveVolumeIntent(intent); err != nil {
+		return device, err
+	}
+	return device, nil
+}
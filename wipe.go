@@ -0,0 +1,125 @@
+package blockdevice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+//Size in megabytes zeroed at both ends of the device when wipefs
+//is not available.
+const wipeRegionSize = 1
+
+//This struct represents a signature found on a device by wipefs.
+type Signature struct {
+	Offset string `json:"offset"`
+	Type   string `json:"type"`
+	UUID   string `json:"uuid"`
+	Label  string `json:"label"`
+}
+
+/*
+This method returns the signatures (filesystems, partition tables,
+raid members ...) found on the device.
+*/
+func (d *Device) Signatures() ([]Signature, error) {
+	output, err := d.run("wipefs", "--json", d.path)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list signatures of device: %s, Error: %w", d.path, err)
+	}
+
+	//wipefs prints nothing when there are no signatures
+	if output == "" {
+		return nil, nil
+	}
+
+	var result struct {
+		Signatures []Signature `json:"signatures"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, parseFailure("wipefs", output, err)
+	}
+	return result.Signatures, nil
+}
+
+/*
+This method clears every signature of the device so it can be
+formatted with a different filesystem, the removed signatures are
+returned. With `dryRun` nothing is removed and the signatures that
+would be are returned.
+
+When wipefs is not available the first and last megabyte of the device
+are zeroed instead, which clears the common signatures.
+*/
+func (d *Device) Wipe(dryRun bool) ([]Signature, error) {
+	if d.readOnly {
+		return nil, fmt.Errorf("Cannot wipe device: %s, Error: device is mapped read-only", d.path)
+	}
+
+	if d.isMounted {
+		return nil, kindErrorf(ErrDeviceBusy, nil, "Cannot wipe device: %s, Error: device is mounted on: %s", d.path, d.mountPoint)
+	}
+
+	signatures, err := d.Signatures()
+	if isCommandNotFound(err) {
+		signatures, err = nil, d.zeroSignatureRegions(dryRun)
+	} else if err == nil && !dryRun && len(signatures) > 0 {
+		if _, err = d.run("wipefs", "--all", d.path); err != nil {
+			err = fmt.Errorf("Cannot wipe device: %s, Error: %w", d.path, err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		d.prepared = false
+	}
+	return signatures, nil
+}
+
+/*
+This is a helper method that tells if a command failed because it's
+not installed, locally or on a remote host.
+*/
+func isCommandNotFound(err error) bool {
+	return errors.Is(err, exec.ErrNotFound) || exitCode(err) == 127
+}
+
+/*
+This method zeroes the regions at both ends of the device.
+*/
+func (d *Device) zeroSignatureRegions(dryRun bool) error {
+	output, err := d.run("blockdev", "--getsize64", d.path)
+	if err != nil {
+		return fmt.Errorf("Cannot get size of device: %s, Error: %w", d.path, err)
+	}
+
+	size, err := strconv.ParseUint(output, 10, 64)
+	if err != nil {
+		return parseFailure("blockdev", output, err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	region := toMegs(wipeRegionSize)
+	count := strconv.FormatUint(wipeRegionSize, 10)
+	seeks := []uint64{0}
+	if size > 2*region {
+		seeks = append(seeks, size/region-wipeRegionSize)
+	}
+
+	for _, seek := range seeks {
+		of := "of=" + d.path
+		if _, err := d.run("dd", "if=/dev/zero", of, "bs=1M", "count="+count, "seek="+strconv.FormatUint(seek, 10), "oflag=direct", "conv=notrunc"); err != nil {
+			return fmt.Errorf("Cannot wipe device: %s, Error: %w", d.path, err)
+		}
+	}
+	return nil
+}